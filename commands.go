@@ -0,0 +1,686 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/iigor000/database/fun"
+	"github.com/iigor000/database/shell"
+)
+
+// registerCommands registruje sve komande baze u shell
+// Svaka komanda prima argumente u jednoj liniji, npr. put key "value with spaces"
+func registerCommands(sh *shell.Shell, db *fun.Database) {
+	sh.Register(&shell.Command{
+		Name:        "put",
+		Args:        "<key> <value>",
+		Description: "Add Entry to Database",
+		MinArgs:     2,
+		MaxArgs:     2,
+		KeyArgs:     []int{1},
+		Run: func(args []string) error {
+			if err := db.Put(args[0], []byte(args[1])); err != nil {
+				return err
+			}
+			fmt.Println("Data inserted successfully")
+			return nil
+		},
+	})
+	sh.Register(&shell.Command{
+		Name:        "get",
+		Args:        "<key>",
+		Description: "Get Entry from Database",
+		MinArgs:     1,
+		MaxArgs:     1,
+		KeyArgs:     []int{1},
+		Run: func(args []string) error {
+			value, found, err := db.Get(args[0])
+			if err != nil {
+				return fmt.Errorf("error retrieving data: %w", err)
+			}
+			if !found {
+				fmt.Println("Entry not found")
+			} else {
+				fmt.Println(string(value))
+			}
+			return nil
+		},
+	})
+	sh.Register(&shell.Command{
+		Name:        "delete",
+		Args:        "<key>",
+		Description: "Delete Entry from Database",
+		MinArgs:     1,
+		MaxArgs:     1,
+		KeyArgs:     []int{1},
+		Run: func(args []string) error {
+			if err := db.Delete(args[0]); err != nil {
+				return err
+			}
+			fmt.Println("Successfully deleted entry")
+			return nil
+		},
+	})
+
+	sh.Register(&shell.Command{
+		Name:        "addbl",
+		Args:        "<name> <expected_elements> <false_positive_rate>",
+		Description: "Add BloomFilter",
+		MinArgs:     3,
+		MaxArgs:     3,
+		Run: func(args []string) error {
+			expectedElements, err := strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid number: %w", err)
+			}
+			falsePositiveProbability, err := strconv.ParseFloat(args[2], 64)
+			if err != nil {
+				return fmt.Errorf("invalid number: %w", err)
+			}
+			if err := db.NewBloomFilter(args[0], expectedElements, falsePositiveProbability); err != nil {
+				return fmt.Errorf("error creating BloomFilter: %w", err)
+			}
+			fmt.Println("BloomFilter created successfully")
+			return nil
+		},
+	})
+	sh.Register(&shell.Command{
+		Name:        "delbl",
+		Args:        "<name>",
+		Description: "Delete BloomFilter",
+		MinArgs:     1,
+		MaxArgs:     1,
+		Run: func(args []string) error {
+			if err := db.DeleteBloomFilter(args[0]); err != nil {
+				return fmt.Errorf("error deleting BloomFilter: %w", err)
+			}
+			fmt.Println("BloomFilter deleted successfully")
+			return nil
+		},
+	})
+	sh.Register(&shell.Command{
+		Name:        "addtobl",
+		Args:        "<name> <value>",
+		Description: "Add key to BloomFilter",
+		MinArgs:     2,
+		MaxArgs:     2,
+		Run: func(args []string) error {
+			if err := db.AddToBloomFilter(args[0], []byte(args[1])); err != nil {
+				return fmt.Errorf("error adding to BloomFilter: %w", err)
+			}
+			fmt.Println("Value added to BloomFilter successfully")
+			return nil
+		},
+	})
+	sh.Register(&shell.Command{
+		Name:        "getbl",
+		Args:        "<name> <value>",
+		Description: "Check key in BloomFilter",
+		MinArgs:     2,
+		MaxArgs:     2,
+		Run: func(args []string) error {
+			found, err := db.CheckInBloomFilter(args[0], []byte(args[1]))
+			if err != nil {
+				return fmt.Errorf("error checking BloomFilter: %w", err)
+			}
+			if found {
+				fmt.Println("Value is likely in the BloomFilter")
+			} else {
+				fmt.Println("Value is definitely not in the BloomFilter")
+			}
+			return nil
+		},
+	})
+
+	sh.Register(&shell.Command{
+		Name:        "addcms",
+		Args:        "<name> <error_rate> <confidence>",
+		Description: "Add CountMinSketch",
+		MinArgs:     3,
+		MaxArgs:     3,
+		Run: func(args []string) error {
+			errorRate, err := strconv.ParseFloat(args[1], 64)
+			if err != nil {
+				return fmt.Errorf("invalid error rate: %w", err)
+			}
+			confidenceLevel, err := strconv.ParseFloat(args[2], 64)
+			if err != nil {
+				return fmt.Errorf("invalid confidence level: %w", err)
+			}
+			if err := db.CreateCMS(args[0], errorRate, confidenceLevel); err != nil {
+				return fmt.Errorf("error creating CountMinSketch: %w", err)
+			}
+			fmt.Println("CountMinSketch created successfully")
+			return nil
+		},
+	})
+	sh.Register(&shell.Command{
+		Name:        "delcms",
+		Args:        "<name>",
+		Description: "Delete CountMinSketch",
+		MinArgs:     1,
+		MaxArgs:     1,
+		Run: func(args []string) error {
+			if err := db.DeleteCMS(args[0]); err != nil {
+				return fmt.Errorf("error deleting CountMinSketch: %w", err)
+			}
+			fmt.Println("CountMinSketch deleted successfully")
+			return nil
+		},
+	})
+	sh.Register(&shell.Command{
+		Name:        "addtocms",
+		Args:        "<name> <value>",
+		Description: "Add key to CountMinSketch",
+		MinArgs:     2,
+		MaxArgs:     2,
+		Run: func(args []string) error {
+			if err := db.AddToCMS(args[0], []byte(args[1])); err != nil {
+				return fmt.Errorf("error adding to CountMinSketch: %w", err)
+			}
+			fmt.Println("Value added to CountMinSketch successfully")
+			return nil
+		},
+	})
+	sh.Register(&shell.Command{
+		Name:        "getcms",
+		Args:        "<name> <value>",
+		Description: "Check key in CountMinSketch",
+		MinArgs:     2,
+		MaxArgs:     2,
+		Run: func(args []string) error {
+			count, err := db.CheckInCMS(args[0], []byte(args[1]))
+			if err != nil {
+				return fmt.Errorf("error checking CountMinSketch: %w", err)
+			}
+			fmt.Printf("Count for '%s' in CountMinSketch '%s': %d\n", args[1], args[0], count)
+			return nil
+		},
+	})
+
+	sh.Register(&shell.Command{
+		Name:        "addhll",
+		Args:        "<name> <precision>",
+		Description: "Add HyperLogLog (precision between 4 and 16)",
+		MinArgs:     2,
+		MaxArgs:     2,
+		Run: func(args []string) error {
+			precision, err := strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid precision: %w", err)
+			}
+			if err := db.CreateHLL(args[0], precision); err != nil {
+				return fmt.Errorf("error creating HyperLogLog: %w", err)
+			}
+			fmt.Println("HyperLogLog created successfully")
+			return nil
+		},
+	})
+	sh.Register(&shell.Command{
+		Name:        "delhll",
+		Args:        "<name>",
+		Description: "Delete HyperLogLog",
+		MinArgs:     1,
+		MaxArgs:     1,
+		Run: func(args []string) error {
+			if err := db.DeleteHLL(args[0]); err != nil {
+				return fmt.Errorf("error deleting HyperLogLog: %w", err)
+			}
+			fmt.Println("HyperLogLog deleted successfully")
+			return nil
+		},
+	})
+	sh.Register(&shell.Command{
+		Name:        "addtohll",
+		Args:        "<name> <value>",
+		Description: "Add key to HyperLogLog",
+		MinArgs:     2,
+		MaxArgs:     2,
+		Run: func(args []string) error {
+			if err := db.AddToHLL(args[0], []byte(args[1])); err != nil {
+				return fmt.Errorf("error adding to HyperLogLog: %w", err)
+			}
+			fmt.Println("Value added to HyperLogLog successfully")
+			return nil
+		},
+	})
+	sh.Register(&shell.Command{
+		Name:        "gethll",
+		Args:        "<name>",
+		Description: "Estimate HyperLogLog",
+		MinArgs:     1,
+		MaxArgs:     1,
+		Run: func(args []string) error {
+			count, err := db.EstimateHLL(args[0])
+			if err != nil {
+				return fmt.Errorf("error estimating HyperLogLog: %w", err)
+			}
+			fmt.Printf("Estimated count for HyperLogLog '%s': %f\n", args[0], count)
+			return nil
+		},
+	})
+
+	sh.Register(&shell.Command{
+		Name:        "addfp",
+		Args:        "<name> <text>",
+		Description: "Add Fingerprint of text",
+		MinArgs:     2,
+		MaxArgs:     2,
+		Run: func(args []string) error {
+			if err := db.AddSHFingerprint(args[0], args[1]); err != nil {
+				return fmt.Errorf("error adding fingerprint: %w", err)
+			}
+			fmt.Println("Fingerprint added successfully")
+			return nil
+		},
+	})
+	sh.Register(&shell.Command{
+		Name:        "delfp",
+		Args:        "<name>",
+		Description: "Delete fingerprint",
+		MinArgs:     1,
+		MaxArgs:     1,
+		Run: func(args []string) error {
+			if err := db.DeleteSHFingerprint(args[0]); err != nil {
+				return fmt.Errorf("error deleting fingerprint: %w", err)
+			}
+			fmt.Println("Fingerprint deleted successfully")
+			return nil
+		},
+	})
+	sh.Register(&shell.Command{
+		Name:        "getdist",
+		Args:        "<name1> <name2>",
+		Description: "Hamming distance between two fingerprints",
+		MinArgs:     2,
+		MaxArgs:     2,
+		Run: func(args []string) error {
+			distance, err := db.GetHemmingDistance(args[0], args[1])
+			if err != nil {
+				return fmt.Errorf("error getting Hamming distance: %w", err)
+			}
+			fmt.Printf("Hamming distance between '%s' and '%s': %d\n", args[0], args[1], distance)
+			return nil
+		},
+	})
+
+	sh.Register(&shell.Command{
+		Name:        "validate",
+		Args:        "<generation> <level>",
+		Description: "Validate Merkle Tree",
+		MinArgs:     2,
+		MaxArgs:     2,
+		Run: func(args []string) error {
+			generation, err := strconv.Atoi(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid generation: %w", err)
+			}
+			level, err := strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid level: %w", err)
+			}
+			if err := db.ValidateMerkleTree(generation, level); err != nil {
+				return fmt.Errorf("error validating Merkle Tree: %w", err)
+			}
+			fmt.Println("Merkle Tree validated successfully")
+			return nil
+		},
+	})
+	sh.Register(&shell.Command{
+		Name:        "prefix_scan",
+		Args:        "<prefix> [page] [page_size] [s|m]",
+		Description: "Prefix Scan (s - sstables, m - memtables)",
+		MinArgs:     1,
+		MaxArgs:     4,
+		KeyArgs:     []int{1},
+		Run: func(args []string) error {
+			pageNumber, pageSize, memtables, err := parsePaging(args[1:])
+			if err != nil {
+				return err
+			}
+			results := db.PrefixScan(args[0], pageNumber, pageSize, memtables)
+			if len(results) == 0 {
+				fmt.Println("No results found for prefix scan")
+				return nil
+			}
+			fmt.Printf("Results for prefix '%s' on page %d:\n", args[0], pageNumber)
+			for _, entry := range results {
+				fmt.Printf(" - %s: %s (Timestamp: %d)\n", entry.Key, entry.Value, entry.Timestamp)
+			}
+			return nil
+		},
+	})
+	sh.Register(&shell.Command{
+		Name:        "range_scan",
+		Args:        "<start> <end> [page] [page_size] [s|m]",
+		Description: "Range Scan (s - sstables, m - memtables)",
+		MinArgs:     2,
+		MaxArgs:     5,
+		KeyArgs:     []int{1, 2},
+		Run: func(args []string) error {
+			pageNumber, pageSize, memtables, err := parsePaging(args[2:])
+			if err != nil {
+				return err
+			}
+			results := db.RangeScan(args[0], args[1], pageNumber, pageSize, memtables)
+			if len(results) == 0 {
+				fmt.Println("No results found for range scan")
+				return nil
+			}
+			fmt.Printf("Results for range '%s' to '%s' on page %d:\n", args[0], args[1], pageNumber)
+			for _, entry := range results {
+				fmt.Printf(" - %s: %s (Timestamp: %d)\n", entry.Key, entry.Value, entry.Timestamp)
+			}
+			return nil
+		},
+	})
+
+	sh.Register(&shell.Command{
+		Name:        "flush",
+		Description: "Flush all memtables to SSTables",
+		Run: func(args []string) error {
+			if err := db.Flush(); err != nil {
+				return err
+			}
+			fmt.Println("Memtables flushed")
+			return nil
+		},
+	})
+	sh.Register(&shell.Command{
+		Name:        "compact",
+		Args:        "[start] [end]",
+		Description: "Compact SSTables overlapping the key range (whole database if omitted)",
+		MaxArgs:     2,
+		KeyArgs:     []int{1, 2},
+		Run: func(args []string) error {
+			start, end := "", ""
+			if len(args) > 0 {
+				start = args[0]
+			}
+			if len(args) > 1 {
+				end = args[1]
+			}
+			if err := db.CompactRange(start, end); err != nil {
+				return err
+			}
+			fmt.Println("Compaction finished")
+			return nil
+		},
+	})
+	sh.Register(&shell.Command{
+		Name:        "size",
+		Args:        "[start] [end]",
+		Description: "Estimate disk space taken by the key range in SSTables (whole database if omitted)",
+		MaxArgs:     2,
+		KeyArgs:     []int{1, 2},
+		Run: func(args []string) error {
+			start, end := "", ""
+			if len(args) > 0 {
+				start = args[0]
+			}
+			if len(args) > 1 {
+				end = args[1]
+			}
+			size, err := db.ApproximateSize(start, end)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Approximately %d bytes\n", size)
+			return nil
+		},
+	})
+	sh.Register(&shell.Command{
+		Name:        "blobgc",
+		Description: "Reclaim space in blob files taken by overwritten and deleted values",
+		Run: func(args []string) error {
+			stats, err := db.CollectBlobGarbage()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Blob GC: %d files checked, %d removed, %d values rewritten, %d bytes reclaimed\n",
+				stats.Files, stats.Removed, stats.Rewritten, stats.Reclaimed)
+			return nil
+		},
+	})
+	sh.Register(&shell.Command{
+		Name:        "stats",
+		Description: "Print database statistics",
+		Run: func(args []string) error {
+			stats, err := db.Stats()
+			if err != nil {
+				return err
+			}
+			printStats(stats)
+			return nil
+		},
+	})
+	sh.Register(&shell.Command{
+		Name:        "levels",
+		Description: "List SSTables per level with their key ranges",
+		Run: func(args []string) error {
+			stats, err := db.Stats()
+			if err != nil {
+				return err
+			}
+			printLevels(stats)
+			return nil
+		},
+	})
+
+	sh.Register(&shell.Command{
+		Name:        "sstdump",
+		Args:        "<level> <gen> | <path> [--verify]",
+		Description: "Dump SSTable contents, --verify only checks record CRCs",
+		MinArgs:     1,
+		MaxArgs:     3,
+		Run: func(args []string) error {
+			verify := false
+			var rest []string
+			for _, arg := range args {
+				if arg == "--verify" {
+					verify = true
+				} else {
+					rest = append(rest, arg)
+				}
+			}
+			var path string
+			switch len(rest) {
+			case 1:
+				path = rest[0]
+			case 2:
+				level, err := strconv.Atoi(rest[0])
+				if err != nil {
+					return fmt.Errorf("invalid level: %w", err)
+				}
+				gen, err := strconv.Atoi(rest[1])
+				if err != nil {
+					return fmt.Errorf("invalid generation: %w", err)
+				}
+				path = db.SSTableDir(level, gen)
+			default:
+				return fmt.Errorf("usage: sstdump <level> <gen> | <path> [--verify]")
+			}
+
+			if !verify {
+				return db.DumpSSTable(os.Stdout, path)
+			}
+			checked, err := db.VerifySSTable(path)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%d records verified, all CRCs match\n", checked)
+			return nil
+		},
+	})
+
+	sh.Register(&shell.Command{
+		Name:        "export",
+		Args:        "<file> [jsonl|csv]",
+		Description: "Export all live keys to a file (format from extension if omitted)",
+		MinArgs:     1,
+		MaxArgs:     2,
+		Run: func(args []string) error {
+			format := formatArg(args[0], args[1:])
+			f, err := os.Create(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", args[0], err)
+			}
+			defer f.Close()
+			count, err := db.Export(f, format)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Exported %d keys to %s\n", count, args[0])
+			return nil
+		},
+	})
+	sh.Register(&shell.Command{
+		Name:        "import",
+		Args:        "<file> [jsonl|csv] [--bypass]",
+		Description: "Import keys from a file, --bypass skips the token bucket (root only)",
+		MinArgs:     1,
+		MaxArgs:     3,
+		Run: func(args []string) error {
+			opts := fun.ImportOptions{
+				Progress: func(imported int) {
+					fmt.Printf("\rImported %d keys", imported)
+				},
+			}
+			var rest []string
+			for _, arg := range args {
+				if arg == "--bypass" {
+					opts.BypassTokenBucket = true
+				} else {
+					rest = append(rest, arg)
+				}
+			}
+			if len(rest) == 0 || len(rest) > 2 {
+				return fmt.Errorf("usage: import <file> [jsonl|csv] [--bypass]")
+			}
+			f, err := os.Open(rest[0])
+			if err != nil {
+				return fmt.Errorf("failed to open %s: %w", rest[0], err)
+			}
+			defer f.Close()
+			count, err := db.Import(f, formatArg(rest[0], rest[1:]), opts)
+			if count > 0 {
+				fmt.Println()
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Imported %d keys from %s\n", count, rest[0])
+			return nil
+		},
+	})
+
+	sh.Register(&shell.Command{
+		Name:        "backup",
+		Args:        "<dir> [--incremental <previous>]",
+		Description: "Back up the database, --incremental copies only SSTables missing from a previous backup",
+		MinArgs:     1,
+		MaxArgs:     3,
+		Run: func(args []string) error {
+			var manifest *fun.BackupManifest
+			var err error
+			switch {
+			case len(args) == 1:
+				manifest, err = db.Backup(args[0])
+			case len(args) == 3 && args[1] == "--incremental":
+				manifest, err = db.BackupIncremental(args[0], args[2])
+			default:
+				return fmt.Errorf("usage: backup <dir> [--incremental <previous>]")
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Backup written to %s: %d files, %d copied\n", args[0], len(manifest.Files), manifest.Copied())
+			return nil
+		},
+	})
+
+	sh.Register(&shell.Command{
+		Name:        "exit",
+		Description: "Exit",
+		Run: func(args []string) error {
+			fmt.Println("Goodbye!")
+			sh.Stop()
+			return nil
+		},
+	})
+}
+
+// formatArg vraca format za export i import: zadati argument ili, ako ga nema, format po ekstenziji fajla
+func formatArg(path string, args []string) string {
+	if len(args) > 0 {
+		return strings.ToLower(args[0])
+	}
+	if strings.HasSuffix(strings.ToLower(path), ".csv") {
+		return fun.FormatCSV
+	}
+	return fun.FormatJSONL
+}
+
+// parsePaging cita opcione argumente [page] [page_size] [s|m] za skeniranje
+// Podrazumevano je prva stranica, 10 zapisa po stranici i pretraga Memtable-a
+// Vraca true ako se pretrazuju Memtable-ovi
+func parsePaging(args []string) (int, int, bool, error) {
+	pageNumber, pageSize, source := 1, 10, "m"
+	var err error
+	if len(args) > 0 {
+		if pageNumber, err = strconv.Atoi(args[0]); err != nil {
+			return 0, 0, false, fmt.Errorf("invalid page number: %w", err)
+		}
+	}
+	if len(args) > 1 {
+		if pageSize, err = strconv.Atoi(args[1]); err != nil {
+			return 0, 0, false, fmt.Errorf("invalid page size: %w", err)
+		}
+	}
+	if len(args) > 2 {
+		source = args[2]
+	}
+	if source != "s" && source != "m" {
+		return 0, 0, false, fmt.Errorf("invalid option, use 's' for sstables or 'm' for memtables")
+	}
+	return pageNumber, pageSize, source == "m", nil
+}
+
+func printStats(stats *fun.Stats) {
+	fmt.Println("Memtables:")
+	for _, m := range stats.Memtables {
+		fmt.Printf("  #%d: %d/%d entries\n", m.Index, m.Size, m.Capacity)
+	}
+	fmt.Println("Levels:")
+	if len(stats.Levels) == 0 {
+		fmt.Println("  no SSTables")
+	}
+	for _, level := range stats.Levels {
+		fmt.Printf("  L%d: %d tables, %d bytes, %d entries (%d tombstones), %d data bytes, %d raw bytes\n",
+			level.Level, len(level.Tables), level.Size, level.Entries, level.Tombstones, level.DataSize, level.RawSize)
+	}
+	fmt.Printf("WAL segments: %d\n", stats.WalSegments)
+	fmt.Printf("Cache: %d entries, %d hits, %d misses, hit rate %.1f%%\n",
+		stats.Cache.Size, stats.Cache.Hits, stats.Cache.Misses, stats.Cache.HitRate()*100)
+	fmt.Printf("Block cache: %d blocks, %d hits, %d misses, hit rate %.1f%%\n",
+		stats.BlockCache.Size, stats.BlockCache.Hits, stats.BlockCache.Misses, stats.BlockCache.HitRate()*100)
+	fmt.Printf("Table cache: %d tables, %d hits, %d misses, hit rate %.1f%%\n",
+		stats.TableCache.Size, stats.TableCache.Hits, stats.TableCache.Misses, stats.TableCache.HitRate()*100)
+	fmt.Printf("Compression dictionary: %d keys, %d bytes\n", stats.DictionaryKeys, stats.DictionaryBytes)
+	fmt.Printf("Blob files: %d, %d bytes\n", stats.BlobFiles, stats.BlobBytes)
+}
+
+func printLevels(stats *fun.Stats) {
+	if len(stats.Levels) == 0 {
+		fmt.Println("No SSTables")
+		return
+	}
+	for _, level := range stats.Levels {
+		fmt.Printf("Level %d (%d bytes):\n", level.Level, level.Size)
+		for _, table := range level.Tables {
+			fmt.Printf("  gen %d: %d bytes, %d entries, keys %s .. %s\n", table.Gen, table.Size, table.Entries, shell.Quote(string(table.MinKey)), shell.Quote(string(table.MaxKey)))
+		}
+	}
+}
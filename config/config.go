@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"os"
 )
 
@@ -19,6 +20,9 @@ type Config struct {
 	LSMTree     LSMTreeConfig     `json:"lsmtree"`      // Konfiguracija LSM stabla
 	TokenBucket TokenBucketConfig `json:"token_bucket"` // Konfiguracija token bucket-a
 	Compression CompressionConfig `json:"compression"`  // Konfiguracija kompresije
+	Shell       ShellConfig       `json:"shell"`        // Konfiguracija interaktivnog shell-a
+	Limits      LimitsConfig      `json:"limits"`       // Ogranicenja velicine kljuceva i vrednosti
+	Blob        BlobConfig        `json:"blob"`         // Izdvajanje velikih vrednosti u blob fajlove
 }
 
 type BlockConfig struct {
@@ -28,8 +32,25 @@ type BlockConfig struct {
 type WalConfig struct {
 	WalSegmentSize int    `json:"wal_segment_size"` // Velicina segmenta u WAL-u
 	WalDirectory   string `json:"wal_directory"`    // Direktorijum u kome se cuvaju WAL segmenti
+	SyncMode       string `json:"sync_mode"`        // Kada se WAL sinhronizuje na disk: "always", "interval" ili "none"
+	SyncIntervalMs int    `json:"sync_interval_ms"` // Period sinhronizacije u milisekundama za "interval"
+	RecoveryMode   string `json:"recovery_mode"`    // Sta raditi sa ostecenim zapisima pri oporavku: "strict", "tail" ili "skip"
 }
 
+// Nacini sinhronizacije WAL-a
+const (
+	SyncAlways   = "always"   // Upis se vraca tek kad je zapis na disku, istovremeni upisi dele jedan fsync
+	SyncInterval = "interval" // Zapisi se sinhronizuju periodicno, moze se izgubiti poslednjih SyncIntervalMs
+	SyncNone     = "none"     // Nema fsync-a, sinhronizaciju radi operativni sistem
+)
+
+// Nacini oporavka WAL-a
+const (
+	RecoveryStrict = "strict" // Svako ostecenje je greska i baza se ne otvara
+	RecoveryTail   = "tail"   // Ostecen kraj poslednjeg segmenta (prekinut upis) se odbacuje i segment se skracuje
+	RecoverySkip   = "skip"   // Osteceni zapisi se preskacu bilo gde u WAL-u
+)
+
 type MemtableConfig struct {
 	NumberOfMemtables int    `json:"num"`         // Velicina memtable-a u bajtovima
 	NumberOfEntries   int    `json:"num_entries"` // Broj unosa u memtable-u
@@ -42,13 +63,91 @@ type SkiplistConfig struct {
 
 type SSTableConfig struct {
 	UseCompression   bool   `json:"use_compression"` // Kompresija SSTable-a true ili false
-	SummaryLevel     int    `json:"summary_level"`   // Velicina filter bloka u bajtovima
+	SummaryLevel     int    `json:"summary_level"`   // Najveci broj zapisa u Index bloku (jedan zapis Summary-ja pokriva jedan Index blok)
 	SstableDirectory string `json:"directory"`       // Direktorijum u kome se cuvaju SSTable-ovi
 	SingleFile       bool   `json:"single_file"`     // Da li se SSTable cuva u jednom fajlu ili u vise
+	// Broj zapisa izmedju dve restart tacke u Data i Index bloku (manje - brza pretraga bloka, vise - bolja kompresija kljuceva)
+	RestartInterval int `json:"restart_interval"`
+	// Podesavanja po nivou LSM stabla: prvi element je za prvi nivo, a poslednji vazi i za sve dublje nivoe
+	// Kodek kompresije Data blokova ("none", "flate", "zlib" ili "lz")
+	BlockCompression []string `json:"block_compression"`
+	// Broj bitova po kljucu u Bloom filteru, gde je 0 (ili nije zadat) racuna se iz FalsePositiveRate
+	BitsPerKey []float64 `json:"bits_per_key"`
+	// Zeljena verovatnoca laznog pogotka Bloom filtera
+	FalsePositiveRate []float64 `json:"false_positive_rate"`
+	// Vrsta Bloom filtera: "standard" ili "blocked" (bitovi kljuca u jednoj cache line, brza provera, malo vise laznih pogodaka)
+	BloomFilter string `json:"bloom_filter"`
+	// Izdvajanje prefiksa kljuca za prefiksni Bloom filter, po kom PrefixScan preskace SSTable-ove bez tog prefiksa
+	// "none" - bez prefiksnog filtera, "fixed" - prvih PrefixLength bajtova, "delimiter" - sve do prvog PrefixDelimiter (ukljucujuci njega)
+	PrefixExtractor string `json:"prefix_extractor"`
+	PrefixLength    int    `json:"prefix_length"`
+	PrefixDelimiter string `json:"prefix_delimiter"`
+}
+
+// Vrste Bloom filtera SSTable-a
+const (
+	BloomStandard = "standard"
+	BloomBlocked  = "blocked"
+)
+
+// Nacini izdvajanja prefiksa kljuca
+const (
+	ExtractorNone      = "none"
+	ExtractorFixed     = "fixed"
+	ExtractorDelimiter = "delimiter"
+)
+
+// Verovatnoca laznog pogotka Bloom filtera ako za nivo nije zadato nista
+const defaultFalsePositiveRate = 0.01
+
+// Kodeci kompresije Data blokova
+const (
+	CodecNone  = "none"  // Bez kompresije
+	CodecFlate = "flate" // DEFLATE, dobra kompresija
+	CodecZlib  = "zlib"  // DEFLATE sa zlib zaglavljem i kontrolnom sumom
+	CodecLZ    = "lz"    // Brz LZ77, slabija kompresija
+)
+
+// levelValue vraca podesavanje za nivo level (nivoi pocinju od 1), a ako ga nema poslednje zadato
+func levelValue[T any](values []T, level int) (T, bool) {
+	var zero T
+	if len(values) == 0 {
+		return zero, false
+	}
+	i := level - 1
+	if i >= len(values) {
+		i = len(values) - 1
+	}
+	if i < 0 {
+		i = 0
+	}
+	return values[i], true
+}
+
+// BlockCodec vraca ime kodeka za Data blokove SSTable-ova na nivou level
+func (c *SSTableConfig) BlockCodec(level int) string {
+	if codec, ok := levelValue(c.BlockCompression, level); ok {
+		return codec
+	}
+	return CodecNone
+}
+
+// BloomBitsPerKey vraca broj bitova po kljucu u Bloom filteru SSTable-ova na nivou level
+func (c *SSTableConfig) BloomBitsPerKey(level int) float64 {
+	if bits, ok := levelValue(c.BitsPerKey, level); ok && bits > 0 {
+		return bits
+	}
+	rate, ok := levelValue(c.FalsePositiveRate, level)
+	if !ok || rate <= 0 || rate >= 1 {
+		rate = defaultFalsePositiveRate
+	}
+	return -math.Log(rate) / (math.Ln2 * math.Ln2)
 }
 
 type CacheConfig struct {
 	Capacity int `json:"capacity"` // Kapacitet kes memorije
+	// Broj otvorenih SSTable-ova (Bloom filter, Summary) koji se drze u memoriji (0 - bez kesa)
+	TableCapacity int `json:"table_capacity"`
 }
 
 type TokenBucketConfig struct {
@@ -64,6 +163,10 @@ type LSMTreeConfig struct {
 	BaseSSTableLimit    int `json:"base_sstable_limit"`    // Bazni limit SSTable-a
 	// Size_Tiered kompakcija - Kada se na nivou dostigne granicu od N SSTable-ova, vrši se kompakcija
 	MaxTablesPerLevel int `json:"max_tables_per_level"` // Maksimalan broj SSTable-ova po nivou
+	// Kompakcija prelazi na novi SSTable kad Data deo dostigne ovu velicinu u bajtovima (0 - bez ogranicenja)
+	TargetSSTableSize int `json:"target_sstable_size"`
+	// SSTable u kome je bar ovaj deo zapisa tombstone se kompaktuje nanize, da bi se tombstone-ovi uklonili (0 - iskljuceno)
+	TombstoneCompactionRatio float64 `json:"tombstone_compaction_ratio"`
 }
 
 type BTreeConfig struct {
@@ -74,6 +177,24 @@ type CompressionConfig struct {
 	DictionaryDir string `json:"dictionary_dir"` // Direktorijum u kome se cuva recnik za kompresiju
 }
 
+type ShellConfig struct {
+	HistoryFile string `json:"history_file"` // Fajl u kome se cuva istorija komandi
+	HistorySize int    `json:"history_size"` // Maksimalan broj komandi u istoriji
+}
+
+type LimitsConfig struct {
+	MaxKeySize   int `json:"max_key_size"`   // Najveca velicina kljuca u bajtovima (0 - bez ogranicenja)
+	MaxValueSize int `json:"max_value_size"` // Najveca velicina vrednosti u bajtovima (0 - bez ogranicenja)
+}
+
+type BlobConfig struct {
+	// Vrednosti od ovoliko bajtova i vece se pri upisu SSTable-a izdvajaju u blob fajl, a SSTable cuva samo pokazivac (0 - iskljuceno)
+	ValueThreshold int    `json:"value_threshold"`
+	Directory      string `json:"directory"` // Direktorijum u kome se cuvaju blob fajlovi
+	// GC prepisuje zive vrednosti blob fajla i brise ga kad je bar ovaj deo njegovih bajtova zastareo
+	GCRatio float64 `json:"gc_ratio"`
+}
+
 func LoadConfigFile(path string) (*Config, error) {
 	defaultConfig := &Config{
 		Block: BlockConfig{
@@ -82,6 +203,9 @@ func LoadConfigFile(path string) (*Config, error) {
 		Wal: WalConfig{
 			WalSegmentSize: 100,
 			WalDirectory:   "data",
+			SyncMode:       SyncAlways,
+			SyncIntervalMs: 100,
+			RecoveryMode:   RecoveryTail,
 		},
 		Memtable: MemtableConfig{
 			NumberOfMemtables: 10,
@@ -99,9 +223,20 @@ func LoadConfigFile(path string) (*Config, error) {
 			SummaryLevel:     10,
 			SstableDirectory: "data/sstable",
 			SingleFile:       false,
+			RestartInterval:  16,
+			// Prvi nivo se cesto kompaktuje pa ga ne kompresujemo, dublji nivoi koriste brz LZ
+			BlockCompression: []string{CodecNone, CodecLZ},
+			// Dublji nivoi imaju vise kljuceva, pa isti broj bitova po kljucu zauzima vise memorije
+			FalsePositiveRate: []float64{0.01, 0.01, 0.02},
+			BloomFilter:       BloomBlocked,
+			// Kljucevi oblika "tenant:..." i "user:..."
+			PrefixExtractor: ExtractorDelimiter,
+			PrefixDelimiter: ":",
 		},
 		Cache: CacheConfig{
 			Capacity: 100,
+			// Kes otvorenih SSTable-ova
+			TableCapacity: 64,
 		},
 		LSMTree: LSMTreeConfig{
 			MaxLevel:            5,
@@ -111,6 +246,9 @@ func LoadConfigFile(path string) (*Config, error) {
 			LevelSizeMultiplier: 10,    // Multiplikator velicine nivoa (granica za prvi nivo je BaseSSTableLimit pomnožena sa 10, kod drugog sa 100, itd.)
 			// "size_tiered" KOMPAKCIJA
 			MaxTablesPerLevel: 8, // Maksimalan broj SSTable-ova po nivou
+			// Izlaz kompakcije i uklanjanje tombstone-ova
+			TargetSSTableSize:        4 * 1024 * 1024,
+			TombstoneCompactionRatio: 0.5,
 		},
 		TokenBucket: TokenBucketConfig{
 			StartTokens:     1000, // Broj tokena na pocetku
@@ -119,6 +257,19 @@ func LoadConfigFile(path string) (*Config, error) {
 		Compression: CompressionConfig{
 			DictionaryDir: "data/compression_dict",
 		},
+		Shell: ShellConfig{
+			HistoryFile: "data/history.txt",
+			HistorySize: 500,
+		},
+		Limits: LimitsConfig{
+			MaxKeySize:   64 * 1024,
+			MaxValueSize: 64 * 1024 * 1024,
+		},
+		Blob: BlobConfig{
+			ValueThreshold: 4096,
+			Directory:      "data/blob",
+			GCRatio:        0.5,
+		},
 	}
 	file, err := os.Open(path)
 	if err != nil {
@@ -136,11 +287,95 @@ func LoadConfigFile(path string) (*Config, error) {
 		return nil, errors.New("invalid block size - it must be value of 4096, 8192 or 16384")
 	}
 
+	switch defaultConfig.Wal.SyncMode {
+	case SyncAlways, SyncNone:
+	case SyncInterval:
+		if defaultConfig.Wal.SyncIntervalMs <= 0 {
+			return nil, errors.New("invalid wal sync interval - it must be greater than 0")
+		}
+	default:
+		return nil, errors.New("invalid wal sync mode - it must be 'always', 'interval' or 'none'")
+	}
+
+	switch defaultConfig.Wal.RecoveryMode {
+	case RecoveryStrict, RecoveryTail, RecoverySkip:
+	default:
+		return nil, errors.New("invalid wal recovery mode - it must be 'strict', 'tail' or 'skip'")
+	}
+
 	switch defaultConfig.LSMTree.CompactionAlgorithm {
 	case "size_tiered", "leveled":
 	default:
 		return nil, errors.New("invalid compaction algorithm - it must be 'size_tiered' or 'leveled'")
 	}
 
+	if defaultConfig.SSTable.RestartInterval < 1 {
+		return nil, errors.New("invalid sstable restart interval - it must be greater than 0")
+	}
+
+	if defaultConfig.Limits.MaxKeySize < 0 || defaultConfig.Limits.MaxValueSize < 0 {
+		return nil, errors.New("invalid key or value size limit - it must not be negative")
+	}
+
+	for _, codec := range defaultConfig.SSTable.BlockCompression {
+		switch codec {
+		case CodecNone, CodecFlate, CodecZlib, CodecLZ:
+		default:
+			return nil, fmt.Errorf("invalid block compression codec %q - it must be 'none', 'flate', 'zlib' or 'lz'", codec)
+		}
+	}
+
+	if defaultConfig.Blob.ValueThreshold < 0 {
+		return nil, errors.New("invalid blob value threshold - it must not be negative")
+	}
+
+	if defaultConfig.Blob.GCRatio <= 0 || defaultConfig.Blob.GCRatio > 1 {
+		return nil, errors.New("invalid blob gc ratio - it must be greater than 0 and at most 1")
+	}
+
+	for _, bits := range defaultConfig.SSTable.BitsPerKey {
+		if bits < 0 || bits > 100 {
+			return nil, errors.New("invalid bloom filter bits per key - it must be between 0 and 100")
+		}
+	}
+
+	for _, rate := range defaultConfig.SSTable.FalsePositiveRate {
+		if rate <= 0 || rate >= 1 {
+			return nil, errors.New("invalid bloom filter false positive rate - it must be between 0 and 1")
+		}
+	}
+
+	switch defaultConfig.SSTable.BloomFilter {
+	case BloomStandard, BloomBlocked:
+	default:
+		return nil, errors.New("invalid bloom filter type - it must be 'standard' or 'blocked'")
+	}
+
+	switch defaultConfig.SSTable.PrefixExtractor {
+	case "", ExtractorNone:
+	case ExtractorFixed:
+		if defaultConfig.SSTable.PrefixLength < 1 {
+			return nil, errors.New("invalid prefix length - it must be greater than 0 for the 'fixed' prefix extractor")
+		}
+	case ExtractorDelimiter:
+		if defaultConfig.SSTable.PrefixDelimiter == "" {
+			return nil, errors.New("invalid prefix delimiter - it must not be empty for the 'delimiter' prefix extractor")
+		}
+	default:
+		return nil, errors.New("invalid prefix extractor - it must be 'none', 'fixed' or 'delimiter'")
+	}
+
+	if defaultConfig.Cache.TableCapacity < 0 {
+		return nil, errors.New("invalid table cache capacity - it must not be negative")
+	}
+
+	if defaultConfig.LSMTree.TargetSSTableSize < 0 {
+		return nil, errors.New("invalid target sstable size - it must not be negative")
+	}
+
+	if defaultConfig.LSMTree.TombstoneCompactionRatio < 0 || defaultConfig.LSMTree.TombstoneCompactionRatio > 1 {
+		return nil, errors.New("invalid tombstone compaction ratio - it must be between 0 and 1")
+	}
+
 	return defaultConfig, nil
 }
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -124,3 +125,53 @@ func TestLoadConfigFile_InvalidJSON(t *testing.T) {
 		t.Fatalf("expected error for invalid JSON, got nil")
 	}
 }
+
+func TestLoadConfigFile_WalModes(t *testing.T) {
+	tmpDir := t.TempDir()
+	cases := []struct {
+		json    string
+		wantErr bool
+	}{
+		{`{"wal": {"sync_mode": "always"}}`, false},
+		{`{"wal": {"sync_mode": "none"}}`, false},
+		{`{"wal": {"sync_mode": "interval", "sync_interval_ms": 5}}`, false},
+		{`{"wal": {"sync_mode": "interval", "sync_interval_ms": 0}}`, true},
+		{`{"wal": {"sync_mode": "sometimes"}}`, true},
+		{`{"wal": {"recovery_mode": "skip"}}`, false},
+		{`{"wal": {"recovery_mode": "ignore"}}`, true},
+	}
+	for i, c := range cases {
+		path := filepath.Join(tmpDir, fmt.Sprintf("config%d.json", i))
+		if err := os.WriteFile(path, []byte(c.json), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+		_, err := LoadConfigFile(path)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s: expected error %v, got %v", c.json, c.wantErr, err)
+		}
+	}
+}
+
+func TestSSTableConfig_PerLevel(t *testing.T) {
+	c := SSTableConfig{
+		BlockCompression:  []string{CodecNone, CodecLZ},
+		BitsPerKey:        []float64{0, 12},
+		FalsePositiveRate: []float64{0.01},
+	}
+	if got := c.BlockCodec(1); got != CodecNone {
+		t.Errorf("BlockCodec(1) = %s, want %s", got, CodecNone)
+	}
+	if got := c.BlockCodec(4); got != CodecLZ {
+		t.Errorf("BlockCodec(4) = %s, want %s", got, CodecLZ)
+	}
+	// Na prvom nivou bits_per_key je 0, pa se racuna iz verovatnoce laznog pogotka
+	if got := c.BloomBitsPerKey(1); got < 9.5 || got > 9.6 {
+		t.Errorf("BloomBitsPerKey(1) = %f, want about 9.59", got)
+	}
+	if got := c.BloomBitsPerKey(3); got != 12 {
+		t.Errorf("BloomBitsPerKey(3) = %f, want 12", got)
+	}
+	if got := (&SSTableConfig{}).BloomBitsPerKey(1); got < 9.5 || got > 9.6 {
+		t.Errorf("default BloomBitsPerKey = %f, want about 9.59", got)
+	}
+}
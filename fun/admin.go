@@ -0,0 +1,178 @@
+package fun
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/iigor000/database/structures/blob"
+	"github.com/iigor000/database/structures/lsmtree"
+	"github.com/iigor000/database/structures/sstable"
+)
+
+// MemtableStats opisuje popunjenost jednog Memtable-a
+type MemtableStats struct {
+	Index    int
+	Size     int
+	Capacity int
+}
+
+// LevelStats opisuje jedan nivo LSM stabla
+type LevelStats struct {
+	Level  int
+	Size   int64 // Ukupna velicina svih SSTable-ova na nivou u bajtovima
+	Tables []lsmtree.TableInfo
+	// Zbirovi iz Properties SSTable-ova (SSTable-ovi bez Properties se ne racunaju)
+	Entries    int64
+	Tombstones int64
+	DataSize   int64 // Velicina Data delova na disku
+	RawSize    int64 // Kljucevi i vrednosti pre kodiranja i kompresije
+}
+
+// CacheStats opisuje pogotke i promasaje jednog kesa
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+	Size   int
+}
+
+// HitRate vraca udeo pogodaka u svim pristupima kesu (0 ako kesu jos nije pristupano)
+func (c CacheStats) HitRate() float64 {
+	total := c.Hits + c.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(c.Hits) / float64(total)
+}
+
+// Stats je presek stanja baze, vraca ga Database.Stats
+type Stats struct {
+	Memtables       []MemtableStats
+	Levels          []LevelStats
+	WalSegments     int
+	Cache           CacheStats // Kes zapisa (read path)
+	BlockCache      CacheStats // Kes blokova u CachedBlockManager-u
+	TableCache      CacheStats // Kes otvorenih SSTable-ova
+	DictionaryKeys  int        // Broj kljuceva u recniku za kompresiju
+	DictionaryBytes int        // Velicina serijalizovanog recnika
+	BlobFiles       int        // Broj blob fajlova sa izdvojenim vrednostima
+	BlobBytes       int64      // Ukupna velicina blob fajlova
+}
+
+// Flush upisuje na disk sve Memtable-ove koji nisu prazni
+// Posle flush-a svi Memtable-ovi su prazni, a WAL segmenti koje pokrivaju SSTable-ovi se brisu
+func (db *Database) Flush() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for i := 0; i < db.memtables.NumberOfMemtables; i++ {
+		if db.memtables.Memtables[0].Size == 0 {
+			break
+		}
+		if err := db.flushMemtable(); err != nil {
+			return fmt.Errorf("failed to flush memtable: %w", err)
+		}
+	}
+	return nil
+}
+
+// CompactRange kompaktuje sve SSTable-ove ciji se kljucevi preklapaju sa opsegom [start, end]
+// Prazan start ili end znaci da opseg nije ogranicen sa te strane
+func (db *Database) CompactRange(start, end string) error {
+	if start != "" && end != "" && start > end {
+		return fmt.Errorf("invalid range: start %q is after end %q", start, end)
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if err := lsmtree.CompactRange(db.versions, []byte(start), []byte(end), db.compression, db.CacheBlockManager); err != nil {
+		return fmt.Errorf("failed to compact range: %w", err)
+	}
+	// Kompakcija menja generacije na prvom nivou
+	db.memtables.GenToFlush = db.versions.NextGeneration(1)
+	return nil
+}
+
+// Stats vraca trenutno stanje baze: popunjenost Memtable-ova, SSTable-ove po nivoima,
+// broj WAL segmenata, pogotke keseva i velicinu recnika
+func (db *Database) Stats() (*Stats, error) {
+	stats := &Stats{}
+
+	db.mu.Lock()
+	for i := 0; i < db.memtables.NumberOfMemtables; i++ {
+		m := db.memtables.Memtables[i]
+		stats.Memtables = append(stats.Memtables, MemtableStats{Index: i, Size: m.Size, Capacity: m.Capacity})
+	}
+	if db.compression != nil {
+		stats.DictionaryKeys = db.compression.Len()
+		stats.DictionaryBytes = len(db.compression.Serialize())
+	}
+	db.mu.Unlock()
+
+	tables, err := lsmtree.Tables(db.versions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list SSTables: %w", err)
+	}
+	for _, table := range tables {
+		if len(stats.Levels) == 0 || stats.Levels[len(stats.Levels)-1].Level != table.Level {
+			stats.Levels = append(stats.Levels, LevelStats{Level: table.Level})
+		}
+		level := &stats.Levels[len(stats.Levels)-1]
+		level.Size += table.Size
+		level.Entries += table.Entries
+		level.Tombstones += table.Tombstones
+		level.DataSize += table.DataSize
+		level.RawSize += table.RawSize
+		level.Tables = append(level.Tables, table)
+	}
+
+	stats.WalSegments = db.wal.SegmentCount()
+
+	stats.Cache.Hits, stats.Cache.Misses, stats.Cache.Size = db.cache.Stats()
+	if db.CacheBlockManager != nil && db.CacheBlockManager.C != nil {
+		stats.BlockCache.Hits, stats.BlockCache.Misses, stats.BlockCache.Size = db.CacheBlockManager.C.Stats()
+	}
+	stats.TableCache.Hits, stats.TableCache.Misses, stats.TableCache.Size = db.versions.TableCacheStats()
+
+	blobs, err := blob.Files(db.config.Blob.Directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blob files: %w", err)
+	}
+	for _, id := range blobs {
+		info, err := os.Stat(blob.FileName(db.config.Blob.Directory, id))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read blob file: %w", err)
+		}
+		stats.BlobFiles++
+		stats.BlobBytes += info.Size()
+	}
+	return stats, nil
+}
+
+// ApproximateSize procenjuje koliko bajtova na disku zauzimaju kljucevi iz opsega [start, end] u SSTable-ovima
+// Prazan start ili end znaci da opseg nije ogranicen sa te strane
+// Zapisi iz Memtable-ova i vrednosti izdvojene u blob fajlove se ne racunaju
+func (db *Database) ApproximateSize(start, end string) (int64, error) {
+	if start != "" && end != "" && start > end {
+		return 0, fmt.Errorf("invalid range: start %q is after end %q", start, end)
+	}
+	size, err := lsmtree.ApproximateSize(db.versions, []byte(start), []byte(end), db.compression, db.CacheBlockManager)
+	if err != nil {
+		return 0, fmt.Errorf("failed to estimate size: %w", err)
+	}
+	return size, nil
+}
+
+// SSTableDir vraca direktorijum SSTable-a sa datim nivoom i generacijom
+func (db *Database) SSTableDir(level, gen int) string {
+	return fmt.Sprintf("%s/%d/%d", db.config.SSTable.SstableDirectory, level, gen)
+}
+
+// DumpSSTable ispisuje u w sadrzaj SSTable-a iz direktorijuma path (sa kljucevima dekodiranim iz recnika)
+func (db *Database) DumpSSTable(w io.Writer, path string) error {
+	return sstable.DumpSSTable(w, path, db.config, db.compression)
+}
+
+// VerifySSTable proverava CRC svih zapisa SSTable-a iz direktorijuma path
+// Vraca broj ispravnih zapisa, a za prvi osteceni zapis *sstable.CorruptionError
+func (db *Database) VerifySSTable(path string) (int, error) {
+	return sstable.VerifySSTable(path, db.config, db.compression)
+}
@@ -0,0 +1,414 @@
+package fun
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/iigor000/database/config"
+	"github.com/iigor000/database/structures/blob"
+	"github.com/iigor000/database/structures/lsmtree"
+	writeaheadlog "github.com/iigor000/database/structures/writeAheadLog"
+)
+
+// Ime fajla sa opisom backup-a, upisuje se poslednji pa backup bez njega nije zavrsen
+const backupManifestName = "backup.json"
+
+const backupManifestVersion = 1
+
+// Vrste fajlova u backup-u
+const (
+	BackupSSTable         = "sstable"
+	BackupVersionManifest = "manifest" // MANIFEST sa SSTable-ovima iz backup-a
+	BackupBlob            = "blob"
+	BackupWAL             = "wal" // Checkpoint i segmenti WAL-a
+	BackupDictionary      = "dictionary"
+)
+
+// Putanje u backup-u, Restore ih prebacuje u direktorijume iz konfiguracije
+const (
+	backupSSTableDir = "sstable"
+	backupBlobDir    = "blob"
+	backupWALDir     = "wal"
+	backupDictionary = "compression.db"
+)
+
+// BackupFile je jedan fajl iz backup-a
+type BackupFile struct {
+	Path     string `json:"path"` // Relativna putanja, npr. sstable/1/3/data.db
+	Kind     string `json:"kind"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"sha256"`
+	// Location je direktorijum backup-a u kome je fajl, relativno u odnosu na ovaj backup
+	// Prazan je ako je fajl kopiran u ovaj backup, a kod inkrementalnog backup-a pokazuje na neki od prethodnih
+	Location string `json:"location,omitempty"`
+}
+
+// BackupManifest opisuje jedan backup
+type BackupManifest struct {
+	Version  int          `json:"version"`
+	Created  time.Time    `json:"created"`
+	Previous string       `json:"previous,omitempty"` // Prethodni backup kod inkrementalnog, relativno u odnosu na ovaj
+	Files    []BackupFile `json:"files"`
+}
+
+// Copied vraca broj fajlova koji su zaista kopirani u ovaj backup
+func (m *BackupManifest) Copied() int {
+	n := 0
+	for _, f := range m.Files {
+		if f.Location == "" {
+			n++
+		}
+	}
+	return n
+}
+
+// Backup pravi pun backup baze u direktorijumu dir (ne sme da postoji ili mora biti prazan)
+// Memtable-ovi se prvo flush-uju, pa se pod db.mu kopiraju checkpoint i segmenti WAL-a (zapisi iza checkpoint-a jos nisu
+// u SSTable-ovima), zadrzava trenutna verzija SSTable-ova (da ih kompakcija ne obrise tokom kopiranja) i uzima spisak blob fajlova.
+// Checkpoint, flush i kompakcija rade pod db.mu, pa za to vreme nijedan segment sa spiska ne nestaje, a nijedan blob fajl
+// nije otvoren za upis. SSTable-ovi iz verzije i blob fajlovi se posle toga ne menjaju i zato se hard-linkuju
+// (ili kopiraju ako link nije moguc), a uz njih se upisuje MANIFEST sa tom verzijom.
+// Recnik se upisuje iz memorije. Na kraju se upisuje backup.json sa SHA-256 svakog fajla
+func (db *Database) Backup(dir string) (*BackupManifest, error) {
+	return db.backup(dir, "")
+}
+
+// BackupIncremental pravi backup koji kopira samo SSTable-ove kojih nema u backup-u previous
+// Ostali SSTable-ovi se u manifestu vode kao fajlovi iz prethodnih backup-ova, pa oni moraju ostati na mestu
+func (db *Database) BackupIncremental(dir, previous string) (*BackupManifest, error) {
+	if previous == "" {
+		return nil, fmt.Errorf("incremental backup needs a previous backup")
+	}
+	return db.backup(dir, previous)
+}
+
+func (db *Database) backup(dir, previous string) (*BackupManifest, error) {
+	// SSTable-ove iz prethodnog backup-a pamtimo po putanji i checksum-u, generacije se posle kompakcije ponavljaju
+	known := make(map[string]BackupFile)
+	manifest := &BackupManifest{Version: backupManifestVersion, Created: time.Now().UTC()}
+	// Putanje do prethodnog backup-a se cuvaju relativno, pa radimo sa apsolutnim
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup directory: %w", err)
+	}
+	if previous != "" {
+		if previous, err = filepath.Abs(previous); err != nil {
+			return nil, fmt.Errorf("invalid previous backup directory: %w", err)
+		}
+		prev, err := ReadBackupManifest(previous)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read previous backup: %w", err)
+		}
+		if manifest.Previous, err = filepath.Rel(dir, previous); err != nil {
+			return nil, fmt.Errorf("failed to resolve previous backup: %w", err)
+		}
+		for _, f := range prev.Files {
+			if f.Kind != BackupSSTable && f.Kind != BackupBlob {
+				continue
+			}
+			location, err := filepath.Rel(dir, filepath.Join(previous, f.Location))
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve previous backup: %w", err)
+			}
+			f.Location = location
+			known[f.Path+"@"+f.Checksum] = f
+		}
+	}
+
+	if err := createEmptyDir(dir); err != nil {
+		return nil, err
+	}
+	if err := db.Flush(); err != nil {
+		return nil, fmt.Errorf("backup failed: %w", err)
+	}
+
+	snapshot, blobs, err := db.backupWAL(dir, manifest)
+	if err != nil {
+		return nil, err
+	}
+	defer snapshot.Release()
+	for _, table := range snapshot.Tables() {
+		tableDir := db.SSTableDir(table.Level, table.Gen)
+		entries, err := os.ReadDir(tableDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SSTable directory: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			src := filepath.Join(tableDir, entry.Name())
+			rel := filepath.ToSlash(filepath.Join(backupSSTableDir, fmt.Sprint(table.Level), fmt.Sprint(table.Gen), entry.Name()))
+			f, err := backupImmutable(dir, src, rel, BackupSSTable, known)
+			if err != nil {
+				return nil, err
+			}
+			manifest.Files = append(manifest.Files, f)
+		}
+	}
+	rel := filepath.ToSlash(filepath.Join(backupSSTableDir, "MANIFEST"))
+	dst := filepath.Join(dir, filepath.FromSlash(rel))
+	if err := snapshot.WriteManifest(dst); err != nil {
+		return nil, fmt.Errorf("failed to write SSTable manifest: %w", err)
+	}
+	f, err := backupFile(dst, rel, BackupVersionManifest)
+	if err != nil {
+		return nil, err
+	}
+	manifest.Files = append(manifest.Files, f)
+
+	// Blob fajlovi se kao i SSTable-ovi ne menjaju posle upisa
+	for _, id := range blobs {
+		src := blob.FileName(db.config.Blob.Directory, id)
+		rel := filepath.ToSlash(filepath.Join(backupBlobDir, filepath.Base(src)))
+		f, err := backupImmutable(dir, src, rel, BackupBlob, known)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, f)
+	}
+
+	// Recnik na disku moze biti zastareo (upisuje se tek pri Close), pa ga upisujemo iz memorije
+	dst = filepath.Join(dir, backupDictionary)
+	db.mu.Lock()
+	hasDictionary := db.compression != nil && !db.compression.IsEmpty()
+	if hasDictionary {
+		err = db.compression.Write(dst, db.CacheBlockManager)
+	}
+	db.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to write dictionary: %w", err)
+	}
+	if hasDictionary {
+		f, err := backupFile(dst, backupDictionary, BackupDictionary)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, f)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal backup manifest: %w", err)
+	}
+	tmp := filepath.Join(dir, backupManifestName+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write backup manifest: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, backupManifestName)); err != nil {
+		return nil, fmt.Errorf("failed to write backup manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// backupWAL kopira WAL u backup, a zatim zadrzava verziju SSTable-ova i vraca spisak blob fajlova, sve pod db.mu
+// WAL se menja, pa se kopira, a ne linkuje. Kopira se pre verzije: SSTable nastao posle samo ponavlja zapise iz WAL-a,
+// a obrnuto bi zapisi nestali. Posle flush-a je ostao samo aktivni segment, pa kopiranje kratko drzi db.mu
+func (db *Database) backupWAL(dir string, manifest *BackupManifest) (*lsmtree.Snapshot, []uint64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if err := db.wal.Sync(); err != nil {
+		return nil, nil, fmt.Errorf("backup failed: %w", err)
+	}
+	walFiles, err := writeaheadlog.Files(db.config.Wal.WalDirectory)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list WAL files: %w", err)
+	}
+	for _, src := range walFiles {
+		rel := filepath.ToSlash(filepath.Join(backupWALDir, filepath.Base(src)))
+		dst := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := copyFile(src, dst); err != nil {
+			return nil, nil, err
+		}
+		f, err := backupFile(dst, rel, BackupWAL)
+		if err != nil {
+			return nil, nil, err
+		}
+		manifest.Files = append(manifest.Files, f)
+	}
+	blobs, err := blob.Files(db.config.Blob.Directory)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list blob files: %w", err)
+	}
+	return db.versions.Snapshot(), blobs, nil
+}
+
+// ReadBackupManifest cita backup.json iz direktorijuma backup-a
+func ReadBackupManifest(dir string) (*BackupManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, backupManifestName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup manifest: %w", err)
+	}
+	var manifest BackupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse backup manifest: %w", err)
+	}
+	if manifest.Version != backupManifestVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", manifest.Version)
+	}
+	return &manifest, nil
+}
+
+// VerifyBackup proverava velicinu i SHA-256 svih fajlova backup-a (i onih iz prethodnih backup-ova)
+func VerifyBackup(backupDir string) (*BackupManifest, error) {
+	manifest, err := ReadBackupManifest(backupDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range manifest.Files {
+		src := filepath.Join(backupDir, f.Location, filepath.FromSlash(f.Path))
+		size, sum, err := checksumFile(src)
+		if err != nil {
+			return nil, err
+		}
+		if size != f.Size || sum != f.Checksum {
+			return nil, fmt.Errorf("backup file %s is corrupted: size %d, sha256 %s, expected size %d, sha256 %s", src, size, sum, f.Size, f.Checksum)
+		}
+	}
+	return manifest, nil
+}
+
+// Restore proverava backup i vraca ga u direktorijume iz konfiguracije: SSTable-ove i MANIFEST u direktorijum SSTable-ova,
+// blob fajlove u direktorijum blob-ova, WAL u direktorijum WAL-a i recnik na njegovu putanju
+// Direktorijumi ne smeju da postoje ili moraju biti prazni, a recnik ne sme da postoji
+func Restore(backupDir string, cfg *config.Config) (*BackupManifest, error) {
+	manifest, err := VerifyBackup(backupDir)
+	if err != nil {
+		return nil, err
+	}
+	// WAL direktorijum treba i kad nema segmenata
+	for _, dir := range []string{cfg.SSTable.SstableDirectory, cfg.Blob.Directory, cfg.Wal.WalDirectory} {
+		if err := createEmptyDir(dir); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := os.Stat(cfg.Compression.DictionaryDir); err == nil {
+		return nil, fmt.Errorf("dictionary %s already exists", cfg.Compression.DictionaryDir)
+	}
+	for _, f := range manifest.Files {
+		dst, err := restorePath(cfg, f)
+		if err != nil {
+			return nil, err
+		}
+		src := filepath.Join(backupDir, f.Location, filepath.FromSlash(f.Path))
+		if err := copyFile(src, dst); err != nil {
+			return nil, err
+		}
+	}
+	return manifest, nil
+}
+
+// restorePath vraca putanju na koju Restore vraca fajl iz backup-a
+func restorePath(cfg *config.Config, f BackupFile) (string, error) {
+	if f.Kind == BackupDictionary {
+		return cfg.Compression.DictionaryDir, nil
+	}
+	top, rest, ok := strings.Cut(f.Path, "/")
+	if !ok || rest == "" || strings.Contains("/"+rest+"/", "/../") {
+		return "", fmt.Errorf("invalid backup file path %s", f.Path)
+	}
+	var dir string
+	switch {
+	case top == backupSSTableDir && (f.Kind == BackupSSTable || f.Kind == BackupVersionManifest):
+		dir = cfg.SSTable.SstableDirectory
+	case top == backupBlobDir && f.Kind == BackupBlob:
+		dir = cfg.Blob.Directory
+	case top == backupWALDir && f.Kind == BackupWAL:
+		dir = cfg.Wal.WalDirectory
+	default:
+		return "", fmt.Errorf("unknown backup file %s (%s)", f.Path, f.Kind)
+	}
+	return filepath.Join(dir, filepath.FromSlash(rest)), nil
+}
+
+// backupImmutable dodaje u backup fajl koji se posle upisa ne menja: ako ga vec ima u prethodnom backup-u
+// vraca zapis iz njega, a inace ga hard-linkuje (ili kopira) u backup
+func backupImmutable(dir, src, rel, kind string, known map[string]BackupFile) (BackupFile, error) {
+	size, sum, err := checksumFile(src)
+	if err != nil {
+		return BackupFile{}, err
+	}
+	if f, ok := known[rel+"@"+sum]; ok {
+		return f, nil
+	}
+	if err := linkOrCopy(src, filepath.Join(dir, filepath.FromSlash(rel))); err != nil {
+		return BackupFile{}, err
+	}
+	return BackupFile{Path: rel, Kind: kind, Size: size, Checksum: sum}, nil
+}
+
+// createEmptyDir pravi direktorijum, a ako vec postoji proverava da je prazan
+func createEmptyDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err == nil && len(entries) > 0 {
+		return fmt.Errorf("directory %s is not empty", dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+	return nil
+}
+
+func backupFile(path, rel, kind string) (BackupFile, error) {
+	size, sum, err := checksumFile(path)
+	if err != nil {
+		return BackupFile{}, err
+	}
+	return BackupFile{Path: rel, Kind: kind, Size: size, Checksum: sum}, nil
+}
+
+func checksumFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// linkOrCopy pravi hard link, a ako to nije moguce (npr. drugi disk) kopira fajl
+func linkOrCopy(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	return copyFile(src, dst)
+}
+
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to sync %s: %w", dst, err)
+	}
+	return out.Close()
+}
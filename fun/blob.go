@@ -0,0 +1,120 @@
+package fun
+
+import (
+	"fmt"
+
+	"github.com/iigor000/database/structures/blob"
+	"github.com/iigor000/database/structures/lsmtree"
+)
+
+// BlobGCStats opisuje jedan prolaz GC-a blob fajlova
+type BlobGCStats struct {
+	Files     int   // Broj pregledanih blob fajlova
+	Removed   int   // Broj obrisanih blob fajlova
+	Rewritten int   // Broj zivih vrednosti koje su ponovo upisane
+	Reclaimed int64 // Broj oslobodjenih bajtova (bez ponovo upisanih vrednosti)
+}
+
+// CollectBlobGarbage oslobadja prostor u blob fajlovima koji zauzimaju prepisane i obrisane vrednosti
+// Vrednost je ziva samo ako najnoviji zapis njenog kljuca pokazuje bas na nju
+// Blob fajl u kom je bar GCRatio bajtova zastarelo se brise, a njegove zive vrednosti se prvo
+// ponovo upisuju kao obican Put (dobijaju novi sekvencni broj i timestamp) i pri flush-u zavrse u novom blob fajlu
+func (db *Database) CollectBlobGarbage() (*BlobGCStats, error) {
+	dir := db.config.Blob.Directory
+	ids, err := blob.Files(dir)
+	if err != nil {
+		return nil, err
+	}
+	stats := &BlobGCStats{Files: len(ids)}
+	var victims []uint64
+	for _, id := range ids {
+		var total, live int64
+		err := blob.Scan(dir, id, func(r blob.Record) error {
+			total += r.Pointer.Size
+			ok, err := db.blobLive(r)
+			if ok {
+				live += r.Pointer.Size
+			}
+			return err
+		})
+		if err != nil {
+			return stats, fmt.Errorf("blob gc failed: %w", err)
+		}
+		if total > 0 && total == live {
+			continue
+		}
+		if total > 0 && float64(total-live)/float64(total) < db.config.Blob.GCRatio {
+			continue
+		}
+
+		err = blob.Scan(dir, id, func(r blob.Record) error {
+			rewritten, err := db.rewriteBlob(r)
+			if rewritten {
+				stats.Rewritten++
+			}
+			return err
+		})
+		if err != nil {
+			return stats, fmt.Errorf("blob gc failed: %w", err)
+		}
+		victims = append(victims, id)
+		stats.Reclaimed += total - live
+	}
+
+	// Ponovo upisane vrednosti moraju biti u WAL-u na disku pre nego sto se obrise jedina kopija
+	if err := db.wal.Sync(); err != nil {
+		return stats, fmt.Errorf("blob gc failed: %w", err)
+	}
+	for _, id := range victims {
+		if err := blob.Remove(dir, id); err != nil {
+			return stats, fmt.Errorf("blob gc failed: %w", err)
+		}
+		stats.Removed++
+	}
+	return stats, nil
+}
+
+// rewriteBlob ponovo upisuje vrednost zapisa r ako je jos ziva
+// Provera i upis su pod istim db.mu, inace bi Put ili Delete istog kljuca izmedju njih bio pregazen starom vrednoscu
+func (db *Database) rewriteBlob(r blob.Record) (bool, error) {
+	db.mu.Lock()
+	ok, err := db.blobLiveLocked(r)
+	if err != nil || !ok {
+		db.mu.Unlock()
+		return false, err
+	}
+	// Scan vraca kljuc i vrednost iz svog bafera, a Memtable ih cuva
+	n, err := db.putLocked(string(r.Key), append([]byte(nil), r.Value...))
+	db.mu.Unlock()
+	if err != nil {
+		return false, err
+	}
+	if err := db.wal.WaitDurable(n); err != nil {
+		return true, fmt.Errorf("failed to sync write-ahead log: %w", err)
+	}
+	return true, nil
+}
+
+// blobLive proverava da li najnoviji zapis kljuca pokazuje na zapis r iz blob fajla
+func (db *Database) blobLive(r blob.Record) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.blobLiveLocked(r)
+}
+
+// blobLiveLocked je blobLive koji se poziva pod db.mu
+func (db *Database) blobLiveLocked(r blob.Record) (bool, error) {
+	// Memtable je noviji od svih SSTable-ova, a u njemu vrednosti nikad nisu izdvojene
+	if _, found := db.memtables.Search(r.Key); found {
+		return false, nil
+	}
+	record, err := lsmtree.Get(db.versions, r.Key, db.compression, db.CacheBlockManager)
+	if err != nil || record == nil || !record.Blob {
+		return false, err
+	}
+	p, err := blob.DecodePointer(record.Value)
+	if err != nil {
+		return false, fmt.Errorf("key %q: %w", r.Key, err)
+	}
+	return p == r.Pointer, nil
+}
@@ -3,10 +3,15 @@ package fun
 import (
 	"errors"
 	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/iigor000/database/config"
 	"github.com/iigor000/database/structures/adapter"
+	"github.com/iigor000/database/structures/blob"
 
 	"github.com/iigor000/database/structures/block_organization"
 	"github.com/iigor000/database/structures/cache"
@@ -20,14 +25,17 @@ import (
 )
 
 type Database struct {
+	// mu cuva Memtable-ove, recnik, cache i flush, upisi u WAL i Memtable idu istim redom
+	// Na fsync WAL-a se ceka posle oslobadjanja, pa istovremeni upisi dele jedan fsync
+	mu                sync.Mutex
 	wal               *writeaheadlog.WAL
 	compression       *compression.Dictionary
 	memtables         *memtable.Memtables
 	config            *config.Config
 	cache             *cache.Cache
 	username          string
-	lastFlushedGen    int // poslednja generacija koja je flush-ovana na disk
 	CacheBlockManager *block_organization.CachedBlockManager
+	versions          *lsmtree.VersionSet
 }
 
 func NewDatabase(config *config.Config, username string) (*Database, error) {
@@ -44,43 +52,78 @@ func NewDatabase(config *config.Config, username string) (*Database, error) {
 		return nil, fmt.Errorf("failed to initialize write-ahead log: %w", err)
 	}
 
-	//ucitaj wal u memtable
-	memtables := memtable.NewMemtables(config)
-	records, err := wal.ReadRecords()
-	if err != nil {
-		return nil, fmt.Errorf("failed to read records from write-ahead log: %w", err)
-	}
-	for _, record := range records {
-		if record.Tombstone {
-			// Ako je tombstone, brisemo kljuc, ne treba nam u memtable
-			memtables.Delete(record.Key)
-		} else {
-			// Ako nije tombstone, dodajemo kljuc i vrednost u memtable
-			memtables.Update(record.Key, record.Value, record.Timestamp, false)
-		}
-	}
-	//?? TODO: Treba da se ucita BloomFilter i Summary iz SSTable-a
-	cache := cache.NewCache(config)
+	// Recnik mora biti ucitan pre WAL-a, kljucevi iz SSTable-ova su zapisani preko njega
 	dict, err := compression.Read(config.Compression.DictionaryDir, cbm)
+	if errors.Is(err, fs.ErrNotExist) {
+		dict = compression.NewDictionary() // Baza je nova, recnik jos nije upisan
+	} else if err != nil {
+		wal.Close()
+		return nil, fmt.Errorf("failed to read compression dictionary: %w", err)
+	}
+
+	// Zivi SSTable-ovi se citaju iz MANIFEST-a, a ostaci prekinutog flush-a ili kompakcije se brisu
+	versions, err := lsmtree.OpenVersionSet(config, dict)
 	if err != nil {
-		dict = compression.NewDictionary() // Ako nije uspelo da se ucita, kreiramo novi
+		wal.Close()
+		return nil, fmt.Errorf("failed to open SSTable manifest: %w", err)
 	}
 
-	return &Database{
+	// Sekvencni brojevi se nastavljaju iza onih u SSTable-ovima (WAL segmenti pre checkpoint-a su obrisani),
+	// a replayWAL ih podize i na najveci iz WAL-a
+	wal.AdvanceSequence(versions.LastSequence())
+
+	memtables := memtable.NewMemtables(config)
+	// Generacije SSTable-ova se nastavljaju od onih koje vec postoje na disku, da flush ne bi pregazio postojeci SSTable
+	memtables.GenToFlush = versions.NextGeneration(1)
+
+	db := &Database{
 		wal:               wal,
 		memtables:         memtables,
 		config:            config,
-		cache:             cache,
+		cache:             cache.NewCache(config),
 		username:          username,
 		compression:       dict,
 		CacheBlockManager: cbm,
-	}, nil
+		versions:          versions,
+	}
+	if err := db.replayWAL(); err != nil {
+		wal.Close()
+		return nil, err
+	}
+	return db, nil
 }
 
-func (db *Database) calculateLWM() int {
-	return db.lastFlushedGen
-	// ako imamo flushovane generacije npr 1 i 2, onda je lwm 1
-	// ostaje taj nivo dok se flush skroz ne zavrsi
+// replayWAL ucitava u Memtable-ove zapise iz WAL-a koji jos nisu u SSTable-ovima, redom kojim su upisani
+// Tombstone se ucitava kao tombstone, jer kljuc moze biti u nekom SSTable-u
+// Ako se Memtable-ovi napune, flush-uju se kao i pri upisu
+func (db *Database) replayWAL() error {
+	records, err := db.wal.ReadRecords()
+	if err != nil {
+		return fmt.Errorf("failed to read records from write-ahead log: %w", err)
+	}
+	for _, record := range records {
+		db.compression.Add(record.Key)
+		db.memtables.CoverWAL(record.Start, record.End)
+		// WAL pamti vreme u nanosekundama, a Memtable i SSTable u sekundama
+		timestamp := time.Unix(0, record.Timestamp).Unix()
+		if db.memtables.Update(record.Key, record.Value, record.Seq, timestamp, record.Tombstone) {
+			if err := db.flushMemtable(); err != nil {
+				return fmt.Errorf("failed to flush replayed memtable: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// writeDictionary upisuje recnik za kompresiju na disk (prazan recnik se ne upisuje)
+func (db *Database) writeDictionary() error {
+	if db.compression == nil || db.compression.IsEmpty() {
+		return nil
+	}
+	if err := db.compression.Write(db.config.Compression.DictionaryDir, db.CacheBlockManager); err != nil {
+		return fmt.Errorf("failed to write compression dictionary: %w", err)
+	}
+	return nil
 }
 
 func (db *Database) Put(key string, value []byte) error {
@@ -98,54 +141,119 @@ func (db *Database) Put(key string, value []byte) error {
 		return errors.New("key is reserved: " + key)
 	}
 
+	if err := db.checkSize(key, value); err != nil {
+		return err
+	}
+
 	return db.put(key, value)
 }
 
+// checkSize proverava da li kljuc i vrednost ne prelaze ogranicenja iz konfiguracije
+func (db *Database) checkSize(key string, value []byte) error {
+	limits := db.config.Limits
+	if limits.MaxKeySize > 0 && len(key) > limits.MaxKeySize {
+		return fmt.Errorf("key is too large: %d bytes (max %d)", len(key), limits.MaxKeySize)
+	}
+	if limits.MaxValueSize > 0 && len(value) > limits.MaxValueSize {
+		return fmt.Errorf("value for key %q is too large: %d bytes (max %d)", key, len(value), limits.MaxValueSize)
+	}
+	return nil
+}
+
+// put upisuje vrednost u WAL i Memtable, a zapis postaje vidljiv pre nego sto je WAL sinhronizovan
 func (db *Database) put(key string, value []byte) error {
+	db.mu.Lock()
+	n, err := db.putLocked(key, value)
+	db.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := db.wal.WaitDurable(n); err != nil {
+		return fmt.Errorf("failed to sync write-ahead log: %w", err)
+	}
+	return nil
+}
 
-	if err := db.wal.Append([]byte(key), value, false); err != nil {
-		return fmt.Errorf("failed to append to write-ahead log: %w", err)
+// putLocked vraca redni broj upisa u WAL, poziva se pod db.mu
+func (db *Database) putLocked(key string, value []byte) (uint64, error) {
+	start := db.wal.Position()
+	seq, n, err := db.wal.Write([]byte(key), value, false)
+	if err != nil {
+		return 0, fmt.Errorf("failed to append to write-ahead log: %w", err)
 	}
+	db.memtables.CoverWAL(start, db.wal.Position())
 
 	if db.compression == nil {
 		db.compression = compression.NewDictionary()
 	}
 	db.compression.Add([]byte(key))
-	shouldFlush := db.memtables.Update([]byte(key), []byte(value), int64(time.Now().Unix()), false)
+	shouldFlush := db.memtables.Update([]byte(key), []byte(value), seq, int64(time.Now().Unix()), false)
 
 	if shouldFlush {
-		sstable.FlushSSTable(db.config, *db.memtables.Memtables[0], 1, db.memtables.GenToFlush, db.compression, db.CacheBlockManager)
-
-		db.lastFlushedGen = db.memtables.GenToFlush // azuriramo poslednju flushovanu generaciju
-		if err := db.wal.RemoveSegmentsUpTo(db.calculateLWM()); err != nil {
-			return fmt.Errorf("failed to remove write-ahead log segments up to lwm: %w", err)
+		if err := db.flushMemtable(); err != nil {
+			return 0, err
 		}
+	}
 
-		// Proverava uslov za kompakciju i vrši kompakciju ako je potrebno (počinje proveru od prvog nivoa)
-		lsmtree.Compact(db.config, db.compression, db.CacheBlockManager)
+	return n, nil
+}
 
-		recordsToCache := db.memtables.Memtables[0].GetAllEntries()
+// flushMemtable upisuje najstariji Memtable na disk kao SSTable na prvom nivou i rotira Memtable-ove
+// Poziva se pod db.mu (ili pri otvaranju baze)
+func (db *Database) flushMemtable() error {
+	sstable.FlushSSTable(db.config, *db.memtables.Memtables[0], 1, db.memtables.GenToFlush, db.compression, db.CacheBlockManager)
+	if err := db.CacheBlockManager.SyncDir(db.SSTableDir(1, db.memtables.GenToFlush)); err != nil {
+		return fmt.Errorf("failed to sync flushed SSTable: %w", err)
+	}
+	// SSTable postaje vidljiv (i prezivljava restart) tek kad je upisan u MANIFEST
+	if err := lsmtree.AddTable(db.versions, 1, db.memtables.GenToFlush, db.compression, db.CacheBlockManager); err != nil {
+		return fmt.Errorf("failed to add flushed SSTable to manifest: %w", err)
+	}
+	// Kljucevi u SSTable-u mogu biti zapisani preko recnika, pa i on mora biti na disku pre checkpoint-a
+	if err := db.writeDictionary(); err != nil {
+		return err
+	}
 
-		// Resetujemo redosled Memtable-a
-		for j := 0; j < db.memtables.NumberOfMemtables-1; j++ {
-			db.memtables.Memtables[j] = db.memtables.Memtables[j+1]
+	// SSTable je na disku, pa WAL treba samo od prvog zapisa koji je jos u nekom od preostalih Memtable-ova
+	// Ako su oni prazni, WAL je u SSTable-ovima do kraja flush-ovanog Memtable-a
+	// (ne do kraja WAL-a, jer pri ucitavanju WAL-a iza njega ima zapisa koji jos nisu ucitani)
+	checkpoint, ok := db.memtables.WALStart(1)
+	if !ok {
+		checkpoint = db.memtables.Memtables[0].WalEnd
+	}
+	if checkpoint.Segment > 0 {
+		if err := db.wal.Checkpoint(checkpoint); err != nil {
+			return fmt.Errorf("failed to checkpoint write-ahead log: %w", err)
 		}
+	}
+
+	// Proverava uslov za kompakciju i vrši kompakciju ako je potrebno (počinje proveru od prvog nivoa)
+	lsmtree.Compact(db.versions, db.compression, db.CacheBlockManager)
 
-		// Dodajemo novi Memtable na kraj
-		db.memtables.Memtables[db.memtables.NumberOfMemtables-1] = memtable.NewMemtable(db.config)
+	flushed := db.memtables.Memtables[0]
 
-		// Ako se desi kompakcija, može se promeniti broj sledeće generacije SSTable-a
-		db.memtables.GenToFlush = lsmtree.GetNextSSTableGeneration(db.config, 1)
+	// Resetujemo redosled Memtable-a
+	for j := 0; j < db.memtables.NumberOfMemtables-1; j++ {
+		db.memtables.Memtables[j] = db.memtables.Memtables[j+1]
+	}
 
-		//TODO: Zapisati u wal da je flush uradjen
+	// Dodajemo novi Memtable na kraj
+	db.memtables.Memtables[db.memtables.NumberOfMemtables-1] = memtable.NewMemtable(db.config)
 
-		for _, record := range recordsToCache {
-			// Dodajemo u cache
-			if _, found := db.cache.Get(string(record.Key)); found {
-				db.cache.Put(record)
-			}
-		}
+	// Ako se desi kompakcija, može se promeniti broj sledeće generacije SSTable-a
+	db.memtables.GenToFlush = db.versions.NextGeneration(1)
 
+	for _, key := range flushed.Keys {
+		// Osvezavamo cache (i tombstone-om), osim ako noviji Memtable ima novu vrednost, ona ce osveziti cache pri svom flush-u
+		if _, found := db.cache.Get(string(key)); !found {
+			continue
+		}
+		if _, newer := db.memtables.Search(key); newer {
+			continue
+		}
+		if entry, found := flushed.Search(key); found {
+			db.cache.Put(*entry)
+		}
 	}
 
 	return nil
@@ -170,6 +278,8 @@ func (db *Database) Get(key string) ([]byte, bool, error) {
 }
 
 func (db *Database) get(key string) ([]byte, bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
 	keyByte := []byte(key)
 
 	// Proveravamo da li je u Memtable-u
@@ -190,16 +300,21 @@ func (db *Database) get(key string) ([]byte, bool, error) {
 		return nil, false, nil
 	}
 
-	record, err := lsmtree.Get(db.config, keyByte, db.compression, db.CacheBlockManager)
+	record, err := lsmtree.Get(db.versions, keyByte, db.compression, db.CacheBlockManager)
 	if err != nil {
 		return nil, false, err
 	} else {
 		if record == nil {
 			return nil, false, nil // Nije pronađen ključ
 		}
+		value, err := db.resolve(record.Key, record.Value, record.Blob)
+		if err != nil {
+			return nil, false, err
+		}
 		entry = &adapter.MemtableEntry{
 			Key:       record.Key,
-			Value:     record.Value,
+			Value:     value,
+			Seq:       record.Seq,
 			Timestamp: record.Timestamp,
 			Tombstone: record.Tombstone,
 		}
@@ -214,6 +329,14 @@ func (db *Database) get(key string) ([]byte, bool, error) {
 	return nil, false, nil
 }
 
+// resolve vraca vrednost zapisa sa diska, a vrednost izdvojenu u blob fajl cita iz njega
+func (db *Database) resolve(key, value []byte, isBlob bool) ([]byte, error) {
+	if !isBlob {
+		return value, nil
+	}
+	return blob.Resolve(db.config.Blob.Directory, key, value)
+}
+
 func (db *Database) Delete(key string) error {
 	// Proveravamo da li po token bucketu korisnik moze da unese podatke
 	allow, err := CheckBucket(db)
@@ -229,27 +352,54 @@ func (db *Database) Delete(key string) error {
 		return errors.New("key is reserved: " + key)
 	}
 
+	// Tombstone nema vrednost, ali kljuc prevelik za Put ne sme ni kroz Delete u WAL i Memtable
+	if err := db.checkSize(key, nil); err != nil {
+		return err
+	}
+
 	return db.delete(key)
 }
 
 func (db *Database) delete(key string) error {
-	// TODO: Napisati u wal da se brise entry
-	if err := db.wal.Append([]byte(key), nil, true); err != nil {
-		return fmt.Errorf("failed to write to write-ahead log: %w", err)
+	db.mu.Lock()
+	n, err := db.deleteLocked(key)
+	db.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := db.wal.WaitDurable(n); err != nil {
+		return fmt.Errorf("failed to sync write-ahead log: %w", err)
 	}
+	return nil
+}
 
-	// Brisanje iz memtable-a
-	found := db.memtables.Delete([]byte(key))
-	if !found {
-		err := db.Put(key, []byte{})
-		if err != nil {
-			return err
-		}
+// deleteLocked vraca redni broj upisa u WAL, poziva se pod db.mu
+func (db *Database) deleteLocked(key string) (uint64, error) {
+	start := db.wal.Position()
+	seq, n, err := db.wal.Write([]byte(key), nil, true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to write to write-ahead log: %w", err)
+	}
+	db.memtables.CoverWAL(start, db.wal.Position())
 
-		db.memtables.Delete([]byte(key))
+	if db.compression == nil {
+		db.compression = compression.NewDictionary()
+	}
+	db.compression.Add([]byte(key))
+	// Tombstone se upisuje u Memtable koji se menja i kad kljuca nema u Memtable-ovima, jer moze biti u SSTable-u
+	timestamp := time.Now().Unix()
+	shouldFlush := db.memtables.Update([]byte(key), nil, seq, timestamp, true)
+	// Stara vrednost u cache-u bi se posle flush-a tombstone-a vratila iz Get
+	if _, found := db.cache.Get(key); found {
+		db.cache.Put(adapter.MemtableEntry{Key: []byte(key), Seq: seq, Timestamp: timestamp, Tombstone: true})
 	}
 
-	return nil
+	if shouldFlush {
+		if err := db.flushMemtable(); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
 }
 
 func (db *Database) ValidateMerkleTree(generation, level int) error {
@@ -269,20 +419,29 @@ func (db *Database) ValidateMerkleTree(generation, level int) error {
 	}
 	return nil
 }
-func (db *Database) Close() {
-	if db.compression != nil {
-		if !db.compression.IsEmpty() {
-			db.compression.Write(db.config.Compression.DictionaryDir, db.CacheBlockManager)
-		}
+func (db *Database) Close() error {
+	db.mu.Lock()
+	err := db.writeDictionary()
+	db.mu.Unlock()
+	if err != nil {
+		db.wal.Close()
+		return err
+	}
+	// Sinhronizuje zapise koji jos nisu na disku (sync_mode "interval")
+	if err := db.wal.Close(); err != nil {
+		return fmt.Errorf("failed to close write-ahead log: %w", err)
 	}
+	return nil
 }
 
 func (db *Database) PrefixScan(prefix string, pageNumber int, pageSize int, m bool) []adapter.MemtableEntry {
 	if m {
+		db.mu.Lock()
+		defer db.mu.Unlock()
 		return db.memtables.PrefixScan(prefix, pageNumber, pageSize)
 	}
 
-	dr, err := lsmtree.PrefixScan(db.config, prefix, db.CacheBlockManager, db.compression, pageNumber, pageSize)
+	dr, err := lsmtree.PrefixScan(db.versions, prefix, db.CacheBlockManager, db.compression, pageNumber, pageSize)
 	if err != nil {
 		return nil
 	}
@@ -291,10 +450,14 @@ func (db *Database) PrefixScan(prefix string, pageNumber int, pageSize int, m bo
 	}
 	entries := make([]adapter.MemtableEntry, 0, len(dr))
 	for _, record := range dr {
-
+		value, err := db.resolve(record.Key, record.Value, record.Blob)
+		if err != nil {
+			return nil
+		}
 		entries = append(entries, adapter.MemtableEntry{
 			Key:       record.Key,
-			Value:     record.Value,
+			Value:     value,
+			Seq:       record.Seq,
 			Timestamp: record.Timestamp,
 			Tombstone: record.Tombstone,
 		})
@@ -304,9 +467,11 @@ func (db *Database) PrefixScan(prefix string, pageNumber int, pageSize int, m bo
 
 func (db *Database) RangeScan(start, end string, pageNumber int, pageSize int, m bool) []adapter.MemtableEntry {
 	if m {
+		db.mu.Lock()
+		defer db.mu.Unlock()
 		return db.memtables.RangeScan([]byte(start), []byte(end), pageNumber, pageSize)
 	}
-	dr, err := lsmtree.RangeScan(db.config, start, end, db.CacheBlockManager, db.compression, pageNumber, pageSize)
+	dr, err := lsmtree.RangeScan(db.versions, start, end, db.CacheBlockManager, db.compression, pageNumber, pageSize)
 	if err != nil {
 		return nil
 	}
@@ -315,13 +480,51 @@ func (db *Database) RangeScan(start, end string, pageNumber int, pageSize int, m
 	}
 	entries := make([]adapter.MemtableEntry, 0, len(dr))
 	for _, record := range dr {
-
+		value, err := db.resolve(record.Key, record.Value, record.Blob)
+		if err != nil {
+			return nil
+		}
 		entries = append(entries, adapter.MemtableEntry{
 			Key:       record.Key,
-			Value:     record.Value,
+			Value:     value,
+			Seq:       record.Seq,
 			Timestamp: record.Timestamp,
 			Tombstone: record.Tombstone,
 		})
 	}
 	return entries
 }
+
+// CompleteKeys vraca najvise limit korisnickih kljuceva koji pocinju datim prefiksom
+// Koristi se za dopunjavanje kljuceva u shell-u, ne trosi tokene korisnika
+// Rezervisani kljucevi i kljucevi obrisani u Memtable-u se preskacu
+func (db *Database) CompleteKeys(prefix string, limit int) []string {
+	seen := make(map[string]bool)
+	keys := make([]string, 0)
+	add := func(key []byte, tombstone bool) {
+		k := string(key)
+		if seen[k] || !strings.HasPrefix(k, prefix) {
+			return
+		}
+		seen[k] = true // Noviji zapis (iz Memtable-a) ima prednost
+		if tombstone || util.CheckKeyReserved(k) || len(keys) >= limit {
+			return
+		}
+		keys = append(keys, k)
+	}
+
+	db.mu.Lock()
+	entries := db.memtables.PrefixScan(prefix, 1, limit)
+	db.mu.Unlock()
+	for _, entry := range entries {
+		add(entry.Key, entry.Tombstone)
+	}
+	records, err := lsmtree.PrefixScan(db.versions, prefix, db.CacheBlockManager, db.compression, 0, limit)
+	if err == nil {
+		for _, record := range records {
+			add(record.Key, record.Tombstone)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
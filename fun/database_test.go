@@ -1,13 +1,20 @@
 package fun
 
 import (
+	"bytes"
 	"fmt"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/iigor000/database/config"
+	"github.com/iigor000/database/structures/blob"
+	"github.com/iigor000/database/util"
 )
 
 func createTestDatabase(t *testing.T) (*Database, func()) {
@@ -27,6 +34,8 @@ func createTestDatabase(t *testing.T) (*Database, func()) {
 	// Override paths
 	cfg.Wal.WalDirectory = filepath.Join(tempDir, "wal")
 	cfg.SSTable.SstableDirectory = filepath.Join(tempDir, "sstable")
+	cfg.Blob.Directory = filepath.Join(tempDir, "blob")
+	cfg.Compression.DictionaryDir = filepath.Join(tempDir, "compression.db")
 	cfg.TokenBucket.StartTokens = 100 // Enough for all test operations
 	cfg.TokenBucket.RefillIntervalS = 1
 
@@ -254,3 +263,907 @@ func TestDatabase_PutMany(t *testing.T) {
 	}
 	fmt.Println("Svi podaci uspešno provereni")
 }
+
+func TestDatabase_FlushCompactStats(t *testing.T) {
+	db, cleanup := createTestDatabase(t)
+	defer cleanup()
+
+	for i := 0; i < 25; i++ {
+		if err := db.Put(fmt.Sprintf("key%02d", i), []byte(fmt.Sprintf("value%d", i))); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	for _, m := range stats.Memtables {
+		if m.Size != 0 {
+			t.Errorf("Memtable %d not empty after flush: %d entries", m.Index, m.Size)
+		}
+	}
+	if len(stats.Levels) == 0 || stats.Levels[0].Level != 1 || len(stats.Levels[0].Tables) == 0 {
+		t.Fatalf("Expected SSTables on level 1 after flush, got %+v", stats.Levels)
+	}
+	if stats.WalSegments == 0 {
+		t.Error("Expected at least the active WAL segment")
+	}
+
+	if err := db.CompactRange("", ""); err != nil {
+		t.Fatalf("CompactRange failed: %v", err)
+	}
+	stats, err = db.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if len(stats.Levels) != 1 || len(stats.Levels[0].Tables) != 1 {
+		t.Fatalf("Expected a single SSTable after full compaction, got %+v", stats.Levels)
+	}
+	table := stats.Levels[0].Tables[0]
+	// Token bucket je takodje kljuc u bazi, pa je min kljuc rezervisan kljuc
+	if string(table.MinKey) > "key00" || string(table.MaxKey) != "key24" {
+		t.Errorf("Unexpected key range %q..%q", table.MinKey, table.MaxKey)
+	}
+	// Statistika iz Properties SSTable-a
+	if table.Entries < 25 || table.Tombstones != 0 || table.DataSize <= 0 || table.RawSize <= 0 || stats.Levels[0].Entries != table.Entries {
+		t.Errorf("Unexpected table properties %+v", table)
+	}
+	all, err := db.ApproximateSize("", "")
+	if err != nil || all != table.DataSize {
+		t.Errorf("ApproximateSize of everything = %d, %v; want %d", all, err, table.DataSize)
+	}
+	if size, err := db.ApproximateSize("key00", "key24"); err != nil || size <= 0 || size > all {
+		t.Errorf("ApproximateSize(key00, key24) = %d, %v", size, err)
+	}
+	if size, err := db.ApproximateSize("zzz", ""); err != nil || size != 0 {
+		t.Errorf("ApproximateSize after last key = %d, %v; want 0", size, err)
+	}
+	if _, err := db.ApproximateSize("b", "a"); err == nil {
+		t.Error("ApproximateSize with start after end should fail")
+	}
+
+	for i := 0; i < 25; i++ {
+		value, found, err := db.Get(fmt.Sprintf("key%02d", i))
+		if err != nil || !found || string(value) != fmt.Sprintf("value%d", i) {
+			t.Errorf("Get key%02d after compaction = %q, %v, %v", i, value, found, err)
+		}
+	}
+	if stats.Cache.Hits+stats.Cache.Misses == 0 {
+		t.Error("Expected cache accesses to be counted")
+	}
+}
+
+func TestDatabase_ExportImport(t *testing.T) {
+	db, cleanup := createTestDatabase(t)
+	defer cleanup()
+
+	for i := 0; i < 20; i++ {
+		if err := db.Put(fmt.Sprintf("key%02d", i), []byte(fmt.Sprintf("value%d", i))); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	// Izmene posle flush-a su u Memtable-u i treba da sakriju zapise sa diska
+	binary := []byte{0x00, 0xff, 0xfe, 'x'}
+	if err := db.Put("key03", binary); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := db.Delete("key05"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := db.Put("key99", []byte("a,b \"quoted\"\nline")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	want := make(map[string][]byte)
+	for i := 0; i < 20; i++ {
+		want[fmt.Sprintf("key%02d", i)] = []byte(fmt.Sprintf("value%d", i))
+	}
+	want["key03"] = binary
+	delete(want, "key05")
+	want["key99"] = []byte("a,b \"quoted\"\nline")
+
+	for _, format := range []string{FormatJSONL, FormatCSV} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			count, err := db.Export(&buf, format)
+			if err != nil {
+				t.Fatalf("Export failed: %v", err)
+			}
+			if count != len(want) {
+				t.Fatalf("Exported %d keys, want %d", count, len(want))
+			}
+			if strings.Contains(buf.String(), util.TokenBucketPrefix) {
+				t.Error("Export contains reserved keys")
+			}
+
+			target, cleanupTarget := createTestDatabase(t)
+			defer cleanupTarget()
+			if _, err := target.Import(bytes.NewReader(buf.Bytes()), format, ImportOptions{BypassTokenBucket: true}); err == nil {
+				t.Error("Expected error when non-root user bypasses the token bucket")
+			}
+
+			target.username = "root"
+			var progress []int
+			imported, err := target.Import(bytes.NewReader(buf.Bytes()), format, ImportOptions{
+				BatchSize:         7,
+				BypassTokenBucket: true,
+				Progress:          func(n int) { progress = append(progress, n) },
+			})
+			if err != nil {
+				t.Fatalf("Import failed: %v", err)
+			}
+			if imported != len(want) || len(progress) != 3 || progress[2] != len(want) {
+				t.Errorf("Imported %d keys with progress %v, want %d", imported, progress, len(want))
+			}
+			for key, value := range want {
+				got, found, err := target.Get(key)
+				if err != nil || !found || !bytes.Equal(got, value) {
+					t.Errorf("Get %s after import = %q, %v, %v; want %q", key, got, found, err, value)
+				}
+			}
+			if _, found, _ := target.Get("key05"); found {
+				t.Error("Deleted key was imported")
+			}
+		})
+	}
+
+	reserved := `{"key":"` + util.TokenBucketPrefix + `x","value":"1"}` + "\n"
+	if _, err := db.Import(strings.NewReader(reserved), FormatJSONL, ImportOptions{}); err == nil {
+		t.Error("Expected error when importing a reserved key")
+	}
+}
+
+// Istovremeni Put-ovi prolaze kroz flush Memtable-ova, pokrece se sa go test -race
+func TestDatabase_ConcurrentPut(t *testing.T) {
+	db, cleanup := createTestDatabase(t)
+	defer cleanup()
+
+	const writers, perWriter = 8, 10
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*perWriter)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				if err := db.Put(fmt.Sprintf("w%d-key%02d", w, i), []byte(fmt.Sprintf("value%d-%d", w, i))); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Put failed: %v", err)
+	}
+
+	for w := 0; w < writers; w++ {
+		for i := 0; i < perWriter; i++ {
+			key := fmt.Sprintf("w%d-key%02d", w, i)
+			value, found, err := db.get(key)
+			if want := fmt.Sprintf("value%d-%d", w, i); err != nil || !found || string(value) != want {
+				t.Errorf("get %s = %q, %v, %v; want %q", key, value, found, err, want)
+			}
+		}
+	}
+}
+
+func TestDatabase_ImportChargesPerBatch(t *testing.T) {
+	db, cleanup := createTestDatabase(t)
+	defer cleanup()
+
+	// Korisnik ima 5 tokena, a uvozi 8 zapisa u serijama od 4
+	db.config.TokenBucket.RefillIntervalS = 3600
+	bucket := fmt.Sprintf(`{"tokens":5,"timestamp":%d}`, time.Now().Unix())
+	if err := db.put(util.TokenBucketPrefix+db.username, []byte(bucket)); err != nil {
+		t.Fatalf("Failed to set token bucket: %v", err)
+	}
+	var input strings.Builder
+	for i := 0; i < 8; i++ {
+		fmt.Fprintf(&input, "{\"key\":\"key%02d\",\"value\":\"value%d\"}\n", i, i)
+	}
+
+	imported, err := db.Import(strings.NewReader(input.String()), FormatJSONL, ImportOptions{BatchSize: 4})
+	if err == nil || !strings.Contains(err.Error(), "rate limit") {
+		t.Fatalf("Expected rate limit error, got %v", err)
+	}
+	if imported != 4 {
+		t.Errorf("Imported %d records, want 4 (only the first batch)", imported)
+	}
+	for i := 0; i < 8; i++ {
+		_, found, err := db.get(fmt.Sprintf("key%02d", i))
+		if err != nil {
+			t.Fatalf("get failed: %v", err)
+		}
+		if found != (i < 4) {
+			t.Errorf("key%02d found = %v after import with 5 tokens", i, found)
+		}
+	}
+	// Druga serija nije naplacena, pa je ostao jedan token
+	value, _, err := db.get(util.TokenBucketPrefix + db.username)
+	if err != nil || !strings.Contains(string(value), `"tokens":1}`) {
+		t.Errorf("token bucket after import = %s, %v; want 1 token left", value, err)
+	}
+}
+
+func TestDatabase_BackupRestore(t *testing.T) {
+	db, cleanup := createTestDatabase(t)
+	defer cleanup()
+	backups := t.TempDir()
+
+	for i := 0; i < 20; i++ {
+		if err := db.Put(fmt.Sprintf("key%02d", i), []byte(fmt.Sprintf("value%d", i))); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	full, err := db.Backup(filepath.Join(backups, "full"))
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	if full.Copied() != len(full.Files) {
+		t.Errorf("Full backup copied %d of %d files", full.Copied(), len(full.Files))
+	}
+
+	// Posle punog backup-a menjamo i brisemo kljuceve, inkrementalni backup kopira samo nove SSTable-ove
+	for i := 20; i < 30; i++ {
+		if err := db.Put(fmt.Sprintf("key%02d", i), []byte(fmt.Sprintf("value%d", i))); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	if err := db.Put("key00", []byte("changed")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := db.Delete("key01"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	incremental, err := db.BackupIncremental(filepath.Join(backups, "incr"), filepath.Join(backups, "full"))
+	if err != nil {
+		t.Fatalf("Incremental backup failed: %v", err)
+	}
+	reused := len(incremental.Files) - incremental.Copied()
+	if reused == 0 {
+		t.Error("Incremental backup did not reuse any SSTable from the full backup")
+	}
+	for _, f := range incremental.Files {
+		if f.Location != "" && f.Kind != BackupSSTable {
+			t.Errorf("Only SSTables should be reused, got %+v", f)
+		}
+	}
+
+	// Restore vraca fajlove u direktorijume iz konfiguracije, koji ne moraju imati podrazumevana imena
+	target := filepath.Join(t.TempDir(), "data")
+	cfg := *db.config
+	cfg.SSTable.SstableDirectory = filepath.Join(target, "tables")
+	cfg.Blob.Directory = filepath.Join(target, "values")
+	cfg.Wal.WalDirectory = filepath.Join(target, "log")
+	cfg.Compression.DictionaryDir = filepath.Join(target, "dict.db")
+	if _, err := Restore(filepath.Join(backups, "incr"), &cfg); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	kinds := make(map[string]int)
+	for _, f := range incremental.Files {
+		kinds[f.Kind]++
+	}
+	if kinds[BackupVersionManifest] != 1 || kinds[BackupWAL] == 0 {
+		t.Errorf("Expected the SSTable manifest and WAL in the backup, got %v", kinds)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.SSTable.SstableDirectory, "MANIFEST")); err != nil {
+		t.Errorf("MANIFEST was not restored: %v", err)
+	}
+	restored, err := NewDatabase(&cfg, "root")
+	if err != nil {
+		t.Fatalf("Failed to open restored database: %v", err)
+	}
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprintf("key%02d", i)
+		want := fmt.Sprintf("value%d", i)
+		if i == 0 {
+			want = "changed"
+		}
+		value, found, err := restored.Get(key)
+		if i == 1 {
+			if found {
+				t.Errorf("Deleted key %s found after restore: %q", key, value)
+			}
+			continue
+		}
+		if err != nil || !found || string(value) != want {
+			t.Errorf("Get %s after restore = %q, %v, %v; want %q", key, value, found, err, want)
+		}
+	}
+
+	// Osteceni fajl u prethodnom backup-u mora da obori restore inkrementalnog backup-a
+	for _, f := range incremental.Files {
+		if f.Location == "" {
+			continue
+		}
+		path := filepath.Join(backups, "incr", f.Location, filepath.FromSlash(f.Path))
+		if err := os.Remove(path); err != nil {
+			t.Fatalf("Failed to remove %s: %v", path, err)
+		}
+		if err := os.WriteFile(path, []byte("garbage"), 0644); err != nil {
+			t.Fatalf("Failed to corrupt %s: %v", path, err)
+		}
+		break
+	}
+	other := cfg
+	other.SSTable.SstableDirectory = filepath.Join(t.TempDir(), "sstable")
+	other.Blob.Directory = filepath.Join(t.TempDir(), "blob")
+	other.Wal.WalDirectory = filepath.Join(t.TempDir(), "wal")
+	other.Compression.DictionaryDir = filepath.Join(t.TempDir(), "compression.db")
+	if _, err := Restore(filepath.Join(backups, "incr"), &other); err == nil {
+		t.Error("Expected restore of a corrupted backup to fail")
+	}
+}
+
+// Backup tokom upisa (flush-evi sa checkpoint-ima i novim blob fajlovima) mora da prodje proveru i da se vrati
+func TestDatabase_BackupDuringWrites(t *testing.T) {
+	db, cleanup := createTestDatabase(t)
+	defer cleanup()
+	db.username = "root"
+	db.config.Blob.ValueThreshold = 100
+	backups := t.TempDir()
+
+	done := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err := db.Put(fmt.Sprintf("key%04d", i%500), bytes.Repeat([]byte{byte('a' + i%26)}, 200)); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		dir := filepath.Join(backups, fmt.Sprint(i))
+		if _, err := db.Backup(dir); err != nil {
+			close(done)
+			t.Fatalf("Backup %d failed: %v", i, err)
+		}
+		if _, err := VerifyBackup(dir); err != nil {
+			close(done)
+			t.Fatalf("VerifyBackup %d failed: %v", i, err)
+		}
+	}
+	close(done)
+	if err := <-errs; err != nil {
+		t.Fatalf("Put during backup failed: %v", err)
+	}
+
+	cfg := *db.config
+	cfg.SSTable.SstableDirectory = filepath.Join(t.TempDir(), "sstable")
+	cfg.Blob.Directory = filepath.Join(t.TempDir(), "blob")
+	cfg.Wal.WalDirectory = filepath.Join(t.TempDir(), "wal")
+	cfg.Compression.DictionaryDir = filepath.Join(t.TempDir(), "compression.db")
+	if _, err := Restore(filepath.Join(backups, "4"), &cfg); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	restored, err := NewDatabase(&cfg, "root")
+	if err != nil {
+		t.Fatalf("Failed to open restored database: %v", err)
+	}
+	defer restored.Close()
+	if value, found, err := restored.Get("key0000"); err != nil || !found || len(value) != 200 {
+		t.Errorf("Get key0000 after restore = %d bytes, %v, %v", len(value), found, err)
+	}
+}
+
+func TestDatabase_WALCheckpoint(t *testing.T) {
+	db, cleanup := createTestDatabase(t)
+	defer cleanup()
+
+	// Memtable-ovi se pune dok poslednji ne bude pun, tada se najstariji flush-uje i WAL dobija checkpoint
+	n := db.config.Memtable.NumberOfMemtables*db.config.Memtable.NumberOfEntries + 5
+	for i := 0; i < n; i++ {
+		if err := db.Put(fmt.Sprintf("key%03d", i), []byte(fmt.Sprintf("value%d", i))); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	checkpoint := db.wal.CheckpointPosition()
+	if checkpoint.Segment == 0 {
+		t.Fatal("Expected a WAL checkpoint after the flush")
+	}
+	if start, ok := db.memtables.WALStart(0); !ok || start.Before(checkpoint) {
+		t.Errorf("Memtables start at %s, before checkpoint %s", start, checkpoint)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	reopened, err := NewDatabase(db.config, "root")
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer reopened.Close()
+	if got := reopened.wal.CheckpointPosition(); got != checkpoint {
+		t.Fatalf("Expected checkpoint %s after restart, got %s", checkpoint, got)
+	}
+	// Flush-ovani kljucevi se ne citaju ponovo iz WAL-a, a svi su i dalje dostupni
+	if _, found := reopened.memtables.Search([]byte("key000")); found {
+		t.Error("Flushed key key000 was replayed from the WAL")
+	}
+	if _, found := reopened.memtables.Search([]byte(fmt.Sprintf("key%03d", n-1))); !found {
+		t.Errorf("Key key%03d was not replayed from the WAL", n-1)
+	}
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("key%03d", i)
+		value, found, err := reopened.Get(key)
+		if err != nil || !found || string(value) != fmt.Sprintf("value%d", i) {
+			t.Errorf("Get %s after restart = %q, %v, %v", key, value, found, err)
+		}
+	}
+}
+
+// Ovaj test vise puta zatvara (ili "obara") i ponovo otvara bazu dok se kljucevi upisuju i brisu
+// Posle svakog otvaranja svi kljucevi moraju imati poslednju upisanu vrednost, a obrisani kljucevi ne smeju da se vrate
+func TestDatabase_RestartCycles(t *testing.T) {
+	for _, useCompression := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compression=%v", useCompression), func(t *testing.T) {
+			dir := t.TempDir()
+			cfg, err := config.LoadConfigFile("../config/config.json")
+			if err != nil {
+				t.Fatalf("Failed to load config: %v", err)
+			}
+			cfg.Wal.WalDirectory = filepath.Join(dir, "wal")
+			cfg.SSTable.SstableDirectory = filepath.Join(dir, "sstable")
+			cfg.Blob.Directory = filepath.Join(dir, "blob")
+			cfg.Compression.DictionaryDir = filepath.Join(dir, "compression.db")
+			cfg.SSTable.UseCompression = useCompression
+			cfg.Memtable.NumberOfMemtables = 2
+			cfg.Memtable.NumberOfEntries = 10
+			// Cesta kompakcija, da bi tombstone-ovi prolazili kroz sve nivoe
+			cfg.LSMTree.MaxTablesPerLevel = 2
+
+			rng := rand.New(rand.NewSource(42))
+			model := make(map[string]string)
+			for cycle := 0; cycle < 20; cycle++ {
+				db, err := NewDatabase(cfg, "root")
+				if err != nil {
+					t.Fatalf("cycle %d: failed to open database: %v", cycle, err)
+				}
+				for key, want := range model {
+					value, found, err := db.Get(key)
+					if err != nil || !found || string(value) != want {
+						t.Fatalf("cycle %d: Get %s = %q, %v, %v; want %q", cycle, key, value, found, err, want)
+					}
+				}
+				for i := 0; i < 30; i++ {
+					key := fmt.Sprintf("key%02d", rng.Intn(30))
+					if _, found, err := db.Get(key); err != nil {
+						t.Fatalf("cycle %d: Get %s failed: %v", cycle, key, err)
+					} else if _, ok := model[key]; found != ok {
+						t.Fatalf("cycle %d: Get %s found = %v, want %v", cycle, key, found, ok)
+					}
+					if rng.Intn(4) == 0 {
+						if err := db.Delete(key); err != nil {
+							t.Fatalf("cycle %d: Delete %s failed: %v", cycle, key, err)
+						}
+						delete(model, key)
+						continue
+					}
+					value := fmt.Sprintf("value-%d-%d", cycle, i)
+					if err := db.Put(key, []byte(value)); err != nil {
+						t.Fatalf("cycle %d: Put %s failed: %v", cycle, key, err)
+					}
+					model[key] = value
+				}
+				if cycle%2 == 0 {
+					if err := db.Close(); err != nil {
+						t.Fatalf("cycle %d: Close failed: %v", cycle, err)
+					}
+				} else {
+					// Pad: ne zatvaramo bazu, samo oslobadjamo fajl WAL-a (zapisi su vec na disku, sync_mode je "always")
+					db.wal.Close()
+				}
+			}
+
+			db, err := NewDatabase(cfg, "root")
+			if err != nil {
+				t.Fatalf("Failed to open database: %v", err)
+			}
+			defer db.Close()
+			for i := 0; i < 30; i++ {
+				key := fmt.Sprintf("key%02d", i)
+				value, found, err := db.Get(key)
+				want, ok := model[key]
+				if err != nil || found != ok || string(value) != want {
+					t.Errorf("Get %s = %q, %v, %v; want %q, %v", key, value, found, err, want, ok)
+				}
+			}
+		})
+	}
+}
+
+// Ovaj test proverava da posle ponovnog otvaranja flush ne pregazi postojeci SSTable
+func TestDatabase_RestartKeepsGenerations(t *testing.T) {
+	db, cleanup := createTestDatabase(t)
+	defer cleanup()
+	if err := db.Put("first", []byte("1")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	reopened, err := NewDatabase(db.config, "root")
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer reopened.Close()
+	if reopened.memtables.GenToFlush == 1 {
+		t.Fatal("Generation counter was not restored after restart")
+	}
+	if err := reopened.Put("second", []byte("2")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := reopened.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	for key, want := range map[string]string{"first": "1", "second": "2"} {
+		value, found, err := reopened.Get(key)
+		if err != nil || !found || string(value) != want {
+			t.Errorf("Get %s = %q, %v, %v; want %q", key, value, found, err, want)
+		}
+	}
+}
+
+// Ovaj test proverava ucitavanje WAL-a koji ne staje u Memtable-ove (npr. posle smanjenja Memtable-a u konfiguraciji)
+// Flush tokom ucitavanja ne sme da pomeri checkpoint iza zapisa koji jos nisu ucitani
+func TestDatabase_RestartReplayFlush(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := config.LoadConfigFile("../config/config.json")
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	cfg.Wal.WalDirectory = filepath.Join(dir, "wal")
+	cfg.SSTable.SstableDirectory = filepath.Join(dir, "sstable")
+	cfg.Blob.Directory = filepath.Join(dir, "blob")
+	cfg.Compression.DictionaryDir = filepath.Join(dir, "compression.db")
+	cfg.Memtable.NumberOfMemtables = 1
+	cfg.Memtable.NumberOfEntries = 100
+
+	db, err := NewDatabase(cfg, "root")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	for i := 0; i < 35; i++ {
+		if err := db.Put(fmt.Sprintf("key%02d", i), []byte(fmt.Sprintf("value%d", i))); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	db.wal.Close() // Pad bez flush-a
+
+	cfg.Memtable.NumberOfEntries = 10
+	for restart := 0; restart < 2; restart++ {
+		db, err = NewDatabase(cfg, "root")
+		if err != nil {
+			t.Fatalf("restart %d: failed to open database: %v", restart, err)
+		}
+		for i := 0; i < 35; i++ {
+			key := fmt.Sprintf("key%02d", i)
+			value, found, err := db.Get(key)
+			if err != nil || !found || string(value) != fmt.Sprintf("value%d", i) {
+				t.Errorf("restart %d: Get %s = %q, %v, %v", restart, key, value, found, err)
+			}
+		}
+		db.wal.Close()
+	}
+}
+
+// Ovaj test proverava da noviji upis pobedjuje i kad oba upisa imaju isti timestamp,
+// i da se sekvencni brojevi nastavljaju posle restarta kad je WAL vec obrisan checkpoint-om
+func TestDatabase_SequenceOrdering(t *testing.T) {
+	db, cleanup := createTestDatabase(t)
+	defer cleanup()
+
+	// Upisi u istoj sekundi, zapis iz starijeg SSTable-a ne sme da pregazi noviji
+	if err := db.Put("key", []byte("old")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if err := db.Put("key", []byte("new")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if err := db.CompactRange("", ""); err != nil {
+		t.Fatalf("CompactRange failed: %v", err)
+	}
+	if value, found, err := db.Get("key"); err != nil || !found || string(value) != "new" {
+		t.Fatalf("Get key = %q, %v, %v; want %q", value, found, err, "new")
+	}
+	last := db.wal.LastSequence()
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	reopened, err := NewDatabase(db.config, "root")
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer reopened.Close()
+	if got := reopened.wal.LastSequence(); got < last {
+		t.Fatalf("Sequence went back after restart: %d < %d", got, last)
+	}
+	if err := reopened.Delete("key"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := reopened.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if _, found, err := reopened.Get("key"); err != nil || found {
+		t.Fatalf("Get key after delete = %v, %v", found, err)
+	}
+}
+
+func TestDatabase_LargeKeysAndValues(t *testing.T) {
+	db, cleanup := createTestDatabase(t)
+	defer cleanup()
+
+	// Kljucevi i vrednosti duzi od 255 bajtova, i vrednost veca od mnogo blokova
+	want := map[string][]byte{
+		strings.Repeat("k", 300):        bytes.Repeat([]byte("v"), 300),
+		strings.Repeat("l", 1000) + "a": bytes.Repeat([]byte("w"), 100*1024),
+		strings.Repeat("l", 1000) + "b": bytes.Repeat([]byte("x"), 20*1024*1024),
+		"small":                         []byte("value"),
+	}
+	for key, value := range want {
+		if err := db.Put(key, value); err != nil {
+			t.Fatalf("Put %d byte key failed: %v", len(key), err)
+		}
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if err := db.Put("small", []byte("newer")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if err := db.CompactRange("", ""); err != nil {
+		t.Fatalf("CompactRange failed: %v", err)
+	}
+	want["small"] = []byte("newer")
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	reopened, err := NewDatabase(db.config, "root")
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer reopened.Close()
+	for key, value := range want {
+		got, found, err := reopened.Get(key)
+		if err != nil || !found || !bytes.Equal(got, value) {
+			t.Errorf("Get %d byte key = %d bytes, %v, %v; want %d bytes", len(key), len(got), found, err, len(value))
+		}
+	}
+
+	reopened.config.Limits.MaxKeySize = 10
+	reopened.config.Limits.MaxValueSize = 100
+	if err := reopened.Put(strings.Repeat("k", 11), []byte("v")); err == nil || !strings.Contains(err.Error(), "key is too large") {
+		t.Errorf("Put with too large key = %v, want key size error", err)
+	}
+	if err := reopened.Put("key", make([]byte, 101)); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("Put with too large value = %v, want value size error", err)
+	}
+	if err := reopened.Put("key", make([]byte, 100)); err != nil {
+		t.Errorf("Put at the size limit failed: %v", err)
+	}
+	walBefore := reopened.wal.Position()
+	if err := reopened.Delete(strings.Repeat("k", 11)); err == nil || !strings.Contains(err.Error(), "key is too large") {
+		t.Errorf("Delete with too large key = %v, want key size error", err)
+	}
+	if walAfter := reopened.wal.Position(); walAfter != walBefore {
+		t.Errorf("Delete with too large key wrote to the WAL: %s -> %s", walBefore, walAfter)
+	}
+	if err := reopened.Delete("key"); err != nil {
+		t.Errorf("Delete at the key size limit failed: %v", err)
+	}
+}
+
+func TestDatabase_BlobValues(t *testing.T) {
+	db, cleanup := createTestDatabase(t)
+	defer cleanup()
+	db.config.Blob.ValueThreshold = 1000
+	db.config.Blob.GCRatio = 0.5
+
+	want := make(map[string][]byte)
+	for i := 0; i < 6; i++ {
+		key := fmt.Sprintf("doc%d", i)
+		want[key] = bytes.Repeat([]byte{byte('a' + i)}, 5000+i)
+	}
+	want["small"] = []byte("inline")
+	for key, value := range want {
+		if err := db.Put(key, value); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if stats.BlobFiles != 1 {
+		t.Fatalf("BlobFiles = %d, want 1", stats.BlobFiles)
+	}
+	// U SSTable-u su samo pokazivaci, pa je manji od izdvojenih vrednosti
+	if size := stats.Levels[0].Size; size >= stats.BlobBytes {
+		t.Errorf("SSTable size %d, want less than blob size %d", size, stats.BlobBytes)
+	}
+
+	// Prepisujemo i brisemo vise od pola vrednosti iz prvog blob fajla
+	for i := 0; i < 3; i++ {
+		key := fmt.Sprintf("doc%d", i)
+		want[key] = bytes.Repeat([]byte{byte('A' + i)}, 6000)
+		if err := db.Put(key, want[key]); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	if err := db.Delete("doc3"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	delete(want, "doc3")
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if err := db.CompactRange("", ""); err != nil {
+		t.Fatalf("CompactRange failed: %v", err)
+	}
+
+	check := func(db *Database) {
+		t.Helper()
+		for key, value := range want {
+			got, found, err := db.get(key)
+			if err != nil || !found || !bytes.Equal(got, value) {
+				t.Errorf("get(%q) = %d bytes, %v, %v; want %d bytes", key, len(got), found, err, len(value))
+			}
+		}
+		if _, found, err := db.get("doc3"); found || err != nil {
+			t.Errorf("get(doc3) = %v, %v; want deleted", found, err)
+		}
+		entries := db.PrefixScan("doc", 0, 10, false)
+		if len(entries) != 6 {
+			t.Fatalf("PrefixScan returned %d entries, want 6", len(entries))
+		}
+		for _, entry := range entries {
+			if value, ok := want[string(entry.Key)]; ok && !bytes.Equal(entry.Value, value) {
+				t.Errorf("PrefixScan %q = %d bytes, want %d bytes", entry.Key, len(entry.Value), len(value))
+			}
+		}
+	}
+	check(db)
+
+	gc, err := db.CollectBlobGarbage()
+	if err != nil {
+		t.Fatalf("CollectBlobGarbage failed: %v", err)
+	}
+	if gc.Files != 2 || gc.Removed != 1 || gc.Rewritten != 2 || gc.Reclaimed <= 0 {
+		t.Errorf("CollectBlobGarbage = %+v, want 2 files, 1 removed, 2 rewritten", *gc)
+	}
+	// Zive vrednosti su u Memtable-u dok se ne flush-uju u novi blob fajl
+	check(db)
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	check(db)
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	reopened, err := NewDatabase(db.config, "root")
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer reopened.Close()
+	check(reopened)
+}
+
+// Put i Delete koji stignu izmedju GC-ove provere da je vrednost ziva i njenog ponovnog upisa ne smeju biti pregazeni
+func TestDatabase_BlobGCConcurrentPut(t *testing.T) {
+	db, cleanup := createTestDatabase(t)
+	defer cleanup()
+	db.config.Blob.ValueThreshold = 1000
+
+	for i := 0; i < 4; i++ {
+		if err := db.Put(fmt.Sprintf("doc%d", i), bytes.Repeat([]byte{byte('a' + i)}, 2000)); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	ids, err := blob.Files(db.config.Blob.Directory)
+	if err != nil || len(ids) != 1 {
+		t.Fatalf("blob.Files = %v, %v; want one file", ids, err)
+	}
+
+	// GC je video zive vrednosti, a pre ponovnog upisa stizu Put u doc0 i Delete doc1
+	var live []blob.Record
+	err = blob.Scan(db.config.Blob.Directory, ids[0], func(r blob.Record) error {
+		ok, err := db.blobLive(r)
+		if ok {
+			live = append(live, blob.Record{Key: append([]byte(nil), r.Key...), Value: append([]byte(nil), r.Value...), Pointer: r.Pointer})
+		}
+		return err
+	})
+	if err != nil || len(live) != 4 {
+		t.Fatalf("found %d live blob records, %v; want 4", len(live), err)
+	}
+	if err := db.Put("doc0", []byte("newer")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := db.Delete("doc1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	rewritten := 0
+	for _, r := range live {
+		ok, err := db.rewriteBlob(r)
+		if err != nil {
+			t.Fatalf("rewriteBlob(%s) failed: %v", r.Key, err)
+		}
+		if ok {
+			rewritten++
+		}
+	}
+	if rewritten != 2 {
+		t.Errorf("rewrote %d values, want 2 (doc2 and doc3)", rewritten)
+	}
+	if value, found, err := db.get("doc0"); err != nil || string(value) != "newer" {
+		t.Errorf("get(doc0) = %d bytes, %v, %v; want newer", len(value), found, err)
+	}
+	if _, found, err := db.get("doc1"); err != nil || found {
+		t.Errorf("get(doc1) = %v, %v; want deleted", found, err)
+	}
+	for i := 2; i < 4; i++ {
+		key := fmt.Sprintf("doc%d", i)
+		if value, _, err := db.get(key); err != nil || !bytes.Equal(value, bytes.Repeat([]byte{byte('a' + i)}, 2000)) {
+			t.Errorf("get(%s) = %d bytes, %v; want the rewritten value", key, len(value), err)
+		}
+	}
+
+	// Ceo GC dok paralelno stizu upisi istih kljuceva
+	errs := make(chan error, 1)
+	go func() {
+		_, err := db.CollectBlobGarbage()
+		errs <- err
+	}()
+	for i := 0; i < 4; i++ {
+		if err := db.Put(fmt.Sprintf("doc%d", i), []byte("latest")); err != nil {
+			t.Fatalf("Put during blob gc failed: %v", err)
+		}
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("CollectBlobGarbage failed: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		if value, _, err := db.get(fmt.Sprintf("doc%d", i)); err != nil || string(value) != "latest" {
+			t.Errorf("get(doc%d) = %d bytes, %v; want latest", i, len(value), err)
+		}
+	}
+}
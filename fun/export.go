@@ -0,0 +1,336 @@
+package fun
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/iigor000/database/structures/adapter"
+	"github.com/iigor000/database/structures/lsmtree"
+	"github.com/iigor000/database/util"
+)
+
+// Formati za izvoz i uvoz podataka
+const (
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+)
+
+// Vrednost polja encoding kada su kljuc i vrednost zapisani u base64
+const encodingBase64 = "base64"
+
+// Podrazumevan broj zapisa u jednoj seriji pri uvozu
+const defaultImportBatchSize = 100
+
+// exportRecord je jedan red izvoza
+// Ako kljuc ili vrednost nisu validan UTF-8, oba se zapisuju u base64 i Encoding je "base64"
+type exportRecord struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+func encodeRecord(key, value []byte) exportRecord {
+	if utf8.Valid(key) && utf8.Valid(value) {
+		return exportRecord{Key: string(key), Value: string(value)}
+	}
+	return exportRecord{
+		Key:      base64.StdEncoding.EncodeToString(key),
+		Value:    base64.StdEncoding.EncodeToString(value),
+		Encoding: encodingBase64,
+	}
+}
+
+func (r exportRecord) decode() (string, []byte, error) {
+	switch r.Encoding {
+	case "":
+		return r.Key, []byte(r.Value), nil
+	case encodingBase64:
+		key, err := base64.StdEncoding.DecodeString(r.Key)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid base64 key: %w", err)
+		}
+		value, err := base64.StdEncoding.DecodeString(r.Value)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid base64 value: %w", err)
+		}
+		return string(key), value, nil
+	default:
+		return "", nil, fmt.Errorf("unknown encoding %q", r.Encoding)
+	}
+}
+
+// Export upisuje u w sve zive korisnicke kljuceve u rastucem redosledu, u formatu jsonl ili csv
+// Rezervisani kljucevi (token bucket, probabilisticke strukture) i obrisani kljucevi se preskacu
+// Vraca broj izvezenih zapisa
+func (db *Database) Export(w io.Writer, format string) (int, error) {
+	if format != FormatJSONL && format != FormatCSV {
+		return 0, fmt.Errorf("unknown export format %q", format)
+	}
+	allow, err := CheckBucket(db)
+	if err != nil {
+		return 0, err
+	}
+	if !allow {
+		return 0, errors.New("user has reached the rate limit")
+	}
+
+	bw := bufio.NewWriter(w)
+	var cw *csv.Writer
+	enc := json.NewEncoder(bw)
+	if format == FormatCSV {
+		cw = csv.NewWriter(bw)
+		if err := cw.Write([]string{"key", "value", "encoding"}); err != nil {
+			return 0, fmt.Errorf("failed to write csv header: %w", err)
+		}
+	}
+
+	count := 0
+	err = db.scanAll(func(key, value []byte) error {
+		if util.CheckKeyReserved(string(key)) {
+			return nil
+		}
+		rec := encodeRecord(key, value)
+		if cw != nil {
+			if err := cw.Write([]string{rec.Key, rec.Value, rec.Encoding}); err != nil {
+				return err
+			}
+		} else if err := enc.Encode(rec); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return count, fmt.Errorf("export failed: %w", err)
+	}
+	if cw != nil {
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return count, fmt.Errorf("export failed: %w", err)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return count, fmt.Errorf("export failed: %w", err)
+	}
+	return count, nil
+}
+
+// scanAll prolazi kroz sve kljuceve baze u rastucem redosledu i za svaki zivi kljuc poziva fn
+// Memtable-ovi su noviji od svih SSTable-ova, pa njihov zapis (i tombstone) sakriva zapis sa diska
+func (db *Database) scanAll(fn func(key, value []byte) error) error {
+	// Najnoviji zapis svakog kljuca iz Memtable-ova, ukljucujuci tombstone-ove
+	latest := make(map[string]*adapter.MemtableEntry)
+	db.mu.Lock()
+	for i := 0; i < db.memtables.NumberOfMemtables; i++ {
+		m := db.memtables.Memtables[i]
+		for _, key := range m.Keys {
+			entry, found := m.Search(key)
+			if !found {
+				continue
+			}
+			// Pobedjuje zapis sa vecim sekvencnim brojem
+			if prev, ok := latest[string(key)]; ok && prev.Seq > entry.Seq {
+				continue
+			}
+			latest[string(key)] = entry
+		}
+	}
+	db.mu.Unlock()
+	memEntries := make([]*adapter.MemtableEntry, 0, len(latest))
+	for _, entry := range latest {
+		memEntries = append(memEntries, entry)
+	}
+	sort.Slice(memEntries, func(i, j int) bool {
+		return bytes.Compare(memEntries[i].Key, memEntries[j].Key) < 0
+	})
+
+	tables, release, err := lsmtree.OpenTables(db.versions, db.compression, db.CacheBlockManager)
+	if err != nil {
+		return err
+	}
+	defer release()
+	var next func() *adapter.MemtableEntry
+	if it := lsmtree.NewLSMTreeIterator(tables, db.CacheBlockManager); it != nil {
+		next = it.Next
+	} else {
+		next = func() *adapter.MemtableEntry { return nil }
+	}
+
+	// Vrednost izdvojena u blob fajl se cita samo za zapis sa diska koji nije sakriven novijim iz Memtable-a
+	emit := func(entry *adapter.MemtableEntry) error {
+		value, err := db.resolve(entry.Key, entry.Value, entry.Blob)
+		if err != nil {
+			return err
+		}
+		return fn(entry.Key, value)
+	}
+
+	disk := next()
+	for _, entry := range memEntries {
+		for disk != nil && bytes.Compare(disk.Key, entry.Key) < 0 {
+			if err := emit(disk); err != nil {
+				return err
+			}
+			disk = next()
+		}
+		if disk != nil && bytes.Equal(disk.Key, entry.Key) {
+			disk = next() // Zapis iz Memtable-a je noviji
+		}
+		if entry.Tombstone {
+			continue
+		}
+		if err := fn(entry.Key, entry.Value); err != nil {
+			return err
+		}
+	}
+	for ; disk != nil; disk = next() {
+		if err := emit(disk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImportOptions podesava Database.Import
+type ImportOptions struct {
+	BatchSize int // Broj zapisa u jednoj seriji, podrazumevano 100
+	// BypassTokenBucket preskace token bucket, dozvoljeno samo root korisniku
+	BypassTokenBucket bool
+	// Progress se poziva posle svake upisane serije sa ukupnim brojem uvezenih zapisa
+	Progress func(imported int)
+}
+
+// Import ucitava zapise iz r (format jsonl ili csv, kao sto ih pravi Export) i upisuje ih u serijama
+// Svaka serija se prvo cela proveri (format, rezervisani kljucevi, velicine), pa se upise pod jednim db.mu,
+// tako da je drugi citaoci vide celu ili nikako, a sa sync_mode=always se ceka samo jedan fsync WAL-a
+// Bez BypassTokenBucket serija unapred trosi po jedan token za svaki zapis, kao i Put,
+// pa serija za koju nema dovoljno tokena nije ni upisana ni naplacena
+// Vraca broj uvezenih zapisa, zapisi iz serija pre greske ostaju upisani
+func (db *Database) Import(r io.Reader, format string, opts ImportOptions) (int, error) {
+	if opts.BypassTokenBucket && db.username != "root" {
+		return 0, errors.New("only root can bypass the token bucket")
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultImportBatchSize
+	}
+
+	var read func() (exportRecord, error)
+	switch format {
+	case FormatJSONL:
+		dec := json.NewDecoder(r)
+		dec.DisallowUnknownFields()
+		read = func() (exportRecord, error) {
+			var rec exportRecord
+			err := dec.Decode(&rec)
+			return rec, err
+		}
+	case FormatCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		first := true
+		read = func() (exportRecord, error) {
+			for {
+				row, err := cr.Read()
+				if err != nil {
+					return exportRecord{}, err
+				}
+				if first {
+					first = false
+					if len(row) >= 2 && row[0] == "key" && row[1] == "value" {
+						continue // Zaglavlje
+					}
+				}
+				if len(row) < 2 || len(row) > 3 {
+					line, _ := cr.FieldPos(0)
+					return exportRecord{}, fmt.Errorf("line %d: expected key,value[,encoding], got %d fields", line, len(row))
+				}
+				rec := exportRecord{Key: row[0], Value: row[1]}
+				if len(row) == 3 {
+					rec.Encoding = row[2]
+				}
+				return rec, nil
+			}
+		}
+	default:
+		return 0, fmt.Errorf("unknown import format %q", format)
+	}
+
+	type pair struct {
+		key   string
+		value []byte
+	}
+	imported := 0
+	batch := make([]pair, 0, opts.BatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if !opts.BypassTokenBucket {
+			allow, err := CheckBucketN(db, len(batch))
+			if err != nil {
+				return err
+			}
+			if !allow {
+				return errors.New("user has reached the rate limit")
+			}
+		}
+		var last uint64
+		db.mu.Lock()
+		for _, p := range batch {
+			n, err := db.putLocked(p.key, p.value)
+			if err != nil {
+				db.mu.Unlock()
+				return err
+			}
+			last = n
+			imported++
+		}
+		db.mu.Unlock()
+		if err := db.wal.WaitDurable(last); err != nil {
+			return fmt.Errorf("failed to sync write-ahead log: %w", err)
+		}
+		batch = batch[:0]
+		if opts.Progress != nil {
+			opts.Progress(imported)
+		}
+		return nil
+	}
+
+	for n := 1; ; n++ {
+		rec, err := read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return imported, fmt.Errorf("import failed at record %d: %w", n, err)
+		}
+		key, value, err := rec.decode()
+		if err != nil {
+			return imported, fmt.Errorf("import failed at record %d: %w", n, err)
+		}
+		if util.CheckKeyReserved(key) {
+			return imported, fmt.Errorf("import failed at record %d: key is reserved: %s", n, key)
+		}
+		if err := db.checkSize(key, value); err != nil {
+			return imported, fmt.Errorf("import failed at record %d: %w", n, err)
+		}
+		batch = append(batch, pair{key: key, value: value})
+		if len(batch) == opts.BatchSize {
+			if err := flush(); err != nil {
+				return imported, fmt.Errorf("import failed: %w", err)
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return imported, fmt.Errorf("import failed: %w", err)
+	}
+	return imported, nil
+}
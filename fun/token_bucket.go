@@ -46,6 +46,12 @@ func CreateBucket(db *Database) error {
 
 // Proverava da li korisnik ima validan token
 func CheckBucket(db *Database) (bool, error) {
+	return CheckBucketN(db, 1)
+}
+
+// CheckBucketN proverava da li korisnik ima n tokena za n upisa odjednom
+// Naplacuje se ili svih n tokena ili nijedan, pa upis za koji nema dovoljno tokena nije ni naplacen
+func CheckBucketN(db *Database, n int) (bool, error) {
 	if db.username == "root" {
 		return true, nil
 	}
@@ -73,9 +79,9 @@ func CheckBucket(db *Database) (bool, error) {
 	currentTime := time.Now().Unix()
 	bucketTime := int64(bucket["timestamp"].(float64))
 
-	// Ako ima vise od 0 tokena, smanjujemo broj tokena
-	if tokens > 0 {
-		bucket["tokens"] = tokens - 1
+	// Ako ima dovoljno tokena, smanjujemo broj tokena
+	if tokens >= float64(n) {
+		bucket["tokens"] = tokens - float64(n)
 		newData, err := json.Marshal(bucket)
 		if err != nil {
 			return false, err
@@ -89,8 +95,9 @@ func CheckBucket(db *Database) (bool, error) {
 	}
 
 	// Ako nema tokena, gledamo da li je proslo vreme, pa ako jeste dopunjavamo ih
-	if currentTime-bucketTime > int64(db.config.TokenBucket.RefillIntervalS) {
-		bucket["tokens"] = db.config.TokenBucket.StartTokens
+	// Upis koji dopuni baket se ne naplacuje, pa se od novih tokena oduzima samo ostalih n-1
+	if currentTime-bucketTime > int64(db.config.TokenBucket.RefillIntervalS) && db.config.TokenBucket.StartTokens >= n-1 {
+		bucket["tokens"] = db.config.TokenBucket.StartTokens - (n - 1)
 		bucket["timestamp"] = currentTime
 		newData, err := json.Marshal(bucket)
 		if err != nil {
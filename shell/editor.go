@@ -0,0 +1,263 @@
+package shell
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrInterrupt se vraca kada korisnik pritisne Ctrl-C, trenutni unos se odbacuje
+var ErrInterrupt = errors.New("interrupted")
+
+// lineReader cita jednu liniju unosa sa datim promptom
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+// plainReader cita linije bez editovanja, koristi se kada ulaz nije terminal (npr. pipe ili fajl)
+type plainReader struct {
+	reader *bufio.Reader
+	out    io.Writer
+}
+
+func (p *plainReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(p.out, prompt)
+	line, err := p.reader.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && line != "" {
+			return strings.TrimRight(line, "\r\n"), nil
+		}
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// completer vraca indeks od kog pocinje rec koja se dopunjava i moguce dopune te reci
+type completer func(before string) (int, []string)
+
+// editor je jednostavan editor linije za terminal u raw modu
+// Podrzava pomeranje kursora, istoriju (strelice gore/dole) i dopunjavanje (Tab)
+type editor struct {
+	fd       int
+	reader   *bufio.Reader
+	out      io.Writer
+	history  *History
+	complete completer
+}
+
+func newEditor(in *os.File, out io.Writer, history *History, complete completer) *editor {
+	return &editor{
+		fd:       int(in.Fd()),
+		reader:   bufio.NewReader(in),
+		out:      out,
+		history:  history,
+		complete: complete,
+	}
+}
+
+func (e *editor) ReadLine(prompt string) (string, error) {
+	state, err := makeRaw(e.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restoreTerminal(e.fd, state)
+
+	var buf []rune
+	pos := 0
+	histIndex := e.history.Len()
+	pending := "" // Linija koju je korisnik kucao pre nego sto je krenuo kroz istoriju
+
+	refresh := func() {
+		fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(buf))
+		if back := len(buf) - pos; back > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", back)
+		}
+	}
+	setLine := func(s string) {
+		buf = []rune(s)
+		pos = len(buf)
+		refresh()
+	}
+
+	fmt.Fprint(e.out, prompt)
+	for {
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(buf), nil
+		case 3: // Ctrl-C
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", ErrInterrupt
+		case 4: // Ctrl-D
+			if len(buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+				refresh()
+			}
+		case 127, 8: // Backspace
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+				refresh()
+			}
+		case 1: // Ctrl-A
+			pos = 0
+			refresh()
+		case 5: // Ctrl-E
+			pos = len(buf)
+			refresh()
+		case 11: // Ctrl-K
+			buf = buf[:pos]
+			refresh()
+		case 21: // Ctrl-U
+			buf = buf[pos:]
+			pos = 0
+			refresh()
+		case 23: // Ctrl-W
+			start := pos
+			for start > 0 && buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && buf[start-1] != ' ' {
+				start--
+			}
+			buf = append(buf[:start], buf[pos:]...)
+			pos = start
+			refresh()
+		case 12: // Ctrl-L
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+			refresh()
+		case '\t':
+			e.completeLine(prompt, &buf, &pos)
+			refresh()
+		case 27: // Escape sekvence (strelice, Home, End, Delete)
+			seq := e.readEscape()
+			switch seq {
+			case "[A": // Gore
+				if histIndex > 0 {
+					if histIndex == e.history.Len() {
+						pending = string(buf)
+					}
+					histIndex--
+					setLine(e.history.Get(histIndex))
+				}
+			case "[B": // Dole
+				if histIndex < e.history.Len() {
+					histIndex++
+					if histIndex == e.history.Len() {
+						setLine(pending)
+					} else {
+						setLine(e.history.Get(histIndex))
+					}
+				}
+			case "[C": // Desno
+				if pos < len(buf) {
+					pos++
+					refresh()
+				}
+			case "[D": // Levo
+				if pos > 0 {
+					pos--
+					refresh()
+				}
+			case "[H", "OH", "[1~":
+				pos = 0
+				refresh()
+			case "[F", "OF", "[4~":
+				pos = len(buf)
+				refresh()
+			case "[3~": // Delete
+				if pos < len(buf) {
+					buf = append(buf[:pos], buf[pos+1:]...)
+					refresh()
+				}
+			}
+		default:
+			if r < 32 {
+				continue // Ostale kontrolne karaktere ignorisemo
+			}
+			buf = append(buf[:pos], append([]rune{r}, buf[pos:]...)...)
+			pos++
+			refresh()
+		}
+	}
+}
+
+// readEscape cita ostatak escape sekvence posle ESC karaktera
+func (e *editor) readEscape() string {
+	first, _, err := e.reader.ReadRune()
+	if err != nil {
+		return ""
+	}
+	seq := string(first)
+	if first != '[' && first != 'O' {
+		return seq
+	}
+	for {
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			return seq
+		}
+		seq += string(r)
+		// Sekvenca se zavrsava slovom ili '~'
+		if (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') || r == '~' {
+			return seq
+		}
+	}
+}
+
+// completeLine dopunjava rec ispred kursora
+// Ako postoji jedna dopuna ona se upisuje, ako ih ima vise upisuje se zajednicki prefiks,
+// a ako nema napretka ispisuju se sve moguce dopune
+func (e *editor) completeLine(prompt string, buf *[]rune, pos *int) {
+	if e.complete == nil {
+		return
+	}
+	before := string((*buf)[:*pos])
+	start, candidates := e.complete(before)
+	if len(candidates) == 0 {
+		return
+	}
+	startRune := len([]rune(before[:start]))
+	word := []rune(before[start:])
+
+	replacement := candidates[0]
+	if len(candidates) == 1 {
+		replacement += " "
+	} else {
+		replacement = commonPrefix(candidates)
+		if len([]rune(replacement)) <= len(word) {
+			fmt.Fprint(e.out, "\r\n"+strings.Join(candidates, "  ")+"\r\n")
+			return
+		}
+	}
+
+	rest := append([]rune{}, (*buf)[*pos:]...)
+	newBuf := append(append([]rune{}, (*buf)[:startRune]...), []rune(replacement)...)
+	*pos = len(newBuf)
+	*buf = append(newBuf, rest...)
+}
+
+func commonPrefix(words []string) string {
+	if len(words) == 0 {
+		return ""
+	}
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
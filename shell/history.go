@@ -0,0 +1,140 @@
+package shell
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// History cuva prethodno unete komande i perzistira ih u fajl
+// Svaka komanda se cuva u jednoj liniji, komande sa vise linija se cuvaju
+// sa escape-ovanim novim redom (\n), a '\' se cuva kao "\\"
+type History struct {
+	path    string
+	maxSize int
+	entries []string
+}
+
+// LoadHistory ucitava istoriju iz fajla, ako fajl ne postoji pocinje se sa praznom istorijom
+// Prazna putanja iskljucuje perzistiranje
+func LoadHistory(path string, maxSize int) (*History, error) {
+	if maxSize <= 0 {
+		maxSize = 500
+	}
+	h := &History{path: path, maxSize: maxSize}
+	if path == "" {
+		return h, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return h, nil
+		}
+		return nil, fmt.Errorf("error opening history file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			h.entries = append(h.entries, unescapeHistory(line))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading history file: %w", err)
+	}
+	h.trim()
+	return h, nil
+}
+
+// Add dodaje komandu na kraj istorije i upisuje je u fajl
+// Uzastopni duplikati i prazne komande se ne cuvaju
+func (h *History) Add(entry string) error {
+	if strings.TrimSpace(entry) == "" {
+		return nil
+	}
+	if len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry {
+		return nil
+	}
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > h.maxSize {
+		// Fajl prepisujemo samo kada istorija predje maksimalnu velicinu
+		h.trim()
+		return h.Save()
+	}
+	if h.path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return fmt.Errorf("error creating history directory: %w", err)
+	}
+	file, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening history file: %w", err)
+	}
+	defer file.Close()
+	_, err = file.WriteString(escapeHistory(entry) + "\n")
+	return err
+}
+
+// Save prepisuje ceo fajl istorije trenutnim sadrzajem
+func (h *History) Save() error {
+	if h.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return fmt.Errorf("error creating history directory: %w", err)
+	}
+	var b strings.Builder
+	for _, entry := range h.entries {
+		b.WriteString(escapeHistory(entry))
+		b.WriteByte('\n')
+	}
+	return os.WriteFile(h.path, []byte(b.String()), 0600)
+}
+
+// Len vraca broj komandi u istoriji
+func (h *History) Len() int {
+	return len(h.entries)
+}
+
+// Get vraca i-tu komandu (0 je najstarija)
+func (h *History) Get(i int) string {
+	if i < 0 || i >= len(h.entries) {
+		return ""
+	}
+	return h.entries[i]
+}
+
+func (h *History) trim() {
+	if len(h.entries) > h.maxSize {
+		h.entries = h.entries[len(h.entries)-h.maxSize:]
+	}
+}
+
+func escapeHistory(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
+
+func unescapeHistory(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			if s[i] == 'n' {
+				b.WriteByte('\n')
+			} else {
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
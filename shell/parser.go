@@ -0,0 +1,149 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrIncomplete oznacava da linija nije zavrsena (otvoren navodnik ili '\' na kraju)
+// i da je potrebno ucitati jos jednu liniju pre parsiranja
+var ErrIncomplete = errors.New("incomplete input")
+
+// Split deli liniju na argumente po uzoru na shell
+// Podrzani su dvostruki navodnici (sa escape sekvencama), jednostruki navodnici (bez escape-a)
+// i '\' van navodnika koji escape-uje sledeci karakter
+//
+//	put key "value with spaces"   -> [put key value with spaces]
+//	put key 'a "quoted" word'     -> [put key a "quoted" word]
+//	put key "line1\nline2"        -> [put key line1<LF>line2]
+func Split(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false // Da li smo zapoceli argument (potrebno za prazne argumente "")
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		case r == '\\':
+			if i+1 >= len(runes) {
+				return nil, ErrIncomplete // Nastavak u sledecoj liniji
+			}
+			i++
+			if runes[i] != '\n' { // "\<LF>" spaja linije
+				current.WriteRune(runes[i])
+				inArg = true
+			}
+		case r == '\'':
+			inArg = true
+			end := indexRune(runes, i+1, '\'')
+			if end == -1 {
+				return nil, ErrIncomplete
+			}
+			current.WriteString(string(runes[i+1 : end]))
+			i = end
+		case r == '"':
+			inArg = true
+			next, err := readDoubleQuoted(runes, i+1, &current)
+			if err != nil {
+				return nil, err
+			}
+			i = next
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// readDoubleQuoted cita sadrzaj izmedju dvostrukih navodnika i vraca indeks zatvarajuceg navodnika
+func readDoubleQuoted(runes []rune, start int, out *strings.Builder) (int, error) {
+	for i := start; i < len(runes); i++ {
+		r := runes[i]
+		if r == '"' {
+			return i, nil
+		}
+		if r != '\\' {
+			out.WriteRune(r)
+			continue
+		}
+		if i+1 >= len(runes) {
+			return 0, ErrIncomplete
+		}
+		i++
+		switch runes[i] {
+		case 'n':
+			out.WriteRune('\n')
+		case 't':
+			out.WriteRune('\t')
+		case 'r':
+			out.WriteRune('\r')
+		case '0':
+			out.WriteRune(0)
+		case '\\', '"', '\'':
+			out.WriteRune(runes[i])
+		case '\n':
+			// "\<LF>" unutar navodnika spaja linije bez novog reda
+		case 'x':
+			if i+2 >= len(runes) {
+				return 0, fmt.Errorf("invalid escape sequence \\x at position %d", i)
+			}
+			var b byte
+			if _, err := fmt.Sscanf(string(runes[i+1:i+3]), "%02x", &b); err != nil {
+				return 0, fmt.Errorf("invalid escape sequence \\x%s", string(runes[i+1:i+3]))
+			}
+			out.WriteByte(b)
+			i += 2
+		default:
+			return 0, fmt.Errorf("unknown escape sequence \\%c", runes[i])
+		}
+	}
+	return 0, ErrIncomplete
+}
+
+func indexRune(runes []rune, start int, r rune) int {
+	for i := start; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// Quote vraca argument u obliku koji Split vraca nepromenjen
+// Koristi se kod dopunjavanja kljuceva koji sadrze razmake ili specijalne karaktere
+func Quote(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\r\"'\\") {
+		return arg
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range arg {
+		switch r {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
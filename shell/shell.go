@@ -0,0 +1,286 @@
+package shell
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Command opisuje jednu komandu shell-a
+type Command struct {
+	Name        string                    // Ime komande
+	Args        string                    // Opis argumenata za help, npr. "<key> <value>"
+	Description string                    // Kratak opis komande
+	MinArgs     int                       // Minimalan broj argumenata
+	MaxArgs     int                       // Maksimalan broj argumenata, -1 znaci bez ogranicenja
+	KeyArgs     []int                     // Pozicije argumenata (od 1) koji su kljucevi i mogu da se dopune
+	Run         func(args []string) error // Funkcija koja izvrsava komandu
+}
+
+// Shell je interaktivni shell koji komande cita liniju po liniju
+// Argumenti se parsiraju funkcijom Split, pa vrednosti mogu da sadrze razmake, navodnike i nove redove
+type Shell struct {
+	commands map[string]*Command
+	order    []string
+	reader   lineReader
+	history  *History
+	out      io.Writer
+	stopped  bool
+
+	Prompt             string
+	ContinuationPrompt string
+	// KeyCompleter vraca kljuceve iz baze koji pocinju datim prefiksom
+	KeyCompleter func(prefix string) []string
+}
+
+// New kreira shell koji cita sa in i pise na out
+// Ako je in terminal, koristi se editor linije sa istorijom i dopunjavanjem, u suprotnom obicno citanje linija
+func New(in *os.File, out io.Writer, history *History) *Shell {
+	if history == nil {
+		history, _ = LoadHistory("", 0)
+	}
+	s := &Shell{
+		commands:           make(map[string]*Command),
+		history:            history,
+		out:                out,
+		Prompt:             "> ",
+		ContinuationPrompt: "... ",
+	}
+	if isTerminal(int(in.Fd())) {
+		s.reader = newEditor(in, out, history, s.complete)
+	} else {
+		s.reader = &plainReader{reader: bufio.NewReader(in), out: out}
+	}
+
+	s.Register(&Command{
+		Name:        "help",
+		Args:        "[command]",
+		Description: "Print commands",
+		MaxArgs:     1,
+		Run:         s.help,
+	})
+	return s
+}
+
+// Register dodaje komandu u shell
+func (s *Shell) Register(cmd *Command) {
+	name := strings.ToLower(cmd.Name)
+	if _, exists := s.commands[name]; !exists {
+		s.order = append(s.order, name)
+	}
+	s.commands[name] = cmd
+}
+
+// Stop zaustavlja petlju u Run posle trenutne komande
+func (s *Shell) Stop() {
+	s.stopped = true
+}
+
+// ReadLine cita jednu liniju sa datim promptom (bez dodavanja u istoriju)
+func (s *Shell) ReadLine(prompt string) (string, error) {
+	return s.reader.ReadLine(prompt)
+}
+
+// Run cita i izvrsava komande dok se ne pozove Stop ili dok se ne dodje do kraja ulaza
+// Greske komandi se ispisuju i ne prekidaju rad shell-a
+func (s *Shell) Run() error {
+	for !s.stopped {
+		input, args, err := s.readCommand()
+		if err == io.EOF {
+			return nil
+		}
+		if err == ErrInterrupt {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if err := s.history.Add(input); err != nil {
+			fmt.Fprintln(s.out, "Error saving history:", err)
+		}
+		if err := s.execute(args); err != nil {
+			fmt.Fprintln(s.out, "Error:", err)
+		}
+	}
+	return nil
+}
+
+// Execute parsira i izvrsava jednu liniju
+func (s *Shell) Execute(line string) error {
+	args, err := Split(line)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return s.execute(args)
+}
+
+// readCommand cita komandu koja moze da se prostire kroz vise linija
+// Linija se nastavlja ako je ostao otvoren navodnik ili se zavrsava sa '\'
+func (s *Shell) readCommand() (string, []string, error) {
+	input, err := s.reader.ReadLine(s.Prompt)
+	if err != nil {
+		return "", nil, err
+	}
+	for {
+		args, err := Split(input)
+		if err == nil {
+			return input, args, nil
+		}
+		if err != ErrIncomplete {
+			fmt.Fprintln(s.out, "Error:", err)
+			return input, nil, nil
+		}
+		next, err := s.reader.ReadLine(s.ContinuationPrompt)
+		if err != nil {
+			if err == io.EOF {
+				fmt.Fprintln(s.out, "Error: unexpected end of input")
+			}
+			return "", nil, err
+		}
+		input += "\n" + next
+	}
+}
+
+func (s *Shell) execute(args []string) error {
+	name := strings.ToLower(args[0])
+	cmd, ok := s.commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command '%s', type 'help' for the list of commands", args[0])
+	}
+	params := args[1:]
+	if len(params) < cmd.MinArgs || (cmd.MaxArgs >= 0 && len(params) > cmd.MaxArgs) {
+		return fmt.Errorf("usage: %s %s", cmd.Name, cmd.Args)
+	}
+	return cmd.Run(params)
+}
+
+func (s *Shell) help(args []string) error {
+	if len(args) == 1 {
+		cmd, ok := s.commands[strings.ToLower(args[0])]
+		if !ok {
+			return fmt.Errorf("unknown command '%s'", args[0])
+		}
+		fmt.Fprintf(s.out, "%s %s - %s\n", cmd.Name, cmd.Args, cmd.Description)
+		return nil
+	}
+
+	width := 0
+	for _, name := range s.order {
+		cmd := s.commands[name]
+		if l := len(cmd.Name) + len(cmd.Args) + 1; l > width {
+			width = l
+		}
+	}
+	for _, name := range s.order {
+		cmd := s.commands[name]
+		fmt.Fprintf(s.out, "%-*s - %s\n", width, strings.TrimSpace(cmd.Name+" "+cmd.Args), cmd.Description)
+	}
+	fmt.Fprintln(s.out, `Values with spaces must be quoted ("..." or '...'), "\n" is a new line. A line ending with \ continues on the next line.`)
+	return nil
+}
+
+// complete vraca pocetak reci ispred kursora i moguce dopune
+// Prva rec se dopunjava imenima komandi, a argumenti koji su kljucevi kljucevima iz baze
+func (s *Shell) complete(before string) (int, []string) {
+	start, word, argIndex := lastWord(before)
+
+	var candidates []string
+	if argIndex == 0 {
+		for _, name := range s.order {
+			if strings.HasPrefix(name, strings.ToLower(word)) {
+				candidates = append(candidates, name)
+			}
+		}
+		sort.Strings(candidates)
+		return start, candidates
+	}
+
+	args, err := Split(before[:start])
+	if err != nil || len(args) == 0 || s.KeyCompleter == nil {
+		return start, nil
+	}
+	cmd, ok := s.commands[strings.ToLower(args[0])]
+	if !ok || !containsInt(cmd.KeyArgs, argIndex) {
+		return start, nil
+	}
+	for _, key := range s.KeyCompleter(word) {
+		candidates = append(candidates, Quote(key))
+	}
+	sort.Strings(candidates)
+	return start, candidates
+}
+
+// lastWord vraca pocetak poslednje (nezavrsene) reci, njen sadrzaj bez navodnika i redni broj reci
+func lastWord(before string) (int, string, int) {
+	start := 0
+	words := 0
+	inWord := false
+	var quote rune
+	escaped := false
+	for i, r := range before {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quote != '\'':
+			if !inWord {
+				start = i
+				inWord = true
+			}
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			if !inWord {
+				start = i
+				inWord = true
+			}
+			quote = r
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words++
+				inWord = false
+			}
+		default:
+			if !inWord {
+				start = i
+				inWord = true
+			}
+		}
+	}
+	if !inWord {
+		return len(before), "", words
+	}
+
+	partial := before[start:]
+	if escaped {
+		partial = partial[:len(partial)-1]
+	}
+	if quote != 0 {
+		partial += string(quote)
+	}
+	args, err := Split(partial)
+	if err != nil || len(args) == 0 {
+		return start, "", words
+	}
+	return start, args[0], words
+}
+
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package shell
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{`put key value`, []string{"put", "key", "value"}},
+		{`  put   key   value  `, []string{"put", "key", "value"}},
+		{`put key "value with spaces"`, []string{"put", "key", "value with spaces"}},
+		{`put key 'single "quoted"'`, []string{"put", "key", `single "quoted"`}},
+		{`put key "line1\nline2\t\"x\" \\"`, []string{"put", "key", "line1\nline2\t\"x\" \\"}},
+		{`put key ""`, []string{"put", "key", ""}},
+		{`put my\ key v`, []string{"put", "my key", "v"}},
+		{`put key "\x41\x42"`, []string{"put", "key", "AB"}},
+		{"put key \"first\nsecond\"", []string{"put", "key", "first\nsecond"}},
+		{"put key val\\\nue", []string{"put", "key", "value"}},
+		{``, nil},
+	}
+	for _, tt := range tests {
+		got, err := Split(tt.line)
+		if err != nil {
+			t.Errorf("Split(%q) returned error: %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Split(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestSplitIncomplete(t *testing.T) {
+	for _, line := range []string{`put key "open`, `put key 'open`, `put key value\`, `put key "a\`} {
+		if _, err := Split(line); err != ErrIncomplete {
+			t.Errorf("Split(%q) error = %v, want ErrIncomplete", line, err)
+		}
+	}
+	if _, err := Split(`put key "\q"`); err == nil || err == ErrIncomplete {
+		t.Errorf("expected error for unknown escape sequence, got %v", err)
+	}
+}
+
+func TestQuoteRoundTrip(t *testing.T) {
+	for _, arg := range []string{"plain", "with space", `quo"te`, `back\slash`, "new\nline", "", "it's"} {
+		args, err := Split("get " + Quote(arg))
+		if err != nil {
+			t.Fatalf("Split(Quote(%q)) returned error: %v", arg, err)
+		}
+		if len(args) != 2 || args[1] != arg {
+			t.Errorf("Quote(%q) round trip = %q", arg, args)
+		}
+	}
+}
+
+func TestHistoryPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.txt")
+	h, err := LoadHistory(path, 3)
+	if err != nil {
+		t.Fatalf("LoadHistory failed: %v", err)
+	}
+	for _, entry := range []string{"get a", "get a", "put b \"x\ny\"", "delete c", "get d"} {
+		if err := h.Add(entry); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+
+	loaded, err := LoadHistory(path, 3)
+	if err != nil {
+		t.Fatalf("LoadHistory failed: %v", err)
+	}
+	want := []string{"put b \"x\ny\"", "delete c", "get d"}
+	if loaded.Len() != len(want) {
+		t.Fatalf("expected %d entries, got %d", len(want), loaded.Len())
+	}
+	for i, entry := range want {
+		if loaded.Get(i) != entry {
+			t.Errorf("entry %d = %q, want %q", i, loaded.Get(i), entry)
+		}
+	}
+}
+
+func newTestShell(t *testing.T, input string) (*Shell, *bytes.Buffer) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		io.WriteString(w, input)
+		w.Close()
+	}()
+	t.Cleanup(func() { r.Close() })
+	out := &bytes.Buffer{}
+	return New(r, out, nil), out
+}
+
+func TestRunMultiLineAndErrors(t *testing.T) {
+	sh, out := newTestShell(t, "put k \"a\nb\"\nbad\nput\nput x y\n")
+	var puts [][]string
+	sh.Register(&Command{
+		Name:    "put",
+		Args:    "<key> <value>",
+		MinArgs: 2,
+		MaxArgs: 2,
+		Run: func(args []string) error {
+			puts = append(puts, args)
+			return nil
+		},
+	})
+	if err := sh.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	want := [][]string{{"k", "a\nb"}, {"x", "y"}}
+	if !reflect.DeepEqual(puts, want) {
+		t.Errorf("executed puts = %q, want %q", puts, want)
+	}
+	if !bytes.Contains(out.Bytes(), []byte("unknown command 'bad'")) {
+		t.Errorf("expected unknown command error, got output:\n%s", out.String())
+	}
+	if !bytes.Contains(out.Bytes(), []byte("usage: put <key> <value>")) {
+		t.Errorf("expected usage error, got output:\n%s", out.String())
+	}
+}
+
+func TestComplete(t *testing.T) {
+	sh, _ := newTestShell(t, "")
+	noop := func(args []string) error { return nil }
+	sh.Register(&Command{Name: "put", MinArgs: 2, MaxArgs: 2, KeyArgs: []int{1}, Run: noop})
+	sh.Register(&Command{Name: "prefix_scan", MinArgs: 1, MaxArgs: 4, KeyArgs: []int{1}, Run: noop})
+	sh.KeyCompleter = func(prefix string) []string {
+		var keys []string
+		for _, k := range []string{"user:1", "user:2", "user 3", "tenant:1"} {
+			if len(k) >= len(prefix) && k[:len(prefix)] == prefix {
+				keys = append(keys, k)
+			}
+		}
+		return keys
+	}
+
+	tests := []struct {
+		before    string
+		wantStart int
+		want      []string
+	}{
+		{"pu", 0, []string{"put"}},
+		{"p", 0, []string{"prefix_scan", "put"}},
+		{"put us", 4, []string{`"user 3"`, "user:1", "user:2"}},
+		{`put "user `, 4, []string{`"user 3"`}},
+		{"put user:1 us", 11, nil}, // Vrednost se ne dopunjava
+		{"get us", 4, nil},         // Nepoznata komanda
+		{"prefix_scan te", 12, []string{"tenant:1"}},
+	}
+	for _, tt := range tests {
+		start, got := sh.complete(tt.before)
+		if start != tt.wantStart || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("complete(%q) = %d %q, want %d %q", tt.before, start, got, tt.wantStart, tt.want)
+		}
+	}
+}
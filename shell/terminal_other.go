@@ -0,0 +1,20 @@
+//go:build !linux
+
+package shell
+
+import "errors"
+
+type terminalState struct{}
+
+// Na ostalim platformama ne podrzavamo raw mod, shell radi sa obicnim citanjem linija
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (*terminalState, error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
+
+func restoreTerminal(fd int, state *terminalState) error {
+	return nil
+}
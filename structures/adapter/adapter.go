@@ -7,12 +7,14 @@ package adapter
 type MemtableEntry struct {
 	Key       []byte
 	Value     []byte
+	Seq       uint64 // Sekvencni broj upisa iz WAL-a, od dva zapisa istog kljuca noviji je onaj sa vecim
 	Timestamp int64
 	Tombstone bool
+	Blob      bool // Value je pokazivac na vrednost u blob fajlu (blob.Pointer), a ne sama vrednost
 }
 
 type MemtableStructure interface {
-	Update(key []byte, value []byte, timestamp int64, tombstone bool)
+	Update(key []byte, value []byte, seq uint64, timestamp int64, tombstone bool)
 	Search(key []byte) (*MemtableEntry, bool)
 	Delete(key []byte)
 	Clear()
@@ -0,0 +1,371 @@
+package blob
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+	=== BLOB ZAPIS (u blob fajlu) ===
+
+	+----------+------------------------+-------------------------+---------+-----------+
+	| CRC (4B) | Key Size (varint)      | Value Size (varint)     |  Kljuc  |  Vrednost |
+	+----------+------------------------+-------------------------+---------+-----------+
+
+	Blob fajl je niz ovakvih zapisa, upisuje se samo jednom (pri flush-u ili kompakciji) i posle se ne menja
+	U SSTable-u umesto velike vrednosti stoji Pointer na njen zapis, pa kompakcija prepisuje samo pokazivac
+	CRC se racuna nad svim iza njega, a kljuc je u zapisu da bi GC mogao da proveri da li je vrednost jos ziva
+*/
+
+const (
+	filePrefix = "blob-"
+	fileSuffix = ".log"
+	nextIDFile = "NEXT" // Broj sledeceg blob fajla: ID (8) + CRC (4) nad ID-jem
+)
+
+var errCorrupted = errors.New("blob record is corrupted")
+
+// Pointer je polozaj zapisa sa vrednoscu u blob fajlu
+type Pointer struct {
+	File   uint64 // Broj blob fajla
+	Offset int64  // Pocetak zapisa u fajlu
+	Size   int64  // Velicina celog zapisa
+}
+
+// Encode vraca pokazivac kako se upisuje u SSTable
+func (p Pointer) Encode() []byte {
+	out := make([]byte, 0, 3*binary.MaxVarintLen64)
+	out = binary.AppendUvarint(out, p.File)
+	out = binary.AppendUvarint(out, uint64(p.Offset))
+	return binary.AppendUvarint(out, uint64(p.Size))
+}
+
+// DecodePointer cita pokazivac koji je upisao Encode
+func DecodePointer(data []byte) (Pointer, error) {
+	var p Pointer
+	var fields [3]uint64
+	for i := range fields {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			return p, fmt.Errorf("invalid blob pointer")
+		}
+		fields[i] = v
+		data = data[n:]
+	}
+	if len(data) > 0 {
+		return p, fmt.Errorf("invalid blob pointer: %d trailing bytes", len(data))
+	}
+	p.File, p.Offset, p.Size = fields[0], int64(fields[1]), int64(fields[2])
+	return p, nil
+}
+
+// Record je jedan zapis iz blob fajla
+type Record struct {
+	Key     []byte
+	Value   []byte
+	Pointer Pointer
+}
+
+// FileName vraca putanju blob fajla sa brojem id
+func FileName(dir string, id uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%06d%s", filePrefix, id, fileSuffix))
+}
+
+// Files vraca brojeve svih blob fajlova u direktorijumu dir, rastuce
+func Files(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading blob directory %s: %w", dir, err)
+	}
+	var ids []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// Remove brise blob fajl sa brojem id
+func Remove(dir string, id uint64) error {
+	if err := os.Remove(FileName(dir, id)); err != nil {
+		return fmt.Errorf("error removing blob file: %w", err)
+	}
+	return nil
+}
+
+// Writer upisuje zapise u novi blob fajl
+type Writer struct {
+	dir    string
+	id     uint64
+	file   *os.File
+	buf    *bufio.Writer
+	offset int64
+}
+
+// NewWriter pravi novi blob fajl u direktorijumu dir, sa brojem koji nijedan blob fajl ranije nije imao
+// GC brise blob fajlove, pa najveci postojeci broj moze biti manji od poslednjeg koriscenog
+// Zato se broj sledeceg fajla cuva u NEXT fajlu i upisuje pre pravljenja blob fajla
+// (bez NEXT fajla, npr. u direktorijumu iz starije verzije, broj je za jedan veci od najveceg postojeceg)
+func NewWriter(dir string) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating blob directory %s: %w", dir, err)
+	}
+	ids, err := Files(dir)
+	if err != nil {
+		return nil, err
+	}
+	id, err := readNextID(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) > 0 && ids[len(ids)-1] >= id {
+		id = ids[len(ids)-1] + 1
+	}
+	if id == 0 {
+		id = 1
+	}
+	if err := writeNextID(dir, id+1); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(FileName(dir, id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error creating blob file: %w", err)
+	}
+	return &Writer{dir: dir, id: id, file: file, buf: bufio.NewWriter(file)}, nil
+}
+
+// readNextID cita broj sledeceg blob fajla iz NEXT fajla, 0 ako ga nema
+func readNextID(dir string) (uint64, error) {
+	path := filepath.Join(dir, nextIDFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error reading next blob file id: %w", err)
+	}
+	if len(data) != 12 || crc32.ChecksumIEEE(data[:8]) != binary.BigEndian.Uint32(data[8:12]) {
+		return 0, fmt.Errorf("next blob file id in %s is corrupted", path)
+	}
+	return binary.BigEndian.Uint64(data[:8]), nil
+}
+
+// writeNextID upisuje broj sledeceg blob fajla u privremeni fajl, sinhronizuje ga i preimenuje, pa je izmena atomicna
+func writeNextID(dir string, id uint64) error {
+	data := binary.BigEndian.AppendUint64(nil, id)
+	data = binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+
+	path := filepath.Join(dir, nextIDFile)
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("error creating next blob file id: %w", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing next blob file id: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("error syncing next blob file id: %w", err)
+	}
+	file.Close()
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error renaming next blob file id: %w", err)
+	}
+	// Sinhronizujemo i direktorijum, da bi preimenovanje bilo trajno pre nego sto se broj iskoristi
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("error syncing blob directory: %w", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("error syncing blob directory: %w", err)
+	}
+	return nil
+}
+
+// ID vraca broj blob fajla u koji Writer upisuje
+func (w *Writer) ID() uint64 {
+	return w.id
+}
+
+// Append dodaje zapis na kraj blob fajla i vraca pokazivac na njega
+func (w *Writer) Append(key, value []byte) (Pointer, error) {
+	header := make([]byte, 4, 4+2*binary.MaxVarintLen64)
+	header = binary.AppendUvarint(header, uint64(len(key)))
+	header = binary.AppendUvarint(header, uint64(len(value)))
+	crc := crc32.ChecksumIEEE(header[4:])
+	crc = crc32.Update(crc, crc32.IEEETable, key)
+	crc = crc32.Update(crc, crc32.IEEETable, value)
+	binary.LittleEndian.PutUint32(header, crc)
+
+	p := Pointer{File: w.id, Offset: w.offset, Size: int64(len(header) + len(key) + len(value))}
+	for _, part := range [][]byte{header, key, value} {
+		if _, err := w.buf.Write(part); err != nil {
+			return Pointer{}, fmt.Errorf("error writing blob file: %w", err)
+		}
+	}
+	w.offset += p.Size
+	return p, nil
+}
+
+// Close upisuje sve na disk (sa fsync-om fajla i direktorijuma) i zatvara fajl
+// Blob fajl mora biti na disku pre SSTable-a koji pokazuje na njega
+func (w *Writer) Close() error {
+	if err := w.buf.Flush(); err != nil {
+		w.file.Close()
+		return fmt.Errorf("error writing blob file: %w", err)
+	}
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return fmt.Errorf("error syncing blob file: %w", err)
+	}
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("error closing blob file: %w", err)
+	}
+	dir, err := os.Open(w.dir)
+	if err != nil {
+		return fmt.Errorf("error syncing blob directory: %w", err)
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// decodeRecord proverava CRC zapisa i vraca kljuc i vrednost
+func decodeRecord(data []byte) (key, value []byte, err error) {
+	if len(data) < 4 {
+		return nil, nil, errCorrupted
+	}
+	stored := binary.LittleEndian.Uint32(data)
+	body := data[4:]
+	keySize, n := binary.Uvarint(body)
+	if n <= 0 {
+		return nil, nil, errCorrupted
+	}
+	valueSize, m := binary.Uvarint(body[n:])
+	if m <= 0 || keySize+valueSize != uint64(len(body)-n-m) {
+		return nil, nil, errCorrupted
+	}
+	if crc32.ChecksumIEEE(body) != stored {
+		return nil, nil, errCorrupted
+	}
+	key = body[n+m : n+m+int(keySize)]
+	return key, body[n+m+int(keySize):], nil
+}
+
+// Read cita zapis na koji pokazuje p iz blob fajla u direktorijumu dir
+// Pokazivac koji izlazi van fajla je ostecen, pa se proverava pre nego sto se zauzme memorija za zapis
+func Read(dir string, p Pointer) (*Record, error) {
+	file, err := os.Open(FileName(dir, p.File))
+	if err != nil {
+		return nil, fmt.Errorf("error opening blob file: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("error reading blob file: %w", err)
+	}
+	if p.Offset < 0 || p.Size < 0 || p.Size > info.Size()-p.Offset {
+		return nil, fmt.Errorf("blob %d@%d: %d bytes past the end of the %d byte file: %w", p.File, p.Offset, p.Size, info.Size(), errCorrupted)
+	}
+	data := make([]byte, p.Size)
+	if _, err := file.ReadAt(data, p.Offset); err != nil {
+		return nil, fmt.Errorf("error reading blob %d@%d: %w", p.File, p.Offset, err)
+	}
+	key, value, err := decodeRecord(data)
+	if err != nil {
+		return nil, fmt.Errorf("blob %d@%d: %w", p.File, p.Offset, err)
+	}
+	return &Record{Key: key, Value: value, Pointer: p}, nil
+}
+
+// Scan redom cita sve zapise blob fajla id i za svaki poziva fn
+// Velicina zapisa iz zaglavlja se proverava prema ostatku fajla pre citanja, pa ostecena velicina ne zauzima memoriju
+func Scan(dir string, id uint64, fn func(Record) error) error {
+	file, err := os.Open(FileName(dir, id))
+	if err != nil {
+		return fmt.Errorf("error opening blob file: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("error reading blob file: %w", err)
+	}
+	r := bufio.NewReader(file)
+	var offset int64
+	for {
+		header, err := r.Peek(4 + 2*binary.MaxVarintLen64)
+		if len(header) == 0 && errors.Is(err, io.EOF) {
+			return nil
+		}
+		if len(header) < 4 {
+			return fmt.Errorf("blob %d@%d: %w", id, offset, errCorrupted)
+		}
+		keySize, n := binary.Uvarint(header[4:])
+		if n <= 0 {
+			return fmt.Errorf("blob %d@%d: %w", id, offset, errCorrupted)
+		}
+		valueSize, m := binary.Uvarint(header[4+n:])
+		if m <= 0 {
+			return fmt.Errorf("blob %d@%d: %w", id, offset, errCorrupted)
+		}
+		if keySize > uint64(info.Size()) || valueSize > uint64(info.Size()) {
+			return fmt.Errorf("blob %d@%d: %w", id, offset, errCorrupted)
+		}
+		size := int64(4+n+m) + int64(keySize) + int64(valueSize)
+		if size > info.Size()-offset {
+			return fmt.Errorf("blob %d@%d: %w", id, offset, errCorrupted)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return fmt.Errorf("blob %d@%d: %w", id, offset, errCorrupted)
+		}
+		key, value, err := decodeRecord(data)
+		if err != nil {
+			return fmt.Errorf("blob %d@%d: %w", id, offset, err)
+		}
+		if err := fn(Record{Key: key, Value: value, Pointer: Pointer{File: id, Offset: offset, Size: size}}); err != nil {
+			return err
+		}
+		offset += size
+	}
+}
+
+// Resolve vraca vrednost na koju pokazuje pokazivac encoded (kako je upisan u SSTable)
+// Kljuc zapisa u blob fajlu mora biti key, inace pokazivac ne pokazuje na vrednost tog kljuca
+func Resolve(dir string, key, encoded []byte) ([]byte, error) {
+	p, err := DecodePointer(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", key, err)
+	}
+	record, err := Read(dir, p)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", key, err)
+	}
+	if !bytes.Equal(record.Key, key) {
+		return nil, fmt.Errorf("key %q: blob %d@%d belongs to key %q", key, p.File, p.Offset, record.Key)
+	}
+	return record.Value, nil
+}
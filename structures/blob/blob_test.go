@@ -0,0 +1,113 @@
+package blob
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWriteReadScan(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWriter(dir)
+	if err != nil {
+		t.Fatalf("NewWriter failed: %v", err)
+	}
+	var pointers []Pointer
+	for i := 0; i < 5; i++ {
+		p, err := w.Append([]byte(fmt.Sprintf("key%d", i)), bytes.Repeat([]byte{byte(i)}, 1000*i))
+		if err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+		pointers = append(pointers, p)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	for i, p := range pointers {
+		decoded, err := DecodePointer(p.Encode())
+		if err != nil || decoded != p {
+			t.Fatalf("DecodePointer = %+v, %v; want %+v", decoded, err, p)
+		}
+		value, err := Resolve(dir, []byte(fmt.Sprintf("key%d", i)), p.Encode())
+		if err != nil || !bytes.Equal(value, bytes.Repeat([]byte{byte(i)}, 1000*i)) {
+			t.Errorf("Resolve key%d = %d bytes, %v", i, len(value), err)
+		}
+	}
+	if _, err := Resolve(dir, []byte("key1"), pointers[2].Encode()); err == nil {
+		t.Error("Resolve with pointer of another key succeeded")
+	}
+
+	var scanned []Pointer
+	if err := Scan(dir, w.ID(), func(r Record) error {
+		scanned = append(scanned, r.Pointer)
+		return nil
+	}); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if fmt.Sprint(scanned) != fmt.Sprint(pointers) {
+		t.Errorf("Scan pointers = %v, want %v", scanned, pointers)
+	}
+
+	// Novi fajl dobija sledeci broj
+	next, err := NewWriter(dir)
+	if err != nil {
+		t.Fatalf("NewWriter failed: %v", err)
+	}
+	next.Close()
+	if ids, err := Files(dir); err != nil || fmt.Sprint(ids) != "[1 2]" {
+		t.Errorf("Files = %v, %v; want [1 2]", ids, err)
+	}
+	// Broj fajla koji je GC obrisao se ne koristi ponovo
+	if err := Remove(dir, next.ID()); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	after, err := NewWriter(dir)
+	if err != nil {
+		t.Fatalf("NewWriter failed: %v", err)
+	}
+	after.Close()
+	if after.ID() != 3 {
+		t.Errorf("NewWriter after removing file 2 got id %d, want 3", after.ID())
+	}
+
+	// Ostecen bajt vrednosti se otkriva CRC-om
+	path := FileName(dir, w.ID())
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	data[pointers[3].Offset+pointers[3].Size-1] ^= 0xff
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if _, err := Read(dir, pointers[3]); err == nil {
+		t.Error("Read of corrupted record succeeded")
+	}
+	if err := Scan(dir, w.ID(), func(Record) error { return nil }); err == nil {
+		t.Error("Scan of corrupted file succeeded")
+	}
+
+	// Velicina vrednosti veca od fajla se odbija pre citanja
+	header := binary.AppendUvarint(make([]byte, 4), 3)
+	header = binary.AppendUvarint(header, 1<<62)
+	if err := os.WriteFile(FileName(dir, 9), append(header, "key"...), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := Scan(dir, 9, func(Record) error { return nil }); err == nil {
+		t.Error("Scan of record larger than the file succeeded")
+	}
+	// Isto i za pokazivac koji izlazi van fajla
+	for _, p := range []Pointer{
+		{File: 9, Offset: 0, Size: 1 << 40},
+		{File: 9, Offset: 1 << 40, Size: 10},
+		{File: 9, Offset: 2, Size: int64(len(header)) + 2},
+	} {
+		if _, err := Read(dir, p); err == nil || !strings.Contains(err.Error(), "past the end") {
+			t.Errorf("Read(%+v) = %v, want past the end error", p, err)
+		}
+	}
+}
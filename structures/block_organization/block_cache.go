@@ -12,6 +12,8 @@ type BlockCache struct {
 	cache     map[string]*list.Element // Mapa koja cuva kljuc i pokazivac na elemente u dvostruko spregnutoj listi
 	list      *list.List               // Dvostruko spregnuta lista koja cuva blokove podataka u redosledu pristupa
 	blockSize int
+	hits      uint64 // Broj pogodaka (za statistiku)
+	misses    uint64 // Broj promasaja (za statistiku)
 }
 
 // Struktura koja cuva kljuc i blok podataka
@@ -34,11 +36,18 @@ func (bc *BlockCache) Get(key string) ([]byte, bool) {
 	if element, isThere := bc.cache[key]; isThere { // Proveravamo da li kljuc postoji u mapi (cache)
 		// elem predstavlja pokazivac na element u listi
 		bc.list.MoveToFront(element)
+		bc.hits++
 		return element.Value.(*cacheData).block, true
 	}
+	bc.misses++
 	return nil, false // Ako kljuc ne postoji u mapi (cache) vracamo ove povratne vrednosti
 }
 
+// Stats vraca broj pogodaka i promasaja kesa, kao i broj blokova koji su trenutno u kesu
+func (bc *BlockCache) Stats() (hits uint64, misses uint64, size int) {
+	return bc.hits, bc.misses, len(bc.cache)
+}
+
 // Funkcija koja dodaje blok u kes
 func (bc *BlockCache) Put(key string, block []byte) {
 	if element, isThere := bc.cache[key]; isThere {
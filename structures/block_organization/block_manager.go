@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 
 	"github.com/iigor000/database/config"
 )
@@ -131,9 +132,9 @@ func (bm *BlockManager) Write(filePath string, blockNumber int, data []byte) err
 }
 
 func (bm *BlockManager) Append(filePath string, data []byte) (int, error) {
-	// Proveravamo da li je duzina podataka veca od BlockSize, ako jeste deilmo ga na blokove
+	// Proveravamo da li podaci staju u jedan blok (BlockSize-1 bajtova), ako ne staju delimo ih na blokove
 	// Prvi bajt svakog bloka je oznaka da li je block krajnji, srednji ili prvi
-	if len(data) > bm.BlockSize+1 {
+	if len(data) > bm.BlockSize-1 {
 		blocks := make([][]byte, 0)
 		for i := 0; i < len(data); i += bm.BlockSize - 1 {
 			end := i + bm.BlockSize - 1
@@ -193,9 +194,44 @@ func (bm *BlockManager) Read(filePath string, blockNumber int) ([]byte, error) {
 			data = append(data, block[1:]...) // Dodajemo podatke iz bloka u data
 			continue
 		}
+		// Blok bez oznake nije upisan preko Append-a (ili je ostecen), pa se lanac ne moze procitati
+		return nil, fmt.Errorf("error reading block %d: invalid block marker %d", blockNumber, block[0])
 	}
 }
 
+// Funkcija koja sinhronizuje na disk sve fajlove iz direktorijuma, pa i sam direktorijum i njegov roditeljski direktorijum
+// Blokovi se upisuju bez fsync-a, pa se SyncDir poziva kad upisani fajlovi moraju da prezive pad sistema (npr. posle flush-a SSTable-a)
+func (bm *BlockManager) SyncDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if err := syncPath(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	if err := syncPath(dir); err != nil {
+		return err
+	}
+	return syncPath(filepath.Dir(dir)) // Da bi i novi direktorijum bio trajno upisan
+}
+
+func syncPath(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("error syncing %s: %w", path, err)
+	}
+	return nil
+}
+
 // INTEGRACIJA BLOCK MANAGERA I BLOCK CACHEA
 
 // CachedBlockManager je struktura koja omogucava citanje i pisanje blokova podataka sa kesiranjem
@@ -276,3 +312,8 @@ func (cbm *CachedBlockManager) Append(filePath string, data []byte) (int, error)
 	cbm.C.Put(cacheKey, data) // Stavljamo podatke u kes
 	return blockNumber, nil
 }
+
+// Funkcija koja sinhronizuje direktorijum na disk, kes se ne menja
+func (cbm *CachedBlockManager) SyncDir(dir string) error {
+	return cbm.BM.SyncDir(dir)
+}
@@ -237,6 +237,57 @@ func TestBlockManagerAppend(t *testing.T) {
 	}
 }
 
+// TestBlockManagerAppendBoundary proverava podatke oko granice bloka, u jedan blok staje BlockSize-1 bajtova
+func TestBlockManagerAppendBoundary(t *testing.T) {
+	cfg := &config.Config{
+		Block: config.BlockConfig{
+			BlockSize: 1024,
+		},
+	}
+	bm := NewBlockManager(cfg)
+	filePath := filepath.Join(t.TempDir(), "testfile.dat")
+
+	next := 0
+	for _, size := range []int{cfg.Block.BlockSize - 1, cfg.Block.BlockSize, cfg.Block.BlockSize + 1} {
+		writeData := bytes.Repeat([]byte{0xAB}, size)
+		blockNumber, err := bm.Append(filePath, writeData)
+		if err != nil {
+			t.Fatalf("Append of %d bytes failed: %v", size, err)
+		}
+		if blockNumber != next {
+			t.Errorf("Append of %d bytes started at block %d, want %d", size, blockNumber, next)
+		}
+		readData, err := bm.Read(filePath, blockNumber)
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		if !bytes.Equal(writeData, bytes.TrimRight(readData, "\x00")) {
+			t.Errorf("Data of %d bytes was not read back (got %d bytes)", size, len(bytes.TrimRight(readData, "\x00")))
+		}
+		next = blockNumber + len(readData)/(cfg.Block.BlockSize-1)
+	}
+}
+
+// TestBlockManagerReadInvalidMarker proverava da Read vraca gresku za blok bez oznake umesto da se vrti u petlji
+func TestBlockManagerReadInvalidMarker(t *testing.T) {
+	cfg := &config.Config{
+		Block: config.BlockConfig{
+			BlockSize: 1024,
+		},
+	}
+	bm := NewBlockManager(cfg)
+	filePath := filepath.Join(t.TempDir(), "testfile.dat")
+
+	raw := make([]byte, cfg.Block.BlockSize)
+	copy(raw, "Data: 1024\n") // Blok upisan bez Append-a, kao tekst sa offsetima
+	if _, err := bm.AppendBlock(filePath, raw); err != nil {
+		t.Fatalf("AppendBlock failed: %v", err)
+	}
+	if _, err := bm.Read(filePath, 0); err == nil {
+		t.Fatal("Read of a block without a marker succeeded")
+	}
+}
+
 func TestBlockManagerWrite(t *testing.T) {
 	// Kreiramo privremeni direktorijum za test
 	tempDir, err := os.MkdirTemp("", "block_manager_append_test")
@@ -1,7 +1,12 @@
 package bloomfilter
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
 	"testing"
+
+	"github.com/iigor000/database/structures/hash"
 )
 
 // Test proverava da li radi upisivanje i citanje iz Bloom filtera
@@ -46,3 +51,89 @@ func TestSerializaton(t *testing.T) {
 		t.Error("hello should not be in the filter")
 	}
 }
+
+// Test proverava lazne pogotke oba bit-packed filtera i velicinu serijalizovanog filtera
+func TestBitPackedFilters(t *testing.T) {
+	const n = 10000
+	for _, blocked := range []bool{false, true} {
+		bf := NewBloomFilter(n, BitsPerKey(0.01), blocked)
+		for i := 0; i < n; i++ {
+			bf.Add([]byte(fmt.Sprintf("key%d", i)))
+		}
+		for i := 0; i < n; i++ {
+			if !bf.Read([]byte(fmt.Sprintf("key%d", i))) {
+				t.Fatalf("blocked=%v: key%d should be in the filter", blocked, i)
+			}
+		}
+		falsePositives := 0
+		for i := 0; i < n; i++ {
+			if bf.Read([]byte(fmt.Sprintf("other%d", i))) {
+				falsePositives++
+			}
+		}
+		if rate := float64(falsePositives) / n; rate > 0.02 {
+			t.Errorf("blocked=%v: false positive rate %.4f, want about 0.01", blocked, rate)
+		}
+
+		// Jedan bit po bitu filtera, plus zaglavlje
+		serialized := bf.Serialize()
+		if len(serialized) > int(bf.Bits()/8)+headerSize {
+			t.Errorf("blocked=%v: serialized filter takes %d bytes for %d bits", blocked, len(serialized), bf.Bits())
+		}
+		restored := Deserialize(serialized)
+		if len(restored) != 1 || restored[0].Kind() != bf.Kind() || !bytes.Equal(restored[0].Serialize(), serialized) {
+			t.Fatalf("blocked=%v: deserialized filter differs", blocked)
+		}
+
+		// Hash ne zavisi od vremena, pa isti kljucevi uvek daju isti filter
+		again := NewBloomFilter(n, BitsPerKey(0.01), blocked)
+		for i := 0; i < n; i++ {
+			again.AddHash(Hash([]byte(fmt.Sprintf("key%d", i))))
+		}
+		if !bytes.Equal(again.Serialize(), serialized) {
+			t.Errorf("blocked=%v: filter is not deterministic", blocked)
+		}
+	}
+}
+
+// Test proverava citanje i dopunjavanje filtera iz starog formata (bajt po bitu, MD5 seed-ovi)
+func TestLegacyFilter(t *testing.T) {
+	seeds := hash.CreateHashFunctions(3)
+	const m = 1000
+	filter := make([]bool, m)
+	for _, key := range []string{"hello", "nesto"} {
+		for _, h := range seeds {
+			filter[h.Hash([]byte(key))%m] = true
+		}
+	}
+	old := make([]byte, 8)
+	binary.BigEndian.PutUint32(old[0:4], m)
+	binary.BigEndian.PutUint32(old[4:8], uint32(len(seeds)))
+	for _, bit := range filter {
+		if bit {
+			old = append(old, 1)
+		} else {
+			old = append(old, 0)
+		}
+	}
+	for _, h := range seeds {
+		old = append(old, h.Seed...)
+	}
+
+	// Iza filtera je popuna bloka nulama
+	filters := Deserialize(append(old, make([]byte, 100)...))
+	if len(filters) != 1 || filters[0].Kind() != "legacy" {
+		t.Fatalf("Deserialize returned %d filters", len(filters))
+	}
+	bf := filters[0]
+	if !bf.Read([]byte("hello")) || !bf.Read([]byte("nesto")) {
+		t.Error("legacy filter lost its keys")
+	}
+	if !bytes.Equal(bf.Serialize(), old) {
+		t.Error("legacy filter is not written back in the old format")
+	}
+	bf.Add([]byte("world"))
+	if again := Deserialize(bf.Serialize()); len(again) != 1 || !again[0].Read([]byte("world")) {
+		t.Error("key added to legacy filter is lost")
+	}
+}
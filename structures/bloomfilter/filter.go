@@ -1,121 +1,289 @@
-package bloomfilter
-
-import (
-	"encoding/binary"
-
-	hash "github.com/iigor000/database/structures/hash"
-)
-
-// Struktura za Bloom filter, koristi se niz boolova, jer oni zauzimaju jedan bit u memoriji
-type BloomFilter struct {
-	HashFunctions []hash.HashWithSeed
-	Filter        []bool
-}
-
-// Pravimo Bloom filter preko datih funkcija
-func MakeBloomFilter(expectedElements int, falsePositive float64) BloomFilter {
-	m := CalculateM(expectedElements, falsePositive)
-	k := CalculateK(expectedElements, m)
-	h := hash.CreateHashFunctions(k)
-	return BloomFilter{HashFunctions: h, Filter: make([]bool, m)}
-}
-
-// Kada dodajemo u filter, prolazimo kroz hash funckije i za svaku hesiramo element (i racunamo moduo od m) i taj indeks postavljamo na true
-func (b *BloomFilter) Add(data []byte) {
-	for _, h := range b.HashFunctions {
-		b.Filter[h.Hash(data)%uint64(len(b.Filter))] = true
-	}
-}
-
-// Kada proveravamo da li je element u filteru, prolazimo kroz sve hash funckije i proveravamo da li je indeks dobijen iz njih true
-func (b *BloomFilter) Read(data []byte) bool {
-	for _, h := range b.HashFunctions {
-		hashed := h.Hash(data)
-		if !b.Filter[hashed%uint64(len(b.Filter))] {
-			return false
-		}
-	}
-	return true
-}
-
-// Funkcija za serijalizaciju
-func (b *BloomFilter) Serialize() []byte {
-	//Pravimo niz bajtova koji ce predstavljati serijalizovani Bloom filter
-	serliazied := make([]byte, 0)
-
-	// Upisujemo duzine nizova (k i m) jer ce nam trebati za deserijaizaciju
-	m := make([]byte, 4)
-	binary.BigEndian.PutUint32(m, uint32(len(b.Filter)))
-	serliazied = append(serliazied, m...)
-
-	k := make([]byte, 4)
-	binary.BigEndian.PutUint32(k, uint32(len(b.HashFunctions)))
-	serliazied = append(serliazied, k...)
-
-	// Filter je niz boolova, pa ga pretvaramo u niz bajtova
-	filter := make([]byte, len(b.Filter))
-	for i := 0; i < len(b.Filter); i++ {
-		if b.Filter[i] {
-			filter[i] = 1
-		}
-	}
-	serliazied = append(serliazied, filter...)
-
-	// Serijalizujemo hash funkcije tako sto upisujemo seedove
-	hashes := make([]byte, 0)
-	for i := 0; i < len(b.HashFunctions); i++ {
-		seed := b.HashFunctions[i].Seed
-		hashes = append(hashes, seed...)
-	}
-	serliazied = append(serliazied, hashes...)
-
-	return serliazied
-}
-
-// Funckija za deserijalizaciju filtera (moze se ucitati fajl sa vise bloom filtera, pa ova funckija vraca niz filtera)
-func Deserialize(data []byte) []BloomFilter {
-	// Pravimo niz filtera
-	bf := make([]BloomFilter, 0)
-
-	// Proveravamo da li postoji jos filtera u niz bajtova
-	for len(data) > 0 {
-		if len(data) < 8 {
-			break
-		}
-
-		// Ucitavamo duzine nizova (k i m)
-		m := binary.BigEndian.Uint32(data[:4])
-		k := binary.BigEndian.Uint32(data[4:8])
-
-		totalLength := 8 + int(m) + int(k)*4
-
-		if len(data) < totalLength {
-			break
-		}
-
-		// Ucitavamo filter (krecemo od 8. bajta jer smo pre toga ucitali duzine)
-		filter := make([]bool, m)
-		for i := 0; i < int(m); i++ {
-			if data[8+i] == 1 {
-				filter[i] = true
-			} else {
-				filter[i] = false
-			}
-		}
-
-		// Ucitavamo hash funkcije, one su dugacke 4 bajta, pa ih ucitavamo po 4 od indeksa 8+m
-		hashes := make([]hash.HashWithSeed, 0)
-		for i := 0; i < int(k); i++ {
-			seed := data[8+int(m)+i*4 : 8+int(m)+(i+1)*4]
-			h := hash.HashWithSeed{Seed: seed}
-			hashes = append(hashes, h)
-		}
-
-		bf = append(bf, BloomFilter{HashFunctions: hashes, Filter: filter})
-
-		// Skracujemo niz bajtova za duzine koje smo upravo ucitali
-		data = data[8+int(m)+int(k)*4:]
-	}
-
-	return bf
-}
+package bloomfilter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/bits"
+
+	hash "github.com/iigor000/database/structures/hash"
+)
+
+/*
+	=== BLOOM FILTER (serijalizovan) ===
+
+	+------------+------------+--------+------------------+-----------------------+
+	| Magic (4B) | Vrsta (1B) | K (1B) | Broj bitova (8B) | Bitovi (8 u bajtu)    |
+	+------------+------------+--------+------------------+-----------------------+
+
+	Sve pozicije bitova jednog kljuca se racunaju iz jednog hash.Hash64 (dvostruko hesiranje)
+	Standardni filter bira pozicije iz celog niza, a blocked filter sve bitove kljuca stavlja u isti blok
+	od 512 bitova (64 bajta, jedna cache line), pa provera cita samo jednu liniju memorije (uz malo vise laznih pogodaka)
+	Stari format nema magic: m (4B), k (4B), bajt po bitu i seed-ovi MD5 hash funkcija, on se samo cita
+	(SSTable-ovi i vrednosti upisani pre bit-packed formata) i tako se i upisuje nazad
+*/
+
+var magic = []byte{'B', 'L', 'M', 2}
+
+// Vrste filtera u zaglavlju
+const (
+	kindStandard = 0
+	kindBlocked  = 1
+)
+
+const headerSize = 4 + 1 + 1 + 8
+
+// Velicina bloka blocked filtera u bitovima (jedna cache line)
+const blockBits = 512
+
+// Najveci broj hash funkcija, vise ne smanjuje lazne pogotke a usporava proveru
+const maxHashCount = 30
+
+// BloomFilter je niz bitova spakovanih po 8 u bajtu
+type BloomFilter struct {
+	bits    []byte
+	m       uint64 // Broj bitova
+	k       int    // Broj bitova koji se postavljaju za svaki kljuc
+	blocked bool
+	legacy  []hash.HashWithSeed // MD5 hash funkcije filtera iz starog formata, nil kod novih filtera
+}
+
+// NewBloomFilter pravi filter za n kljuceva sa bitsPerKey bitova po kljucu
+// Blocked filter je brzi za proveru, ali za isti broj bitova ima malo vise laznih pogodaka
+func NewBloomFilter(n int, bitsPerKey float64, blocked bool) BloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	if bitsPerKey < 1 {
+		bitsPerKey = 1
+	}
+	m := uint64(math.Ceil(float64(n) * bitsPerKey))
+	if blocked {
+		m = (m + blockBits - 1) / blockBits * blockBits
+	} else {
+		m = (m + 63) / 64 * 64
+	}
+	return BloomFilter{bits: make([]byte, m/8), m: m, k: hashCount(bitsPerKey), blocked: blocked}
+}
+
+// MakeBloomFilter pravi standardni filter za expectedElements elemenata sa verovatnocom laznog pogotka falsePositive
+func MakeBloomFilter(expectedElements int, falsePositive float64) BloomFilter {
+	return NewBloomFilter(expectedElements, BitsPerKey(falsePositive), false)
+}
+
+// Hash vraca hash kljuca iz kog filter racuna pozicije bitova
+// Ko unapred izracuna hash (npr. Writer SSTable-a, dok jos ne zna broj kljuceva) koristi AddHash
+func Hash(data []byte) uint64 {
+	return hash.Hash64(data, 0)
+}
+
+// Add dodaje element u filter
+func (b *BloomFilter) Add(data []byte) {
+	if b.legacy != nil {
+		for _, h := range b.legacy {
+			b.set(h.Hash(data) % b.m)
+		}
+		return
+	}
+	b.AddHash(Hash(data))
+}
+
+// AddHash dodaje element ciji je hash izracunat funkcijom Hash (ne moze se koristiti za filter iz starog formata)
+func (b *BloomFilter) AddHash(h uint64) {
+	if b.blocked {
+		base, x, delta := b.block(h)
+		for i := 0; i < b.k; i++ {
+			b.set(base + uint64(x%blockBits))
+			x += delta
+		}
+		return
+	}
+	delta := bits.RotateLeft64(h, 31) | 1
+	for i := 0; i < b.k; i++ {
+		b.set(h % b.m)
+		h += delta
+	}
+}
+
+// Read proverava da li element moze biti u filteru (false znaci da sigurno nije)
+func (b *BloomFilter) Read(data []byte) bool {
+	if b.m == 0 {
+		return false
+	}
+	if b.legacy != nil {
+		for _, h := range b.legacy {
+			if !b.get(h.Hash(data) % b.m) {
+				return false
+			}
+		}
+		return true
+	}
+	h := Hash(data)
+	if b.blocked {
+		base, x, delta := b.block(h)
+		for i := 0; i < b.k; i++ {
+			if !b.get(base + uint64(x%blockBits)) {
+				return false
+			}
+			x += delta
+		}
+		return true
+	}
+	delta := bits.RotateLeft64(h, 31) | 1
+	for i := 0; i < b.k; i++ {
+		if !b.get(h % b.m) {
+			return false
+		}
+		h += delta
+	}
+	return true
+}
+
+// block vraca prvi bit bloka za hash h i pocetnu vrednost i korak za pozicije u bloku
+// Blok se bira gornjom polovinom hash-a (mnozenjem umesto moduom), a pozicije donjom
+func (b *BloomFilter) block(h uint64) (uint64, uint32, uint32) {
+	blocks := b.m / blockBits
+	base := (((h >> 32) * blocks) >> 32) * blockBits
+	x := uint32(h)
+	return base, x, x>>17 | x<<15
+}
+
+func (b *BloomFilter) set(bit uint64) {
+	b.bits[bit/8] |= 1 << (bit % 8)
+}
+
+func (b *BloomFilter) get(bit uint64) bool {
+	return b.bits[bit/8]&(1<<(bit%8)) != 0
+}
+
+// Bits vraca velicinu filtera u bitovima
+func (b *BloomFilter) Bits() uint64 {
+	return b.m
+}
+
+// HashCount vraca broj bitova koji se postavljaju za svaki element
+func (b *BloomFilter) HashCount() int {
+	if b.legacy != nil {
+		return len(b.legacy)
+	}
+	return b.k
+}
+
+// Kind vraca vrstu filtera: "standard", "blocked" ili "legacy" (stari format)
+func (b *BloomFilter) Kind() string {
+	switch {
+	case b.legacy != nil:
+		return "legacy"
+	case b.blocked:
+		return "blocked"
+	}
+	return "standard"
+}
+
+// SetBits vraca broj postavljenih bitova
+func (b *BloomFilter) SetBits() int {
+	n := 0
+	for _, v := range b.bits {
+		n += bits.OnesCount8(v)
+	}
+	return n
+}
+
+// Funkcija za serijalizaciju
+func (b *BloomFilter) Serialize() []byte {
+	if b.legacy != nil {
+		return b.serializeLegacy()
+	}
+	out := make([]byte, 0, headerSize+len(b.bits))
+	out = append(out, magic...)
+	if b.blocked {
+		out = append(out, kindBlocked)
+	} else {
+		out = append(out, kindStandard)
+	}
+	out = append(out, byte(b.k))
+	out = binary.LittleEndian.AppendUint64(out, b.m)
+	return append(out, b.bits...)
+}
+
+// serializeLegacy upisuje filter iz starog formata u stari format: m, k, bajt po bitu, seed-ovi
+func (b *BloomFilter) serializeLegacy() []byte {
+	out := make([]byte, 8, 8+int(b.m)+4*len(b.legacy))
+	binary.BigEndian.PutUint32(out[0:4], uint32(b.m))
+	binary.BigEndian.PutUint32(out[4:8], uint32(len(b.legacy)))
+	for i := uint64(0); i < b.m; i++ {
+		if b.get(i) {
+			out = append(out, 1)
+		} else {
+			out = append(out, 0)
+		}
+	}
+	for _, h := range b.legacy {
+		out = append(out, h.Seed...)
+	}
+	return out
+}
+
+// Funckija za deserijalizaciju filtera (moze se ucitati fajl sa vise bloom filtera, pa ova funckija vraca niz filtera)
+// Citanje staje na prvom mestu gde nema ispravnog filtera (npr. popuna bloka nulama)
+func Deserialize(data []byte) []BloomFilter {
+	bf := make([]BloomFilter, 0)
+	for {
+		f, n := Decode(data)
+		if n == 0 {
+			return bf
+		}
+		bf = append(bf, f)
+		data = data[n:]
+	}
+}
+
+// Decode cita jedan filter sa pocetka data i vraca ga sa brojem procitanih bajtova (0 ako tu nema ispravnog filtera)
+func Decode(data []byte) (BloomFilter, int) {
+	if len(data) < 8 {
+		return BloomFilter{}, 0
+	}
+	if bytes.HasPrefix(data, magic) {
+		return deserialize(data)
+	}
+	return deserializeLegacy(data)
+}
+
+// deserialize cita filter u bit-packed formatu i vraca ga sa brojem procitanih bajtova (0 ako nije ispravan)
+func deserialize(data []byte) (BloomFilter, int) {
+	if len(data) < headerSize {
+		return BloomFilter{}, 0
+	}
+	kind, k := data[4], int(data[5])
+	m := binary.LittleEndian.Uint64(data[6:headerSize])
+	size := m / 8
+	if m == 0 || m%64 != 0 || k < 1 || kind > kindBlocked || (kind == kindBlocked && m%blockBits != 0) || uint64(len(data)-headerSize) < size {
+		return BloomFilter{}, 0
+	}
+	f := BloomFilter{bits: make([]byte, size), m: m, k: k, blocked: kind == kindBlocked}
+	copy(f.bits, data[headerSize:])
+	return f, headerSize + int(size)
+}
+
+// deserializeLegacy cita filter u starom formatu (bajt po bitu, MD5 seed-ovi)
+func deserializeLegacy(data []byte) (BloomFilter, int) {
+	m := binary.BigEndian.Uint32(data[:4])
+	k := binary.BigEndian.Uint32(data[4:8])
+	totalLength := 8 + int(m) + int(k)*4
+	if m == 0 || k == 0 || len(data) < totalLength {
+		return BloomFilter{}, 0
+	}
+	f := BloomFilter{bits: make([]byte, (uint64(m)+7)/8), m: uint64(m)}
+	for i := uint64(0); i < uint64(m); i++ {
+		if data[8+i] == 1 {
+			f.set(i)
+		}
+	}
+	// Hash funkcije su dugacke 4 bajta, pocinju iza filtera
+	f.legacy = make([]hash.HashWithSeed, k)
+	for i := 0; i < int(k); i++ {
+		seed := data[8+int(m)+i*4 : 8+int(m)+(i+1)*4]
+		f.legacy[i] = hash.HashWithSeed{Seed: append([]byte(nil), seed...)}
+	}
+	return f, totalLength
+}
@@ -2,10 +2,19 @@ package bloomfilter
 
 import "math"
 
-func CalculateM(expectedElements int, falsePositiveRate float64) uint {
-	return uint(math.Ceil(float64(expectedElements) * math.Abs(math.Log(falsePositiveRate)) / math.Pow(math.Log(2), float64(2))))
+// BitsPerKey vraca broj bitova po kljucu za datu verovatnocu laznog pogotka
+func BitsPerKey(falsePositiveRate float64) float64 {
+	return math.Abs(math.Log(falsePositiveRate)) / math.Pow(math.Log(2), float64(2))
 }
 
-func CalculateK(expectedElements int, m uint) uint32 {
-	return uint32(math.Ceil((float64(m) / float64(expectedElements)) * math.Log(2)))
+// hashCount vraca broj hash funkcija sa najmanje laznih pogodaka za dati broj bitova po kljucu
+func hashCount(bitsPerKey float64) int {
+	k := int(math.Round(bitsPerKey * math.Log(2)))
+	if k < 1 {
+		return 1
+	}
+	if k > maxHashCount {
+		return maxHashCount
+	}
+	return k
 }
@@ -44,12 +44,13 @@ func (t *BTree) Search(k []byte) (*memtable.MemtableEntry, bool) {
 }
 
 // Update azurira vrednost za kljuc k u B stablu
-func (t *BTree) Update(k, v []byte, timestamp int64, tombstone bool) {
+func (t *BTree) Update(k, v []byte, seq uint64, timestamp int64, tombstone bool) {
 	println("Updating key:", string(k))
 
 	entry := memtable.MemtableEntry{
 		Key:       k,
 		Value:     v,
+		Seq:       seq,
 		Timestamp: timestamp,
 		Tombstone: tombstone,
 	}
@@ -548,6 +549,7 @@ func serializeEntry(entry memtable.MemtableEntry) []byte {
 	var valueLen int64 = int64(len(entry.Value))
 	binary.Write(buf, binary.BigEndian, valueLen)
 	buf.Write(entry.Value)
+	binary.Write(buf, binary.BigEndian, entry.Seq)
 	binary.Write(buf, binary.BigEndian, entry.Timestamp)
 	binary.Write(buf, binary.BigEndian, entry.Tombstone)
 	return buf.Bytes()
@@ -564,6 +566,8 @@ func deserializeEntry(data []byte) memtable.MemtableEntry {
 	binary.Read(buf, binary.BigEndian, &valueLen)
 	value := make([]byte, valueLen)
 	binary.Read(buf, binary.BigEndian, &value)
+	var seq uint64
+	binary.Read(buf, binary.BigEndian, &seq)
 	var timestamp int64
 	binary.Read(buf, binary.BigEndian, &timestamp)
 	var tombstone bool
@@ -571,6 +575,7 @@ func deserializeEntry(data []byte) memtable.MemtableEntry {
 	return memtable.MemtableEntry{
 		Key:       key,
 		Value:     value,
+		Seq:       seq,
 		Timestamp: timestamp,
 		Tombstone: tombstone,
 	}
@@ -42,7 +42,7 @@ func TestInsertAndSearch(t *testing.T) {
 
 	// Prvo umetanje
 	entry1 := createTestEntry([]byte("key1"), []byte("value1"), false)
-	tree.Update(entry1.Key, entry1.Value, entry1.Timestamp, entry1.Tombstone)
+	tree.Update(entry1.Key, entry1.Value, entry1.Seq, entry1.Timestamp, entry1.Tombstone)
 
 	if tree.root == nil {
 		t.Fatal("Root should not be nil after insertion")
@@ -79,7 +79,7 @@ func TestInsertAndSearch(t *testing.T) {
 	}
 
 	for _, entry := range entries {
-		tree.Update(entry.Key, entry.Value, entry.Timestamp, entry.Tombstone)
+		tree.Update(entry.Key, entry.Value, entry.Seq, entry.Timestamp, entry.Tombstone)
 	}
 
 	testCases := []struct {
@@ -122,7 +122,7 @@ func TestSplitRoot(t *testing.T) {
 
 	for i, k := range keys {
 		entry := createTestEntry(k, []byte("value"+string(k)), false)
-		tree.Update(entry.Key, entry.Value, entry.Timestamp, entry.Tombstone)
+		tree.Update(entry.Key, entry.Value, entry.Seq, entry.Timestamp, entry.Tombstone)
 
 		if i == 2 {
 			if len(tree.root.keys) != 3 {
@@ -165,7 +165,7 @@ func TestDelete(t *testing.T) {
 
 	for _, k := range keys {
 		entry := createTestEntry(k, []byte("value"+string(k)), false)
-		tree.Update(entry.Key, entry.Value, entry.Timestamp, entry.Tombstone)
+		tree.Update(entry.Key, entry.Value, entry.Seq, entry.Timestamp, entry.Tombstone)
 	}
 
 	tree.Delete([]byte("key0.5"))
@@ -271,7 +271,7 @@ func TestBorrowAndMerge(t *testing.T) {
 	// Dodaj kljuceve u stablo
 	for _, k := range keys {
 		entry := createTestEntry(k, []byte("value"+string(k)), false)
-		tree.Update(entry.Key, entry.Value, entry.Timestamp, entry.Tombstone)
+		tree.Update(entry.Key, entry.Value, entry.Seq, entry.Timestamp, entry.Tombstone)
 	}
 
 	// Izbriši neke kljuxeve
@@ -315,10 +315,10 @@ func TestEdgeCases(t *testing.T) {
 	// Testiraj dupliranje ključeva
 	// Ocekuje se da se vrednost azurira, a ne da se dodaje novi cvor
 	entry1 := createTestEntry([]byte("key1"), []byte("value1"), false)
-	tree.Update(entry1.Key, entry1.Value, entry1.Timestamp, entry1.Tombstone)
+	tree.Update(entry1.Key, entry1.Value, entry1.Seq, entry1.Timestamp, entry1.Tombstone)
 
 	entry2 := createTestEntry([]byte("key1"), []byte("value2"), false)
-	tree.Update(entry2.Key, entry2.Value, entry2.Timestamp, entry2.Tombstone)
+	tree.Update(entry2.Key, entry2.Value, entry2.Seq, entry2.Timestamp, entry2.Tombstone)
 
 	foundEntry, found := tree.Search([]byte("key1"))
 	if !found {
@@ -343,17 +343,17 @@ func TestEdgeCases(t *testing.T) {
 	// Test nil kljuca
 	tree2 := NewBTree(2)
 	validEntry := createTestEntry([]byte("valid"), []byte("value"), false)
-	tree2.Update(validEntry.Key, validEntry.Value, validEntry.Timestamp, validEntry.Tombstone)
+	tree2.Update(validEntry.Key, validEntry.Value, validEntry.Seq, validEntry.Timestamp, validEntry.Tombstone)
 
-	tree2.Update(nil, []byte("value"), now, false)
+	tree2.Update(nil, []byte("value"), 1, now, false)
 
 	// Test tombstone azuriranje
 	tree3 := NewBTree(2)
 	entry3 := createTestEntry([]byte("key"), []byte("value"), false)
-	tree3.Update(entry3.Key, entry3.Value, entry3.Timestamp, entry3.Tombstone)
+	tree3.Update(entry3.Key, entry3.Value, entry3.Seq, entry3.Timestamp, entry3.Tombstone)
 
 	// Azriraj tombstone
-	tree3.Update([]byte("key"), nil, now, true)
+	tree3.Update([]byte("key"), nil, 1, now, true)
 
 	entry, found := tree3.Search([]byte("key"))
 	if !found {
@@ -368,7 +368,7 @@ func TestUpdate(t *testing.T) {
 	tree := NewBTree(2)
 	now := time.Now().UnixNano()
 
-	tree.Update([]byte("key1"), []byte("value1"), now, false)
+	tree.Update([]byte("key1"), []byte("value1"), 1, now, false)
 
 	// Verifikuj da li je kljuc umetnut i da li je vrednost odgovara
 	entry, found := tree.Search([]byte("key1"))
@@ -381,7 +381,7 @@ func TestUpdate(t *testing.T) {
 
 	// Test azuriranje postojeceg kljuca
 	newValue := []byte("new_value1")
-	tree.Update([]byte("key1"), newValue, now+1, false)
+	tree.Update([]byte("key1"), newValue, 2, now+1, false)
 
 	// Da li je vrednost azurirana
 	entry, _ = tree.Search([]byte("key1"))
@@ -390,7 +390,7 @@ func TestUpdate(t *testing.T) {
 	}
 
 	// Test tombstone azuranje
-	tree.Update([]byte("key1"), nil, now+2, true)
+	tree.Update([]byte("key1"), nil, 3, now+2, true)
 
 	// verifikuj tombstone
 	entry, _ = tree.Search([]byte("key1"))
@@ -15,6 +15,8 @@ type Cache struct {
 	Items    map[string]*list.Element // Heš mapa koja čuva ključeve i pokazivače na elemente u kešu
 	List     *list.List               // Lista koja čuva elemente u redosledu pristupa
 	Mu       sync.Mutex
+	hits     uint64 // Broj pogodaka (za statistiku)
+	misses   uint64 // Broj promašaja (za statistiku)
 }
 
 // Funkcija za kreiranje novog keša
@@ -35,13 +37,22 @@ func (c *Cache) Get(key string) (*adapter.MemtableEntry, bool) {
 		c.List.MoveToFront(element) // Pomeri element na početak liste
 		if element.Value != nil {
 			if entry, ok := element.Value.(*adapter.MemtableEntry); ok {
+				c.hits++
 				return entry, true
 			}
 		}
 	}
+	c.misses++
 	return nil, false // Ako ključ ne postoji, vrati null i false
 }
 
+// Stats vraća broj pogodaka i promašaja keša, kao i broj elemenata koji su trenutno u kešu
+func (c *Cache) Stats() (hits uint64, misses uint64, size int) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+	return c.hits, c.misses, len(c.Items)
+}
+
 func (c *Cache) Put(entry adapter.MemtableEntry) error {
 	if len(entry.Key) == 0 {
 		return errors.New("cache: entry key is empty")
@@ -56,6 +67,7 @@ func (c *Cache) Put(entry adapter.MemtableEntry) error {
 		c.List.MoveToFront(element) // Pomeri postojeći element na početak
 		if existingEntry, ok := element.Value.(*adapter.MemtableEntry); ok {
 			existingEntry.Value = entry.Value         // Ažuriraj vrednost
+			existingEntry.Seq = entry.Seq             // Ažuriraj i sekvencni broj
 			existingEntry.Timestamp = entry.Timestamp // Ažuriraj i timestamp
 			existingEntry.Tombstone = entry.Tombstone // Ažuriraj i tombstone
 			return nil
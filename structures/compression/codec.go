@@ -0,0 +1,236 @@
+package compression
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/iigor000/database/config"
+)
+
+// Codec kompresuje i dekompresuje blokove SSTable-a
+// ID se upisuje u svaki blok, pa se ID postojeceg kodeka nikad ne sme menjati
+type Codec interface {
+	ID() byte
+	Name() string
+	Compress(src []byte) ([]byte, error)
+	Decompress(src []byte) ([]byte, error)
+}
+
+// ID-jevi kodeka
+const (
+	CodecNone  byte = 0
+	CodecFlate byte = 1
+	CodecZlib  byte = 2
+	CodecLZ    byte = 3
+)
+
+var codecs = []Codec{noneCodec{}, flateCodec{}, zlibCodec{}, lzCodec{}}
+
+// MaxBlockSize je najveca velicina bloka posle dekompresije
+// Veci blokovi se upisuju bez kompresije, pa ostecena duzina u kompresovanom bloku ne moze da zauzme vise memorije od ovoga
+const MaxBlockSize = 1 << 28
+
+// CodecByID vraca kodek sa datim ID-jem
+func CodecByID(id byte) (Codec, error) {
+	for _, c := range codecs {
+		if c.ID() == id {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown codec id %d", id)
+}
+
+// CodecByName vraca kodek sa datim imenom (config.CodecNone, config.CodecFlate, ...)
+func CodecByName(name string) (Codec, error) {
+	for _, c := range codecs {
+		if c.Name() == name {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown codec %q", name)
+}
+
+// noneCodec ne menja podatke
+type noneCodec struct{}
+
+func (noneCodec) ID() byte                              { return CodecNone }
+func (noneCodec) Name() string                          { return config.CodecNone }
+func (noneCodec) Compress(src []byte) ([]byte, error)   { return src, nil }
+func (noneCodec) Decompress(src []byte) ([]byte, error) { return src, nil }
+
+// flateCodec koristi DEFLATE iz standardne biblioteke
+type flateCodec struct{}
+
+func (flateCodec) ID() byte     { return CodecFlate }
+func (flateCodec) Name() string { return config.CodecFlate }
+
+func (flateCodec) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (flateCodec) Decompress(src []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(src))
+	defer r.Close()
+	return readLimited(r)
+}
+
+// zlibCodec koristi zlib iz standardne biblioteke (DEFLATE sa zaglavljem i Adler-32 sumom)
+type zlibCodec struct{}
+
+func (zlibCodec) ID() byte     { return CodecZlib }
+func (zlibCodec) Name() string { return config.CodecZlib }
+
+func (zlibCodec) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (zlibCodec) Decompress(src []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readLimited(r)
+}
+
+// readLimited cita dekompresovane podatke, najvise MaxBlockSize bajtova
+func readLimited(r io.Reader) ([]byte, error) {
+	out, err := io.ReadAll(io.LimitReader(r, MaxBlockSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > MaxBlockSize {
+		return nil, fmt.Errorf("decompressed block larger than %d bytes", MaxBlockSize)
+	}
+	return out, nil
+}
+
+/*
+	=== LZ ===
+
+	+------------------------------+---------------------------------------------+
+	| Duzina nekompresovanih (var) | Tokeni: (duzina<<1 | vrsta) varint, podaci  |
+	+------------------------------+---------------------------------------------+
+
+	Vrsta 0 je niz literala: iza tokena je duzina bajtova koji se samo prepisuju
+	Vrsta 1 je kopija: iza tokena je offset (varint), kopira se duzina bajtova od offset bajtova unazad
+	Ponavljanja se traze hash tabelom po 4 bajta, bez trazenja najboljeg poklapanja, pa je kompresija brza
+*/
+
+const (
+	lzMinMatch  = 4
+	lzHashBits  = 14
+	lzMaxOffset = 1 << 16 // Dalja ponavljanja se ne traze
+)
+
+// lzCodec je brz LZ77 kodek, slabije kompresuje od flate-a ali je mnogo brzi
+type lzCodec struct{}
+
+func (lzCodec) ID() byte     { return CodecLZ }
+func (lzCodec) Name() string { return config.CodecLZ }
+
+func lzHash(v uint32) uint32 {
+	return (v * 2654435761) >> (32 - lzHashBits)
+}
+
+func (lzCodec) Compress(src []byte) ([]byte, error) {
+	out := make([]byte, 0, len(src)/2+16)
+	out = binary.AppendUvarint(out, uint64(len(src)))
+	var table [1 << lzHashBits]int32 // Poslednja pozicija + 1 za svaki hash, 0 znaci prazno
+	literal := 0                     // Pocetak literala koji jos nisu upisani
+	for i := 0; i+lzMinMatch <= len(src); {
+		v := binary.LittleEndian.Uint32(src[i:])
+		h := lzHash(v)
+		candidate := int(table[h]) - 1
+		table[h] = int32(i + 1)
+		if candidate < 0 || i-candidate > lzMaxOffset || binary.LittleEndian.Uint32(src[candidate:]) != v {
+			i++
+			continue
+		}
+		length := lzMinMatch
+		for i+length < len(src) && src[candidate+length] == src[i+length] {
+			length++
+		}
+		if literal < i {
+			out = binary.AppendUvarint(out, uint64(i-literal)<<1)
+			out = append(out, src[literal:i]...)
+		}
+		out = binary.AppendUvarint(out, uint64(length)<<1|1)
+		out = binary.AppendUvarint(out, uint64(i-candidate))
+		i += length
+		literal = i
+	}
+	if literal < len(src) {
+		out = binary.AppendUvarint(out, uint64(len(src)-literal)<<1)
+		out = append(out, src[literal:]...)
+	}
+	return out, nil
+}
+
+func (lzCodec) Decompress(src []byte) ([]byte, error) {
+	size, n := binary.Uvarint(src)
+	if n <= 0 {
+		return nil, fmt.Errorf("lz: invalid length")
+	}
+	if size > MaxBlockSize {
+		return nil, fmt.Errorf("lz: length %d larger than %d bytes", size, MaxBlockSize)
+	}
+	src = src[n:]
+	out := make([]byte, 0, size)
+	for len(src) > 0 {
+		token, n := binary.Uvarint(src)
+		if n <= 0 {
+			return nil, fmt.Errorf("lz: invalid token")
+		}
+		src = src[n:]
+		length := token >> 1
+		if length > size-uint64(len(out)) {
+			return nil, fmt.Errorf("lz: output longer than %d bytes", size)
+		}
+		if token&1 == 0 {
+			if length > uint64(len(src)) {
+				return nil, fmt.Errorf("lz: literal out of input")
+			}
+			out = append(out, src[:length]...)
+			src = src[length:]
+			continue
+		}
+		offset, n := binary.Uvarint(src)
+		if n <= 0 || offset == 0 || offset > uint64(len(out)) {
+			return nil, fmt.Errorf("lz: invalid copy offset")
+		}
+		src = src[n:]
+		// Kopija se moze preklapati sa onim sto pise (npr. niz istih bajtova), pa ide bajt po bajt
+		start := len(out) - int(offset)
+		for i := 0; i < int(length); i++ {
+			out = append(out, out[start+i])
+		}
+	}
+	if uint64(len(out)) != size {
+		return nil, fmt.Errorf("lz: got %d bytes, want %d", len(out), size)
+	}
+	return out, nil
+}
@@ -2,6 +2,9 @@ package compression
 
 import (
 	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
 
 	"github.com/iigor000/database/structures/block_organization"
 )
@@ -89,22 +92,46 @@ func Read(path string, cbm *block_organization.CachedBlockManager) (*Dictionary,
 	}
 	dict, pass := Deserialize(data)
 	if !pass {
-		return nil, err // Greska pri dekodiranju
+		return nil, fmt.Errorf("dictionary %s is corrupted", path) // Greska pri dekodiranju
 	}
 	return dict, nil
 }
 
-// Pisanje u fajl
+// Pisanje u fajl, recnik se upisuje u privremeni fajl koji zamenjuje stari tek kad je ceo na disku
+// Tako posle pada sistema na disku ostaje ili stari ili novi recnik, nikad delimicno upisan
 func (d *Dictionary) Write(path string, cbm *block_organization.CachedBlockManager) error {
-
 	encoded := d.Serialize()
-	_, err := cbm.Append(path, encoded)
-	if err != nil {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if _, err := cbm.BM.Append(tmp, encoded); err != nil {
 		return err // Greska pri pisanju u fajl
 	}
+	file, err := os.Open(tmp)
+	if err != nil {
+		return err
+	}
+	err = file.Sync()
+	file.Close()
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	cbm.C.Put(fmt.Sprintf("%s:%d", path, 0), encoded) // Kes ne sme da vrati stari recnik
 	return nil
 }
 
+// Len vraca broj kljuceva u recniku
+func (d *Dictionary) Len() int {
+	return len(d.keys)
+}
+
 func (d *Dictionary) IsEmpty() bool {
 	return len(d.keys) == 0
 }
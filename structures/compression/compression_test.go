@@ -1,6 +1,10 @@
 package compression
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
 	"testing"
 
 	"github.com/iigor000/database/config"
@@ -107,3 +111,57 @@ func TestReadWriteFile(t *testing.T) {
 		t.Errorf("Decoded keys do not match original: %s, %s", decoded.keys[0], decoded.keys[1])
 	}
 }
+
+func TestCodecs(t *testing.T) {
+	random := make([]byte, 5000)
+	rand.New(rand.NewSource(1)).Read(random)
+	var records []byte
+	for i := 0; i < 500; i++ {
+		records = append(records, fmt.Sprintf("user:%06d|value-%d|", i, i%7)...)
+	}
+	inputs := map[string][]byte{
+		"empty":   {},
+		"short":   []byte("abc"),
+		"run":     bytes.Repeat([]byte{'a'}, 10000),
+		"random":  random,
+		"records": records,
+	}
+
+	for _, name := range []string{config.CodecNone, config.CodecFlate, config.CodecZlib, config.CodecLZ} {
+		codec, err := CodecByName(name)
+		if err != nil {
+			t.Fatalf("CodecByName(%s) failed: %v", name, err)
+		}
+		if byID, err := CodecByID(codec.ID()); err != nil || byID.Name() != name {
+			t.Errorf("CodecByID(%d) = %v, %v; want %s", codec.ID(), byID, err, name)
+		}
+		for inputName, input := range inputs {
+			compressed, err := codec.Compress(input)
+			if err != nil {
+				t.Fatalf("%s: Compress(%s) failed: %v", name, inputName, err)
+			}
+			decompressed, err := codec.Decompress(compressed)
+			if err != nil || !bytes.Equal(decompressed, input) {
+				t.Errorf("%s: round trip of %s = %d bytes, %v; want %d bytes", name, inputName, len(decompressed), err, len(input))
+			}
+			if name != config.CodecNone && (inputName == "run" || inputName == "records") && len(compressed) >= len(input)/2 {
+				t.Errorf("%s: %s compressed to %d of %d bytes", name, inputName, len(compressed), len(input))
+			}
+		}
+	}
+
+	if _, err := CodecByName("snappy"); err == nil {
+		t.Error("expected error for unknown codec name")
+	}
+	if _, err := CodecByID(200); err == nil {
+		t.Error("expected error for unknown codec id")
+	}
+	lz, _ := CodecByName(config.CodecLZ)
+	compressed, _ := lz.Compress(records)
+	tooLarge := binary.AppendUvarint(nil, MaxBlockSize+1)
+	for _, bad := range [][]byte{compressed[:len(compressed)/2], append([]byte{0xff, 0xff, 0x03}, compressed[1:]...), append(tooLarge, compressed[1:]...)} {
+		if _, err := lz.Decompress(bad); err == nil {
+			t.Error("expected error when decompressing damaged lz data")
+		}
+	}
+}
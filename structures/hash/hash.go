@@ -3,6 +3,7 @@ package hash
 import (
 	"crypto/md5"
 	"encoding/binary"
+	"math/bits"
 	"time"
 )
 
@@ -12,7 +13,9 @@ type HashWithSeed struct {
 
 func (h HashWithSeed) Hash(data []byte) uint64 {
 	fn := md5.New()
-	fn.Write(append(data, h.Seed...))
+	// Seed se upisuje posebno, append bi mogao da prepise niz iza data (npr. sledeci kljuc u recniku)
+	fn.Write(data)
+	fn.Write(h.Seed)
 	return binary.BigEndian.Uint64(fn.Sum(nil))
 }
 
@@ -27,3 +30,72 @@ func CreateHashFunctions(k uint32) []HashWithSeed {
 	}
 	return h
 }
+
+// Konstante xxHash64
+const (
+	prime1 uint64 = 11400714785074694791
+	prime2 uint64 = 14029467366897019727
+	prime3 uint64 = 1609587929392839161
+	prime4 uint64 = 9650029242287828579
+	prime5 uint64 = 2870177450012600261
+)
+
+// Hash64 je xxHash64: brz, nekriptografski hash koji za isti ulaz i seed uvek daje isti rezultat
+// Za razliku od HashWithSeed ne zavisi od vremena pravljenja, pa moze da se koristi u fajlovima na disku
+func Hash64(data []byte, seed uint64) uint64 {
+	n := len(data)
+	var h uint64
+	if n >= 32 {
+		v1 := seed + prime1 + prime2
+		v2 := seed + prime2
+		v3 := seed
+		v4 := seed - prime1
+		for len(data) >= 32 {
+			v1 = round(v1, binary.LittleEndian.Uint64(data[0:]))
+			v2 = round(v2, binary.LittleEndian.Uint64(data[8:]))
+			v3 = round(v3, binary.LittleEndian.Uint64(data[16:]))
+			v4 = round(v4, binary.LittleEndian.Uint64(data[24:]))
+			data = data[32:]
+		}
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = mergeRound(h, v1)
+		h = mergeRound(h, v2)
+		h = mergeRound(h, v3)
+		h = mergeRound(h, v4)
+	} else {
+		h = seed + prime5
+	}
+	h += uint64(n)
+
+	for ; len(data) >= 8; data = data[8:] {
+		h ^= round(0, binary.LittleEndian.Uint64(data))
+		h = bits.RotateLeft64(h, 27)*prime1 + prime4
+	}
+	if len(data) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(data)) * prime1
+		h = bits.RotateLeft64(h, 23)*prime2 + prime3
+		data = data[4:]
+	}
+	for _, b := range data {
+		h ^= uint64(b) * prime5
+		h = bits.RotateLeft64(h, 11) * prime1
+	}
+
+	h ^= h >> 33
+	h *= prime2
+	h ^= h >> 29
+	h *= prime3
+	h ^= h >> 32
+	return h
+}
+
+func round(acc, input uint64) uint64 {
+	acc += input * prime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * prime1
+}
+
+func mergeRound(acc, val uint64) uint64 {
+	acc ^= round(0, val)
+	return acc*prime1 + prime4
+}
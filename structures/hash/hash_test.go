@@ -0,0 +1,30 @@
+package hash
+
+import (
+	"strings"
+	"testing"
+)
+
+// Test proverava Hash64 na poznatim vrednostima xxHash64
+func TestHash64(t *testing.T) {
+	tests := []struct {
+		data string
+		want uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+		{"Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+	}
+	for _, test := range tests {
+		if got := Hash64([]byte(test.data), 0); got != test.want {
+			t.Errorf("Hash64(%q) = %#x, want %#x", test.data, got, test.want)
+		}
+	}
+
+	// Duzi ulaz ide kroz glavnu petlju po 32 bajta
+	long := []byte(strings.Repeat("abcdefghijklmnopqrstuvwxyz", 4))
+	if Hash64(long, 0) != Hash64(long, 0) || Hash64(long, 0) == Hash64(long, 1) || Hash64(long, 0) == Hash64(long[1:], 0) {
+		t.Error("Hash64 of long input does not depend only on data and seed")
+	}
+}
@@ -24,10 +24,11 @@ func (h *HashMap) Search(key []byte) (*adapter.MemtableEntry, bool) {
 	return entry, true
 }
 
-func (h *HashMap) Update(key []byte, value []byte, timestamp int64, tombstone bool) {
+func (h *HashMap) Update(key []byte, value []byte, seq uint64, timestamp int64, tombstone bool) {
 	h.data[string(key)] = &adapter.MemtableEntry{
 		Key:       key,
 		Value:     value,
+		Seq:       seq,
 		Timestamp: timestamp,
 		Tombstone: tombstone,
 	}
@@ -7,9 +7,9 @@ import (
 // Pravi se iterator i prolazi kroz sve kljuceve
 func TestIterator(t *testing.T) {
 	hm := NewHashMap()
-	hm.Update([]byte("key1"), []byte("one"), 0, false)
-	hm.Update([]byte("key2"), []byte("two"), 0, false)
-	hm.Update([]byte("key3"), []byte("three"), 0, false)
+	hm.Update([]byte("key1"), []byte("one"), 0, 0, false)
+	hm.Update([]byte("key2"), []byte("two"), 0, 0, false)
+	hm.Update([]byte("key3"), []byte("three"), 0, 0, false)
 
 	iter, err := hm.NewIterator()
 	if err != nil {
@@ -48,10 +48,10 @@ func TestIterator(t *testing.T) {
 
 func TestRangeIterator(t *testing.T) {
 	hm := NewHashMap()
-	hm.Update([]byte("key1"), []byte("one"), 0, false)
-	hm.Update([]byte("key2"), []byte("two"), 0, false)
-	hm.Update([]byte("key3"), []byte("three"), 0, false)
-	hm.Update([]byte("key4"), []byte("four"), 0, false)
+	hm.Update([]byte("key1"), []byte("one"), 0, 0, false)
+	hm.Update([]byte("key2"), []byte("two"), 0, 0, false)
+	hm.Update([]byte("key3"), []byte("three"), 0, 0, false)
+	hm.Update([]byte("key4"), []byte("four"), 0, 0, false)
 
 	startKey := []byte("key2")
 	endKey := []byte("key4")
@@ -93,11 +93,11 @@ func TestRangeIterator(t *testing.T) {
 
 func TestPrefixIterator(t *testing.T) {
 	hm := NewHashMap()
-	hm.Update([]byte("notkey1"), []byte("onenot"), 0, false)
-	hm.Update([]byte("key1"), []byte("one"), 0, false)
-	hm.Update([]byte("key2"), []byte("two"), 0, false)
-	hm.Update([]byte("key3"), []byte("three"), 0, false)
-	hm.Update([]byte("notkey4"), []byte("fournot"), 0, false)
+	hm.Update([]byte("notkey1"), []byte("onenot"), 0, 0, false)
+	hm.Update([]byte("key1"), []byte("one"), 0, 0, false)
+	hm.Update([]byte("key2"), []byte("two"), 0, 0, false)
+	hm.Update([]byte("key3"), []byte("three"), 0, 0, false)
+	hm.Update([]byte("notkey4"), []byte("fournot"), 0, 0, false)
 
 	prefix := []byte("key")
 	prefixIter, err := hm.NewPrefixIterator(prefix)
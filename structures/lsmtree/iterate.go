@@ -10,9 +10,33 @@ import (
 	"github.com/iigor000/database/structures/sstable"
 )
 
+// OpenTables otvara sve SSTable-ove koje pretrazuje Get (nivoi 1 do MaxLevel-1)
+// Tabele su poredjane od najnovijih ka najstarijim: nivo po nivo, a na nivou od najvece generacije
+// Fajlovi otvorenih tabela se ne brisu (npr. posle kompakcije) dok se ne pozove release
+func OpenTables(vs *VersionSet, dict *compression.Dictionary, cbm *block_organization.CachedBlockManager) ([]*sstable.SSTable, func(), error) {
+	conf := vs.conf
+	v := vs.acquire()
+	release := func() { vs.release(v) }
+
+	var tables []*sstable.SSTable
+	for level := 1; level < conf.LSMTree.MaxLevel; level++ {
+		for _, ref := range v.references(level, false) { // najnoviji podaci prvo
+			table, err := vs.tables.open(conf, *ref, dict, cbm)
+			if err != nil {
+				release()
+				return nil, nil, err
+			}
+
+			tables = append(tables, table)
+		}
+	}
+	return tables, release, nil
+}
+
 type LSMTreeIterator struct {
 	iterators    []*sstable.SSTableIterator
 	CurrentEntry *adapter.MemtableEntry // trenutni zapis koji se koristi za iteraciju
+	tombstones   bool                   // Da li Next vraca i tombstone-ove (za kompakciju)
 }
 
 func NewLSMTreeIterator(tables []*sstable.SSTable, bm *block_organization.CachedBlockManager) *LSMTreeIterator {
@@ -57,13 +81,13 @@ func (l *LSMTreeIterator) Next() *adapter.MemtableEntry {
 			return nil
 		}
 
-		// Skupi sve zapise sa tim ključem i zadrži onaj sa najvećim timestamp-om
+		// Skupi sve zapise sa tim ključem i zadrži onaj sa najvećim sekvencnim brojem
 		var bestEntry *adapter.MemtableEntry
 		var itersToAdvance []*sstable.SSTableIterator
 		for _, iter := range l.iterators {
 			entry := iter.Peek()
 			if entry != nil && bytes.Equal(entry.Key, minKey) {
-				if bestEntry == nil || entry.Timestamp > bestEntry.Timestamp {
+				if bestEntry == nil || entry.Seq > bestEntry.Seq {
 					bestEntry = entry
 				}
 				itersToAdvance = append(itersToAdvance, iter)
@@ -74,13 +98,23 @@ func (l *LSMTreeIterator) Next() *adapter.MemtableEntry {
 			iter.Next() // Pomeri iterator na sledeći element
 		}
 
-		if bestEntry != nil && !bestEntry.Tombstone {
+		if bestEntry != nil && (l.tombstones || !bestEntry.Tombstone) {
 			l.CurrentEntry = bestEntry
 			return bestEntry
 		}
 	}
 }
 
+// newCompactionIterator je kao NewLSMTreeIterator, ali vraca i tombstone-ove, kompakcija odlucuje da li ih zadrzava
+// Kod istog sekvencnog broja pobedjuje zapis iz ranije tabele, pa tabele treba poredjati od najnovije
+func newCompactionIterator(tables []*sstable.SSTable, bm *block_organization.CachedBlockManager) *LSMTreeIterator {
+	iter := NewLSMTreeIterator(tables, bm)
+	if iter != nil {
+		iter.tombstones = true
+	}
+	return iter
+}
+
 type PrefixIterator struct {
 	iterators     []*sstable.PrefixIterator
 	CurrentRecord *adapter.MemtableEntry
@@ -116,8 +150,8 @@ func PrefixIterate(tables []*sstable.SSTable, conf *config.Config, prefix string
 
 		if bytes.Compare(it.Key, minEntry.Key) < 0 {
 			minEntry = it // Pronađen je manji ključ, ažuriraj minEntry
-		} else if bytes.Equal(minEntry.Key, it.Key) && minEntry.Timestamp < it.Timestamp {
-			minEntry = it // Ažuriraj minEntry ako je timestamp veći
+		} else if bytes.Equal(minEntry.Key, it.Key) && minEntry.Seq < it.Seq {
+			minEntry = it // Ažuriraj minEntry ako je zapis noviji
 		}
 	}
 
@@ -161,8 +195,8 @@ func (pi *PrefixIterator) Next() *adapter.MemtableEntry {
 
 		if minEntry.Key == nil || bytes.Compare(it.Key, minEntry.Key) < 0 {
 			minEntry = it // Pronađen je manji ključ, ažuriraj minEntry
-		} else if minEntry.Timestamp < it.Timestamp {
-			minEntry = it // Ažuriraj minEntry ako je timestamp veći
+		} else if minEntry.Seq < it.Seq {
+			minEntry = it // Ažuriraj minEntry ako je zapis noviji
 		}
 	}
 
@@ -195,36 +229,39 @@ func (pi *PrefixIterator) Stop() {
 	pi.iterators = nil                                  // Oslobodi iteratore
 }
 
-// PrefixScan pretražuje sve SSTable-ove u LSM stablu i vraća sve zapise koji počinju sa datim prefiksom
-func PrefixScan(conf *config.Config, prefix string, cbm *block_organization.CachedBlockManager, dict *compression.Dictionary, pageNumber, pageSize int) ([]*sstable.DataRecord, error) {
-	maxLevel := conf.LSMTree.MaxLevel
-	//seenKeys := make(map[string]bool)
-	var tables []*sstable.SSTable
-
-	for level := 1; level < maxLevel; level++ {
-		refs, err := getSSTableReferences(conf, level, false) // najnoviji podaci prvo
-		if err != nil {
-			return nil, err
-		}
-
-		var tables []*sstable.SSTable
-
-		for _, ref := range refs {
-			table, err := sstable.StartSSTable(ref.Level, ref.Gen, conf, dict, cbm)
-			if err != nil {
-				return nil, err
-			}
-
-			tables = append(tables, table)
-		}
+// ApproximateSize procenjuje koliko bajtova na disku zauzimaju kljucevi iz opsega [start, end] u svim SSTable-ovima
+// Prazan start ili end znaci da opseg nije ogranicen sa te strane
+// Procena se racuna iz Summary-ja i Properties otvorenih SSTable-ova, bez citanja Data blokova
+func ApproximateSize(vs *VersionSet, start, end []byte, dict *compression.Dictionary, cbm *block_organization.CachedBlockManager) (int64, error) {
+	tables, release, err := OpenTables(vs, dict, cbm)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	var size int64
+	for _, table := range tables {
+		size += table.ApproximateSize(start, end)
 	}
+	return size, nil
+}
 
-	merged := PrefixIterate(tables, conf, prefix, cbm, dict)
+// PrefixScan pretražuje sve SSTable-ove u LSM stablu i vraća sve zapise koji počinju sa datim prefiksom
+func PrefixScan(vs *VersionSet, prefix string, cbm *block_organization.CachedBlockManager, dict *compression.Dictionary, pageNumber, pageSize int) ([]*sstable.DataRecord, error) {
+	tables, release, err := OpenTables(vs, dict, cbm)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
 	if len(tables) == 0 {
 		return nil, nil
 	}
 
+	merged := PrefixIterate(tables, vs.conf, prefix, cbm, dict)
+	if merged == nil {
+		return nil, nil // Nijedan SSTable nema zapise sa datim prefiksom
+	}
+
 	var results []*sstable.DataRecord
 	index := pageNumber * pageSize
 	endIndex := index + pageSize
@@ -243,8 +280,10 @@ func PrefixScan(conf *config.Config, prefix string, cbm *block_organization.Cach
 		results = append(results, &sstable.DataRecord{
 			Key:       entry.Key,
 			Value:     entry.Value,
+			Seq:       entry.Seq,
 			Timestamp: entry.Timestamp,
 			Tombstone: entry.Tombstone,
+			Blob:      entry.Blob,
 		})
 	}
 
@@ -289,8 +328,8 @@ func RangeIterate(tables []*sstable.SSTable, startKey, endKey string, bm *block_
 
 		if bytes.Compare(it.Key, minEntry.Key) < 0 {
 			minEntry = it // Pronađen je manji ključ, ažuriraj minEntry
-		} else if bytes.Equal(minEntry.Key, it.Key) && minEntry.Timestamp < it.Timestamp {
-			minEntry = it // Ažuriraj minEntry ako je timestamp veći
+		} else if bytes.Equal(minEntry.Key, it.Key) && minEntry.Seq < it.Seq {
+			minEntry = it // Ažuriraj minEntry ako je zapis noviji
 		}
 	}
 
@@ -337,8 +376,8 @@ func (ri *RangeIterator) Next() *adapter.MemtableEntry {
 
 		if minEntry.Key == nil || bytes.Compare(it.Key, minEntry.Key) < 0 {
 			minEntry = it // Pronađen je manji ključ, ažuriraj minEntry
-		} else if minEntry.Timestamp < it.Timestamp {
-			minEntry = it // Ažuriraj minEntry ako je timestamp veći
+		} else if minEntry.Seq < it.Seq {
+			minEntry = it // Ažuriraj minEntry ako je zapis noviji
 		}
 	}
 
@@ -372,35 +411,22 @@ func (ri *RangeIterator) Stop() {
 }
 
 // RangeScan pretražuje sve SSTable-ove u LSM stablu i vraća sve zapise koji su unutar datog opsega ključeva
-func RangeScan(conf *config.Config, startKey, endKey string, cbm *block_organization.CachedBlockManager, dict *compression.Dictionary, pageNumber, pageSize int) ([]*sstable.DataRecord, error) {
-	maxLevel := conf.LSMTree.MaxLevel
-	//seenKeys := make(map[string]bool)
-	var tables []*sstable.SSTable
-
-	for level := 1; level < maxLevel; level++ {
-		refs, err := getSSTableReferences(conf, level, false) // najnoviji podaci prvo
-		if err != nil {
-			return nil, err
-		}
-
-		var tables []*sstable.SSTable
-
-		for _, ref := range refs {
-			table, err := sstable.StartSSTable(ref.Level, ref.Gen, conf, dict, cbm)
-			if err != nil {
-				return nil, err
-			}
-
-			tables = append(tables, table)
-		}
+func RangeScan(vs *VersionSet, startKey, endKey string, cbm *block_organization.CachedBlockManager, dict *compression.Dictionary, pageNumber, pageSize int) ([]*sstable.DataRecord, error) {
+	tables, release, err := OpenTables(vs, dict, cbm)
+	if err != nil {
+		return nil, err
 	}
-
-	merged := RangeIterate(tables, startKey, endKey, cbm)
+	defer release()
 
 	if len(tables) == 0 {
 		return nil, nil
 	}
 
+	merged := RangeIterate(tables, startKey, endKey, cbm)
+	if merged == nil {
+		return nil, nil // Nijedan SSTable nema zapise u datom opsegu
+	}
+
 	var results []*sstable.DataRecord
 	index := pageNumber * pageSize
 	endIndex := index + pageSize
@@ -419,8 +445,10 @@ func RangeScan(conf *config.Config, startKey, endKey string, cbm *block_organiza
 		results = append(results, &sstable.DataRecord{
 			Key:       entry.Key,
 			Value:     entry.Value,
+			Seq:       entry.Seq,
 			Timestamp: entry.Timestamp,
 			Tombstone: entry.Tombstone,
+			Blob:      entry.Blob,
 		})
 	}
 
@@ -4,10 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"math"
-	"os"
-	"strconv"
+	"sort"
 
-	"github.com/iigor000/database/config"
 	"github.com/iigor000/database/structures/block_organization"
 	"github.com/iigor000/database/structures/compression"
 	"github.com/iigor000/database/structures/sstable"
@@ -15,15 +13,17 @@ import (
 
 // Get traži vrednost za dati ključ u LSM stablu
 // Vraća najnoviji DataRecord ukoliko je pronađen (na najnižem LSM nivou),
-// Ako je isti key pronađen u više SSTable-ova, vraća vrednost sa najnovijim timestamp-om
-func Get(conf *config.Config, key []byte, dict *compression.Dictionary, cbm *block_organization.CachedBlockManager) (*sstable.DataRecord, error) {
+// Ako je isti key pronađen u više SSTable-ova, vraća zapis sa najvećim sekvencnim brojem
+// Svi nivoi se čitaju iz iste verzije, pa kompakcija tokom pretrage ne može da sakrije ključ
+func Get(vs *VersionSet, key []byte, dict *compression.Dictionary, cbm *block_organization.CachedBlockManager) (*sstable.DataRecord, error) {
+	conf := vs.conf
 	maxLevel := conf.LSMTree.MaxLevel
 
+	v := vs.acquire()
+	defer vs.release(v)
+
 	for level := 1; level < maxLevel; level++ {
-		refs, err := getSSTableReferences(conf, level, false) // Sortiraj po generaciji u opadajućem redosledu (najnoviji podaci su kod većih generacija)
-		if err != nil {
-			return nil, err
-		}
+		refs := v.references(level, false) // Sortiraj po generaciji u opadajućem redosledu (najnoviji podaci su kod većih generacija)
 
 		if len(refs) == 0 {
 			continue // Nema SSTable-ova na ovom nivou, ništa ne radimo
@@ -31,16 +31,19 @@ func Get(conf *config.Config, key []byte, dict *compression.Dictionary, cbm *blo
 
 		var record *sstable.DataRecord = nil
 		for _, ref := range refs {
-			table, err := sstable.StartSSTable(ref.Level, ref.Gen, conf, dict, cbm)
+			table, err := vs.tables.open(conf, *ref, dict, cbm)
 			if err != nil {
-				return nil, fmt.Errorf("failed to open SSTable for level %d, gen %d: %w", ref.Level, ref.Gen, err)
+				return nil, err
 			}
 
-			rec, _ := table.Get(conf, key, cbm)
+			rec, err := table.Get(conf, key, cbm)
+			if err != nil {
+				return nil, fmt.Errorf("error reading sstable %d on level %d: %w", ref.Gen, level, err)
+			}
 			if record == nil {
 				record = rec
 			}
-			if rec != nil && rec.Timestamp > record.Timestamp {
+			if rec != nil && rec.Seq > record.Seq {
 				record = rec
 			}
 		}
@@ -53,63 +56,93 @@ func Get(conf *config.Config, key []byte, dict *compression.Dictionary, cbm *blo
 	return nil, nil // Ako nije pronađen ključ ni u jednom nivou
 }
 
-// GetNextSSTableGeneration vraća sledeću generaciju SSTable-a na datom nivou
-// Proverava da li postoji direktorijum za nivo i čita sve fajlove u direktorijumu da bi pronašao najveću generaciju
-func GetNextSSTableGeneration(conf *config.Config, level int) int {
-	// Proveri da li postoji direktorijum za nivo
-	dir := fmt.Sprintf("%s/%d", conf.SSTable.SstableDirectory, level)
-	if !sstable.FileExists(dir) {
-		return 1 // Ako direktorijum ne postoji, prva generacija je 1
-	}
-
-	// Pročitaj sve fajlove u direktorijumu i pronađi najveću generaciju
-	entries, err := os.ReadDir(dir)
-	if err != nil {
-		panic(fmt.Errorf("failed to read level %d directory '%s' : %w", level, dir, err))
-	}
-
-	maxGen := 1
-	for _, entry := range entries {
-		if entry.IsDir() {
-			gen, err := strconv.Atoi(entry.Name())
-			if err == nil && gen > maxGen {
-				maxGen = gen
-			}
-		}
-	}
-
-	return maxGen + 1 // Vraća sledeću generaciju
-}
-
 // Compact pokreće kompakciju LSM stabla spajanjem SSTable-ova
 // Kompakcija se vrši na osnovu podešavanja u konfiguraciji samo ako je ostvaren uslov za kompakciju
-func Compact(conf *config.Config, dict *compression.Dictionary, cbm *block_organization.CachedBlockManager) error {
+func Compact(vs *VersionSet, dict *compression.Dictionary, cbm *block_organization.CachedBlockManager) error {
+	conf := vs.conf
 	if conf.LSMTree.CompactionAlgorithm == "size_tiered" {
-		err := sizeTieredCompaction(conf, dict, cbm)
+		err := sizeTieredCompaction(vs, dict, cbm)
 		if err != nil {
 			return fmt.Errorf("error during size-tiered compaction: %w", err)
 		}
 	} else if conf.LSMTree.CompactionAlgorithm == "leveled" {
-		err := leveledCompaction(conf, 1, dict, cbm)
+		err := leveledCompaction(vs, 1, dict, cbm)
 		if err != nil {
 			return fmt.Errorf("error during leveled compaction: %w", err)
 		}
 	} else {
 		return fmt.Errorf("unknown compaction algorithm: %s", conf.LSMTree.CompactionAlgorithm)
 	}
+	if err := tombstoneCompaction(vs, dict, cbm); err != nil {
+		return fmt.Errorf("error during tombstone compaction: %w", err)
+	}
+	return nil
+}
+
+// CompactRange ručno pokreće kompakciju svih SSTable-ova čiji se opseg ključeva preklapa sa [start, end]
+// Prazan start ili end znači da opseg nije ograničen sa te strane
+// Preklapajući SSTable-ovi se spuštaju nivo po nivo, a na poslednjem nivou se spajaju u jedan SSTable
+func CompactRange(vs *VersionSet, start, end []byte, dict *compression.Dictionary, cbm *block_organization.CachedBlockManager) error {
+	lastLevel := bottomLevel(vs.conf) // Get pretražuje nivoe od 1 do MaxLevel-1
+
+	for level := 1; level <= lastLevel; level++ {
+		v := vs.acquire()
+		var inRange []*SSTableReference
+		var minKey, maxKey []byte
+		for _, ref := range v.references(level, true) {
+			meta := v.meta(ref.Level, ref.Gen)
+			if (len(end) > 0 && bytes.Compare(meta.MinKey, end) > 0) || (len(start) > 0 && bytes.Compare(meta.MaxKey, start) < 0) {
+				continue // Van opsega
+			}
+			if minKey == nil || bytes.Compare(meta.MinKey, minKey) < 0 {
+				minKey = meta.MinKey
+			}
+			if maxKey == nil || bytes.Compare(meta.MaxKey, maxKey) > 0 {
+				maxKey = meta.MaxKey
+			}
+			inRange = append(inRange, ref)
+		}
+		if len(inRange) == 0 {
+			vs.release(v)
+			continue
+		}
+		// Stariji SSTable-ovi sa nivoa koji se preklapaju sa opsegom idu zajedno sa njim, inace bi ostali iznad novijih zapisa
+		inRange, minKey, maxKey = expandInputs(v, level, inRange, minKey, maxKey, level == lastLevel)
+		vs.release(v)
+
+		if level == lastLevel {
+			// Na poslednjem nivou nema gde dalje, spajamo samo ako ima vise SSTable-ova
+			if len(inRange) > 1 {
+				if err := mergeTables(vs, level, sstable.ReasonManual, cbm, dict, inRange[0], inRange[1:]...); err != nil {
+					return fmt.Errorf("error merging tables for level %d: %w", level, err)
+				}
+			}
+			break
+		}
+
+		overlapping, err := getOverlappingReferences(vs, level+1, minKey, maxKey, cbm)
+		if err != nil {
+			return fmt.Errorf("error getting overlapping SSTables for level %d: %w", level+1, err)
+		}
+		if err := mergeTables(vs, level+1, sstable.ReasonManual, cbm, dict, inRange[0], append(inRange[1:], overlapping...)...); err != nil {
+			return fmt.Errorf("error merging tables for level %d: %w", level, err)
+		}
+	}
 	return nil
 }
 
 // sizeTieredCompaction vrši kompakciju na osnovu broja SSTable-ova na nivou
-func sizeTieredCompaction(conf *config.Config, dict *compression.Dictionary, cbm *block_organization.CachedBlockManager) error {
-	maxLevel := conf.LSMTree.MaxLevel
+// Poslednji nivo (MaxLevel-1, poslednji koji Get pretražuje) se ne spaja dalje
+func sizeTieredCompaction(vs *VersionSet, dict *compression.Dictionary, cbm *block_organization.CachedBlockManager) error {
+	conf := vs.conf
+	lastLevel := bottomLevel(conf)
 
 	level := 1
 
-	for level < maxLevel {
+	for level < lastLevel {
 		maxSSTablesPerLevel := conf.LSMTree.MaxTablesPerLevel
 
-		refs, err := getSSTableReferences(conf, level, true) // Sortiraj po generaciji u opadajućem redosledu
+		refs, err := getSSTableReferences(vs, level, true) // Sortiraj po generaciji u opadajućem redosledu
 		if err != nil {
 			return fmt.Errorf("error getting SSTable references for level %d: %v", level, err)
 		}
@@ -121,11 +154,11 @@ func sizeTieredCompaction(conf *config.Config, dict *compression.Dictionary, cbm
 		for len(refs) >= maxSSTablesPerLevel {
 			// Spaja prve dve tabele i kreira novu SSTable na sledećem nivou
 			// briše stare SSTable-ove
-			err = mergeTables(conf, level+1, cbm, dict, refs[0], refs[1])
+			err = mergeTables(vs, level+1, sstable.ReasonSizeTiered, cbm, dict, refs[0], refs[1])
 			if err != nil {
 				return fmt.Errorf("error merging tables for level %d: %w", level, err)
 			}
-			refs, err = getSSTableReferences(conf, level, true)
+			refs, err = getSSTableReferences(vs, level, true)
 			if err != nil {
 				return fmt.Errorf("error getting SSTable references for level %d after merge: %w", level, err)
 			}
@@ -138,23 +171,31 @@ func sizeTieredCompaction(conf *config.Config, dict *compression.Dictionary, cbm
 }
 
 // needCompaction proverava da li je potrebno izvršiti kompakciju na datom nivou (za Leveled kompakciju)
-func needCompaction(conf *config.Config, level int, refs []*SSTableReference) (bool, error) {
+func needCompaction(vs *VersionSet, level int, refs []*SSTableReference) (bool, error) {
+	conf := vs.conf
 	if len(refs) == 0 {
 		return false, nil
 	}
 
 	maxSSTablesSize := conf.LSMTree.BaseSSTableLimit * int(math.Pow(float64(conf.LSMTree.LevelSizeMultiplier), float64(level)))
 
+	v := vs.acquire()
+	defer vs.release(v)
+
 	totalDataSize := 0
 	// Proverava da li je data block size na nivou veći od maksimalnog
+	// Velicina Data dela je iz Properties, a SSTable-ovi bez njih se racunaju celom velicinom na disku
 	for _, ref := range refs {
-		path := fmt.Sprintf("%s/%d/%d", conf.SSTable.SstableDirectory, ref.Level, ref.Gen)
-		if conf.SSTable.SingleFile {
-			path = sstable.CreateFileName(fmt.Sprintf("%s/%d", conf.SSTable.SstableDirectory, ref.Level), ref.Gen, "SSTable", "db")
+		meta := v.meta(ref.Level, ref.Gen)
+		if meta == nil {
+			continue // SSTable je u međuvremenu uklonjen
 		}
-		size := sstable.CalculateDataSize(path, conf)
 
-		totalDataSize += int(size)
+		if meta.DataSize > 0 {
+			totalDataSize += int(meta.DataSize)
+		} else {
+			totalDataSize += int(meta.Size)
+		}
 
 		if totalDataSize > maxSSTablesSize {
 			return true, nil // Ako je ukupna veličina podataka veća od maksimalne, potrebno je izvršiti kompakciju
@@ -166,8 +207,8 @@ func needCompaction(conf *config.Config, level int, refs []*SSTableReference) (b
 
 // getOverlappingReferences vraća sve reference na SSTable-ove na sledećem nivou koji se preklapaju sa datim SSTable-om
 // Preklapanje se vrši na osnovu ključeva u Summary-ju
-func getOverlappingReferences(conf *config.Config, nextLevel int, minSSTKey []byte, maxSSTKey []byte, cbm *block_organization.CachedBlockManager) ([]*SSTableReference, error) {
-	refs, err := getSSTableReferences(conf, nextLevel, true)
+func getOverlappingReferences(vs *VersionSet, nextLevel int, minSSTKey []byte, maxSSTKey []byte, cbm *block_organization.CachedBlockManager) ([]*SSTableReference, error) {
+	refs, err := getSSTableReferences(vs, nextLevel, true)
 	if err != nil {
 		return nil, fmt.Errorf("error getting SSTable references for level %d: %v", nextLevel, err)
 	}
@@ -175,7 +216,7 @@ func getOverlappingReferences(conf *config.Config, nextLevel int, minSSTKey []by
 	var overlapping []*SSTableReference
 
 	for _, ref := range refs {
-		minKey, maxKey, err := sstable.ReadSummaryMinMax(ref.Level, ref.Gen, conf, cbm)
+		minKey, maxKey, err := sstable.ReadSummaryMinMax(ref.Level, ref.Gen, vs.conf, cbm)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read summary min/max for level %d, gen %d: %w", ref.Level, ref.Gen, err)
 		}
@@ -193,17 +234,22 @@ func getOverlappingReferences(conf *config.Config, nextLevel int, minSSTKey []by
 
 // leveledCompaction vrši kompakciju spram granice za nivo (maxSSTablesSize = BaseSSTableLimit * LevelSizeMultiplier^(Level))
 // Vršimo kompakciju na ovom nivou sve dok ne dostigne Size ispod granice, pa tek onda na sledećem nivou
-func leveledCompaction(conf *config.Config, level int, dict *compression.Dictionary, cbm *block_organization.CachedBlockManager) error {
+// Sa poslednjeg nivoa (MaxLevel-1, poslednji koji Get pretražuje) se ne spaja dalje
+func leveledCompaction(vs *VersionSet, level int, dict *compression.Dictionary, cbm *block_organization.CachedBlockManager) error {
+	conf := vs.conf
+	if level >= bottomLevel(conf) {
+		return nil
+	}
 	compactionDone := false
 
 	// Vršimo kompakciju na ovom nivou sve dok ne dostigne određeni Size, pa tek onda na sledećem nivou
 	for ; ; compactionDone = true {
-		refs, err := getSSTableReferences(conf, level, true) // Sortiraj po generaciji u rastućem redosledu (želimo da kompaktujemo najstarije)
+		refs, err := getSSTableReferences(vs, level, true) // Sortiraj po generaciji u rastućem redosledu (želimo da kompaktujemo najstarije)
 		if err != nil {
 			return fmt.Errorf("error getting SSTable references for level %d: %w", level, err)
 		}
 
-		toCompact, err := needCompaction(conf, level, refs)
+		toCompact, err := needCompaction(vs, level, refs)
 		if err != nil {
 			return err
 		}
@@ -222,31 +268,48 @@ func leveledCompaction(conf *config.Config, level int, dict *compression.Diction
 			return fmt.Errorf("failed to read summary min/max for level %d, gen %d: %w", refs[0].Level, refs[0].Gen, err)
 		}
 
-		overlapping, err := getOverlappingReferences(conf, level+1, minKey, maxKey, cbm)
+		overlapping, err := getOverlappingReferences(vs, level+1, minKey, maxKey, cbm)
 		if err != nil {
 			return fmt.Errorf("error getting overlapping SSTables for level %d: %w", level+1, err)
 		}
 		// Spaja prvi SSTable sa svim preklapajućim SSTable-ovima
 		// briše stare SSTable-ove
-		err = mergeTables(conf, level+1, cbm, dict, refs[0], overlapping...)
+		err = mergeTables(vs, level+1, sstable.ReasonLeveled, cbm, dict, refs[0], overlapping...)
 		if err != nil {
 			return fmt.Errorf("error merging tables for level %d: %w", level, err)
 		}
 	}
 
 	if compactionDone {
-		leveledCompaction(conf, level+1, dict, cbm)
+		leveledCompaction(vs, level+1, dict, cbm)
 	}
 
 	return nil
 }
 
-// mergeTables spaja dva ili više SSTable-ova u jedan novi SSTable i upisuje ga na newLevel
-// Briše stare fajlove SSTable-ova koji su spojeni
-func mergeTables(conf *config.Config, newLevel int, cbm *block_organization.CachedBlockManager, dict *compression.Dictionary, sst1 *SSTableReference, ssts ...*SSTableReference) error {
+// mergeTables spaja dva ili više SSTable-ova u nove SSTable-ove na newLevel
+// Zapisi se upisuju redom kako ih iterator vraća, a izlaz se deli na SSTable-ove veličine TargetSSTableSize
+// Tombstone se izbacuje samo ako nijedan stariji SSTable van kompakcije ne može da sadrži ključ
+// Novi SSTable-ovi i uklanjanje starih se upisuju u MANIFEST kao jedna izmena, tek kad su novi SSTable-ovi na disku
+// Fajlovi starih SSTable-ova se brišu kad ih više niko ne čita
+// reason i ulazni SSTable-ovi se upisuju u Properties novih SSTable-ova
+func mergeTables(vs *VersionSet, newLevel int, reason string, cbm *block_organization.CachedBlockManager, dict *compression.Dictionary, sst1 *SSTableReference, ssts ...*SSTableReference) error {
 	allRefs := append([]*SSTableReference{sst1}, ssts...)
+	// Od najnovijeg ka najstarijem (pliči nivo, pa veća generacija), iterator kod istog sekvencnog broja bira raniju tabelu
+	sort.SliceStable(allRefs, func(i, j int) bool {
+		if allRefs[i].Level != allRefs[j].Level {
+			return allRefs[i].Level < allRefs[j].Level
+		}
+		return allRefs[i].Gen > allRefs[j].Gen
+	})
 	tables := make([]*sstable.SSTable, 0, len(allRefs))
 
+	conf := vs.conf
+	v := vs.acquire()
+	defer vs.release(v)
+	gc := newTombstoneGC(conf, vs, v, newLevel, allRefs, dict, cbm)
+
+	// Ulazi se otvaraju mimo kesa tabela, posle kompakcije se brisu
 	for _, ref := range allRefs {
 		table, err := sstable.StartSSTable(ref.Level, ref.Gen, conf, dict, cbm)
 		if err != nil {
@@ -255,15 +318,28 @@ func mergeTables(conf *config.Config, newLevel int, cbm *block_organization.Cach
 		tables = append(tables, table)
 	}
 
-	iter := NewLSMTreeIterator(tables, cbm)
+	iter := newCompactionIterator(tables, cbm)
+
+	// Broj zapisa ulaznih SSTable-ova (iz Summary-ja) je gornja granica za broj zapisa izlaza
+	expected := 0
+	for _, table := range tables {
+		for _, record := range table.Summary.Records {
+			expected += record.NumberOfRecords
+		}
+	}
 
 	// Kreiraj novi SSTable builder
-	nextGen := GetNextSSTableGeneration(conf, newLevel)
+	nextGen := vs.NextGeneration(newLevel)
 	fmt.Printf("Spajanje SSTable-ova na nivou %d, generacija %d\n", newLevel, nextGen)
-	builder, err := NewSSTableBuilder(newLevel, nextGen, conf)
+	builder, err := NewSSTableBuilder(newLevel, nextGen, expected, conf, dict, cbm)
 	if err != nil {
 		return fmt.Errorf("failed to create new SSTable builder: %w", err)
 	}
+	sources := make([]sstable.Source, 0, len(allRefs))
+	for _, ref := range allRefs {
+		sources = append(sources, sstable.Source{Level: ref.Level, Gen: ref.Gen})
+	}
+	builder.SetOrigin(reason, sources)
 
 	for {
 		if iter == nil {
@@ -281,7 +357,13 @@ func mergeTables(conf *config.Config, newLevel int, cbm *block_organization.Cach
 		}
 
 		if entry.Tombstone {
-			continue // preskoči obrisane
+			drop, err := gc.canDrop(entry.Key)
+			if err != nil {
+				return err
+			}
+			if drop {
+				continue // Nijedan stariji zapis ne može da se vrati, tombstone više nije potreban
+			}
 		}
 
 		err := builder.Write(*entry)
@@ -290,19 +372,29 @@ func mergeTables(conf *config.Config, newLevel int, cbm *block_organization.Cach
 		}
 	}
 
-	// Obriši stare SSTable-ove
-	if err := sst1.DeleteFiles(conf); err != nil {
-		return err
+	// Ako su svi zapisi obrisani, novi SSTable se ne pravi, stari se samo uklanjaju
+	gens, err := builder.Finish()
+	if err != nil {
+		return fmt.Errorf("failed to finish SSTable build: %w", err)
+	}
+
+	edit := VersionEdit{NextGen: map[int]int{newLevel: nextGen + len(gens)}}
+	for _, ref := range allRefs {
+		edit.Removed = append(edit.Removed, *ref)
 	}
-	for _, s := range ssts {
-		if err := s.DeleteFiles(conf); err != nil {
+	for _, gen := range gens {
+		if err := cbm.SyncDir(fmt.Sprintf("%s/%d/%d", conf.SSTable.SstableDirectory, newLevel, gen)); err != nil {
+			return fmt.Errorf("failed to sync merged SSTable: %w", err)
+		}
+		meta, err := readTableMeta(conf, newLevel, gen, dict, cbm)
+		if err != nil {
 			return err
 		}
+		edit.Added = append(edit.Added, meta)
 	}
 
-	err = builder.Finish(cbm, dict)
-	if err != nil {
-		return fmt.Errorf("failed to finish SSTable build: %w", err)
+	if err := vs.Apply(edit); err != nil {
+		return fmt.Errorf("failed to record compaction in manifest: %w", err)
 	}
 
 	return nil
@@ -2,20 +2,24 @@ package lsmtree
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/iigor000/database/config"
 	"github.com/iigor000/database/structures/adapter"
 	"github.com/iigor000/database/structures/block_organization"
 	"github.com/iigor000/database/structures/compression"
+	"github.com/iigor000/database/structures/sstable"
 )
 
 var cbm *block_organization.CachedBlockManager
 
-func createTestConfig(t *testing.T) *config.Config {
+func createTestConfig(t testing.TB) *config.Config {
 	dir := t.TempDir()
 
 	conf := &config.Config{
@@ -45,6 +49,8 @@ func createTestConfig(t *testing.T) *config.Config {
 		},
 		Cache: config.CacheConfig{
 			Capacity: 100,
+			// Mali kes tabela, da bi se izbacivanje desavalo i u testovima
+			TableCapacity: 4,
 		},
 		LSMTree: config.LSMTreeConfig{
 			MaxLevel:            3,
@@ -74,43 +80,64 @@ func createTestConfig(t *testing.T) *config.Config {
 	return conf
 }
 
+// Helper: Otvara VersionSet za direktorijum SSTable-ova iz konfiguracije
+func createTestVersions(t testing.TB, conf *config.Config) *VersionSet {
+	t.Helper()
+	vs, err := OpenVersionSet(conf, nil)
+	if err != nil {
+		t.Fatalf("failed to open version set: %v", err)
+	}
+	return vs
+}
+
 // Helper: Kreira i upisuje SSTable sa jednim zapisom za test
-func createTestSSTable(t *testing.T, conf *config.Config, level int, gen int, key, value []byte, dict *compression.Dictionary) *SSTableReference {
+func createTestSSTable(t *testing.T, vs *VersionSet, level int, gen int, key, value []byte, dict *compression.Dictionary) *SSTableReference {
+	t.Helper()
+	return createTestSSTableEntries(t, vs, level, gen, dict, adapter.MemtableEntry{Key: key, Value: value, Seq: 1, Timestamp: 1, Tombstone: false})
+}
+
+// Helper: Kreira SSTable sa datim (sortiranim) zapisima i dodaje ga u verziju
+func createTestSSTableEntries(t testing.TB, vs *VersionSet, level int, gen int, dict *compression.Dictionary, entries ...adapter.MemtableEntry) *SSTableReference {
 	t.Helper()
 	ref := &SSTableReference{Level: level, Gen: gen}
 
-	// Kreiraj jednostavan SSTable builder i upiši jedan zapis
-	builder, err := NewSSTableBuilder(level, gen, conf)
+	builder, err := NewSSTableBuilder(level, gen, len(entries), vs.conf, dict, cbm)
 	if err != nil {
 		t.Fatalf("failed to create SSTable builder: %v", err)
 	}
 
-	err = builder.Write(adapter.MemtableEntry{Key: key, Value: value, Timestamp: 1, Tombstone: false})
-	if err != nil {
-		t.Fatalf("failed to write record: %v", err)
+	for _, entry := range entries {
+		if err := builder.Write(entry); err != nil {
+			t.Fatalf("failed to write record: %v", err)
+		}
 	}
 
-	err = builder.Finish(cbm, dict)
+	_, err = builder.Finish()
 	if err != nil {
 		t.Fatalf("failed to finish SSTable build: %v", err)
 	}
 
+	if err := AddTable(vs, level, gen, dict, cbm); err != nil {
+		t.Fatalf("failed to add SSTable to manifest: %v", err)
+	}
+
 	return ref
 }
 
 func TestGetAndCompact(t *testing.T) {
 	conf := createTestConfig(t)
+	vs := createTestVersions(t, conf)
 	dict := compression.NewDictionary()
 
 	dict.Add([]byte("key1"))
 	dict.Add([]byte("key2"))
 
 	// Napravi 2 SSTable-ova sa različitim ključevima na nivou 1
-	createTestSSTable(t, conf, 1, 1, []byte("key1"), []byte("value1"), dict)
-	createTestSSTable(t, conf, 1, 2, []byte("key2"), []byte("value2"), dict)
+	createTestSSTable(t, vs, 1, 1, []byte("key1"), []byte("value1"), dict)
+	createTestSSTable(t, vs, 1, 2, []byte("key2"), []byte("value2"), dict)
 
 	// Test Get za key1
-	rec, err := Get(conf, []byte("key1"), dict, cbm)
+	rec, err := Get(vs, []byte("key1"), dict, cbm)
 	if err != nil {
 		t.Fatalf("Get failed: %v", err)
 	}
@@ -120,7 +147,7 @@ func TestGetAndCompact(t *testing.T) {
 	fmt.Print("Key1 pronađen: ", rec.Value, "\n")
 
 	// Test Get za nepostojeći ključ
-	rec, err = Get(conf, []byte("nokey"), dict, cbm)
+	rec, err = Get(vs, []byte("nokey"), dict, cbm)
 	if err != nil {
 		t.Fatalf("Get failed: %v", err)
 	}
@@ -130,14 +157,14 @@ func TestGetAndCompact(t *testing.T) {
 	fmt.Print("Nepostojeći ključ vraća nil: ", rec, "\n")
 
 	// Test kompakcije (size-tiered) ?
-	err = Compact(conf, dict, cbm)
+	err = Compact(vs, dict, cbm)
 	if err != nil {
 		t.Fatalf("Compact failed: %v", err)
 	}
 	fmt.Print("Kompakcija uspešna\n")
 }
 
-func TestGetNextSSTableGeneration(t *testing.T) {
+func TestNextGeneration(t *testing.T) {
 	conf := createTestConfig(t)
 
 	levelDir := filepath.Join(conf.SSTable.SstableDirectory, "1")
@@ -148,13 +175,32 @@ func TestGetNextSSTableGeneration(t *testing.T) {
 	os.MkdirAll(filepath.Join(levelDir, "2"), 0755)
 	os.MkdirAll(filepath.Join(levelDir, "5"), 0755)
 
-	nextGen := GetNextSSTableGeneration(conf, 1)
+	// Ucitavanje ne menja nista na disku, MANIFEST i brisanje praznih direktorijuma su posao OpenVersionSet-a
+	loaded, err := loadVersionSet(conf, nil)
+	if err != nil {
+		t.Fatalf("failed to load versions: %v", err)
+	}
+	if gen := loaded.NextGeneration(1); gen != 6 {
+		t.Errorf("expected next gen 6, got %d", gen)
+	}
+	if _, err := os.Stat(filepath.Join(conf.SSTable.SstableDirectory, manifestFileName)); !os.IsNotExist(err) {
+		t.Errorf("expected loading to leave the manifest alone, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(levelDir, "5")); err != nil {
+		t.Errorf("expected loading to leave directories alone, got %v", err)
+	}
+
+	vs := createTestVersions(t, conf)
+	nextGen := vs.NextGeneration(1)
 	if nextGen != 6 {
 		t.Errorf("expected next gen 6, got %d", nextGen)
 	}
+	if _, err := os.Stat(filepath.Join(conf.SSTable.SstableDirectory, manifestFileName)); err != nil {
+		t.Errorf("expected OpenVersionSet to write the manifest, got %v", err)
+	}
 
 	// Test za nepostojeći direktorijum
-	nextGen = GetNextSSTableGeneration(conf, 99)
+	nextGen = vs.NextGeneration(99)
 	if nextGen != 1 {
 		t.Errorf("expected next gen 1 for missing dir, got %d", nextGen)
 	}
@@ -162,22 +208,23 @@ func TestGetNextSSTableGeneration(t *testing.T) {
 
 func TestMergeTables(t *testing.T) {
 	conf := createTestConfig(t)
+	vs := createTestVersions(t, conf)
 	dict := compression.NewDictionary()
 
 	dict.Add([]byte("a"))
 	dict.Add([]byte("b"))
 
 	// Kreiraj 2 SSTable sa po jednim zapisom
-	ref1 := createTestSSTable(t, conf, 1, 1, []byte("a"), []byte("valueA"), dict)
-	ref2 := createTestSSTable(t, conf, 1, 2, []byte("b"), []byte("valueB"), dict)
+	ref1 := createTestSSTable(t, vs, 1, 1, []byte("a"), []byte("valueA"), dict)
+	ref2 := createTestSSTable(t, vs, 1, 2, []byte("b"), []byte("valueB"), dict)
 
-	err := mergeTables(conf, 2, cbm, dict, ref1, ref2)
+	err := mergeTables(vs, 2, sstable.ReasonManual, cbm, dict, ref1, ref2)
 	if err != nil {
 		t.Fatalf("mergeTables failed: %v", err)
 	}
 
 	// Nakon merge, na nivou 2 treba postojati nova SSTable generacija 1
-	newRefs, err := getSSTableReferences(conf, 2, true)
+	newRefs, err := getSSTableReferences(vs, 2, true)
 	if err != nil {
 		t.Fatalf("failed to get SSTable references: %v", err)
 	}
@@ -192,10 +239,26 @@ func TestMergeTables(t *testing.T) {
 	if !found {
 		t.Errorf("expected merged SSTable generation 1 at level 2")
 	}
+
+	// Properties novog SSTable-a pamte razlog kompakcije i ulazne SSTable-ove
+	table, err := sstable.StartSSTable(2, 1, conf, dict, cbm)
+	if err != nil {
+		t.Fatalf("failed to open merged SSTable: %v", err)
+	}
+	p := table.Properties
+	if p == nil || p.Reason != sstable.ReasonManual || p.Entries != 2 || fmt.Sprint(p.Sources) != "[{1 2} {1 1}]" {
+		t.Errorf("unexpected properties of merged SSTable: %+v", p)
+	}
+	v := vs.acquire()
+	defer vs.release(v)
+	if meta := v.meta(2, 1); meta == nil || meta.Entries != 2 || meta.MaxSeq != p.MaxSeq || meta.DataSize != p.DataSize || meta.Size != table.DiskSize {
+		t.Errorf("unexpected table meta %+v", meta)
+	}
 }
 
 func TestMergeMultipleTables(t *testing.T) {
 	conf := createTestConfig(t)
+	vs := createTestVersions(t, conf)
 	dict := compression.NewDictionary()
 
 	dict.Add([]byte("a"))
@@ -204,18 +267,18 @@ func TestMergeMultipleTables(t *testing.T) {
 	dict.Add([]byte("d"))
 
 	// Kreiraj 2 SSTable sa po jednim zapisom
-	ref1 := createTestSSTable(t, conf, 1, 1, []byte("a"), []byte("valueA"), dict)
-	createTestSSTable(t, conf, 1, 2, []byte("b"), []byte("valueB"), dict)
-	ref3 := createTestSSTable(t, conf, 2, 1, []byte("c"), []byte("valueC"), dict)
-	createTestSSTable(t, conf, 2, 2, []byte("d"), []byte("valueD"), dict)
+	ref1 := createTestSSTable(t, vs, 1, 1, []byte("a"), []byte("valueA"), dict)
+	createTestSSTable(t, vs, 1, 2, []byte("b"), []byte("valueB"), dict)
+	ref3 := createTestSSTable(t, vs, 2, 1, []byte("c"), []byte("valueC"), dict)
+	createTestSSTable(t, vs, 2, 2, []byte("d"), []byte("valueD"), dict)
 
-	err := mergeTables(conf, 2, cbm, dict, ref1, ref3)
+	err := mergeTables(vs, 2, sstable.ReasonManual, cbm, dict, ref1, ref3)
 	if err != nil {
 		t.Fatalf("mergeTables failed: %v", err)
 	}
 
 	// Nakon merge, na nivou 2 treba postojati nova SSTable generacija 1
-	newRefs, err := getSSTableReferences(conf, 2, true)
+	newRefs, err := getSSTableReferences(vs, 2, true)
 	if err != nil {
 		t.Fatalf("failed to get SSTable references: %v", err)
 	}
@@ -234,3 +297,491 @@ func TestMergeMultipleTables(t *testing.T) {
 		t.Errorf("expected merged SSTable generation 3 at level 2")
 	}
 }
+
+// reopenVersions ucitava VersionSet ponovo sa diska, kao pri restartu baze
+func reopenVersions(t *testing.T, vs *VersionSet) *VersionSet {
+	t.Helper()
+	return createTestVersions(t, vs.conf)
+}
+
+func TestManifestSurvivesReopen(t *testing.T) {
+	conf := createTestConfig(t)
+	vs := createTestVersions(t, conf)
+	dict := compression.NewDictionary()
+
+	ref1 := createTestSSTable(t, vs, 1, 1, []byte("a"), []byte("valueA"), dict)
+	ref2 := createTestSSTable(t, vs, 1, 2, []byte("b"), []byte("valueB"), dict)
+	if err := mergeTables(vs, 2, sstable.ReasonManual, cbm, dict, ref1, ref2); err != nil {
+		t.Fatalf("mergeTables failed: %v", err)
+	}
+
+	vs = reopenVersions(t, vs)
+
+	tables, err := Tables(vs)
+	if err != nil {
+		t.Fatalf("Tables failed: %v", err)
+	}
+	if len(tables) != 1 || tables[0].Level != 2 || tables[0].Gen != 1 {
+		t.Fatalf("expected only level 2 gen 1 after reopen, got %+v", tables)
+	}
+	if !bytes.Equal(tables[0].MinKey, []byte("a")) || !bytes.Equal(tables[0].MaxKey, []byte("b")) {
+		t.Errorf("expected key range [a, b], got [%s, %s]", tables[0].MinKey, tables[0].MaxKey)
+	}
+	// Generacije na prvom nivou se ne ponavljaju iako su SSTable-ovi obrisani
+	if gen := vs.NextGeneration(1); gen != 3 {
+		t.Errorf("expected next generation 3 at level 1, got %d", gen)
+	}
+}
+
+func TestOpenVersionSetRemovesOrphans(t *testing.T) {
+	conf := createTestConfig(t)
+	vs := createTestVersions(t, conf)
+	dict := compression.NewDictionary()
+
+	createTestSSTable(t, vs, 1, 1, []byte("a"), []byte("valueA"), dict)
+
+	// SSTable koji je upisan na disk, ali nije stigao u MANIFEST (pad tokom flush-a ili kompakcije)
+	builder, err := NewSSTableBuilder(1, 2, 1, conf, dict, cbm)
+	if err != nil {
+		t.Fatalf("failed to create SSTable builder: %v", err)
+	}
+	builder.Write(adapter.MemtableEntry{Key: []byte("b"), Value: []byte("valueB"), Timestamp: 1})
+	if _, err := builder.Finish(); err != nil {
+		t.Fatalf("failed to finish SSTable build: %v", err)
+	}
+
+	rec, err := Get(vs, []byte("b"), dict, cbm)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if rec != nil {
+		t.Errorf("expected SSTable outside the manifest to be invisible, got %v", rec)
+	}
+
+	vs = reopenVersions(t, vs)
+
+	if _, err := os.Stat(filepath.Join(conf.SSTable.SstableDirectory, "1", "2")); !os.IsNotExist(err) {
+		t.Errorf("expected orphan SSTable directory to be removed, got %v", err)
+	}
+	rec, err = Get(vs, []byte("a"), dict, cbm)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if rec == nil || !bytes.Equal(rec.Value, []byte("valueA")) {
+		t.Errorf("expected valueA, got %v", rec)
+	}
+}
+
+func TestMergeKeepsTablesWhileRead(t *testing.T) {
+	conf := createTestConfig(t)
+	vs := createTestVersions(t, conf)
+	dict := compression.NewDictionary()
+
+	ref1 := createTestSSTable(t, vs, 1, 1, []byte("a"), []byte("valueA"), dict)
+	ref2 := createTestSSTable(t, vs, 1, 2, []byte("b"), []byte("valueB"), dict)
+
+	tables, release, err := OpenTables(vs, dict, cbm)
+	if err != nil {
+		t.Fatalf("OpenTables failed: %v", err)
+	}
+	if len(tables) != 2 {
+		t.Fatalf("expected 2 tables, got %d", len(tables))
+	}
+
+	if err := mergeTables(vs, 2, sstable.ReasonManual, cbm, dict, ref1, ref2); err != nil {
+		t.Fatalf("mergeTables failed: %v", err)
+	}
+
+	// Citalac jos drzi staru verziju, fajlovi moraju ostati
+	for _, ref := range []*SSTableReference{ref1, ref2} {
+		dir := filepath.Join(conf.SSTable.SstableDirectory, fmt.Sprint(ref.Level), fmt.Sprint(ref.Gen))
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("expected level %d gen %d to exist while it is read: %v", ref.Level, ref.Gen, err)
+		}
+	}
+	refs, err := getSSTableReferences(vs, 1, true)
+	if err != nil {
+		t.Fatalf("failed to get SSTable references: %v", err)
+	}
+	if len(refs) != 0 {
+		t.Errorf("expected no tables at level 1 in the current version, got %d", len(refs))
+	}
+
+	release()
+
+	for _, ref := range []*SSTableReference{ref1, ref2} {
+		dir := filepath.Join(conf.SSTable.SstableDirectory, fmt.Sprint(ref.Level), fmt.Sprint(ref.Gen))
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("expected level %d gen %d to be deleted after release, got %v", ref.Level, ref.Gen, err)
+		}
+	}
+}
+
+func TestManifestTornTail(t *testing.T) {
+	conf := createTestConfig(t)
+	vs := createTestVersions(t, conf)
+	dict := compression.NewDictionary()
+
+	createTestSSTable(t, vs, 1, 1, []byte("a"), []byte("valueA"), dict)
+
+	// Nepotpun zapis na kraju MANIFEST-a, kao posle pada tokom upisa
+	path := filepath.Join(conf.SSTable.SstableDirectory, manifestFileName)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("failed to open manifest: %v", err)
+	}
+	file.Write([]byte{0, 0, 1, 0, 1, 2})
+	file.Close()
+
+	vs = reopenVersions(t, vs)
+
+	refs, err := getSSTableReferences(vs, 1, true)
+	if err != nil {
+		t.Fatalf("failed to get SSTable references: %v", err)
+	}
+	if len(refs) != 1 || refs[0].Gen != 1 {
+		t.Errorf("expected level 1 gen 1 after torn manifest tail, got %v", refs)
+	}
+
+	// Zaglavlje sa duzinom od 4 GiB iza ispravnog zapisa se odbacuje kao nepotpun zapis, bez zauzimanja memorije
+	payload := []byte(`{}`)
+	record := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	record = binary.BigEndian.AppendUint32(record, crc32.ChecksumIEEE(payload))
+	record = append(record, payload...)
+	record = append(record, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, '{')
+	oversized := filepath.Join(t.TempDir(), manifestFileName)
+	if err := os.WriteFile(oversized, record, 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	edits, err := readManifest(oversized)
+	if err != nil || len(edits) != 1 {
+		t.Errorf("readManifest with oversized record length = %d edits, %v; want 1 edit", len(edits), err)
+	}
+}
+
+func TestMergeTablesRollsOutput(t *testing.T) {
+	conf := createTestConfig(t)
+	conf.LSMTree.TargetSSTableSize = 4 * conf.Block.BlockSize // Svaki zapis zauzima jedan Data blok, pa najvise 4 zapisa po SSTable-u
+	vs := createTestVersions(t, conf)
+	dict := compression.NewDictionary()
+	padding := strings.Repeat("x", conf.Block.BlockSize-100)
+
+	var refs []*SSTableReference
+	for i := 0; i < 10; i++ {
+		key := []byte(fmt.Sprintf("key%02d", i))
+		dict.Add(key)
+		refs = append(refs, createTestSSTable(t, vs, 1, i+1, key, []byte(fmt.Sprintf("value%02d%s", i, padding)), dict))
+	}
+
+	if err := mergeTables(vs, 2, sstable.ReasonManual, cbm, dict, refs[0], refs[1:]...); err != nil {
+		t.Fatalf("mergeTables failed: %v", err)
+	}
+
+	tables, err := Tables(vs)
+	if err != nil {
+		t.Fatalf("Tables failed: %v", err)
+	}
+	if len(tables) != 3 {
+		t.Fatalf("expected 3 SSTables after merge, got %+v", tables)
+	}
+	for i, table := range tables {
+		if table.Level != 2 || table.Gen != i+1 {
+			t.Errorf("expected level 2 gen %d, got level %d gen %d", i+1, table.Level, table.Gen)
+		}
+		if i > 0 && bytes.Compare(tables[i-1].MaxKey, table.MinKey) >= 0 {
+			t.Errorf("SSTables %d and %d overlap: %s >= %s", i, i+1, tables[i-1].MaxKey, table.MinKey)
+		}
+	}
+	if gen := vs.NextGeneration(2); gen != 4 {
+		t.Errorf("expected next generation 4 at level 2, got %d", gen)
+	}
+
+	for i := 0; i < 10; i++ {
+		rec, err := Get(vs, []byte(fmt.Sprintf("key%02d", i)), dict, cbm)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if rec == nil || string(rec.Value) != fmt.Sprintf("value%02d%s", i, padding) {
+			t.Errorf("expected value%02d, got %v", i, rec)
+		}
+	}
+}
+
+func put(key string, ts int64) adapter.MemtableEntry {
+	return adapter.MemtableEntry{Key: []byte(key), Value: []byte(fmt.Sprintf("%s@%d", key, ts)), Seq: uint64(ts), Timestamp: ts}
+}
+
+func del(key string, ts int64) adapter.MemtableEntry {
+	return adapter.MemtableEntry{Key: []byte(key), Seq: uint64(ts), Timestamp: ts, Tombstone: true}
+}
+
+// expectDeleted proverava da obrisan kljuc nije vidljiv, a da ostali jesu
+func expectDeleted(t *testing.T, vs *VersionSet, dict *compression.Dictionary, deleted string, live ...string) {
+	t.Helper()
+	rec, err := Get(vs, []byte(deleted), dict, cbm)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if rec != nil && !rec.Tombstone {
+		t.Errorf("deleted key %q came back with value %q", deleted, rec.Value)
+	}
+	for _, key := range live {
+		rec, err := Get(vs, []byte(key), dict, cbm)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if rec == nil || rec.Tombstone {
+			t.Errorf("expected key %q to be live, got %v", key, rec)
+		}
+	}
+}
+
+func TestSizeTieredCompactionKeepsTombstones(t *testing.T) {
+	conf := createTestConfig(t)
+	conf.LSMTree.CompactionAlgorithm = "size_tiered"
+	conf.LSMTree.MaxLevel = 4 // Get pretrazuje nivoe 1-3
+	conf.LSMTree.MaxTablesPerLevel = 2
+	vs := createTestVersions(t, conf)
+	dict := compression.NewDictionary()
+
+	// Stara vrednost je na nivou 3, a brisanje stize na nivo 1
+	createTestSSTableEntries(t, vs, 3, 1, dict, put("a", 1), put("c", 1))
+	createTestSSTableEntries(t, vs, 1, 1, dict, del("a", 2))
+	createTestSSTableEntries(t, vs, 1, 2, dict, put("b", 3))
+	expectDeleted(t, vs, dict, "a", "b", "c")
+
+	// Spajanje nivoa 1 ide na nivo 2, a nivo 3 nije deo kompakcije pa tombstone mora ostati
+	if err := Compact(vs, dict, cbm); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	expectDeleted(t, vs, dict, "a", "b", "c")
+
+	// Jos dva SSTable-a na nivou 2 spustaju tombstone na poslednji nivo, gde se izbacuje zajedno sa starom vrednoscu
+	createTestSSTableEntries(t, vs, 1, 3, dict, put("d", 4))
+	createTestSSTableEntries(t, vs, 1, 4, dict, put("e", 5))
+	if err := Compact(vs, dict, cbm); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	expectDeleted(t, vs, dict, "a", "b", "c", "d", "e")
+
+	tables, err := Tables(vs)
+	if err != nil {
+		t.Fatalf("Tables failed: %v", err)
+	}
+	for _, table := range tables {
+		if table.Level > bottomLevel(conf) {
+			t.Errorf("compaction moved level %d gen %d below the last level Get reads", table.Level, table.Gen)
+		}
+	}
+}
+
+func TestLeveledCompactionKeepsTombstones(t *testing.T) {
+	conf := createTestConfig(t)
+	conf.LSMTree.MaxLevel = 4 // Get pretrazuje nivoe 1-3
+	conf.LSMTree.BaseSSTableLimit = 1
+	conf.LSMTree.LevelSizeMultiplier = 1 // Svaki neprazan nivo treba kompaktovati
+	vs := createTestVersions(t, conf)
+	dict := compression.NewDictionary()
+
+	createTestSSTableEntries(t, vs, 3, 1, dict, put("a", 1), put("c", 1))
+	createTestSSTableEntries(t, vs, 1, 1, dict, del("a", 2), put("b", 2))
+	expectDeleted(t, vs, dict, "a", "b", "c")
+
+	// Prvo spajanje (nivo 1 u nivo 2) ne vidi nivo 3, tombstone mora preziveti do poslednjeg nivoa
+	if err := mergeTables(vs, 2, sstable.ReasonManual, cbm, dict, &SSTableReference{Level: 1, Gen: 1}); err != nil {
+		t.Fatalf("mergeTables failed: %v", err)
+	}
+	expectDeleted(t, vs, dict, "a", "b", "c")
+
+	// Novi SSTable na nivou 1 pokrece kompakciju nivo po nivo, do poslednjeg
+	createTestSSTableEntries(t, vs, 1, 2, dict, put("e", 3))
+	if err := Compact(vs, dict, cbm); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	expectDeleted(t, vs, dict, "a", "b", "c", "e")
+
+	// Na poslednjem nivou nema starijih SSTable-ova, pa tombstone vise ne postoji
+	v := vs.acquire()
+	defer vs.release(v)
+	for ref, meta := range v.tables {
+		if ref.Level != 3 {
+			t.Errorf("expected all tables on level 3 after compaction, got level %d gen %d", ref.Level, ref.Gen)
+		}
+		if meta.Tombstones != 0 {
+			t.Errorf("expected tombstones to be dropped on the last level, level %d gen %d has %d", ref.Level, ref.Gen, meta.Tombstones)
+		}
+	}
+}
+
+func TestTombstoneDensityCompaction(t *testing.T) {
+	conf := createTestConfig(t)
+	conf.LSMTree.CompactionAlgorithm = "size_tiered"
+	conf.LSMTree.MaxTablesPerLevel = 100 // Bez obicne kompakcije
+	conf.LSMTree.TombstoneCompactionRatio = 0.5
+	vs := createTestVersions(t, conf)
+	dict := compression.NewDictionary()
+
+	createTestSSTableEntries(t, vs, 2, 1, dict, put("a", 1), put("b", 1), put("c", 1), put("d", 1))
+	createTestSSTableEntries(t, vs, 1, 1, dict, put("x", 2))                                        // Bez tombstone-ova, ostaje
+	createTestSSTableEntries(t, vs, 1, 2, dict, del("a", 3), del("b", 3), put("c", 3), del("d", 3)) // 3 od 4 su tombstone-ovi
+
+	if err := Compact(vs, dict, cbm); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	expectDeleted(t, vs, dict, "a", "c", "x")
+	expectDeleted(t, vs, dict, "b")
+	expectDeleted(t, vs, dict, "d")
+
+	tables, err := Tables(vs)
+	if err != nil {
+		t.Fatalf("Tables failed: %v", err)
+	}
+	if len(tables) != 2 || tables[0].Level != 1 || tables[0].Gen != 1 || tables[1].Level != 2 {
+		t.Fatalf("expected level 1 gen 1 and one merged table on level 2, got %+v", tables)
+	}
+	rec, err := Get(vs, []byte("c"), dict, cbm)
+	if err != nil || rec == nil || string(rec.Value) != "c@3" {
+		t.Errorf("expected newest value c@3, got %v, %v", rec, err)
+	}
+
+	v := vs.acquire()
+	defer vs.release(v)
+	if meta := v.meta(tables[1].Level, tables[1].Gen); meta.Entries != 1 || meta.Tombstones != 0 {
+		t.Errorf("expected only c on level 2 after dropping tombstones, got %d entries, %d tombstones", meta.Entries, meta.Tombstones)
+	}
+}
+
+// Upis pa brisanje kljuca (dva flush-a na nivo 1), pa rucna kompakcija opsega sa kljucem
+func TestCompactRangeKeepsTombstones(t *testing.T) {
+	conf := createTestConfig(t)
+	conf.LSMTree.MaxLevel = 4 // Get pretrazuje nivoe 1-3
+	vs := createTestVersions(t, conf)
+	dict := compression.NewDictionary()
+
+	createTestSSTableEntries(t, vs, 1, 1, dict, put("k", 2), put("x", 2))
+	createTestSSTableEntries(t, vs, 1, 2, dict, del("k", 3))
+	expectDeleted(t, vs, dict, "k", "x")
+
+	// Stariji SSTable sa nivoa ulaza koji nije ulaz i dalje ima kljuc, tombstone se ne sme izbaciti
+	v := vs.acquire()
+	gc := newTombstoneGC(conf, vs, v, 2, []*SSTableReference{{Level: 1, Gen: 2}}, dict, cbm)
+	vs.release(v)
+	if drop, err := gc.canDrop([]byte("k")); err != nil || drop {
+		t.Errorf("expected tombstone to be kept while level 1 gen 1 holds the key, got %v, %v", drop, err)
+	}
+
+	if err := CompactRange(vs, []byte("k"), []byte("k"), dict, cbm); err != nil {
+		t.Fatalf("CompactRange failed: %v", err)
+	}
+	expectDeleted(t, vs, dict, "k", "x")
+
+	// Oba SSTable-a sa nivoa 1 su spojena, stari zapis i tombstone nestaju zajedno
+	tables, err := Tables(vs)
+	if err != nil {
+		t.Fatalf("Tables failed: %v", err)
+	}
+	if len(tables) != 1 || tables[0].Level != 2 || tables[0].Entries != 1 || tables[0].Tombstones != 0 {
+		t.Errorf("expected a single level 2 table with only x, got %+v", tables)
+	}
+}
+
+func TestCompactRangeTakesOlderTables(t *testing.T) {
+	conf := createTestConfig(t)
+	conf.LSMTree.MaxLevel = 4 // Get pretrazuje nivoe 1-3
+	vs := createTestVersions(t, conf)
+	dict := compression.NewDictionary()
+
+	// Samo gen 2 je u opsegu, ali gen 1 ima stariju vrednost kljuca koji gen 2 brise
+	createTestSSTableEntries(t, vs, 1, 1, dict, put("k", 1), put("m", 1), put("z", 1))
+	createTestSSTableEntries(t, vs, 1, 2, dict, put("a", 2), del("m", 2))
+	expectDeleted(t, vs, dict, "m", "a", "k", "z")
+
+	if err := CompactRange(vs, []byte("b"), []byte("b"), dict, cbm); err != nil {
+		t.Fatalf("CompactRange failed: %v", err)
+	}
+	expectDeleted(t, vs, dict, "m", "a", "k", "z")
+
+	tables, err := Tables(vs)
+	if err != nil {
+		t.Fatalf("Tables failed: %v", err)
+	}
+	for _, table := range tables {
+		if table.Level == 1 {
+			t.Errorf("expected older overlapping level 1 gen %d to be compacted with the range", table.Gen)
+		}
+	}
+}
+
+func TestTableCache(t *testing.T) {
+	conf := createTestConfig(t)
+	vs := createTestVersions(t, conf)
+	dict := compression.NewDictionary()
+
+	ref1 := createTestSSTable(t, vs, 1, 1, []byte("a"), []byte("valueA"), dict)
+	ref2 := createTestSSTable(t, vs, 1, 2, []byte("b"), []byte("valueB"), dict)
+
+	for i := 0; i < 3; i++ {
+		rec, err := Get(vs, []byte("a"), dict, cbm)
+		if err != nil || rec == nil || !bytes.Equal(rec.Value, []byte("valueA")) {
+			t.Fatalf("Get a = %v, %v; want valueA", rec, err)
+		}
+	}
+	// Prvi Get otvara oba SSTable-a, ostali ih nalaze u kesu
+	if hits, misses, size := vs.TableCacheStats(); hits != 4 || misses != 2 || size != 2 {
+		t.Errorf("expected 4 hits, 2 misses and 2 tables, got %d, %d, %d", hits, misses, size)
+	}
+
+	// Kompakcija brise SSTable-ove, pa moraju izaci i iz kesa
+	if err := mergeTables(vs, 2, sstable.ReasonManual, cbm, dict, ref1, ref2); err != nil {
+		t.Fatalf("mergeTables failed: %v", err)
+	}
+	if _, _, size := vs.TableCacheStats(); size != 0 {
+		t.Errorf("expected merged tables to be evicted, got %d tables in cache", size)
+	}
+	rec, err := Get(vs, []byte("b"), dict, cbm)
+	if err != nil || rec == nil || !bytes.Equal(rec.Value, []byte("valueB")) {
+		t.Fatalf("Get b = %v, %v; want valueB", rec, err)
+	}
+
+	// Kes ne prelazi kapacitet, izbacuje se najduze nekorisceni SSTable
+	for gen := 3; gen <= 8; gen++ {
+		createTestSSTable(t, vs, 1, gen, []byte(fmt.Sprintf("k%d", gen)), []byte("v"), dict)
+	}
+	if _, err := Get(vs, []byte("k3"), dict, cbm); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if _, _, size := vs.TableCacheStats(); size != conf.Cache.TableCapacity {
+		t.Errorf("expected %d tables in cache, got %d", conf.Cache.TableCapacity, size)
+	}
+	if _, ok := vs.tables.tables[SSTableReference{Level: 1, Gen: 3}]; !ok {
+		t.Errorf("expected last opened table to stay in cache")
+	}
+}
+
+// Get sa kesom tabela i bez njega (bez kesa se za svaki SSTable cita footer, Bloom filter i Summary)
+// go test -bench TableCache ./structures/lsmtree
+func BenchmarkTableCache(b *testing.B) {
+	for _, capacity := range []int{0, 64} {
+		b.Run(fmt.Sprintf("capacity=%d", capacity), func(b *testing.B) {
+			conf := createTestConfig(b)
+			conf.Cache.TableCapacity = capacity
+			vs := createTestVersions(b, conf)
+			dict := compression.NewDictionary()
+			for gen := 1; gen <= 8; gen++ {
+				var entries []adapter.MemtableEntry
+				for i := 0; i < 100; i++ {
+					entries = append(entries, put(fmt.Sprintf("key%d-%03d", gen, i), 1))
+				}
+				createTestSSTableEntries(b, vs, 1, gen, dict, entries...)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				key := []byte(fmt.Sprintf("key%d-%03d", i%8+1, i%100))
+				if rec, err := Get(vs, key, dict, cbm); err != nil || rec == nil {
+					b.Fatalf("Get %s = %v, %v", key, rec, err)
+				}
+			}
+		})
+	}
+}
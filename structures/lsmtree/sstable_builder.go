@@ -11,35 +11,92 @@ import (
 )
 
 // SSTableBuilder se koristi za gradnju SSTable-a
-// Ovaj builder omogućava dodavanje zapisa i njihovo upisivanje u SSTable
+// Zapisi se upisuju na disk cim stignu, pa memorija ne zavisi od broja zapisa
+// Kad Data deo dostigne TargetSSTableSize, builder zatvara SSTable i nastavlja u sledecoj generaciji
 type SSTableBuilder struct {
-	level   int
-	gen     int
-	conf    *config.Config
-	records []adapter.MemtableEntry
+	level    int
+	nextGen  int // Generacija sledeceg SSTable-a
+	expected int // Procena broja zapisa koji jos nisu upisani, za velicinu Bloom filtera
+	conf     *config.Config
+	dict     *compression.Dictionary
+	cbm      *block_organization.CachedBlockManager
+	writer   *sstable.Writer
+	gens     []int // Zavrseni SSTable-ovi
+	// Razlog i izvori za Properties svih SSTable-ova koje builder napravi
+	reason  string
+	sources []sstable.Source
 }
 
-func NewSSTableBuilder(level, gen int, conf *config.Config) (*SSTableBuilder, error) {
+// NewSSTableBuilder pravi builder koji pise SSTable-ove na nivo level, pocevsi od generacije gen
+// expectedEntries je procena ukupnog broja zapisa (npr. zbir zapisa ulaznih SSTable-ova)
+func NewSSTableBuilder(level, gen, expectedEntries int, conf *config.Config, dict *compression.Dictionary, cbm *block_organization.CachedBlockManager) (*SSTableBuilder, error) {
 	return &SSTableBuilder{
-		level:   level,
-		gen:     gen,
-		conf:    conf,
-		records: make([]adapter.MemtableEntry, 0),
+		level:    level,
+		nextGen:  gen,
+		expected: expectedEntries,
+		conf:     conf,
+		dict:     dict,
+		cbm:      cbm,
 	}, nil
 }
 
+// Write upisuje zapis, zapisi moraju stizati sortirani po kljucu
 func (b *SSTableBuilder) Write(entry adapter.MemtableEntry) error {
-	// Možeš dodati validaciju ako želiš
-	b.records = append(b.records, entry)
-	return nil
+	target := int64(b.conf.LSMTree.TargetSSTableSize)
+	if b.writer != nil && target > 0 && b.writer.DataSize() >= target {
+		if err := b.finishTable(); err != nil {
+			return err
+		}
+	}
+	if b.writer == nil {
+		writer, err := sstable.NewWriter(b.conf, b.level, b.nextGen, b.tableEntries(), b.dict, b.cbm)
+		if err != nil {
+			return fmt.Errorf("failed to start SSTable level %d, gen %d: %w", b.level, b.nextGen, err)
+		}
+		if b.reason != "" {
+			writer.SetOrigin(b.reason, b.sources)
+		}
+		b.writer = writer
+		b.nextGen++
+	}
+	return b.writer.Add(entry)
+}
+
+// SetOrigin postavlja razlog i izvore (ulazne SSTable-ove kompakcije) koji se upisuju u Properties
+// Bez poziva SSTable-ovi dobijaju razlog sstable.ReasonFlush
+func (b *SSTableBuilder) SetOrigin(reason string, sources []sstable.Source) {
+	b.reason = reason
+	b.sources = sources
 }
 
-// Finish kreira SSTable strukturu i upisuje je na disk zajedno sa svim potrebnim komponentama
-func (b *SSTableBuilder) Finish(cbm *block_organization.CachedBlockManager, dict *compression.Dictionary) error {
-	if len(b.records) == 0 {
-		return fmt.Errorf("no entries to write")
+// tableEntries procenjuje broj zapisa sledeceg SSTable-a
+// Vise zapisa staje u jedan Data blok, pa velicina SSTable-a ne ogranicava broj zapisa i koristi se broj preostalih zapisa
+// Bez te procene se uzima po jedan zapis po bloku
+func (b *SSTableBuilder) tableEntries() int {
+	entries := b.expected
+	if target := b.conf.LSMTree.TargetSSTableSize; target > 0 && entries <= 0 {
+		entries = target/b.conf.Block.BlockSize + 1
 	}
+	return entries
+}
 
-	sstable.BuildSSTable(b.records, b.conf, dict, cbm, b.level, b.gen)
+func (b *SSTableBuilder) finishTable() error {
+	if err := b.writer.Finish(); err != nil {
+		return fmt.Errorf("failed to finish SSTable level %d, gen %d: %w", b.level, b.nextGen-1, err)
+	}
+	b.expected -= b.writer.Count()
+	b.gens = append(b.gens, b.nextGen-1)
+	b.writer = nil
 	return nil
 }
+
+// Finish zavrsava poslednji SSTable i vraca generacije svih upisanih SSTable-ova
+// Ako nijedan zapis nije upisan, ne pravi se nijedan SSTable
+func (b *SSTableBuilder) Finish() ([]int, error) {
+	if b.writer != nil {
+		if err := b.finishTable(); err != nil {
+			return nil, err
+		}
+	}
+	return b.gens, nil
+}
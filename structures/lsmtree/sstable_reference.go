@@ -18,25 +18,37 @@ type SSTableReference struct {
 	Gen   int // Generacija SSTable-a
 }
 
-// getSSTableReferences vraća sve SSTable-ove na datom nivou, sortirane po generaciji
-func getSSTableReferences(conf *config.Config, level int, ascending bool) ([]*SSTableReference, error) {
+// getSSTableReferences vraća sve SSTable-ove na datom nivou iz trenutne verzije, sortirane po generaciji
+func getSSTableReferences(vs *VersionSet, level int, ascending bool) ([]*SSTableReference, error) {
+	v := vs.acquire()
+	defer vs.release(v)
+	return v.references(level, ascending), nil
+}
+
+// listSSTableDirs vraća SSTable-ove koji postoje na disku na datom nivou i najveću generaciju direktorijuma na nivou
+// Koristi se samo za direktorijum bez MANIFEST-a, inače su živi SSTable-ovi oni iz verzije
+func listSSTableDirs(conf *config.Config, level int) ([]*SSTableReference, int, error) {
 	dir := fmt.Sprintf("%s/%d", conf.SSTable.SstableDirectory, level)
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, nil
+			return nil, 0, nil
 		}
 
-		return nil, fmt.Errorf("failed to read level %d directory '%s' : %w", level, dir, err)
+		return nil, 0, fmt.Errorf("failed to read level %d directory '%s' : %w", level, dir, err)
 	}
 	var refs []*SSTableReference
+	maxGen := 0
 
 	for _, entry := range entries {
 		if entry.IsDir() {
 			genDir := filepath.Join(dir, entry.Name())
 			gen, err := strconv.Atoi(entry.Name())
 			if err != nil {
-				return nil, fmt.Errorf("failed to parse generation from directory name '%s': %w", genDir, err)
+				return nil, 0, fmt.Errorf("failed to parse generation from directory name '%s': %w", genDir, err)
+			}
+			if gen > maxGen {
+				maxGen = gen
 			}
 
 			tocPath := filepath.Join(genDir, fmt.Sprintf("usertable-%06d-Data.db", gen))
@@ -49,8 +61,48 @@ func getSSTableReferences(conf *config.Config, level int, ascending bool) ([]*SS
 		}
 	}
 
-	sortReferencesByGen(refs, ascending) // Sortiraj po generaciji
-	return refs, err
+	sortReferencesByGen(refs, true)
+	return refs, maxGen, nil
+}
+
+// TableInfo opisuje jedan SSTable na disku, koristi se za statistiku i pregled nivoa
+type TableInfo struct {
+	Level  int
+	Gen    int
+	Size   int64  // Ukupna velicina fajlova SSTable-a u bajtovima
+	MinKey []byte // Prvi kljuc (iz Summary-ja)
+	MaxKey []byte // Poslednji kljuc (iz Summary-ja)
+	// Broj zapisa i tombstone-ova, velicina Data dela i kljuceva i vrednosti pre kodiranja (iz Properties, 0 ako nisu poznati)
+	Entries    int64
+	Tombstones int64
+	DataSize   int64
+	RawSize    int64
+}
+
+// Tables vraca opis svih SSTable-ova iz trenutne verzije, sortiranih po nivou pa po generaciji
+func Tables(vs *VersionSet) ([]TableInfo, error) {
+	v := vs.acquire()
+	defer vs.release(v)
+
+	var tables []TableInfo
+	for level := 1; level <= vs.conf.LSMTree.MaxLevel; level++ {
+		for _, ref := range v.references(level, true) {
+			meta := v.meta(ref.Level, ref.Gen)
+			tables = append(tables, TableInfo{
+				Level:  meta.Level,
+				Gen:    meta.Gen,
+				Size:   meta.Size,
+				MinKey: meta.MinKey,
+				MaxKey: meta.MaxKey,
+
+				Entries:    meta.Entries,
+				Tombstones: meta.Tombstones,
+				DataSize:   meta.DataSize,
+				RawSize:    meta.RawSize,
+			})
+		}
+	}
+	return tables, nil
 }
 
 // sortReferencesByGen sortira SSTableReference-ove po generaciji
@@ -0,0 +1,97 @@
+package lsmtree
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	"github.com/iigor000/database/config"
+	"github.com/iigor000/database/structures/block_organization"
+	"github.com/iigor000/database/structures/compression"
+	"github.com/iigor000/database/structures/sstable"
+)
+
+// tableCache cuva otvorene SSTable-ove (footer, Bloom filter, Summary i informaciju o kompresiji),
+// da Get i skeniranja ne bi citali te delove sa diska pri svakom pozivu
+// Izbacuje najduze nekorisceni SSTable kad se popuni, a SSTable uklonjen kompakcijom se izbacuje kad se obrisu njegovi fajlovi
+type tableCache struct {
+	mu       sync.Mutex
+	capacity int // 0 - kes je iskljucen
+	tables   map[SSTableReference]*list.Element
+	list     *list.List // Od poslednje koriscenog ka najduze nekoriscenom
+	hits     uint64
+	misses   uint64
+}
+
+// Element liste u kesu tabela
+type cachedTable struct {
+	ref   SSTableReference
+	table *sstable.SSTable
+	dict  *compression.Dictionary // Recnik sa kojim je SSTable otvoren
+}
+
+func newTableCache(capacity int) *tableCache {
+	return &tableCache{
+		capacity: capacity,
+		tables:   make(map[SSTableReference]*list.Element),
+		list:     list.New(),
+	}
+}
+
+// open vraca SSTable iz kesa, a ako ga nema otvara ga i dodaje u kes
+// SSTable otvoren sa drugim recnikom se otvara ponovo, jer bi kljucevi bili pogresno dekodirani
+func (tc *tableCache) open(conf *config.Config, ref SSTableReference, dict *compression.Dictionary, cbm *block_organization.CachedBlockManager) (*sstable.SSTable, error) {
+	tc.mu.Lock()
+	if element, ok := tc.tables[ref]; ok {
+		cached := element.Value.(*cachedTable)
+		if !cached.table.UseCompression || cached.dict == dict {
+			tc.list.MoveToFront(element)
+			tc.hits++
+			tc.mu.Unlock()
+			return cached.table, nil
+		}
+	}
+	tc.misses++
+	tc.mu.Unlock()
+
+	// SSTable se otvara van brave, citanje sa diska ne blokira ostale
+	table, err := sstable.StartSSTable(ref.Level, ref.Gen, conf, dict, cbm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SSTable for level %d, gen %d: %w", ref.Level, ref.Gen, err)
+	}
+	if tc.capacity <= 0 {
+		return table, nil
+	}
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if element, ok := tc.tables[ref]; ok {
+		element.Value = &cachedTable{ref: ref, table: table, dict: dict}
+		tc.list.MoveToFront(element)
+		return table, nil
+	}
+	if tc.list.Len() >= tc.capacity {
+		last := tc.list.Back()
+		delete(tc.tables, last.Value.(*cachedTable).ref)
+		tc.list.Remove(last)
+	}
+	tc.tables[ref] = tc.list.PushFront(&cachedTable{ref: ref, table: table, dict: dict})
+	return table, nil
+}
+
+// evict izbacuje SSTable iz kesa
+func (tc *tableCache) evict(ref SSTableReference) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if element, ok := tc.tables[ref]; ok {
+		tc.list.Remove(element)
+		delete(tc.tables, ref)
+	}
+}
+
+// stats vraca broj pogodaka i promasaja kesa, kao i broj SSTable-ova koji su trenutno u kesu
+func (tc *tableCache) stats() (hits uint64, misses uint64, size int) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return tc.hits, tc.misses, tc.list.Len()
+}
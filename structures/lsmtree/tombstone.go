@@ -0,0 +1,164 @@
+package lsmtree
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/iigor000/database/config"
+	"github.com/iigor000/database/structures/block_organization"
+	"github.com/iigor000/database/structures/compression"
+	"github.com/iigor000/database/structures/sstable"
+)
+
+// bottomLevel vraca poslednji nivo koji Get pretrazuje, kompakcija ne spusta podatke ispod njega
+func bottomLevel(conf *config.Config) int {
+	return conf.LSMTree.MaxLevel - 1
+}
+
+// tombstoneGC odlucuje da li kompakcija sme da izbaci tombstone
+// Tombstone se cuva dok god neki stariji SSTable van kompakcije (na nivou izlaza ili dublje) moze da sadrzi kljuc,
+// inace bi se posle kompakcije ponovo video stari zapis
+type tombstoneGC struct {
+	conf  *config.Config
+	vs    *VersionSet
+	dict  *compression.Dictionary
+	cbm   *block_organization.CachedBlockManager
+	older []*TableMeta
+}
+
+// newTombstoneGC skuplja SSTable-ove iz verzije v koji nisu ulaz kompakcije, a stariji su od nje:
+// sve sa nivoa newLevel ili dublje i one sa nivoa ulaza cija je generacija manja od najnovijeg ulaza sa tog nivoa
+func newTombstoneGC(conf *config.Config, vs *VersionSet, v *Version, newLevel int, inputs []*SSTableReference, dict *compression.Dictionary, cbm *block_organization.CachedBlockManager) *tombstoneGC {
+	skip := make(map[SSTableReference]bool, len(inputs))
+	newest := make(map[int]int) // Najveca generacija ulaza po nivou
+	for _, ref := range inputs {
+		skip[*ref] = true
+		if ref.Gen > newest[ref.Level] {
+			newest[ref.Level] = ref.Gen
+		}
+	}
+	gc := &tombstoneGC{conf: conf, vs: vs, dict: dict, cbm: cbm}
+	for ref, meta := range v.tables {
+		if skip[ref] {
+			continue
+		}
+		if ref.Level >= newLevel || ref.Gen < newest[ref.Level] {
+			gc.older = append(gc.older, meta)
+		}
+	}
+	return gc
+}
+
+// canDrop vraca true ako nijedan stariji SSTable ne moze da sadrzi kljuc (po opsegu kljuceva i Bloom filteru)
+func (gc *tombstoneGC) canDrop(key []byte) (bool, error) {
+	for _, meta := range gc.older {
+		if bytes.Compare(key, meta.MinKey) < 0 || bytes.Compare(key, meta.MaxKey) > 0 {
+			continue
+		}
+		table, err := gc.vs.tables.open(gc.conf, SSTableReference{Level: meta.Level, Gen: meta.Gen}, gc.dict, gc.cbm)
+		if err != nil {
+			return false, err
+		}
+		if table.Filter.Read(append([]byte(nil), key...)) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// tombstoneCompaction spusta nanize SSTable-ove u kojima je bar TombstoneCompactionRatio zapisa tombstone,
+// da bi tombstone-ovi stigli do starih zapisa i bili izbaceni
+// Na poslednjem nivou se SSTable prepisuje zajedno sa svim SSTable-ovima sa kojima se preklapa
+func tombstoneCompaction(vs *VersionSet, dict *compression.Dictionary, cbm *block_organization.CachedBlockManager) error {
+	conf := vs.conf
+	ratio := conf.LSMTree.TombstoneCompactionRatio
+	if ratio <= 0 {
+		return nil
+	}
+
+	bottom := bottomLevel(conf)
+	for level := 1; level <= bottom; level++ {
+		// Svaki SSTable se proverava jednom, SSTable-ovi nastali na ovom nivou cekaju sledecu kompakciju
+		v := vs.acquire()
+		var dense []SSTableReference
+		for _, ref := range v.references(level, true) {
+			meta := v.meta(ref.Level, ref.Gen)
+			if meta.Tombstones > 0 && float64(meta.Tombstones) >= ratio*float64(meta.Entries) {
+				dense = append(dense, *ref)
+			}
+		}
+		vs.release(v)
+
+		for _, ref := range dense {
+			if err := compactTombstones(vs, ref, dict, cbm); err != nil {
+				return fmt.Errorf("error compacting tombstones of level %d, gen %d: %w", ref.Level, ref.Gen, err)
+			}
+		}
+	}
+	return nil
+}
+
+// expandInputs dodaje ulazima kompakcije sa nivoa level SSTable-ove tog nivoa koji se (posredno) preklapaju sa njima
+// Ako all nije postavljen dodaju se samo stariji od najnovijeg ulaza, noviji ostaju iznad izlaza i i dalje zaklanjaju stare zapise
+// Kad izlaz ostaje na istom nivou (all) mora se dodati svaki koji se preklapa, jer izlaz dobija najnoviju generaciju
+// Vraca prosirene ulaze i njihov opseg kljuceva
+func expandInputs(v *Version, level int, inputs []*SSTableReference, minKey, maxKey []byte, all bool) ([]*SSTableReference, []byte, []byte) {
+	newest := 0
+	included := make(map[SSTableReference]bool, len(inputs))
+	for _, ref := range inputs {
+		included[*ref] = true
+		if ref.Gen > newest {
+			newest = ref.Gen
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, other := range v.references(level, true) {
+			if included[*other] || (!all && other.Gen > newest) {
+				continue
+			}
+			m := v.meta(other.Level, other.Gen)
+			if bytes.Compare(m.MinKey, maxKey) > 0 || bytes.Compare(m.MaxKey, minKey) < 0 {
+				continue
+			}
+			included[*other] = true
+			inputs = append(inputs, other)
+			if bytes.Compare(m.MinKey, minKey) < 0 {
+				minKey = m.MinKey
+			}
+			if bytes.Compare(m.MaxKey, maxKey) > 0 {
+				maxKey = m.MaxKey
+			}
+			changed = true
+		}
+	}
+	return inputs, minKey, maxKey
+}
+
+// compactTombstones spaja SSTable ref sa SSTable-ovima sa kojima mora ici zajedno
+// Sa istog nivoa idu stariji SSTable-ovi koji se (posredno) preklapaju sa njim, jer stariji zapis
+// ne sme ostati iznad novijeg, a na poslednjem nivou svi koji se preklapaju
+// Ispod poslednjeg nivoa izlaz ide na sledeci nivo, zajedno sa SSTable-ovima tog nivoa koji se preklapaju
+func compactTombstones(vs *VersionSet, ref SSTableReference, dict *compression.Dictionary, cbm *block_organization.CachedBlockManager) error {
+	v := vs.acquire()
+	meta := v.meta(ref.Level, ref.Gen)
+	if meta == nil {
+		vs.release(v)
+		return nil // Vec je kompaktovan zajedno sa nekim drugim SSTable-om
+	}
+	bottom := bottomLevel(vs.conf)
+
+	inputs, minKey, maxKey := expandInputs(v, ref.Level, []*SSTableReference{{Level: ref.Level, Gen: ref.Gen}}, meta.MinKey, meta.MaxKey, ref.Level >= bottom)
+	vs.release(v)
+
+	newLevel := ref.Level
+	if ref.Level < bottom {
+		newLevel = ref.Level + 1
+		overlapping, err := getOverlappingReferences(vs, newLevel, minKey, maxKey, cbm)
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, overlapping...)
+	}
+	return mergeTables(vs, newLevel, sstable.ReasonTombstone, cbm, dict, inputs[0], inputs[1:]...)
+}
@@ -0,0 +1,537 @@
+package lsmtree
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/iigor000/database/config"
+	"github.com/iigor000/database/structures/block_organization"
+	"github.com/iigor000/database/structures/compression"
+	"github.com/iigor000/database/structures/sstable"
+)
+
+// Ime fajla sa MANIFEST log-om u direktorijumu SSTable-ova
+const manifestFileName = "MANIFEST"
+
+// Zaglavlje zapisa u MANIFEST-u: duzina (4) + CRC (4) nad JSON-om izmene
+const manifestHeaderSize = 8
+
+// TableMeta opisuje jedan SSTable iz verzije
+type TableMeta struct {
+	Level  int    `json:"level"`
+	Gen    int    `json:"gen"`
+	MinKey []byte `json:"min_key"`
+	MaxKey []byte `json:"max_key"`
+	Size   int64  `json:"size"` // Ukupna velicina SSTable-a na disku
+	// Broj zapisa i tombstone-ova, za kompakciju po gustini tombstone-ova (0 ako nisu poznati)
+	Entries    int64 `json:"entries"`
+	Tombstones int64 `json:"tombstones"`
+	// Najveci sekvencni broj u SSTable-u
+	MaxSeq uint64 `json:"max_seq"`
+	// Velicina Data dela na disku i kljuceva i vrednosti pre kodiranja, iz Properties (0 ako ih SSTable nema)
+	DataSize int64 `json:"data_size,omitempty"`
+	RawSize  int64 `json:"raw_size,omitempty"`
+}
+
+// VersionEdit je jedna atomicna izmena skupa SSTable-ova: dodati i uklonjeni SSTable-ovi
+// NextGen pamti sledecu generaciju po nivou, da se generacija ne bi ponovila dok stari fajlovi jos postoje
+type VersionEdit struct {
+	Added   []TableMeta        `json:"added,omitempty"`
+	Removed []SSTableReference `json:"removed,omitempty"`
+	NextGen map[int]int        `json:"next_gen,omitempty"`
+	// Najveci sekvencni broj koji je ikad bio u SSTable-ovima, ostaje i kad kompakcija izbaci te zapise
+	LastSeq uint64 `json:"last_seq,omitempty"`
+}
+
+// Version je nepromenljiv skup zivih SSTable-ova
+// Citaoci drze referencu na verziju dok citaju, pa fajlovi iz nje ne mogu biti obrisani ispod njih
+type Version struct {
+	tables map[SSTableReference]*TableMeta
+	refs   int
+}
+
+// references vraca SSTable-ove sa nivoa, sortirane po generaciji
+func (v *Version) references(level int, ascending bool) []*SSTableReference {
+	var refs []*SSTableReference
+	for ref := range v.tables {
+		if ref.Level == level {
+			refs = append(refs, &SSTableReference{Level: ref.Level, Gen: ref.Gen})
+		}
+	}
+	sortReferencesByGen(refs, ascending)
+	return refs
+}
+
+func (v *Version) meta(level, gen int) *TableMeta {
+	return v.tables[SSTableReference{Level: level, Gen: gen}]
+}
+
+// VersionSet cuva trenutnu verziju SSTable-ova za jedan direktorijum i upisuje izmene u MANIFEST
+// Izmena se primenjuje tek kad je upisana i sinhronizovana, a fajlovi uklonjenih SSTable-ova
+// se brisu tek kad ih nijedna ziva verzija ne sadrzi
+type VersionSet struct {
+	mu       sync.Mutex
+	conf     *config.Config
+	current  *Version
+	live     map[*Version]struct{}         // Verzije na koje neko drzi referencu
+	obsolete map[SSTableReference]struct{} // Uklonjeni SSTable-ovi ciji fajlovi jos nisu obrisani
+	nextGen  map[int]int
+	lastSeq  uint64      // Najveci sekvencni broj u SSTable-ovima
+	tables   *tableCache // Otvoreni SSTable-ovi
+}
+
+// OpenVersionSet ucitava MANIFEST iz direktorijuma SSTable-ova i vraca VersionSet za taj direktorijum
+// Ako MANIFEST ne postoji (stari direktorijum), verzija se pravi od SSTable-ova koji postoje na disku
+// MANIFEST se prepisuje jednom izmenom sa celim stanjem, da ne bi rastao, a direktorijumi SSTable-ova
+// koji nisu u verziji (prekinut flush ili kompakcija, neobrisani stari fajlovi) se brisu
+// Poziva se jednom pri otvaranju baze, pre prvog upisa SSTable-a, i VersionSet se prosledjuje funkcijama paketa
+// Recnik je potreban samo za brojanje tombstone-ova u SSTable-ovima sa kompresijom bez MANIFEST-a
+func OpenVersionSet(conf *config.Config, dict *compression.Dictionary) (*VersionSet, error) {
+	vs, err := loadVersionSet(conf, dict)
+	if err != nil {
+		return nil, err
+	}
+	if err := vs.writeSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := vs.removeOrphans(); err != nil {
+		return nil, err
+	}
+	return vs, nil
+}
+
+// loadVersionSet cita verziju iz MANIFEST-a (ili sa diska ako ga nema) i ne menja nista na disku
+func loadVersionSet(conf *config.Config, dict *compression.Dictionary) (*VersionSet, error) {
+	vs := &VersionSet{
+		conf:     conf,
+		live:     make(map[*Version]struct{}),
+		obsolete: make(map[SSTableReference]struct{}),
+		nextGen:  make(map[int]int),
+		tables:   newTableCache(conf.Cache.TableCapacity),
+	}
+	v := &Version{tables: make(map[SSTableReference]*TableMeta), refs: 1}
+
+	edits, err := readManifest(vs.manifestPath())
+	if errors.Is(err, os.ErrNotExist) {
+		// Nema MANIFEST-a, zive su sve SSTable-ove sa diska
+		edit, err := scanSSTables(conf, dict)
+		if err != nil {
+			return nil, err
+		}
+		edits = []VersionEdit{edit}
+	} else if err != nil {
+		return nil, err
+	}
+	for _, edit := range edits {
+		v = vs.apply(v, edit)
+	}
+	vs.current = v
+	vs.live[v] = struct{}{}
+	return vs, nil
+}
+
+func (vs *VersionSet) manifestPath() string {
+	return filepath.Join(vs.conf.SSTable.SstableDirectory, manifestFileName)
+}
+
+// apply pravi novu verziju od v i izmene edit i azurira sledece generacije i poslednji sekvencni broj
+func (vs *VersionSet) apply(v *Version, edit VersionEdit) *Version {
+	next := &Version{tables: make(map[SSTableReference]*TableMeta, len(v.tables)+len(edit.Added))}
+	for ref, meta := range v.tables {
+		next.tables[ref] = meta
+	}
+	for _, ref := range edit.Removed {
+		delete(next.tables, ref)
+	}
+	for i := range edit.Added {
+		meta := edit.Added[i]
+		next.tables[SSTableReference{Level: meta.Level, Gen: meta.Gen}] = &meta
+		if meta.Gen >= vs.nextGen[meta.Level] {
+			vs.nextGen[meta.Level] = meta.Gen + 1
+		}
+		if meta.MaxSeq > vs.lastSeq {
+			vs.lastSeq = meta.MaxSeq
+		}
+	}
+	if edit.LastSeq > vs.lastSeq {
+		vs.lastSeq = edit.LastSeq
+	}
+	for level, gen := range edit.NextGen {
+		if gen > vs.nextGen[level] {
+			vs.nextGen[level] = gen
+		}
+	}
+	return next
+}
+
+// acquire vraca trenutnu verziju i drzi referencu na nju, pozivalac je oslobadja sa release
+func (vs *VersionSet) acquire() *Version {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	vs.current.refs++
+	return vs.current
+}
+
+func (vs *VersionSet) release(v *Version) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	vs.unref(v)
+}
+
+func (vs *VersionSet) unref(v *Version) {
+	v.refs--
+	if v.refs > 0 {
+		return
+	}
+	delete(vs.live, v)
+	vs.deleteObsolete()
+}
+
+// deleteObsolete brise fajlove uklonjenih SSTable-ova koje vise nijedna ziva verzija ne sadrzi
+// Greska pri brisanju nije kriticna, takve fajlove brise sledece otvaranje (removeOrphans)
+func (vs *VersionSet) deleteObsolete() {
+	for ref := range vs.obsolete {
+		used := false
+		for v := range vs.live {
+			if _, ok := v.tables[ref]; ok {
+				used = true
+				break
+			}
+		}
+		if used {
+			continue
+		}
+		vs.tables.evict(ref)
+		if err := ref.DeleteFiles(vs.conf); err != nil {
+			log.Printf("lsmtree: %v", err)
+		}
+		delete(vs.obsolete, ref)
+	}
+}
+
+// Apply trajno upisuje izmenu u MANIFEST i tek onda je primenjuje na trenutnu verziju
+// Uklonjeni SSTable-ovi se brisu kad ih vise niko ne cita
+func (vs *VersionSet) Apply(edit VersionEdit) error {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	if err := appendManifest(vs.manifestPath(), edit); err != nil {
+		return err
+	}
+	old := vs.current
+	vs.current = vs.apply(old, edit)
+	vs.current.refs = 1 // Referenca samog VersionSet-a
+	vs.live[vs.current] = struct{}{}
+	for _, ref := range edit.Removed {
+		vs.obsolete[ref] = struct{}{}
+	}
+	vs.unref(old)
+	return nil
+}
+
+// NextGeneration vraca sledecu slobodnu generaciju na nivou
+func (vs *VersionSet) NextGeneration(level int) int {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	if gen := vs.nextGen[level]; gen > 1 {
+		return gen
+	}
+	return 1
+}
+
+// LastSequence vraca najveci sekvencni broj zapisa koji je upisan u SSTable-ove
+// Novi upisi posle restarta moraju dobiti veci sekvencni broj, inace bi stariji zapis pobedio noviji
+func (vs *VersionSet) LastSequence() uint64 {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	return vs.lastSeq
+}
+
+// TableCacheStats vraca broj pogodaka i promasaja kesa otvorenih SSTable-ova, kao i broj SSTable-ova u njemu
+func (vs *VersionSet) TableCacheStats() (hits uint64, misses uint64, size int) {
+	return vs.tables.stats()
+}
+
+// snapshotEdit vraca izmenu koja od prazne verzije pravi verziju v
+func (vs *VersionSet) snapshotEdit(v *Version) VersionEdit {
+	edit := VersionEdit{NextGen: make(map[int]int, len(vs.nextGen)), LastSeq: vs.lastSeq}
+	for level, gen := range vs.nextGen {
+		edit.NextGen[level] = gen
+	}
+	for _, meta := range v.tables {
+		edit.Added = append(edit.Added, *meta)
+	}
+	sort.Slice(edit.Added, func(i, j int) bool {
+		if edit.Added[i].Level != edit.Added[j].Level {
+			return edit.Added[i].Level < edit.Added[j].Level
+		}
+		return edit.Added[i].Gen < edit.Added[j].Gen
+	})
+	return edit
+}
+
+// writeSnapshot zamenjuje MANIFEST jednom izmenom sa celom trenutnom verzijom
+func (vs *VersionSet) writeSnapshot() error {
+	edit := vs.snapshotEdit(vs.current)
+	if err := os.MkdirAll(vs.conf.SSTable.SstableDirectory, 0755); err != nil {
+		return fmt.Errorf("failed to create SSTable directory: %w", err)
+	}
+	tmp := vs.manifestPath() + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove old manifest snapshot: %w", err)
+	}
+	if err := appendManifest(tmp, edit); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, vs.manifestPath()); err != nil {
+		return fmt.Errorf("failed to replace manifest: %w", err)
+	}
+	return syncDir(vs.conf.SSTable.SstableDirectory)
+}
+
+// Snapshot je zadrzana verzija SSTable-ova, fajlovi njenih SSTable-ova se ne brisu dok se ne pozove Release
+// Koristi se za backup, da kompakcija tokom kopiranja ne obrise SSTable koji se kopira
+type Snapshot struct {
+	vs   *VersionSet
+	v    *Version
+	edit VersionEdit
+}
+
+// Snapshot zadrzava trenutnu verziju
+func (vs *VersionSet) Snapshot() *Snapshot {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	vs.current.refs++
+	return &Snapshot{vs: vs, v: vs.current, edit: vs.snapshotEdit(vs.current)}
+}
+
+// Tables vraca SSTable-ove zadrzane verzije, sortirane po nivou i generaciji
+func (s *Snapshot) Tables() []TableMeta {
+	return append([]TableMeta(nil), s.edit.Added...)
+}
+
+// WriteManifest upisuje u path novi MANIFEST koji sadrzi samo zadrzanu verziju
+func (s *Snapshot) WriteManifest(path string) error {
+	return appendManifest(path, s.edit)
+}
+
+// Release oslobadja verziju, posle toga se fajlovi SSTable-ova koje je kompakcija uklonila mogu obrisati
+func (s *Snapshot) Release() {
+	s.vs.release(s.v)
+}
+
+// removeOrphans brise direktorijume SSTable-ova koji nisu u trenutnoj verziji
+func (vs *VersionSet) removeOrphans() error {
+	root := vs.conf.SSTable.SstableDirectory
+	levels, err := os.ReadDir(root)
+	if err != nil {
+		return fmt.Errorf("failed to read SSTable directory: %w", err)
+	}
+	for _, levelEntry := range levels {
+		level, err := strconv.Atoi(levelEntry.Name())
+		if err != nil || !levelEntry.IsDir() {
+			continue
+		}
+		gens, err := os.ReadDir(filepath.Join(root, levelEntry.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read level %d directory: %w", level, err)
+		}
+		for _, genEntry := range gens {
+			gen, err := strconv.Atoi(genEntry.Name())
+			if err != nil || !genEntry.IsDir() {
+				continue
+			}
+			if vs.current.meta(level, gen) != nil {
+				continue
+			}
+			log.Printf("lsmtree: removing SSTable level %d gen %d, it is not in the manifest", level, gen)
+			ref := SSTableReference{Level: level, Gen: gen}
+			if err := ref.DeleteFiles(vs.conf); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// scanSSTables pravi izmenu sa svim SSTable-ovima koji postoje na disku (za direktorijum bez MANIFEST-a)
+// Sledeca generacija na nivou je iza najvece postojece, i kad direktorijum nema SSTable
+func scanSSTables(conf *config.Config, dict *compression.Dictionary) (VersionEdit, error) {
+	edit := VersionEdit{NextGen: make(map[int]int)}
+	root := conf.SSTable.SstableDirectory
+	levels, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return edit, nil
+	}
+	if err != nil {
+		return edit, fmt.Errorf("failed to read SSTable directory: %w", err)
+	}
+	cbm := &block_organization.CachedBlockManager{
+		BM: block_organization.NewBlockManager(conf),
+		C:  block_organization.NewBlockCache(conf),
+	}
+	for _, levelEntry := range levels {
+		level, err := strconv.Atoi(levelEntry.Name())
+		if err != nil || !levelEntry.IsDir() {
+			continue
+		}
+		refs, maxGen, err := listSSTableDirs(conf, level)
+		if err != nil {
+			return edit, err
+		}
+		if maxGen > 0 {
+			edit.NextGen[level] = maxGen + 1
+		}
+		for _, ref := range refs {
+			meta, err := readTableMeta(conf, ref.Level, ref.Gen, dict, cbm)
+			if err != nil {
+				return edit, err
+			}
+			edit.Added = append(edit.Added, meta)
+		}
+	}
+	return edit, nil
+}
+
+// readTableMeta cita opseg kljuceva, velicinu, broj zapisa i najveci sekvencni broj SSTable-a sa diska
+// Kod SSTable-a sa Properties delom sve se cita iz footer-a, Summary-ja i Properties, a kod starijih se prolazi kroz sve zapise
+func readTableMeta(conf *config.Config, level, gen int, dict *compression.Dictionary, cbm *block_organization.CachedBlockManager) (TableMeta, error) {
+	table, err := sstable.StartSSTable(level, gen, conf, dict, cbm)
+	if err != nil {
+		return TableMeta{}, fmt.Errorf("failed to open SSTable for level %d, gen %d: %w", level, gen, err)
+	}
+	meta := TableMeta{
+		Level:  level,
+		Gen:    gen,
+		MinKey: table.Summary.FirstKey,
+		MaxKey: table.Summary.LastKey,
+		Size:   table.DiskSize,
+	}
+	if meta.Size == 0 {
+		meta.Size = sstable.CalculateDataSize(tableDataPath(conf, level, gen), conf)
+	}
+	if p := table.Properties; p != nil {
+		meta.Entries, meta.Tombstones, meta.MaxSeq = p.Entries, p.Tombstones, p.MaxSeq
+		meta.DataSize, meta.RawSize = p.DataSize, p.RawKeySize+p.RawValueSize
+		return meta, nil
+	}
+	if table.UseCompression && dict == nil {
+		return meta, nil // Kljucevi se ne mogu procitati bez recnika, broj zapisa ostaje nepoznat
+	}
+	iter := table.NewSSTableIterator(cbm)
+	for {
+		entry, ok := iter.Next()
+		if !ok {
+			break
+		}
+		meta.Entries++
+		if entry.Tombstone {
+			meta.Tombstones++
+		}
+		if entry.Seq > meta.MaxSeq {
+			meta.MaxSeq = entry.Seq
+		}
+	}
+	return meta, nil
+}
+
+// tableDataPath vraca putanju koju CalculateDataSize ocekuje: direktorijum SSTable-a ili fajl kod SingleFile
+func tableDataPath(conf *config.Config, level, gen int) string {
+	path := fmt.Sprintf("%s/%d/%d", conf.SSTable.SstableDirectory, level, gen)
+	if conf.SSTable.SingleFile {
+		path = sstable.CreateFileName(path, gen, "SSTable", "db")
+	}
+	return path
+}
+
+// AddTable dodaje u verziju novi SSTable (npr. posle flush-a Memtable-a), fajlovi moraju vec biti na disku
+func AddTable(vs *VersionSet, level, gen int, dict *compression.Dictionary, cbm *block_organization.CachedBlockManager) error {
+	meta, err := readTableMeta(vs.conf, level, gen, dict, cbm)
+	if err != nil {
+		return err
+	}
+	return vs.Apply(VersionEdit{Added: []TableMeta{meta}})
+}
+
+// appendManifest dodaje izmenu na kraj MANIFEST-a i sinhronizuje ga
+func appendManifest(path string, edit VersionEdit) error {
+	payload, err := json.Marshal(edit)
+	if err != nil {
+		return fmt.Errorf("failed to encode version edit: %w", err)
+	}
+	record := make([]byte, manifestHeaderSize, manifestHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	record = append(record, payload...)
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(record); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync manifest: %w", err)
+	}
+	return nil
+}
+
+// readManifest cita sve izmene iz MANIFEST-a
+// Nepotpun poslednji zapis (pad sistema tokom upisa) se odbacuje, ta izmena nikad nije bila primenjena
+// Duzina iz zaglavlja se proverava prema ostatku fajla, pa ni osteceno zaglavlje ne zauzima memoriju
+func readManifest(path string) ([]VersionEdit, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var edits []VersionEdit
+	for offset := 0; offset < len(data); {
+		rest := data[offset:]
+		if len(rest) < manifestHeaderSize {
+			log.Printf("lsmtree: dropped torn manifest record at offset %d", offset)
+			break
+		}
+		length := int(binary.BigEndian.Uint32(rest[0:4]))
+		if length < 0 || length > len(rest)-manifestHeaderSize {
+			log.Printf("lsmtree: dropped torn manifest record at offset %d", offset)
+			break
+		}
+		payload := rest[manifestHeaderSize : manifestHeaderSize+length]
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(rest[4:8]) {
+			if offset+manifestHeaderSize+length == len(data) {
+				log.Printf("lsmtree: dropped torn manifest record at offset %d", offset)
+				break
+			}
+			return nil, fmt.Errorf("manifest %s is corrupted at offset %d", path, offset)
+		}
+		var edit VersionEdit
+		if err := json.Unmarshal(payload, &edit); err != nil {
+			return nil, fmt.Errorf("manifest %s is corrupted at offset %d: %w", path, offset, err)
+		}
+		edits = append(edits, edit)
+		offset += manifestHeaderSize + length
+	}
+	return edits, nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", dir, err)
+	}
+	return nil
+}
@@ -189,7 +189,7 @@ func (mi *MemtablesIterator) Next() (adapter.MemtableEntry, bool) {
 			iIndex = i
 			newEntry = key
 		} else if bytes.Equal(key.Key, minKey) {
-			if key.Timestamp > newEntry.Timestamp {
+			if key.Seq > newEntry.Seq {
 				minKey = key.Key
 				iIndex = i
 				newEntry = key
@@ -268,7 +268,7 @@ func (ms *Memtables) PrefixIterate(prefix string) *PrefixIterator {
 			currentEntry = key
 		}
 		if bytes.Equal(key.Key, minKey) {
-			if key.Timestamp > currentEntry.Timestamp {
+			if key.Seq > currentEntry.Seq {
 				minKey = key.Key
 				currentEntry = key
 			}
@@ -322,7 +322,7 @@ func (pi *PrefixIterator) Next() (adapter.MemtableEntry, bool) {
 			iIndex = i
 			newEntry = key
 		} else if bytes.Equal(key.Key, minKey) {
-			if key.Timestamp > newEntry.Timestamp {
+			if key.Seq > newEntry.Seq {
 				minKey = key.Key
 				iIndex = i
 				newEntry = key
@@ -392,7 +392,7 @@ func (ms *Memtables) RangeIterate(startKey, endKey []byte) *RangeIterator {
 				currentEntry = iterators[i].memtableIterator.currentEntry
 			}
 			if bytes.Equal(iterators[i].memtableIterator.currentEntry.Key, minKey) {
-				if iterators[i].memtableIterator.currentEntry.Timestamp > currentEntry.Timestamp {
+				if iterators[i].memtableIterator.currentEntry.Seq > currentEntry.Seq {
 					minKey = iterators[i].memtableIterator.currentEntry.Key
 					currentEntry = iterators[i].memtableIterator.currentEntry
 				}
@@ -447,7 +447,7 @@ func (ri *RangeIterator) Next() (adapter.MemtableEntry, bool) {
 			iIndex = i
 			newEntry = key
 		} else if bytes.Equal(key.Key, minKey) {
-			if key.Timestamp > newEntry.Timestamp {
+			if key.Seq > newEntry.Seq {
 				minKey = key.Key
 				iIndex = i
 				newEntry = key
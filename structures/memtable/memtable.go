@@ -9,6 +9,7 @@ import (
 	"github.com/iigor000/database/structures/btree"
 	"github.com/iigor000/database/structures/hashmap"
 	"github.com/iigor000/database/structures/skiplist"
+	writeaheadlog "github.com/iigor000/database/structures/writeAheadLog"
 )
 
 // Memtables struktura koja sadrzi vise Memtable-a
@@ -37,12 +38,12 @@ func NewMemtables(conf *config.Config) *Memtables {
 
 // CRUD operacije
 // Update dodaje ili azurira na osnovu kljuca u Memtables
-func (m *Memtables) Update(key []byte, value []byte, timestamp int64, tombstone bool) bool {
+func (m *Memtables) Update(key []byte, value []byte, seq uint64, timestamp int64, tombstone bool) bool {
 	// Prolazimo kroz sve Memtable i azuriramo
 
 	flushed := false
 	i := m.GetMemtableToChange()
-	m.Memtables[i].Update(key, value, timestamp, tombstone)
+	m.Memtables[i].Update(key, value, seq, timestamp, tombstone)
 
 	if i == m.NumberOfMemtables-1 {
 		if m.Memtables[i].Size >= m.Memtables[i].Capacity {
@@ -71,10 +72,35 @@ func (m *Memtables) Delete(key []byte) bool {
 	return false
 }
 
+// CoverWAL belezi da je zapis iz WAL-a na pozicijama [start, end) primenjen na Memtables
+// Zapis se pripisuje Memtable-u koji se trenutno menja, pa se poziva pre Update i Delete
+// (i kad Delete izmeni stariji Memtable, ovaj se flush-uje posle njega, pa je granica i dalje ispravna)
+func (m *Memtables) CoverWAL(start, end writeaheadlog.Position) {
+	m.Memtables[m.GetMemtableToChange()].CoverWAL(start, end)
+}
+
+// WALStart vraca poziciju od koje WAL jos treba za Memtable-ove od from nadalje
+// ok je false ako ti Memtable-ovi nemaju nijedan zapis
+func (m *Memtables) WALStart(from int) (writeaheadlog.Position, bool) {
+	var start writeaheadlog.Position
+	ok := false
+	for i := from; i < m.NumberOfMemtables; i++ {
+		memtable := m.Memtables[i]
+		if memtable.WalStart.Segment == 0 {
+			continue
+		}
+		if !ok || memtable.WalStart.Before(start) {
+			start, ok = memtable.WalStart, true
+		}
+	}
+	return start, ok
+}
+
 // Search trazi kljuc u Memtables
+// Memtable-ovi se pune redom, pa se pretrazuju od poslednjeg, da bi noviji zapis (ili tombstone) sakrio stariji
 func (m *Memtables) Search(key []byte) (*adapter.MemtableEntry, bool) {
 	// Prolazimo kroz sve Memtable i trazimo
-	for i := 0; i < m.NumberOfMemtables; i++ {
+	for i := m.NumberOfMemtables - 1; i >= 0; i-- {
 		memtable := m.Memtables[i]
 		// Proveravamo da li postoji dati kljuc
 		record, exist := memtable.Search(key)
@@ -93,6 +119,9 @@ type Memtable struct {
 	Size      int
 	Capacity  int
 	Keys      [][]byte
+	// Deo WAL-a [WalStart, WalEnd) iz kog su zapisi ovog Memtable-a, Segment 0 znaci da zapisa nema
+	WalStart writeaheadlog.Position
+	WalEnd   writeaheadlog.Position
 }
 
 // Konstruktor za Memtable strukturu, opcija za implementaciju skip listom ili binarnim stablom
@@ -113,14 +142,24 @@ func NewMemtable(conf *config.Config) *Memtable {
 
 // CRUD operacije
 // Update dodaje ili azurira na osnovu kljuca u Memtable
-func (m *Memtable) Update(key []byte, value []byte, timestamp int64, tombstone bool) {
+func (m *Memtable) Update(key []byte, value []byte, seq uint64, timestamp int64, tombstone bool) {
 	_, exist := m.Search(key)
 	if !exist {
 		m.Keys = append(m.Keys, key)
 		m.Size++
 	}
-	m.Structure.Update(key, value, timestamp, tombstone)
+	m.Structure.Update(key, value, seq, timestamp, tombstone)
+
+}
 
+// CoverWAL prosiruje deo WAL-a koji Memtable pokriva zapisom sa pozicija [start, end)
+func (m *Memtable) CoverWAL(start, end writeaheadlog.Position) {
+	if m.WalStart.Segment == 0 || start.Before(m.WalStart) {
+		m.WalStart = start
+	}
+	if m.WalEnd.Before(end) {
+		m.WalEnd = end
+	}
 }
 
 func (m *Memtable) Delete(key []byte) {
@@ -155,19 +194,19 @@ func (ms *Memtables) GetFirstEntry() adapter.MemtableEntry {
 		minKey := ms.Memtables[0].Keys[0]
 		memIndex := 0
 		e, _ := ms.Memtables[0].Search(minKey)
-		timestamp := e.Timestamp
+		seq := e.Seq
 		for i, memtable := range ms.Memtables {
 			for _, key := range memtable.Keys {
 				if bytes.Compare(key, minKey) < 0 {
 					minKey = key
 					memIndex = i
-					timestamp = e.Timestamp
+					seq = e.Seq
 				} else if bytes.Equal(key, minKey) {
 					e1, _ := memtable.Search(key)
-					if e1.Timestamp > timestamp {
+					if e1.Seq > seq {
 						minKey = key
 						memIndex = i
-						timestamp = e1.Timestamp
+						seq = e1.Seq
 					}
 				}
 			}
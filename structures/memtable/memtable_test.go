@@ -26,18 +26,18 @@ func TestMemtableCRUD(t *testing.T) {
 	}
 	// Test Update and Search
 	fmt.Println("Adding entries to Memtable:")
-	m.Update([]byte("1"), []byte("one"), 1, false)
+	m.Update([]byte("1"), []byte("one"), 1, 1, false)
 	//fmt.Println("Added key 1 with value 'one'")
-	m.Update([]byte("4"), []byte("four"), 4, false)
-	m.Update([]byte("7"), []byte("seven"), 7, false)
-	m.Update([]byte("10"), []byte("ten"), 10, false)
-	m.Update([]byte("12"), []byte("twelve"), 12, false)
+	m.Update([]byte("4"), []byte("four"), 4, 4, false)
+	m.Update([]byte("7"), []byte("seven"), 7, 7, false)
+	m.Update([]byte("10"), []byte("ten"), 10, 10, false)
+	m.Update([]byte("12"), []byte("twelve"), 12, 12, false)
 	fmt.Println("Added keys 1, 4, 7, 10, 12")
 	fmt.Println("Updating keys 1, 4, 7, 12 with new values:")
-	m.Update([]byte("1"), []byte("newone"), 13, false)
-	m.Update([]byte("4"), []byte("newfour"), 14, false)
-	m.Update([]byte("7"), []byte("newseven"), 15, false)
-	m.Update([]byte("12"), []byte("newtwelve"), 16, false)
+	m.Update([]byte("1"), []byte("newone"), 13, 13, false)
+	m.Update([]byte("4"), []byte("newfour"), 14, 14, false)
+	m.Update([]byte("7"), []byte("newseven"), 15, 15, false)
+	m.Update([]byte("12"), []byte("newtwelve"), 16, 16, false)
 	fmt.Println("Updated keys 1, 4, 7, 12 with new values")
 
 	entry, found := m.Search([]byte("1"))
@@ -110,22 +110,22 @@ func TestMemtables(t *testing.T) {
 		ms.Memtables[i].Print()
 	}
 	fmt.Println("Adding entries to Memtables:")
-	ms.Update([]byte("1"), []byte("one"), 1, false)
-	ms.Update([]byte("2"), []byte("two"), 2, false)
-	ms.Update([]byte("3"), []byte("three"), 3, false)
-	ms.Update([]byte("4"), []byte("four"), 4, false)
-	ms.Update([]byte("5"), []byte("five"), 5, false)
-	ms.Update([]byte("6"), []byte("six"), 6, false)
-	ms.Update([]byte("7"), []byte("seven"), 7, false)
-	ms.Update([]byte("8"), []byte("eight"), 8, false)
+	ms.Update([]byte("1"), []byte("one"), 1, 1, false)
+	ms.Update([]byte("2"), []byte("two"), 2, 2, false)
+	ms.Update([]byte("3"), []byte("three"), 3, 3, false)
+	ms.Update([]byte("4"), []byte("four"), 4, 4, false)
+	ms.Update([]byte("5"), []byte("five"), 5, 5, false)
+	ms.Update([]byte("6"), []byte("six"), 6, 6, false)
+	ms.Update([]byte("7"), []byte("seven"), 7, 7, false)
+	ms.Update([]byte("8"), []byte("eight"), 8, 8, false)
 	for i := 0; i < cf.Memtable.NumberOfMemtables; i++ {
 		fmt.Printf("Memtable %d after updates:\n", i)
 		ms.Memtables[i].Print()
 	}
 	fmt.Println("Updating keys in Memtables:")
-	ms.Update([]byte("6"), []byte("newsix"), 15, false)
-	ms.Update([]byte("7"), []byte("newseven"), 16, false)
-	ms.Update([]byte("8"), []byte("neweight"), 17, false)
+	ms.Update([]byte("6"), []byte("newsix"), 15, 15, false)
+	ms.Update([]byte("7"), []byte("newseven"), 16, 16, false)
+	ms.Update([]byte("8"), []byte("neweight"), 17, 17, false)
 	for i := 0; i < cf.Memtable.NumberOfMemtables; i++ {
 		fmt.Printf("Memtable %d after updates:\n", i)
 		ms.Memtables[i].Print()
@@ -167,16 +167,16 @@ func TestMemtableIterate(t *testing.T) {
 	}
 
 	memtables := NewMemtables(conf)
-	memtables.Update([]byte("key1"), []byte("value1"), 1, false)
-	memtables.Update([]byte("key2"), []byte("value2"), 2, false)
-	memtables.Update([]byte("key3"), []byte("value3"), 3, false)
-	memtables.Update([]byte("key4"), []byte("value4"), 4, false)
-	memtables.Update([]byte("key5"), []byte("value5"), 5, false)
-	memtables.Update([]byte("key6"), []byte("value6"), 6, false)
-	memtables.Update([]byte("key7"), []byte("value7"), 7, false)
-	memtables.Update([]byte("key8"), []byte("value8"), 8, false)
-	memtables.Update([]byte("key9"), []byte("value9"), 9, false)
-	memtables.Update([]byte("key10"), []byte("value10"), 10, false)
+	memtables.Update([]byte("key1"), []byte("value1"), 1, 1, false)
+	memtables.Update([]byte("key2"), []byte("value2"), 2, 2, false)
+	memtables.Update([]byte("key3"), []byte("value3"), 3, 3, false)
+	memtables.Update([]byte("key4"), []byte("value4"), 4, 4, false)
+	memtables.Update([]byte("key5"), []byte("value5"), 5, 5, false)
+	memtables.Update([]byte("key6"), []byte("value6"), 6, 6, false)
+	memtables.Update([]byte("key7"), []byte("value7"), 7, 7, false)
+	memtables.Update([]byte("key8"), []byte("value8"), 8, 8, false)
+	memtables.Update([]byte("key9"), []byte("value9"), 9, 9, false)
+	memtables.Update([]byte("key10"), []byte("value10"), 10, 10, false)
 
 	for i := 0; i < conf.Memtable.NumberOfMemtables; i++ {
 		iterator := memtables.Memtables[i].NewMemtableIterator()
@@ -241,16 +241,16 @@ func TestMemtablesIterator(t *testing.T) {
 	}
 
 	memtables := NewMemtables(conf)
-	memtables.Update([]byte("key1"), []byte("value1"), 1, false)
-	memtables.Update([]byte("key2"), []byte("value2"), 2, false)
-	memtables.Update([]byte("key3"), []byte("value3"), 3, false)
-	memtables.Update([]byte("key4"), []byte("value4"), 4, false)
-	memtables.Update([]byte("key5"), []byte("value5"), 5, false)
-	memtables.Update([]byte("key6"), []byte("value6"), 6, false)
-	memtables.Update([]byte("key7"), []byte("value7"), 7, false)
-	memtables.Update([]byte("key3"), []byte("value8"), 8, false)
-	memtables.Update([]byte("key2"), []byte("value9"), 9, false)
-	memtables.Update([]byte("key1"), []byte("value10"), 10, false)
+	memtables.Update([]byte("key1"), []byte("value1"), 1, 1, false)
+	memtables.Update([]byte("key2"), []byte("value2"), 2, 2, false)
+	memtables.Update([]byte("key3"), []byte("value3"), 3, 3, false)
+	memtables.Update([]byte("key4"), []byte("value4"), 4, 4, false)
+	memtables.Update([]byte("key5"), []byte("value5"), 5, 5, false)
+	memtables.Update([]byte("key6"), []byte("value6"), 6, 6, false)
+	memtables.Update([]byte("key7"), []byte("value7"), 7, 7, false)
+	memtables.Update([]byte("key3"), []byte("value8"), 8, 8, false)
+	memtables.Update([]byte("key2"), []byte("value9"), 9, 9, false)
+	memtables.Update([]byte("key1"), []byte("value10"), 10, 10, false)
 	println("Iterating:")
 	iter := memtables.NewMemtablesIterator()
 
@@ -310,16 +310,16 @@ func TestMemtablesScan(t *testing.T) {
 	}
 
 	memtables := NewMemtables(conf)
-	memtables.Update([]byte("key1"), []byte("value1"), 1, false)
-	memtables.Update([]byte("key2"), []byte("value2"), 2, false)
-	memtables.Update([]byte("key3"), []byte("value3"), 3, false)
-	memtables.Update([]byte("key4"), []byte("value4"), 4, false)
-	memtables.Update([]byte("key5"), []byte("value5"), 5, false)
-	memtables.Update([]byte("key6"), []byte("value6"), 6, false)
-	memtables.Update([]byte("key7"), []byte("value7"), 7, false)
-	memtables.Update([]byte("key8"), []byte("value8"), 8, false)
-	memtables.Update([]byte("key9"), []byte("value9"), 9, false)
-	memtables.Update([]byte("key10"), []byte("value10"), 10, false)
+	memtables.Update([]byte("key1"), []byte("value1"), 1, 1, false)
+	memtables.Update([]byte("key2"), []byte("value2"), 2, 2, false)
+	memtables.Update([]byte("key3"), []byte("value3"), 3, 3, false)
+	memtables.Update([]byte("key4"), []byte("value4"), 4, 4, false)
+	memtables.Update([]byte("key5"), []byte("value5"), 5, 5, false)
+	memtables.Update([]byte("key6"), []byte("value6"), 6, 6, false)
+	memtables.Update([]byte("key7"), []byte("value7"), 7, 7, false)
+	memtables.Update([]byte("key8"), []byte("value8"), 8, 8, false)
+	memtables.Update([]byte("key9"), []byte("value9"), 9, 9, false)
+	memtables.Update([]byte("key10"), []byte("value10"), 10, 10, false)
 
 	fmt.Println("Range Scan from key3 to key8:")
 	rangeEntries := memtables.RangeScan([]byte("key3"), []byte("key8"), 1, 5)
@@ -5,6 +5,9 @@ import "github.com/iigor000/database/structures/adapter"
 func (m *Memtables) RangeScan(startKey, endKey []byte, pageNumber int, pageSize int) []adapter.MemtableEntry {
 	rangeIterator := m.RangeIterate(startKey, endKey)
 	entries := make([]adapter.MemtableEntry, 0)
+	if rangeIterator == nil {
+		return entries // Nema unosa u opsegu
+	}
 	startIndex := (pageNumber - 1) * pageSize
 	endIndex := startIndex + pageSize
 	if startIndex < 0 {
@@ -29,6 +32,9 @@ func (m *Memtables) RangeScan(startKey, endKey []byte, pageNumber int, pageSize
 func (m *Memtables) PrefixScan(prefix string, pageNumber int, pageSize int) []adapter.MemtableEntry {
 	prefixIterator := m.PrefixIterate(prefix)
 	entries := make([]adapter.MemtableEntry, 0)
+	if prefixIterator == nil {
+		return entries // Nema unosa sa datim prefiksom
+	}
 	startIndex := (pageNumber - 1) * pageSize
 	endIndex := startIndex + pageSize
 	if startIndex < 0 {
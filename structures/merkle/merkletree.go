@@ -79,6 +79,18 @@ func NewMerkleTree(data [][]byte) *MerkleTree {
 	return &MerkleTree{Root: root, MerkleRootHash: root.Hash}
 }
 
+// HashLeaf racuna hash vrednost jednog podatka, kao za list stabla
+func HashLeaf(data []byte) HashValue {
+	return HashValue{Hash: sha256.Sum256(data)}
+}
+
+// NewMerkleTreeFromHashes kreira Merkle stablo od vec izracunatih hash vrednosti listova (HashLeaf)
+// Koristi se kad podaci ne mogu da stanu u memoriju, pa se cuvaju samo njihovi hash-evi
+func NewMerkleTreeFromHashes(hashes []HashValue) *MerkleTree {
+	root := buildMerkleTree(hashes)
+	return &MerkleTree{Root: root, MerkleRootHash: root.Hash}
+}
+
 // Serijalizacija Merkle stabla u binarnu datoteku merklee.bin
 func (t *MerkleTree) SerializeToBinaryFile(filename string, offset int64) (int, error) {
 	file, err := os.OpenFile(filename, os.O_WRONLY, 0644)
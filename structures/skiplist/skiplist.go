@@ -161,10 +161,11 @@ func (s *SkipList) Remove(key []byte) {
 }
 
 // Kreira novi cvor (za koriscenje u memtablu)
-func (s *SkipList) Create(key []byte, value []byte, timestamp int64, tombstone bool) {
+func (s *SkipList) Create(key []byte, value []byte, seq uint64, timestamp int64, tombstone bool) {
 	entry := memtable.MemtableEntry{
 		Key:       key,
 		Value:     value,
+		Seq:       seq,
 		Timestamp: timestamp,
 		Tombstone: tombstone,
 	}
@@ -203,14 +204,15 @@ func (s *SkipList) Delete(key []byte) {
 }
 
 // Azurira cvor - ako ne postoji doda ga, a ako postoji menja vrednost (za memtable)
-func (s *SkipList) Update(key []byte, value []byte, timestamp int64, tombstone bool) {
+func (s *SkipList) Update(key []byte, value []byte, seq uint64, timestamp int64, tombstone bool) {
 	entry, found := s.Search(key)
 	if !found {
-		s.Create(key, value, timestamp, tombstone)
+		s.Create(key, value, seq, timestamp, tombstone)
 		return
 	}
 	s.Remove(key)
 	entry.Value = value
+	entry.Seq = seq
 	entry.Timestamp = timestamp
 	entry.Tombstone = tombstone
 	serialized := serializeEntry(*entry)
@@ -225,6 +227,7 @@ func serializeEntry(entry memtable.MemtableEntry) []byte {
 	var valueLen int64 = int64(len(entry.Value))
 	binary.Write(buf, binary.BigEndian, valueLen)
 	buf.Write(entry.Value)
+	binary.Write(buf, binary.BigEndian, entry.Seq)
 	binary.Write(buf, binary.BigEndian, entry.Timestamp)
 	binary.Write(buf, binary.BigEndian, entry.Tombstone)
 	return buf.Bytes()
@@ -240,6 +243,8 @@ func deserializeEntry(data []byte) memtable.MemtableEntry {
 	binary.Read(buf, binary.BigEndian, &valueLen)
 	value := make([]byte, valueLen)
 	binary.Read(buf, binary.BigEndian, &value)
+	var seq uint64
+	binary.Read(buf, binary.BigEndian, &seq)
 	var timestamp int64
 	binary.Read(buf, binary.BigEndian, &timestamp)
 	var tombstone bool
@@ -247,6 +252,7 @@ func deserializeEntry(data []byte) memtable.MemtableEntry {
 	return memtable.MemtableEntry{
 		Key:       key,
 		Value:     value,
+		Seq:       seq,
 		Timestamp: timestamp,
 		Tombstone: tombstone,
 	}
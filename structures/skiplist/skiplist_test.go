@@ -47,9 +47,9 @@ func TestList(t *testing.T) {
 
 func TestBasicIterator(t *testing.T) {
 	s := MakeSkipList(3)
-	s.Create([]byte("key1"), []byte("one"), 0, false)
-	s.Create([]byte("key2"), []byte("two"), 0, false)
-	s.Create([]byte("key3"), []byte("three"), 0, false)
+	s.Create([]byte("key1"), []byte("one"), 0, 0, false)
+	s.Create([]byte("key2"), []byte("two"), 0, 0, false)
+	s.Create([]byte("key3"), []byte("three"), 0, 0, false)
 
 	println("=== Testing Basic Iterator ===")
 	iter, err := s.NewIterator()
@@ -79,18 +79,18 @@ func TestBasicIterator(t *testing.T) {
 
 func TestRangeIterator(t *testing.T) {
 	s := MakeSkipList(3)
-	s.Create([]byte("key1"), []byte("one"), 0, false)
-	s.Create([]byte("key2"), []byte("two"), 0, false)
-	s.Create([]byte("key3"), []byte("three"), 0, false)
-	s.Create([]byte("key4"), []byte("four"), 0, false)
-	s.Create([]byte("key5"), []byte("five"), 0, false)
-	s.Create([]byte("key6"), []byte("six"), 0, false)
-	s.Create([]byte("key7"), []byte("seven"), 0, false)
-	s.Create([]byte("key8"), []byte("eight"), 0, false)
-	s.Create([]byte("key9"), []byte("nine"), 0, false)
-	s.Create([]byte("key10"), []byte("ten"), 0, false)
-	s.Create([]byte("key11"), []byte("eleven"), 0, false)
-	s.Create([]byte("key12"), []byte("twelve"), 0, false)
+	s.Create([]byte("key1"), []byte("one"), 0, 0, false)
+	s.Create([]byte("key2"), []byte("two"), 0, 0, false)
+	s.Create([]byte("key3"), []byte("three"), 0, 0, false)
+	s.Create([]byte("key4"), []byte("four"), 0, 0, false)
+	s.Create([]byte("key5"), []byte("five"), 0, 0, false)
+	s.Create([]byte("key6"), []byte("six"), 0, 0, false)
+	s.Create([]byte("key7"), []byte("seven"), 0, 0, false)
+	s.Create([]byte("key8"), []byte("eight"), 0, 0, false)
+	s.Create([]byte("key9"), []byte("nine"), 0, 0, false)
+	s.Create([]byte("key10"), []byte("ten"), 0, 0, false)
+	s.Create([]byte("key11"), []byte("eleven"), 0, 0, false)
+	s.Create([]byte("key12"), []byte("twelve"), 0, 0, false)
 
 	// Pravimo range iterator od key3 do key9
 	iter, err := s.NewRangeIterator([]byte("key3"), []byte("key9"))
@@ -123,9 +123,9 @@ func TestRangeIterator(t *testing.T) {
 
 func TestPrefixIterate(t *testing.T) {
 	s := MakeSkipList(3)
-	s.Create([]byte("key1"), []byte("one"), 0, false)
-	s.Create([]byte("key2"), []byte("two"), 0, false)
-	s.Create([]byte("key3"), []byte("three"), 0, false)
+	s.Create([]byte("key1"), []byte("one"), 0, 0, false)
+	s.Create([]byte("key2"), []byte("two"), 0, 0, false)
+	s.Create([]byte("key3"), []byte("three"), 0, 0, false)
 
 	prefix := []byte("key")
 	prefixIter, err := s.NewPrefixIterator(prefix)
@@ -0,0 +1,318 @@
+package sstable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"sort"
+
+	"github.com/iigor000/database/structures/compression"
+)
+
+/*
+	=== BLOK (Data i Index) ===
+
+	+-----------+------------+--------------------------------------------------------------+-----------+
+	| Size (4B) | Codec (1B) | Telo (kompresovano kodekom): Zapisi | Restart offseti (4B) |  CRC (4B) |
+	|           |            | | Broj restarta (4B)                                          |           |
+	+-----------+------------+--------------------------------------------------------------+-----------+
+
+	Size je duzina kodeka i tela, jer BlockManager dopunjuje poslednji blok nulama
+	CRC se racuna nad svim pre njega, nad kompresovanim telom, pa se ostecenje otkriva pre dekompresije
+	Ako kompresija ne ustedi bar osminu tela, blok se upisuje bez nje (Codec 0), kao i blok veci od compression.MaxBlockSize
+	SSTable-ovi pre verzije formata 3 nemaju Codec bajt, telo im je uvek nekompresovano
+
+	=== ZAPIS U BLOKU ===
+
+	+----------------+------------------+--------------------+------------------+-----------+
+	| Shared (varint)| Unshared (varint)| Value Size (varint)| Kljuc (unshared) | Vrednost  |
+	+----------------+------------------+--------------------+------------------+-----------+
+
+	Shared je broj prvih bajtova kljuca koji su isti kao kod prethodnog zapisa
+	Na restart tackama (svaki RestartInterval-ti zapis) Shared je 0, pa se tu kljuc moze procitati bez prethodnih zapisa
+*/
+
+// Podrazumevan broj zapisa izmedju dve restart tacke
+const defaultRestartInterval = 16
+
+// Velicina Size polja i kodeka na pocetku i broja restarta i CRC-a na kraju bloka
+const blockOverhead = 4 + 1 + 4 + 4
+
+// Prva verzija formata SSTable-a u kojoj blok ima Codec bajt
+const formatVersionCodec = 3
+
+// blockBuilder slaze sortirane zapise u jedan blok
+type blockBuilder struct {
+	buf      []byte
+	restarts []uint32
+	interval int
+	counter  int // Broj zapisa od poslednje restart tacke
+	entries  int
+	lastKey  []byte
+}
+
+func newBlockBuilder(interval int) *blockBuilder {
+	if interval < 1 {
+		interval = defaultRestartInterval
+	}
+	return &blockBuilder{interval: interval}
+}
+
+// add dodaje zapis u blok, kljucevi moraju stizati sortirani
+func (b *blockBuilder) add(key, value []byte) {
+	shared := 0
+	if b.counter < b.interval {
+		for shared < len(key) && shared < len(b.lastKey) && key[shared] == b.lastKey[shared] {
+			shared++
+		}
+	} else {
+		b.counter = 0
+	}
+	if b.counter == 0 {
+		b.restarts = append(b.restarts, uint32(len(b.buf)))
+	}
+	b.buf = binary.AppendUvarint(b.buf, uint64(shared))
+	b.buf = binary.AppendUvarint(b.buf, uint64(len(key)-shared))
+	b.buf = binary.AppendUvarint(b.buf, uint64(len(value)))
+	b.buf = append(b.buf, key[shared:]...)
+	b.buf = append(b.buf, value...)
+	b.lastKey = append(b.lastKey[:0], key...)
+	b.counter++
+	b.entries++
+}
+
+// size vraca velicinu bloka kad bi se sada zavrsio
+func (b *blockBuilder) size() int {
+	return len(b.buf) + 4*len(b.restarts) + blockOverhead
+}
+
+// sizeWith vraca (gornju granicu) velicine bloka posle dodavanja zapisa
+func (b *blockBuilder) sizeWith(key, value []byte) int {
+	return b.size() + 3*binary.MaxVarintLen32 + len(key) + len(value) + 4
+}
+
+func (b *blockBuilder) empty() bool {
+	return b.entries == 0
+}
+
+// finish vraca serijalizovan blok sa telom kompresovanim kodekom codec, posle toga builder treba resetovati
+func (b *blockBuilder) finish(codec compression.Codec) ([]byte, error) {
+	body := make([]byte, 0, b.size())
+	body = append(body, b.buf...)
+	for _, restart := range b.restarts {
+		body = binary.LittleEndian.AppendUint32(body, restart)
+	}
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(b.restarts)))
+
+	id := compression.CodecNone
+	if codec != nil && codec.ID() != compression.CodecNone && len(body) <= compression.MaxBlockSize {
+		compressed, err := codec.Compress(body)
+		if err != nil {
+			return nil, fmt.Errorf("error compressing block with %s: %w", codec.Name(), err)
+		}
+		if len(compressed) < len(body)-len(body)/8 {
+			id, body = codec.ID(), compressed
+		}
+	}
+	out := make([]byte, 5, len(body)+9)
+	binary.LittleEndian.PutUint32(out[:4], uint32(1+len(body)))
+	out[4] = id
+	out = append(out, body...)
+	return binary.LittleEndian.AppendUint32(out, crc32.ChecksumIEEE(out)), nil
+}
+
+func (b *blockBuilder) reset() {
+	b.buf = b.buf[:0]
+	b.restarts = b.restarts[:0]
+	b.counter = 0
+	b.entries = 0
+	b.lastKey = b.lastKey[:0]
+}
+
+// block je procitan i proveren blok
+type block struct {
+	data     []byte   // Zapisi
+	restarts []uint32 // Offseti restart tacaka u data
+	codec    byte     // Kodek kojim je telo bilo kompresovano
+	stored   int      // Velicina bloka na disku, bez dopune
+}
+
+// decodeBlock proverava CRC bloka, dekompresuje telo i odvaja zapise od restart tacaka
+// data moze imati visak bajtova na kraju (nule kojima je dopunjen poslednji fizicki blok)
+// version je verzija formata SSTable-a, pre verzije 3 blok nema Codec bajt
+func decodeBlock(data []byte, version int) (*block, error) {
+	header := 4
+	if version >= formatVersionCodec {
+		header = 5
+	}
+	if len(data) < header+8 {
+		return nil, fmt.Errorf("block too short: %d bytes", len(data))
+	}
+	size := int(binary.LittleEndian.Uint32(data[:4]))
+	if size < header-4 || 4+size+4 > len(data) {
+		return nil, fmt.Errorf("invalid block size %d (%d bytes available)", size, len(data))
+	}
+	stored := binary.LittleEndian.Uint32(data[4+size:])
+	if calculated := crc32.ChecksumIEEE(data[:4+size]); stored != calculated {
+		return nil, fmt.Errorf("block checksum mismatch: stored %08x, calculated %08x", stored, calculated)
+	}
+	body := data[header : 4+size]
+	b := &block{codec: compression.CodecNone, stored: 4 + size + 4}
+	if header == 5 && data[4] != compression.CodecNone {
+		codec, err := compression.CodecByID(data[4])
+		if err != nil {
+			return nil, err
+		}
+		if body, err = codec.Decompress(body); err != nil {
+			return nil, fmt.Errorf("error decompressing block with %s: %w", codec.Name(), err)
+		}
+		b.codec = codec.ID()
+	}
+	if len(body) < 4 {
+		return nil, fmt.Errorf("block body too short: %d bytes", len(body))
+	}
+	count := int(binary.LittleEndian.Uint32(body[len(body)-4:]))
+	if count < 1 || 4*(count+1) > len(body) {
+		return nil, fmt.Errorf("invalid number of restart points %d", count)
+	}
+	restartsStart := len(body) - 4*(count+1)
+	b.data, b.restarts = body[:restartsStart], make([]uint32, count)
+	for i := range b.restarts {
+		b.restarts[i] = binary.LittleEndian.Uint32(body[restartsStart+4*i:])
+		if int(b.restarts[i]) >= restartsStart {
+			return nil, fmt.Errorf("restart point %d out of block", b.restarts[i])
+		}
+	}
+	return b, nil
+}
+
+// blockEntry je zapis procitan iz bloka, Key je nov niz, a Value pokazuje u blok
+type blockEntry struct {
+	Key   []byte
+	Value []byte
+}
+
+// readEntry cita zapis na offsetu offset, prev je kljuc prethodnog zapisa
+// Vraca zapis i offset sledeceg zapisa
+func (b *block) readEntry(offset int, prev []byte) (blockEntry, int, error) {
+	data := b.data[offset:]
+	var fields [3]uint64
+	for i := range fields {
+		value, n := binary.Uvarint(data)
+		if n <= 0 {
+			return blockEntry{}, 0, fmt.Errorf("invalid entry header at offset %d", offset)
+		}
+		fields[i] = value
+		data = data[n:]
+	}
+	shared, unshared, valueSize := fields[0], fields[1], fields[2]
+	if shared > uint64(len(prev)) || unshared+valueSize > uint64(len(data)) {
+		return blockEntry{}, 0, fmt.Errorf("entry at offset %d out of block", offset)
+	}
+	key := make([]byte, 0, shared+unshared)
+	key = append(key, prev[:shared]...)
+	key = append(key, data[:unshared]...)
+	entry := blockEntry{Key: key, Value: data[unshared : unshared+valueSize]}
+	return entry, len(b.data) - len(data) + int(unshared+valueSize), nil
+}
+
+// entries vraca sve zapise bloka
+func (b *block) entries() ([]blockEntry, error) {
+	return b.entriesFrom(0)
+}
+
+// entriesFrom vraca zapise od restart tacke restart do kraja bloka
+func (b *block) entriesFrom(restart int) ([]blockEntry, error) {
+	var entries []blockEntry
+	var prev []byte
+	for offset := int(b.restarts[restart]); offset < len(b.data); {
+		entry, next, err := b.readEntry(offset, prev)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+		prev = entry.Key
+		offset = next
+	}
+	return entries, nil
+}
+
+// restartBefore vraca poslednju restart tacku ciji je kljuc <= key (prvu, ako je key manji od svih)
+// Restart tacka se trazi binarnom pretragom, pa se posle dekodiraju samo zapisi od nje
+// decodeKey pretvara upisan kljuc u pravi (npr. indeks iz recnika u kljuc), nil ako su isti
+func (b *block) restartBefore(key []byte, decodeKey func([]byte) ([]byte, error)) (int, error) {
+	var searchErr error
+	// Prva restart tacka ciji je kljuc > key, pretraga pocinje od one pre nje
+	restart := sort.Search(len(b.restarts), func(i int) bool {
+		entry, _, err := b.readEntry(int(b.restarts[i]), nil)
+		if err != nil {
+			searchErr = err
+			return true
+		}
+		k := entry.Key
+		if decodeKey != nil {
+			if k, err = decodeKey(k); err != nil {
+				searchErr = err
+				return true
+			}
+		}
+		return bytes.Compare(k, key) > 0
+	})
+	if searchErr != nil {
+		return 0, searchErr
+	}
+	if restart > 0 {
+		restart--
+	}
+	return restart, nil
+}
+
+// seek vraca zapise od prvog zapisa ciji je kljuc >= key do kraja bloka
+// decodeKey pretvara upisan kljuc u pravi (npr. indeks iz recnika u kljuc), nil ako su isti
+func (b *block) seek(key []byte, decodeKey func([]byte) ([]byte, error)) ([]blockEntry, error) {
+	restart, err := b.restartBefore(key, decodeKey)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := b.entriesFrom(restart)
+	if err != nil {
+		return nil, err
+	}
+	for i, entry := range entries {
+		k := entry.Key
+		if decodeKey != nil {
+			if k, err = decodeKey(k); err != nil {
+				return nil, err
+			}
+		}
+		if bytes.Compare(k, key) >= 0 {
+			return entries[i:], nil
+		}
+	}
+	return nil, nil
+}
+
+// floor vraca poslednji zapis ciji je kljuc <= key, a ako je key manji od svih kljuceva, prvi zapis bloka
+// Kao i seek, cita samo zapise od restart tacke pre key, i to dok ne naidje na veci kljuc
+func (b *block) floor(key []byte) (blockEntry, error) {
+	restart, err := b.restartBefore(key, nil)
+	if err != nil {
+		return blockEntry{}, err
+	}
+	var found blockEntry
+	for offset := int(b.restarts[restart]); offset < len(b.data); {
+		entry, next, err := b.readEntry(offset, found.Key)
+		if err != nil {
+			return blockEntry{}, err
+		}
+		if found.Key != nil && bytes.Compare(entry.Key, key) > 0 {
+			break
+		}
+		found, offset = entry, next
+	}
+	if found.Key == nil {
+		return blockEntry{}, fmt.Errorf("block has no entries")
+	}
+	return found, nil
+}
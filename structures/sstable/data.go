@@ -1,334 +1,297 @@
 package sstable
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
-	"hash/crc32"
-	"strings"
+	"io"
 
 	"github.com/iigor000/database/config"
-	"github.com/iigor000/database/structures/adapter"
 	"github.com/iigor000/database/structures/block_organization"
 	"github.com/iigor000/database/structures/compression"
 )
 
+/*
+	=== DATA RECORD (vrednost zapisa u Data bloku) ===
+
+	+--------------+-------------+-------------------+-----------+
+	| Flags (1B)   | Seq (varint)| Timestamp (varint)|  Value    |
+	+--------------+-------------+-------------------+-----------+
+
+	Kljuc zapisa je kljuc u bloku: sam kljuc, ili njegov indeks u recniku (varint) ako se koristi kompresija
+	Obrisan zapis (flag 1) nema vrednost, a kod izdvojene vrednosti (flag 2) Value je blob.Pointer
+*/
+
+// Flagovi zapisa
+const (
+	flagTombstone = 1
+	flagBlob      = 2 // Vrednost je u blob fajlu
+)
+
 // DataRecord struktura je jedan zapis u Data segmentu SSTable-a
 // Tombstone oznacava da li je zapis logicki obrisan
-// CRC je kontrolna suma koja se koristi za proveru integriteta podataka
+// Integritet zapisa se proverava kontrolnom sumom Data bloka u kom se nalazi
 type DataRecord struct {
 	Key       []byte
 	Value     []byte
+	Seq       uint64 // Sekvencni broj upisa, noviji zapis kljuca ima veci
 	Timestamp int64
 	Tombstone bool
-	CRC       uint32 // Kontrolna suma za proveru integriteta podataka
-	KeySize   int8   // Velicina kljuca
-	ValueSize int8   // Velicina vrednosti
-	Offset    int    // Offset u fajlu gde je zapis upisan
+	Blob      bool // Value je pokazivac na vrednost u blob fajlu
+	Offset    int  // Offset Data bloka u kom je zapis upisan
 }
 
 // Data struktura je skup DataRecord-a
 type Data struct {
 	Records  []DataRecord
 	DataFile File
+	// Verzija formata SSTable-a, od nje zavisi zapis bloka
+	FormatVersion int
 }
 
 // NewDataRecord pravi DataRecord iz memtable entrija
-func NewDataRecord(key, value []byte, timestamp int64, tombstone bool) DataRecord {
+func NewDataRecord(key, value []byte, seq uint64, timestamp int64, tombstone bool) DataRecord {
+	if tombstone {
+		value = nil // Vrednost obrisanog zapisa se ne upisuje
+	}
 	record := DataRecord{
 		Key:       key,
 		Value:     value,
+		Seq:       seq,
 		Timestamp: timestamp,
 		Tombstone: tombstone,
 	}
-	// Racunanje CRC pre zapisa u buffer
-	record.CRC = record.calcCRC()
-	record.KeySize = int8(len(key))
-	record.ValueSize = int8(len(value))
 	// Postavljanje ofseta na -1, jer jos uvek nije upisan u fajl
 	record.Offset = -1
 
 	return record
 }
 
-// Serialize serijalizuje DataRecord u bajt niz
-func (dr *DataRecord) Serialize(dict *compression.Dictionary) ([]byte, error) {
-	var serialized_data []byte
-	// Upisujemo CRC
-	bytes := make([]byte, 4)
-	binary.LittleEndian.PutUint32(bytes, dr.CRC)
-	serialized_data = append(serialized_data, bytes...)
-	// Upisujemo Timestamp
-	bytes1 := make([]byte, 8)
-	binary.LittleEndian.PutUint64(bytes1, uint64(dr.Timestamp))
-	serialized_data = append(serialized_data, bytes1...)
-	// Upisujemo Tombstone
-	if dr.Tombstone {
-		serialized_data = append(serialized_data, 1)
-	} else {
-		serialized_data = append(serialized_data, 0)
-	}
-	// Upisujemo Key Size ako ne koristimo kompresiju
+// encodeKey vraca kljuc kako se upisuje u Data blok
+func encodeKey(key []byte, dict *compression.Dictionary) ([]byte, error) {
 	if dict == nil {
-		serialized_data = append(serialized_data, byte(len(dr.Key)))
-		// Upisujemo Value Size ako nije logicki obrisan
-		if !dr.Tombstone {
-			serialized_data = append(serialized_data, byte(len(dr.Value)))
-		}
-		// Upisujemo Key
-		serialized_data = append(serialized_data, dr.Key...)
-
-		// Upisujemo Value ako nije logicki obrisan
-		if !dr.Tombstone {
-			serialized_data = append(serialized_data, dr.Value...)
-
-		}
-	} else {
-		// Upisujemo indeks kljuca u recniku
-		index, found := dict.SearchKey(dr.Key)
-		if !found {
-			return nil, fmt.Errorf("key not found in dictionary")
-		}
-		bytes := make([]byte, 8)
-		binary.LittleEndian.PutUint64(bytes, uint64(index))
-		serialized_data = append(serialized_data, bytes...)
-		// Upisujemo vrednost samo ako nije logicki obrisana
-		if !dr.Tombstone {
-			serialized_data = append(serialized_data, byte(len(dr.Value)))
-			serialized_data = append(serialized_data, dr.Value...)
-		}
+		return key, nil
+	}
+	index, found := dict.SearchKey(key)
+	if !found {
+		return nil, fmt.Errorf("key not found in dictionary")
 	}
-	return serialized_data, nil
+	return binary.AppendUvarint(nil, uint64(index)), nil
 }
 
-// WriteDataRecord upisuje DataRecord u fajl
-func (dr *DataRecord) WriteDataRecord(path string, dict *compression.Dictionary, bm *block_organization.CachedBlockManager) (int, error) {
-	serialized_data, err := dr.Serialize(dict)
-	if err != nil {
-		return -1, fmt.Errorf("error serializing data record: %w", err)
+// decodeKey vraca pravi kljuc iz kljuca upisanog u Data blok
+func decodeKey(stored []byte, dict *compression.Dictionary) ([]byte, error) {
+	if dict == nil {
+		return stored, nil
+	}
+	index, n := binary.Uvarint(stored)
+	if n <= 0 || n != len(stored) {
+		return nil, fmt.Errorf("invalid key index")
 	}
-	return bm.Append(path, serialized_data)
+	key, found := dict.SearchIndex(int(index))
+	if !found {
+		return nil, fmt.Errorf("key index %d not found in dictionary", index)
+	}
+	return key, nil
 }
 
-// calcCRC Racunaa CRC na osnovu Key, Value, Timestamp i Tombstone
-func (dr *DataRecord) calcCRC() uint32 {
-	// Create a new slice instead of appending to dr.Key
-	data := make([]byte, 0, len(dr.Key)+len(dr.Value)+8+1)
-	data = append(data, dr.Key...)
-	data = append(data, dr.Value...)
-	data = append(data, byte(dr.Timestamp>>56), byte(dr.Timestamp>>48), byte(dr.Timestamp>>40), byte(dr.Timestamp>>32),
-		byte(dr.Timestamp>>24), byte(dr.Timestamp>>16), byte(dr.Timestamp>>8), byte(dr.Timestamp))
+// encodeValue serijalizuje sve osim kljuca
+func (dr *DataRecord) encodeValue() []byte {
+	out := make([]byte, 0, 1+2*binary.MaxVarintLen64+len(dr.Value))
+	var flags byte
 	if dr.Tombstone {
-		data = append(data, 1)
-	} else {
-		data = append(data, 0)
+		flags |= flagTombstone
+	} else if dr.Blob {
+		flags |= flagBlob
+	}
+	out = append(out, flags)
+	out = binary.AppendUvarint(out, dr.Seq)
+	out = binary.AppendVarint(out, dr.Timestamp)
+	if !dr.Tombstone {
+		out = append(out, dr.Value...)
 	}
-	return crc32.ChecksumIEEE(data)
+	return out
 }
 
-// Upisuje Data u fajl
-func (db *Data) WriteData(path string, conf *config.Config, dict *compression.Dictionary, cbm *block_organization.CachedBlockManager) (*Data, error) {
-
-	rec := 0
-	for _, record := range db.Records {
-
-		bn, err := record.WriteDataRecord(path, dict, cbm)
-		if err != nil {
-			return db, fmt.Errorf("error writing data record to file %s: %w", path, err)
-		}
-		db.Records[rec].Offset = bn * conf.Block.BlockSize // Racunamo ofset kao broj bloka pomnozen sa velicinom bloka
-
-		rec++
-		db.DataFile.SizeOnDisk = int64(bn * conf.Block.BlockSize)
+// decodeDataRecord pravi DataRecord od zapisa iz Data bloka
+func decodeDataRecord(entry blockEntry, dict *compression.Dictionary) (DataRecord, error) {
+	dr := DataRecord{}
+	key, err := decodeKey(entry.Key, dict)
+	if err != nil {
+		return dr, err
+	}
+	dr.Key = key
+	data := entry.Value
+	if len(data) < 1 {
+		return dr, fmt.Errorf("data record for key %q is empty", key)
+	}
+	dr.Tombstone = data[0]&flagTombstone != 0
+	dr.Blob = data[0]&flagBlob != 0
+	data = data[1:]
+	seq, n := binary.Uvarint(data)
+	if n <= 0 {
+		return dr, fmt.Errorf("invalid sequence number for key %q", key)
 	}
-	return db, nil
+	dr.Seq = seq
+	data = data[n:]
+	timestamp, n := binary.Varint(data)
+	if n <= 0 {
+		return dr, fmt.Errorf("invalid timestamp for key %q", key)
+	}
+	dr.Timestamp = timestamp
+	data = data[n:]
+	if !dr.Tombstone {
+		dr.Value = data
+	} else if len(data) > 0 {
+		return dr, fmt.Errorf("tombstone for key %q has a value", key)
+	}
+	return dr, nil
 }
 
-// Citanje DataBlock iz fajla
-func ReadData(path string, conf *config.Config, dict *compression.Dictionary, startOffset, endOffset int64, bm *block_organization.CachedBlockManager) (*Data, error) {
-
-	block_num := int(startOffset / int64(conf.Block.BlockSize)) // Pocinjemo od bloka koji sadrzi startOffset
-	end_block := int(endOffset / int64(conf.Block.BlockSize))   // Kraj bloka koji sadrzi endOffset
-
-	if endOffset <= startOffset {
-		end_block = -1 // Kraj bloka koji sadrzi endOffset
+// endBlock vraca prvi blok iza Data dela, -1 ako Data deo ide do kraja fajla
+func (d *Data) endBlock(blockSize int) int {
+	if d.DataFile.SizeOnDisk < 0 {
+		return -1
 	}
-	dataBlock := &Data{}
+	return int((d.DataFile.Offset + d.DataFile.SizeOnDisk) / int64(blockSize))
+}
 
-	for {
-		block, err := bm.Read(path, block_num)
-		if err != nil {
-			if err.Error() == "EOF" || strings.Contains(err.Error(), "EOF") {
-				break // Kraj fajla
-			}
-			return nil, fmt.Errorf("error reading data block from file %s: %w", path, err)
+// readBlock cita i proverava Data blok koji pocinje u bloku blockNumber
+// Vraca blok i broj bloka iza njega, a nil ako na tom mestu vise nema Data blokova
+// dict je potreban za proveru zapisa starog formata (verzija 1), kod kojih je blok jedan zapis
+func (d *Data) readBlock(bm *block_organization.CachedBlockManager, blockNumber int, dict *compression.Dictionary) (*block, int, error) {
+	if end := d.endBlock(bm.BM.BlockSize); blockNumber < 0 || (end != -1 && blockNumber >= end) {
+		return nil, -1, nil
+	}
+	payload, err := bm.Read(d.DataFile.Path, blockNumber)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, -1, nil // Kraj fajla
 		}
+		return nil, -1, fmt.Errorf("error reading data block %d from file %s: %w", blockNumber, d.DataFile.Path, err)
+	}
+	b, err := decodeDataBlock(payload, d.FormatVersion, dict)
+	if err != nil {
+		return nil, -1, fmt.Errorf("data block %d in file %s: %w", blockNumber, d.DataFile.Path, err)
+	}
+	return b, blockNumber + appendedBlocks(len(payload), bm.BM.BlockSize), nil
+}
 
-		if len(block) == 0 {
-			break // Nema vise podataka
-		}
-		block_num1 := block_num
-		i := 1
-		for {
-			if len(block)+(i*1) <= i*conf.Block.BlockSize {
-				block_num1 = block_num + i
-				break
-			}
-			i++
-		}
-		if end_block != -1 && block_num1 > end_block {
-			break
-		}
-		record := DataRecord{}
-		if err := record.Deserialize(block, dict); err != nil {
-			return nil, fmt.Errorf("error deserializing data record: %w", err)
+// decodeRecords pravi DataRecord-e od zapisa bloka koji pocinje u bloku blockNumber
+func decodeRecords(entries []blockEntry, blockNumber, blockSize int, dict *compression.Dictionary) ([]DataRecord, error) {
+	records := make([]DataRecord, len(entries))
+	for i, entry := range entries {
+		record, err := decodeDataRecord(entry, dict)
+		if err != nil {
+			return nil, fmt.Errorf("data block %d: %w", blockNumber, err)
 		}
-		//dict.Print()
-		record.Offset = block_num * conf.Block.BlockSize // Racunamo ofset kao broj bloka pomnozen sa velicinom bloka
-		dataBlock.Records = append(dataBlock.Records, record)
-		block_num = block_num1
+		record.Offset = blockNumber * blockSize
+		records[i] = record
+	}
+	return records, nil
+}
 
+// ReadBlock cita sve zapise Data bloka koji pocinje u bloku blockNumber
+// Vraca zapise i broj bloka iza njega, a nil zapise ako na tom mestu vise nema Data blokova
+func (d *Data) ReadBlock(bm *block_organization.CachedBlockManager, blockNumber int, dict *compression.Dictionary) ([]DataRecord, int, error) {
+	b, next, err := d.readBlock(bm, blockNumber, dict)
+	if err != nil || b == nil {
+		return nil, next, err
 	}
-	dataBlock.DataFile = File{
-		Path:       path,
-		Offset:     startOffset,
-		SizeOnDisk: endOffset - startOffset,
+	entries, err := b.entries()
+	if err != nil {
+		return nil, -1, fmt.Errorf("data block %d: %w", blockNumber, err)
 	}
-	return dataBlock, nil
+	records, err := decodeRecords(entries, blockNumber, bm.BM.BlockSize, dict)
+	return records, next, err
 }
 
-// Deserialize deserializuje DataRecord iz bajt niza
-func (dr *DataRecord) Deserialize(data []byte, dict *compression.Dictionary) error {
-	//dict.Print()
-	if len(data) < 4+8+1 { // CRC + Timestamp + Tombstone
-		println("data too short to deserialize DataRecord")
-		return fmt.Errorf("data too short to deserialize DataRecord")
+// SeekBlock cita zapise Data bloka od prvog zapisa ciji je kljuc >= key
+// Ako su svi kljucevi bloka manji, vraca prazan niz i broj sledeceg bloka
+func (d *Data) SeekBlock(bm *block_organization.CachedBlockManager, blockNumber int, key []byte, dict *compression.Dictionary) ([]DataRecord, int, error) {
+	b, next, err := d.readBlock(bm, blockNumber, dict)
+	if err != nil || b == nil {
+		return nil, next, err
 	}
-
-	// Citanje CRC
-	dr.CRC = binary.LittleEndian.Uint32(data[:4])
-	data = data[4:]
-
-	// Citanje Timestamp
-	dr.Timestamp = int64(binary.LittleEndian.Uint64(data[:8]))
-	data = data[8:]
-	// Citanje Tombstone
-	dr.Tombstone = data[0] == 1
-	data = data[1:]
-
-	if dict == nil {
-		if !dr.Tombstone {
-			// Citanje Key Size
-			if len(data) < 2 {
-				println("data too short to read key size")
-				return fmt.Errorf("data too short to read key size")
-			}
-			keySize := int(data[0])
-			valueSize := int(data[1])
-			data = data[2:]
-
-			if len(data) < keySize {
-				println("data too short to read key")
-				return fmt.Errorf("data too short to read key")
-			}
-			dr.Key = data[:keySize]
-			data = data[keySize:]
-			if len(data) < valueSize {
-				println("data too short to read value")
-				return fmt.Errorf("data too short to read value")
-			}
-			dr.Value = data[:valueSize]
-
-		} else {
-			dr.Value = nil
-			// Citanje Key Size
-			if len(data) < 1 {
-				println("data too short to read key size")
-				return fmt.Errorf("data too short to read key size")
-			}
-			keySize := int(data[0])
-			data = data[1:]
-			if len(data) < keySize {
-				println("data too short to read key")
-				return fmt.Errorf("data too short to read key")
-			}
-			dr.Key = data[:keySize]
-
-		}
-	} else {
-		// Ocekivano je da imamo keyindex, valuesize i value
-		if len(data) < 8 {
-			println("data too short to read key index")
-			return fmt.Errorf("data too short to read key index")
-		}
-
-		keyIndex := binary.LittleEndian.Uint64(data[:8])
-		data = data[8:]
-		//println("Key index deserialized:", int(keyIndex))
-		var found bool
-		dr.Key, found = dict.SearchIndex(int(keyIndex))
-
-		if !found {
-			println("key index not found in dictionary:", keyIndex)
-			return fmt.Errorf("key index %d not found in dictionary", keyIndex)
-		}
-		if !dr.Tombstone {
-			if len(data) < 1 {
-				println("data too short to read value size")
-				return fmt.Errorf("data too short to read value size")
-			}
-			valueSize := int(data[0])
-			data = data[1:]
-			if len(data) < valueSize {
-				println("data too short to read value")
-				return fmt.Errorf("data too short to read value")
-			}
-			dr.Value = data[:valueSize]
-			//data = data[valueSize:]
-		} else {
-			dr.Value = nil // Logicki obrisan zapis nema vrednost
-		}
+	var decode func([]byte) ([]byte, error)
+	if dict != nil {
+		decode = func(stored []byte) ([]byte, error) { return decodeKey(stored, dict) }
 	}
-
-	// Proveravamo CRC
-	calculatedCRC := dr.calcCRC()
-
-	if dr.CRC != calculatedCRC {
-		println("CRC mismatch")
-		println("Expected CRC:", dr.CRC, "Calculated CRC:", calculatedCRC)
-		return fmt.Errorf("CRC mismatch: expected %d, got %d", dr.CRC, calculatedCRC)
+	entries, err := b.seek(key, decode)
+	if err != nil {
+		return nil, -1, fmt.Errorf("data block %d: %w", blockNumber, err)
 	}
-
-	return nil
+	records, err := decodeRecords(entries, blockNumber, bm.BM.BlockSize, dict)
+	if records == nil && err == nil {
+		records = []DataRecord{}
+	}
+	return records, next, err
 }
 
-// Pomocna funkcija za Iterator-e
-func (d *Data) ReadRecord(bm *block_organization.CachedBlockManager, blockNumber int, dict *compression.Dictionary) (adapter.MemtableEntry, int) {
-
-	blockData, err := bm.Read(d.DataFile.Path, blockNumber)
+// FindRecord trazi zapis sa kljucem key u Data bloku koji pocinje u bloku blockNumber
+// Cita samo taj blok i dekodira samo pronadjeni zapis, a vraca nil ako kljuca nema u bloku
+func (d *Data) FindRecord(bm *block_organization.CachedBlockManager, blockNumber int, key []byte, dict *compression.Dictionary) (*DataRecord, error) {
+	b, _, err := d.readBlock(bm, blockNumber, dict)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	var decode func([]byte) ([]byte, error)
+	if dict != nil {
+		decode = func(stored []byte) ([]byte, error) { return decodeKey(stored, dict) }
+	}
+	entries, err := b.seek(key, decode)
 	if err != nil {
-		return adapter.MemtableEntry{}, -1
+		return nil, fmt.Errorf("data block %d: %w", blockNumber, err)
+	}
+	if len(entries) == 0 {
+		return nil, nil
 	}
+	record, err := decodeDataRecord(entries[0], dict)
+	if err != nil {
+		return nil, fmt.Errorf("data block %d: %w", blockNumber, err)
+	}
+	if !bytes.Equal(record.Key, key) {
+		return nil, nil
+	}
+	record.Offset = blockNumber * bm.BM.BlockSize
+	return &record, nil
+}
 
-	record := DataRecord{}
-	if err := record.Deserialize(blockData, dict); err != nil {
-		println("Error deserializing record:", err)
-		return adapter.MemtableEntry{}, -1
+// Citanje svih zapisa Data dela iz fajla, od startOffset do endOffset (do kraja fajla ako endOffset <= startOffset)
+func ReadData(path string, conf *config.Config, dict *compression.Dictionary, startOffset, endOffset int64, bm *block_organization.CachedBlockManager) (*Data, error) {
+	dataBlock := &Data{
+		DataFile: File{
+			Path:       path,
+			Offset:     startOffset,
+			SizeOnDisk: endOffset - startOffset,
+		},
+		FormatVersion: FormatVersion,
+	}
+	if endOffset <= startOffset {
+		dataBlock.DataFile.SizeOnDisk = -1
 	}
+	records, err := dataBlock.readAll(bm, dict)
+	if err != nil {
+		return nil, err
+	}
+	dataBlock.Records = records
+	return dataBlock, nil
+}
 
-	record.Offset = blockNumber * bm.BM.BlockSize
-	nextBlock := 0
-	i := 1
+// readAll cita sve zapise Data dela redom
+func (d *Data) readAll(bm *block_organization.CachedBlockManager, dict *compression.Dictionary) ([]DataRecord, error) {
+	var all []DataRecord
+	blockNum := int(d.DataFile.Offset / int64(bm.BM.BlockSize))
 	for {
-		if len(blockData)+(i*1) <= i*bm.BM.BlockSize {
-			nextBlock = blockNumber + i
-			break
+		records, next, err := d.ReadBlock(bm, blockNum, dict)
+		if err != nil {
+			return nil, err
 		}
-		i++
-	}
-	return adapter.MemtableEntry{
-		Key:       record.Key,
-		Value:     record.Value,
-		Timestamp: record.Timestamp,
-		Tombstone: record.Tombstone,
-	}, nextBlock
+		if records == nil {
+			return all, nil
+		}
+		all = append(all, records...)
+		blockNum = next
+	}
 }
@@ -0,0 +1,454 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iigor000/database/config"
+	"github.com/iigor000/database/structures/blob"
+	"github.com/iigor000/database/structures/block_organization"
+	"github.com/iigor000/database/structures/bloomfilter"
+	"github.com/iigor000/database/structures/compression"
+	"github.com/iigor000/database/structures/merkle"
+)
+
+// Maksimalan broj bajtova vrednosti koji se ispisuje u dump-u
+const dumpValueLimit = 48
+
+// CorruptionError opisuje prvi osteceni zapis pronadjen u SSTable-u
+type CorruptionError struct {
+	Path   string
+	Offset int64 // Offset bloka u kom pocinje osteceni zapis
+	Record int   // Redni broj zapisa u Data segmentu (od 0)
+	Reason string
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("corrupted record #%d at offset %d in %s: %s", e.Record, e.Offset, e.Path, e.Reason)
+}
+
+// dumpTable opisuje SSTable otvoren za dump, nezavisno od toga da li je u jednom ili vise fajlova
+type dumpTable struct {
+	dir    string
+	gen    int
+	path   string // Putanja do SSTable fajla, odnosno Data fajla kod vise fajlova
+	layout *layout
+	bm     *block_organization.BlockManager
+}
+
+// section je deo SSTable-a: fajl i opseg blokova [start, end), end -1 znaci do kraja fajla
+type section struct {
+	path  string
+	start int
+	end   int
+}
+
+// openDumpTable pronalazi SSTable u direktorijumu (ili direktorijumu datog fajla) i cita njegov raspored
+// Fajlovi se citaju direktno sa diska, bez keša, da bi se videlo tacno ono sto je upisano
+func openDumpTable(path string, conf *config.Config) (*dumpTable, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SSTable %s: %w", path, err)
+	}
+	dir := path
+	if !info.IsDir() {
+		dir = filepath.Dir(path)
+	}
+
+	t := &dumpTable{dir: dir, bm: block_organization.NewBlockManager(conf)}
+	matches, _ := filepath.Glob(filepath.Join(dir, "usertable-*-SSTable.db"))
+	if len(matches) == 0 {
+		matches, _ = filepath.Glob(filepath.Join(dir, "usertable-*-Data.db"))
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no SSTable found in %s", dir)
+		}
+	}
+	t.path = matches[0]
+	parts := strings.Split(filepath.Base(matches[0]), "-")
+	if len(parts) < 3 {
+		return nil, fmt.Errorf("invalid SSTable file name %s", matches[0])
+	}
+	t.gen, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid generation in file name %s: %w", matches[0], err)
+	}
+	if t.layout, err = readLayout(dir, t.gen, t.bm); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *dumpTable) section(name string) section {
+	file := t.layout.sections[name]
+	bs := int64(t.bm.BlockSize)
+	s := section{path: file.Path, start: int(file.Offset / bs), end: -1}
+	if file.SizeOnDisk >= 0 {
+		s.end = int((file.Offset + file.SizeOnDisk) / bs)
+	}
+	return s
+}
+
+// readChain cita jedan zapis koji pocinje u bloku block i moze da se prostire kroz vise blokova (oznake 1, 3, 2)
+// Vraca podatke bez oznaka i broj procitanih blokova, io.EOF ako na tom mestu vise nema zapisa
+// Za razliku od BlockManager.Read ne ulazi u beskonacnu petlju na ostecenom bloku
+func (t *dumpTable) readChain(s section, block int) ([]byte, int, error) {
+	var data []byte
+	for n := 0; ; n++ {
+		if s.end != -1 && block+n >= s.end {
+			if n == 0 {
+				return nil, 0, io.EOF
+			}
+			return nil, n, fmt.Errorf("record starting at block %d is cut off by the end of the section", block)
+		}
+		raw, err := t.bm.ReadBlock(s.path, block+n)
+		if err == io.EOF {
+			if n == 0 {
+				return nil, 0, io.EOF
+			}
+			return nil, n, fmt.Errorf("record starting at block %d is cut off by the end of the file", block)
+		}
+		if err != nil {
+			return nil, n, err
+		}
+		marker := raw[0]
+		switch {
+		case n == 0 && marker != 1 && marker != 2:
+			return nil, 1, fmt.Errorf("invalid first block marker %d in block %d", marker, block)
+		case n > 0 && marker != 2 && marker != 3:
+			return nil, n + 1, fmt.Errorf("invalid continuation block marker %d in block %d", marker, block+n)
+		}
+		data = append(data, raw[1:]...)
+		if marker == 2 {
+			return data, n + 1, nil
+		}
+	}
+}
+
+// DumpSSTable ispisuje sadrzaj SSTable-a: raspored fajlova i offsete, sve zapise sa dekodiranim kljucevima,
+// Index i Summary zapise, parametre Bloom filtera, koren Merkle stabla i Properties
+// path je direktorijum generacije SSTable-a ili bilo koji fajl u njemu
+func DumpSSTable(w io.Writer, path string, conf *config.Config, dict *compression.Dictionary) error {
+	t, err := openDumpTable(path, conf)
+	if err != nil {
+		return err
+	}
+	if !t.layout.useCompression {
+		dict = nil
+	}
+
+	layout := "multi file"
+	if t.layout.singleFile {
+		layout = "single file"
+	}
+	fmt.Fprintf(w, "SSTable %s (generation %d, %s, format version %d, compression %v)\n", t.dir, t.gen, layout, t.layout.version, t.layout.useCompression)
+	t.dumpFiles(w)
+
+	fmt.Fprintln(w, "Data:")
+	if _, err := t.walkData(dict, func(first int, offset int64, records []dumpRecord, b *block, err error) {
+		if err != nil {
+			fmt.Fprintf(w, "  block @%d ERROR %v\n", offset, err)
+			return
+		}
+		fmt.Fprintf(w, "  block @%d (%d records, %d bytes, codec %s) checksum ok\n", offset, len(records), b.stored, codecName(b.codec))
+		for i, r := range records {
+			fmt.Fprintf(w, "    #%d ", first+i)
+			if r.err != nil {
+				fmt.Fprintf(w, "ERROR %v\n", r.err)
+				continue
+			}
+			fmt.Fprintf(w, "key=%q", r.Key)
+			if r.keyIndex >= 0 {
+				fmt.Fprintf(w, " (dict #%d)", r.keyIndex)
+			}
+			fmt.Fprintf(w, " seq=%d ts=%d (%s)", r.Seq, r.Timestamp, time.Unix(r.Timestamp, 0).UTC().Format(time.RFC3339))
+			if r.Tombstone {
+				fmt.Fprint(w, " tombstone\n")
+			} else if p, err := blob.DecodePointer(r.Value); r.Blob && err == nil {
+				fmt.Fprintf(w, " blob(file %d @%d, %d bytes)\n", p.File, p.Offset, p.Size)
+			} else {
+				fmt.Fprintf(w, " value(%d)=%s\n", len(r.Value), formatValue(r.Value))
+			}
+		}
+	}); err != nil {
+		fmt.Fprintf(w, "  ERROR %v\n", err)
+	}
+
+	fmt.Fprintln(w, "Index:")
+	t.dumpIndex(w)
+	fmt.Fprintln(w, "Summary:")
+	t.dumpSummary(w)
+	t.dumpFilter(w)
+	t.dumpMetadata(w)
+	t.dumpProperties(w)
+	return nil
+}
+
+// VerifySSTable proverava kontrolnu sumu svakog Data bloka i format svakog zapisa u SSTable-u
+// Vraca broj proverenih zapisa, a za prvi osteceni blok *CorruptionError sa offsetom bloka i rednim brojem njegovog prvog zapisa
+func VerifySSTable(path string, conf *config.Config, dict *compression.Dictionary) (int, error) {
+	t, err := openDumpTable(path, conf)
+	if err != nil {
+		return 0, err
+	}
+	if !t.layout.useCompression {
+		dict = nil
+	}
+
+	var corruption *CorruptionError
+	dataPath := t.section("Data").path
+	checked, err := t.walkData(dict, func(first int, offset int64, records []dumpRecord, _ *block, err error) {
+		if corruption != nil {
+			return
+		}
+		if err != nil {
+			corruption = &CorruptionError{Path: dataPath, Offset: offset, Record: first, Reason: err.Error()}
+			return
+		}
+		for i, r := range records {
+			if r.err != nil {
+				corruption = &CorruptionError{Path: dataPath, Offset: offset, Record: first + i, Reason: r.err.Error()}
+				return
+			}
+		}
+	})
+	if corruption != nil {
+		return corruption.Record, corruption
+	}
+	return checked, err
+}
+
+// dumpRecord je zapis procitan za dump, sa indeksom kljuca u recniku (-1 bez kompresije) i greskom dekodiranja
+type dumpRecord struct {
+	DataRecord
+	keyIndex int64
+	err      error
+}
+
+// walkData prolazi kroz sve Data blokove i za svaki poziva fn sa njegovim zapisima
+// first je redni broj prvog zapisa bloka u Data segmentu, a b procitan blok (nil ako je blok ostecen)
+// Greska u bloku (kontrolna suma, format) se prosledjuje fn, a citanje se nastavlja od sledeceg bloka
+// Ako je lanac blokova ostecen, dalje citanje nije moguce pa se vraca *CorruptionError
+func (t *dumpTable) walkData(dict *compression.Dictionary, fn func(first int, offset int64, records []dumpRecord, b *block, err error)) (int, error) {
+	s := t.section("Data")
+	blockNum := s.start
+	count := 0
+	for {
+		offset := int64(blockNum) * int64(t.bm.BlockSize)
+		payload, blocks, err := t.readChain(s, blockNum)
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, &CorruptionError{Path: s.path, Offset: offset, Record: count, Reason: err.Error()}
+		}
+		blockNum += blocks
+
+		b, err := decodeDataBlock(payload, t.layout.version, dict)
+		if err != nil {
+			fn(count, offset, nil, nil, err)
+			continue
+		}
+		entries, err := b.entries()
+		if err != nil {
+			fn(count, offset, nil, nil, err)
+			continue
+		}
+		records := make([]dumpRecord, len(entries))
+		for i, entry := range entries {
+			records[i].keyIndex = -1
+			if dict != nil {
+				if index, n := binary.Uvarint(entry.Key); n > 0 {
+					records[i].keyIndex = int64(index)
+				}
+			}
+			records[i].DataRecord, records[i].err = decodeDataRecord(entry, dict)
+			records[i].Offset = int(offset)
+		}
+		fn(count, offset, records, b, nil)
+		count += len(records)
+	}
+}
+
+func (t *dumpTable) dumpFiles(w io.Writer) {
+	if t.layout.singleFile {
+		fmt.Fprintf(w, "File: %s (%d bytes)\n", t.path, fileSize(t.path))
+	} else if t.layout.version == FormatVersionLegacy {
+		fmt.Fprintf(w, "TOC: %s\n", CreateFileName(t.dir, t.gen, "TOC", "txt"))
+	} else {
+		fmt.Fprintf(w, "Footer: %s\n", t.path)
+	}
+	for _, name := range sectionNames {
+		file, ok := t.layout.sections[name]
+		if !ok {
+			continue // Deo koji ova verzija formata nema
+		}
+		if t.layout.singleFile {
+			fmt.Fprintf(w, "  %-12s offset %d", name, file.Offset)
+		} else {
+			fmt.Fprintf(w, "  %-12s %s (%d bytes)", name, file.Path, fileSize(file.Path))
+		}
+		if file.SizeOnDisk >= 0 {
+			fmt.Fprintf(w, ", length %d", file.SizeOnDisk)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func (t *dumpTable) dumpIndex(w io.Writer) {
+	s := t.section("Index")
+	blockNum := s.start
+	for i := 0; ; {
+		payload, blocks, err := t.readChain(s, blockNum)
+		if err == io.EOF {
+			return
+		}
+		offset := int64(blockNum) * int64(t.bm.BlockSize)
+		if err != nil {
+			fmt.Fprintf(w, "  block @%d ERROR %v\n", offset, err)
+			return
+		}
+		blockNum += blocks
+		b, err := decodeIndexBlock(payload, t.layout.version)
+		if err != nil {
+			fmt.Fprintf(w, "  block @%d ERROR %v\n", offset, err)
+			continue
+		}
+		entries, err := b.entries()
+		if err != nil {
+			fmt.Fprintf(w, "  block @%d ERROR %v\n", offset, err)
+			continue
+		}
+		fmt.Fprintf(w, "  block @%d (%d records)\n", offset, len(entries))
+		for _, entry := range entries {
+			if dataOffset, n := binary.Uvarint(entry.Value); n > 0 {
+				fmt.Fprintf(w, "    #%d key=%q data @%d\n", i, entry.Key, dataOffset)
+			} else {
+				fmt.Fprintf(w, "    #%d key=%q ERROR invalid data offset\n", i, entry.Key)
+			}
+			i++
+		}
+	}
+}
+
+func (t *dumpTable) dumpSummary(w io.Writer) {
+	var summary *Summary
+	var err error
+	if t.layout.version == FormatVersionLegacy {
+		summary, err = readLegacySummary(t.layout.sections["Summary"], t.bm)
+	} else {
+		s := t.section("Summary")
+		var payload []byte
+		if payload, _, err = t.readChain(s, s.start); err == nil {
+			summary, err = decodeSummary(payload)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(w, "  ERROR %v\n", err)
+		return
+	}
+	fmt.Fprintf(w, "  first key %q, last key %q\n", summary.FirstKey, summary.LastKey)
+	for i, sr := range summary.Records {
+		fmt.Fprintf(w, "  #%d first key=%q index @%d records %d\n", i, sr.FirstKey, sr.IndexOffset, sr.NumberOfRecords)
+	}
+}
+
+func (t *dumpTable) dumpFilter(w io.Writer) {
+	s := t.section("Filter")
+	payload, _, err := t.readChain(s, s.start)
+	if err != nil {
+		fmt.Fprintf(w, "Bloom filter: ERROR %v\n", err)
+		return
+	}
+	bf, extractor, prefixFilter, err := decodeFilters(payload)
+	if err != nil {
+		fmt.Fprintf(w, "Bloom filter: ERROR %v\n", err)
+		return
+	}
+	fmt.Fprintf(w, "Bloom filter: %s\n", describeFilter(&bf))
+	if prefixFilter != nil {
+		fmt.Fprintf(w, "Prefix filter: %s, extractor %s\n", describeFilter(prefixFilter), extractor.Name())
+	}
+}
+
+// describeFilter vraca vrstu i parametre filtera i koliko je popunjen
+func describeFilter(bf *bloomfilter.BloomFilter) string {
+	set := bf.SetBits()
+	fill := 0.0
+	if bf.Bits() > 0 {
+		fill = float64(set) / float64(bf.Bits())
+	}
+	return fmt.Sprintf("%s, m=%d bits, k=%d hash functions, %d bits set (%.1f%%)", bf.Kind(), bf.Bits(), bf.HashCount(), set, fill*100)
+}
+
+func (t *dumpTable) dumpMetadata(w io.Writer) {
+	s := t.section("Metadata")
+	payload, _, err := t.readChain(s, s.start)
+	if err != nil {
+		fmt.Fprintf(w, "Merkle tree: ERROR %v\n", err)
+		return
+	}
+	if len(payload) < 36 {
+		fmt.Fprintf(w, "Merkle tree: ERROR metadata too short (%d bytes)\n", len(payload))
+		return
+	}
+	mt, err := merkle.Deserialize(payload)
+	if err != nil {
+		fmt.Fprintf(w, "Merkle tree: ERROR %v\n", err)
+		return
+	}
+	leaves := int32(binary.LittleEndian.Uint32(payload[32:36])) // Posle korena (32B) je broj listova
+	fmt.Fprintf(w, "Merkle tree: root %s, %d leaves\n", hex.EncodeToString(mt.MerkleRootHash.Hash[:]), leaves)
+}
+
+func (t *dumpTable) dumpProperties(w io.Writer) {
+	if _, ok := t.layout.sections["Properties"]; !ok {
+		return
+	}
+	s := t.section("Properties")
+	payload, _, err := t.readChain(s, s.start)
+	if err != nil {
+		fmt.Fprintf(w, "Properties: ERROR %v\n", err)
+		return
+	}
+	p, err := DecodeProperties(payload)
+	if err != nil {
+		fmt.Fprintf(w, "Properties: ERROR %v\n", err)
+		return
+	}
+	fmt.Fprintln(w, "Properties:")
+	for _, line := range strings.Split(p.String(), "\n") {
+		fmt.Fprintf(w, "  %s\n", line)
+	}
+}
+
+// codecName vraca ime kodeka sa datim ID-jem
+func codecName(id byte) string {
+	codec, err := compression.CodecByID(id)
+	if err != nil {
+		return fmt.Sprintf("#%d", id)
+	}
+	return codec.Name()
+}
+
+// formatValue vraca vrednost pod navodnicima, skracenu ako je preduga
+func formatValue(value []byte) string {
+	if len(value) <= dumpValueLimit {
+		return strconv.Quote(string(value))
+	}
+	return strconv.Quote(string(value[:dumpValueLimit])) + "..."
+}
+
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return -1
+	}
+	return info.Size()
+}
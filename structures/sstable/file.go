@@ -103,25 +103,29 @@ func CalculateDataSize(path string, conf *config.Config) int64 {
 	return totalSize
 }
 
-// ReadOffsetsFromFile cita offsete iz fajla
+// ReadOffsetsFromFile cita offsete iz bloka 0 SSTable-a u jednom fajlu verzije 1
 func ReadOffsetsFromFile(path string, conf *config.Config, bm *block_organization.CachedBlockManager) (map[string]int64, error) {
-	offsets := make(map[string]int64)
 	block, err := bm.ReadBlock(path, 0)
 	if err != nil {
 		return nil, fmt.Errorf("error reading offsets from file %s: %w", path, err)
 	}
-	lines := strings.Split(string(block), "\n")
-	for _, line := range lines {
+	offsets := parseOffsets(block)
+	if len(offsets) == 0 {
+		return nil, fmt.Errorf("no offsets found in file %s", path)
+	}
+	return offsets, nil
+}
+
+// parseOffsets cita redove "Deo: offset" iz bloka
+func parseOffsets(block []byte) map[string]int64 {
+	offsets := make(map[string]int64)
+	for _, line := range strings.Split(string(block), "\n") {
 		parts := strings.Split(line, ": ")
 		if len(parts) == 2 {
-			val, err := strconv.ParseInt(parts[1], 10, 64)
-			if err == nil {
+			if val, err := strconv.ParseInt(parts[1], 10, 64); err == nil {
 				offsets[parts[0]] = val
 			}
 		}
 	}
-	if len(offsets) == 0 {
-		return nil, fmt.Errorf("no offsets found in file %s", path)
-	}
-	return offsets, nil
+	return offsets
 }
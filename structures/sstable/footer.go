@@ -0,0 +1,254 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/iigor000/database/structures/block_organization"
+)
+
+/*
+	=== FOOTER (poslednji blok SSTable-a) ===
+
+	+--------------+------------+--------------------------------------------------------------------------+----------+------------+
+	| Version (4B) | Flags (4B) | Data, Index, Summary, Filter, Metadata, Properties (Offset 8B, Length 8B) | CRC (4B) | Magic (8B) |
+	+--------------+------------+--------------------------------------------------------------------------+----------+------------+
+
+	Kod SSTable-a u jednom fajlu footer je poslednji blok fajla, a kod SSTable-a u vise fajlova poslednji blok Data fajla
+	U vise fajlova svaki deo ima svoj fajl, pa su Offset i Length u fajlu tog dela
+	CRC se racuna nad svim pre njega
+	Footer verzija 2 i 3 nema Properties deo, pa je za 16 bajtova kraci
+	SSTable bez footer-a je verzija 1: offseti su tekst u bloku 0 (jedan fajl), odnosno fajlovi su navedeni u TOC-u,
+	a svaki zapis je u svom lancu blokova (legacy.go)
+*/
+
+const (
+	FormatVersionLegacy = 1 // Zapis po lancu blokova, offseti kao tekst u bloku 0, odnosno TOC fajl, bez footer-a
+	FormatVersion       = 4 // Trenutna verzija: binarni footer (od verzije 2), kodek kompresije u svakom bloku (od verzije 3), Properties (od verzije 4)
+)
+
+// Prva verzija sa Properties delom
+const formatVersionProperties = 4
+
+// Oznaka kraja footer-a, po njoj se prepoznaje SSTable sa footer-om
+const footerMagic uint64 = 0x53535461626c4654
+
+// Flag footer-a: kljucevi su zapisani preko recnika kompresije
+const footerFlagCompression = 1
+
+// Broj delova SSTable-a u footer-u
+const numSections = 6
+
+// Velicina footer-a u bajtovima
+const footerSize = 4 + 4 + numSections*16 + 4 + 8
+
+// Delovi SSTable-a redom kojim su u footer-u (i u fajlu kod SSTable-a u jednom fajlu)
+var sectionNames = []string{"Data", "Index", "Summary", "Filter", "Metadata", "Properties"}
+
+// sectionCount vraca broj delova SSTable-a u footer-u verzije version
+func sectionCount(version uint32) int {
+	if version < formatVersionProperties {
+		return numSections - 1
+	}
+	return numSections
+}
+
+// footerLength vraca velicinu footer-a verzije version u bajtovima
+func footerLength(version uint32) int {
+	return 4 + 4 + sectionCount(version)*16 + 4 + 8
+}
+
+// Handle je polozaj dela SSTable-a u fajlu
+type Handle struct {
+	Offset int64
+	Length int64
+}
+
+// Footer opisuje verziju formata i polozaj svih delova SSTable-a
+type Footer struct {
+	Version  uint32
+	Flags    uint32
+	Sections [numSections]Handle // Redom kao sectionNames
+}
+
+var errNoFooter = errors.New("no sstable footer")
+
+// Serialize vraca footer u binarnom obliku
+func (f *Footer) Serialize() []byte {
+	out := make([]byte, 0, footerSize)
+	out = binary.LittleEndian.AppendUint32(out, f.Version)
+	out = binary.LittleEndian.AppendUint32(out, f.Flags)
+	for _, h := range f.Sections[:sectionCount(f.Version)] {
+		out = binary.LittleEndian.AppendUint64(out, uint64(h.Offset))
+		out = binary.LittleEndian.AppendUint64(out, uint64(h.Length))
+	}
+	out = binary.LittleEndian.AppendUint32(out, crc32.ChecksumIEEE(out))
+	return binary.LittleEndian.AppendUint64(out, footerMagic)
+}
+
+// DecodeFooter cita footer sa pocetka data
+// Ako na kraju nema oznake footer-a vraca errNoFooter, pa se SSTable cita kao verzija 1
+func DecodeFooter(data []byte) (*Footer, error) {
+	if len(data) < 8 {
+		return nil, errNoFooter
+	}
+	// Velicina footer-a zavisi od verzije, a verzija se proverava tek kad se pronadje oznaka kraja
+	size := footerLength(binary.LittleEndian.Uint32(data))
+	if len(data) < size || binary.LittleEndian.Uint64(data[size-8:]) != footerMagic {
+		return nil, errNoFooter
+	}
+	stored := binary.LittleEndian.Uint32(data[size-12:])
+	if calculated := crc32.ChecksumIEEE(data[:size-12]); stored != calculated {
+		return nil, fmt.Errorf("footer checksum mismatch: stored %08x, calculated %08x", stored, calculated)
+	}
+	f := &Footer{
+		Version: binary.LittleEndian.Uint32(data[0:4]),
+		Flags:   binary.LittleEndian.Uint32(data[4:8]),
+	}
+	if f.Version > FormatVersion {
+		return nil, fmt.Errorf("unsupported sstable format version %d", f.Version)
+	}
+	for i := range f.Sections[:sectionCount(f.Version)] {
+		pos := 8 + 16*i
+		f.Sections[i].Offset = int64(binary.LittleEndian.Uint64(data[pos:]))
+		f.Sections[i].Length = int64(binary.LittleEndian.Uint64(data[pos+8:]))
+	}
+	return f, nil
+}
+
+// readFooter cita footer iz poslednjeg bloka fajla
+// Vraca errNoFooter ako poslednji blok nije footer (SSTable verzije 1)
+func readFooter(path string, bm *block_organization.BlockManager) (*Footer, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading sstable file %s: %w", path, err)
+	}
+	last := int(info.Size()/int64(bm.BlockSize)) - 1
+	if last < 0 {
+		return nil, errNoFooter
+	}
+	block, err := bm.ReadBlock(path, last)
+	if err != nil {
+		return nil, fmt.Errorf("error reading footer from file %s: %w", path, err)
+	}
+	if block[0] != 2 { // Footer je uvek ceo u jednom bloku
+		return nil, errNoFooter
+	}
+	f, err := DecodeFooter(block[1:])
+	if err != nil && !errors.Is(err, errNoFooter) {
+		return nil, fmt.Errorf("file %s: %w", path, err)
+	}
+	return f, err
+}
+
+// layout opisuje gde se nalaze delovi SSTable-a, procitan iz footer-a ili (za verziju 1) iz offseta u bloku 0, odnosno TOC-a
+type layout struct {
+	version        int
+	singleFile     bool
+	useCompression bool
+	sections       map[string]File // SizeOnDisk -1 znaci do kraja fajla
+}
+
+// readLayout pronalazi SSTable generacije gen u direktorijumu dir i cita polozaj njegovih delova
+func readLayout(dir string, gen int, bm *block_organization.BlockManager) (*layout, error) {
+	l := &layout{sections: make(map[string]File)}
+	path := CreateFileName(dir, gen, "SSTable", "db")
+	if _, err := os.Stat(path); err == nil {
+		l.singleFile = true
+	} else {
+		path = CreateFileName(dir, gen, "Data", "db")
+	}
+
+	f, err := readFooter(path, bm)
+	if errors.Is(err, errNoFooter) {
+		return readLegacyLayout(l, dir, gen, path, bm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	l.version = int(f.Version)
+	l.useCompression = f.Flags&footerFlagCompression != 0
+	for i, name := range sectionNames[:sectionCount(f.Version)] {
+		p := path
+		if !l.singleFile {
+			p = CreateFileName(dir, gen, name, "db")
+		}
+		l.sections[name] = File{Path: p, Offset: f.Sections[i].Offset, SizeOnDisk: f.Sections[i].Length}
+	}
+	return l, nil
+}
+
+// Delovi SSTable-a verzije 1
+var legacySections = sectionNames[:numSections-1]
+
+// readLegacyLayout cita polozaj delova SSTable-a verzije 1
+// Jedan fajl: blok 0 sadrzi redove "Deo: offset", a informacija o kompresiji je tekst u svom bloku
+// Vise fajlova: svaki deo je ceo fajl, a informacija o kompresiji je jedan bajt u CompressionInfo fajlu
+func readLegacyLayout(l *layout, dir string, gen int, path string, bm *block_organization.BlockManager) (*layout, error) {
+	l.version = FormatVersionLegacy
+	if !l.singleFile {
+		for _, name := range legacySections {
+			l.sections[name] = File{Path: CreateFileName(dir, gen, name, "db"), SizeOnDisk: -1}
+		}
+		info, err := bm.Read(CreateFileName(dir, gen, "CompressionInfo", "db"), 0)
+		if err != nil {
+			return nil, fmt.Errorf("error reading compression info: %w", err)
+		}
+		l.useCompression = len(info) > 0 && info[0] == 1
+		return l, nil
+	}
+
+	block, err := bm.ReadBlock(path, 0)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("error reading offsets from file %s: %w", path, err)
+	}
+	offsets := parseOffsets(block)
+	names := append(append([]string(nil), legacySections...), "Compression")
+	for _, name := range names {
+		if _, ok := offsets[name]; !ok {
+			return nil, fmt.Errorf("offset for %s missing in %s", name, path)
+		}
+	}
+	// Delovi su u fajlu redom, pa se svaki zavrsava tamo gde pocinje sledeci
+	sorted := make([]int64, 0, len(offsets))
+	for _, offset := range offsets {
+		sorted = append(sorted, offset)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	for _, name := range legacySections {
+		file := File{Path: path, Offset: offsets[name], SizeOnDisk: -1}
+		if i := sort.Search(len(sorted), func(i int) bool { return sorted[i] > file.Offset }); i < len(sorted) {
+			file.SizeOnDisk = sorted[i] - file.Offset
+		}
+		l.sections[name] = file
+	}
+	info, err := bm.Read(path, int(offsets["Compression"]/int64(bm.BlockSize)))
+	if err != nil {
+		return nil, fmt.Errorf("error reading compression info: %w", err)
+	}
+	l.useCompression = strings.TrimRight(string(info), "\x00") == "Using compression"
+	return l, nil
+}
+
+// diskSize vraca zbir velicina svih delova i footer-a, 0 kod verzije 1 (velicine delova nisu zapisane)
+func (l *layout) diskSize(blockSize int) int64 {
+	if l.version == FormatVersionLegacy {
+		return 0
+	}
+	size := int64(blockSize) // Footer
+	for _, file := range l.sections {
+		size += file.SizeOnDisk
+	}
+	return size
+}
+
+// blockNumber vraca broj bloka u kom pocinje deo name
+func (l *layout) blockNumber(name string, blockSize int) int {
+	return int(l.sections[name].Offset / int64(blockSize))
+}
@@ -1,33 +1,38 @@
 package sstable
 
 import (
-	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 
 	"github.com/iigor000/database/config"
 	"github.com/iigor000/database/structures/block_organization"
 )
 
 /*
-	=== INDEX RECORD ===
+	=== INDEX RECORD (zapis u Index bloku) ===
 
-	+------------------+---------+---------------+
-	|   Key Size (1B)  |   Key   |  Offset (4B)  |
-	+------------------+---------+---------------+
+	+-------------------------+-----------------------+
+	|  Kljuc (kljuc u bloku)  | Data Offset (varint)  |
+	+-------------------------+-----------------------+
 
+	Za svaki Data blok postoji jedan zapis, sa prvim kljucem tog bloka
 */
 
 // IndexRecord struktura je jedan zapis u Index segmentu SSTable-a
 type IndexRecord struct {
 	Key         []byte
-	Offset      int
-	IndexOffset int
+	Offset      int // Offset Data bloka
+	IndexOffset int // Offset Index bloka u kom je zapis upisan
 }
 
 // IndexBlock struktura je skup IndexRecord-a
 type Index struct {
 	Records   []IndexRecord
 	IndexFile File
+	// Verzija formata SSTable-a, od nje zavisi zapis bloka
+	FormatVersion int
 }
 
 // NewIndexRecord pravi IndexRecord
@@ -40,202 +45,104 @@ func NewIndexRecord(k []byte, offs int) IndexRecord {
 	return record
 }
 
-func (ib *Index) WriteIndex(path string, conf *config.Config, cbm *block_organization.CachedBlockManager) error {
-	rec := 0
-	for _, record := range ib.Records {
-		i, err := record.WriteIndexRecord(path, cbm)
-		if rec == 0 {
-			ib.IndexFile.Offset = int64(i) * int64(conf.Block.BlockSize)
-		}
-		if err != nil {
-			return err
-		}
-		ib.Records[rec].IndexOffset = i * conf.Block.BlockSize // Racunamo IndexOffset kao broj bloka pomnozen sa velicinom bloka
-		rec++
-		ib.IndexFile.SizeOnDisk = int64(i) * int64(conf.Block.BlockSize)
-	}
-	ib.IndexFile.Path = path
-	ib.IndexFile.SizeOnDisk = ib.IndexFile.SizeOnDisk - ib.IndexFile.Offset
-	return nil
+// encodeValue serijalizuje offset Data bloka
+func (ir *IndexRecord) encodeValue() []byte {
+	return binary.AppendUvarint(nil, uint64(ir.Offset))
 }
 
-func (ir *IndexRecord) WriteIndexRecord(path string, bm *block_organization.CachedBlockManager) (int, error) {
-	serializedData, _ := ir.Serialize()
-	return bm.Append(path, serializedData)
+// readBlock cita i proverava Index blok koji pocinje u bloku blockNumber
+// Vraca blok i broj bloka iza njega, a nil ako na tom mestu vise nema Index blokova
+func (ib *Index) readBlock(bm *block_organization.CachedBlockManager, blockNumber int) (*block, int, error) {
+	if ib.IndexFile.SizeOnDisk >= 0 && int64(blockNumber)*int64(bm.BM.BlockSize) >= ib.IndexFile.Offset+ib.IndexFile.SizeOnDisk {
+		return nil, -1, nil
+	}
+	payload, err := bm.Read(ib.IndexFile.Path, blockNumber)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, -1, nil // Kraj fajla
+		}
+		return nil, -1, fmt.Errorf("error reading index block %d from file %s: %w", blockNumber, ib.IndexFile.Path, err)
+	}
+	b, err := decodeIndexBlock(payload, ib.FormatVersion)
+	if err != nil {
+		return nil, -1, fmt.Errorf("index block %d in file %s: %w", blockNumber, ib.IndexFile.Path, err)
+	}
+	return b, blockNumber + appendedBlocks(len(payload), bm.BM.BlockSize), nil
 }
 
-func (ir *IndexRecord) Serialize() ([]byte, int) {
-	var serializedData []byte
-	rec_size := 1 + len(ir.Key) + 4 // 1 byte for key length, len(ir.Key) bytes for key, 4 bytes for offset
-	serializedData = append(serializedData, byte(len(ir.Key)))
-	serializedData = append(serializedData, ir.Key...)
-	serializedData = append(serializedData, byte(ir.Offset>>24), byte(ir.Offset>>16), byte(ir.Offset>>8), byte(ir.Offset))
-	return serializedData, rec_size
+// ReadBlock cita sve zapise Index bloka koji pocinje u bloku blockNumber
+// Vraca zapise i broj bloka iza njega, a nil zapise ako na tom mestu vise nema Index blokova
+func (ib *Index) ReadBlock(bm *block_organization.CachedBlockManager, blockNumber int) ([]IndexRecord, int, error) {
+	b, next, err := ib.readBlock(bm, blockNumber)
+	if err != nil || b == nil {
+		return nil, next, err
+	}
+	entries, err := b.entries()
+	if err != nil {
+		return nil, -1, fmt.Errorf("index block %d in file %s: %w", blockNumber, ib.IndexFile.Path, err)
+	}
+	records := make([]IndexRecord, len(entries))
+	for i, entry := range entries {
+		offset, n := binary.Uvarint(entry.Value)
+		if n <= 0 || n != len(entry.Value) {
+			return nil, -1, fmt.Errorf("index block %d: invalid data offset for key %q", blockNumber, entry.Key)
+		}
+		records[i] = IndexRecord{Key: entry.Key, Offset: int(offset), IndexOffset: blockNumber * bm.BM.BlockSize}
+	}
+	return records, next, nil
 }
 
-// ReadIndexBlock cita IndexBlock iz fajla
+// ReadIndex cita sve zapise Index dela iz fajla, od startOffset do endOffset (do kraja fajla ako endOffset <= startOffset)
 func ReadIndex(path string, conf *config.Config, startOffset, endOffset int64, bm *block_organization.CachedBlockManager) (*Index, error) {
-	blockNum := int(startOffset / int64(conf.Block.BlockSize)) // Pocinjemo od bloka koji sadrzi startOffset
-	endBlock := int(endOffset / int64(conf.Block.BlockSize))   // Kraj bloka koji sadrzi endOffset
+	indexs := &Index{
+		IndexFile: File{
+			Path:       path,
+			Offset:     startOffset,
+			SizeOnDisk: endOffset - startOffset,
+		},
+		FormatVersion: FormatVersion,
+	}
 	if endOffset <= startOffset {
-		endBlock = -1 // Kraj bloka koji sadrzi endOffset
+		indexs.IndexFile.SizeOnDisk = -1
 	}
-	indexs := &Index{}
 
+	blockNum := int(startOffset / int64(conf.Block.BlockSize))
 	for {
-		block, err := bm.Read(path, blockNum)
+		records, next, err := indexs.ReadBlock(bm, blockNum)
 		if err != nil {
-			if err.Error() == "EOF" {
-				break // Kraj fajla
-			}
 			return nil, err
 		}
-		if len(block) == 0 {
-			break // Nema vise podataka
+		if records == nil {
+			break
 		}
-		blockNum1 := blockNum
-		i := 1
-		for {
-			if len(block)+(i*1) <= i*conf.Block.BlockSize {
-				blockNum1 += i
-				break
-			}
-			i++
-		}
-		if endBlock != -1 && blockNum1 > endBlock {
-			break // Dostigli smo kraj bloka koji nas zanima
-		}
-		record := IndexRecord{}
-		if err := record.Deserialize(block); err != nil {
-			return nil, err
-		}
-		record.IndexOffset = blockNum * conf.Block.BlockSize // Racunamo ofset kao broj bloka pomnozen sa velicinom bloka
-		indexs.Records = append(indexs.Records, record)
-		blockNum = blockNum1
-
-	}
-	indexs.IndexFile = File{
-		Path:       path,
-		Offset:     startOffset,
-		SizeOnDisk: int64(blockNum)*int64(conf.Block.BlockSize) - startOffset, // Racunamo velicinu fajla kao broj blokova pomnozen sa velicinom bloka minus startOffset
+		indexs.Records = append(indexs.Records, records...)
+		blockNum = next
 	}
-
 	return indexs, nil
 }
 
-// Deserialize deserializuje IndexRecord iz bajt niza
-func (ir *IndexRecord) Deserialize(data []byte) error {
-	if len(data) < 1+4 { // Key Size + Offset
-		return fmt.Errorf("data too short to read key size and offset")
+// FindDataOffsetWithKey vraca offset Data bloka u kom bi trebalo da bude kljuc key
+// Cita samo Index blok na offsetu indexOffset (koji je pronadjen u Summary-ju) i u njemu preko restart tacaka trazi
+// poslednji Data blok ciji je prvi kljuc <= key, a ako je key manji od svih kljuceva, prvi Data blok
+func (ib *Index) FindDataOffsetWithKey(indexOffset int, key []byte, bm *block_organization.CachedBlockManager) (int, error) {
+	if ib.FormatVersion == FormatVersionLegacy {
+		return ib.findLegacyDataOffset(indexOffset, key, bm)
 	}
-
-	// Citanje Key Size
-	keySize := int(data[0])
-	data = data[1:]
-
-	if len(data) < keySize+4 {
-		return fmt.Errorf("data too short to read key and offset")
+	blockNumber := indexOffset / bm.BM.BlockSize
+	b, _, err := ib.readBlock(bm, blockNumber)
+	if err != nil {
+		return -1, err
 	}
-
-	// Citanje Key
-	ir.Key = data[:keySize]
-	data = data[keySize:]
-
-	// Citanje Offset
-	ir.Offset = int(data[0])<<24 | int(data[1])<<16 | int(data[2])<<8 | int(data[3])
-
-	return nil
-}
-
-// Pomocna funkcija za Iterate
-// Index segment nije ucitan iz fajla
-func (ib *Index) FindDataOffsetWithKey(indexOffset int, key []byte, bm *block_organization.CachedBlockManager) (int, error) {
-	indexRecord := IndexRecord{}
-	found := -1
-	bnum := indexOffset / bm.BM.BlockSize
-	for {
-		if ib.IndexFile.SizeOnDisk != -1 {
-			if bnum*bm.BM.BlockSize > int(ib.IndexFile.SizeOnDisk+ib.IndexFile.Offset) {
-				if found != -1 {
-					return found, nil
-				}
-				return -1, fmt.Errorf("key not found in index")
-			}
-		}
-		serlzdIndexRec, err := bm.Read(ib.IndexFile.Path, bnum)
-		if err != nil {
-			if err.Error() == "EOF" {
-				break // Kraj fajla
-			}
-
-			return -1, fmt.Errorf("error reading index block: %w", err)
-		}
-
-		if len(serlzdIndexRec) == 0 {
-			return -1, fmt.Errorf("key not found in index")
-		}
-		if err := indexRecord.Deserialize(serlzdIndexRec); err != nil {
-			//println("Error deserializing index record:", err)
-			return -1, fmt.Errorf("error deserializing index record: %w", err)
-		}
-		cmp := bytes.Compare(indexRecord.Key, key)
-		if cmp == 0 {
-			return indexRecord.Offset, nil // Vracamo ofset ako je kljuc pronadjen
-		} else if cmp < 0 {
-			found = indexRecord.Offset
-		} else {
-			if found != -1 {
-				return found, nil // Vracamo poslednji pronadjeni ofset ako je kljuc manji od trenutnog
-			}
-			return -1, fmt.Errorf("key not found in index")
-		}
-		i := 1
-		for {
-			if len(serlzdIndexRec)+(i*1) <= i*bm.BM.BlockSize {
-				bnum += i
-				break
-			}
-			i++
-		}
+	if b == nil {
+		return -1, fmt.Errorf("key not found in index")
 	}
-	return -1, fmt.Errorf("key not found in index")
-}
-
-func (ib *Index) FindDataOffsetWithPrefix(indexOffset int, key []byte, bm *block_organization.CachedBlockManager) (int, error) {
-	indexRecord := IndexRecord{}
-	bnum := indexOffset / bm.BM.BlockSize
-
-	for {
-		if ib.IndexFile.SizeOnDisk != -1 {
-			if bnum*bm.BM.BlockSize > int(ib.IndexFile.SizeOnDisk)+int(ib.IndexFile.Offset) {
-				return -1, fmt.Errorf("key not found in index")
-			}
-		}
-		serlzdIndexRec, err := bm.Read(ib.IndexFile.Path, bnum)
-		if err != nil {
-			if err.Error() == "EOF" {
-				break // Kraj fajla
-			}
-			return -1, fmt.Errorf("error reading index block: %w", err)
-		}
-
-		if len(serlzdIndexRec) == 0 {
-			return -1, fmt.Errorf("key not found in index")
-		}
-		if err := indexRecord.Deserialize(serlzdIndexRec); err != nil {
-			return -1, fmt.Errorf("error deserializing index record: %w", err)
-		}
-		if bytes.HasPrefix(indexRecord.Key, []byte(key)) {
-			return indexRecord.Offset, nil
-		}
-		i := 1
-		for {
-			if len(serlzdIndexRec)+(i*1) <= i*bm.BM.BlockSize {
-				bnum += i
-				break
-			}
-			i++
-		}
+	entry, err := b.floor(key)
+	if err != nil {
+		return -1, fmt.Errorf("index block %d: %w", blockNumber, err)
+	}
+	offset, n := binary.Uvarint(entry.Value)
+	if n <= 0 || n != len(entry.Value) {
+		return -1, fmt.Errorf("index block %d: invalid data offset for key %q", blockNumber, entry.Key)
 	}
-	return -1, fmt.Errorf("key not found in index")
+	return int(offset), nil
 }
@@ -10,19 +10,74 @@ import (
 type SSTableIterator struct {
 	sstable         *SSTable
 	CurrentRecord   adapter.MemtableEntry
-	nextBlockNumber int
+	records         []DataRecord // Preostali zapisi tekuceg Data bloka
+	nextBlockNumber int          // Blok u kom pocinje sledeci Data blok, -1 ako ga nema
 	blockManager    *block_organization.CachedBlockManager
 }
 
 func (sst *SSTable) NewSSTableIterator(bm *block_organization.CachedBlockManager) *SSTableIterator {
-	bn := int(sst.Data.DataFile.Offset) / bm.BM.BlockSize
-	rec, nxtBlck := sst.Data.ReadRecord(bm, bn, sst.CompressionKey)
-	return &SSTableIterator{
+	it := &SSTableIterator{
 		sstable:         sst,
-		CurrentRecord:   rec,
-		nextBlockNumber: nxtBlck,
+		nextBlockNumber: int(sst.Data.DataFile.Offset) / bm.BM.BlockSize,
 		blockManager:    bm,
 	}
+	it.advance()
+	return it
+}
+
+// seek vraca iterator postavljen na prvi zapis ciji je kljuc >= key
+// Summary daje Index blok, Index blok daje Data blok, a u Data bloku se zapis trazi preko restart tacaka
+func (sst *SSTable) seek(key []byte, bm *block_organization.CachedBlockManager) *SSTableIterator {
+	if bytes.Compare(key, sst.Summary.FirstKey) <= 0 {
+		return sst.NewSSTableIterator(bm)
+	}
+	it := &SSTableIterator{sstable: sst, nextBlockNumber: -1, blockManager: bm}
+	sumRec, err := sst.Summary.FindSummaryRecordWithKey(string(key))
+	if err != nil {
+		return it
+	}
+	dataOffset, err := sst.Index.FindDataOffsetWithKey(sumRec.IndexOffset, key, bm)
+	if err != nil {
+		println("Error searching index:", err.Error())
+		return it
+	}
+	it.records, it.nextBlockNumber, err = sst.Data.SeekBlock(bm, dataOffset/bm.BM.BlockSize, key, sst.CompressionKey)
+	if err != nil {
+		println("Error reading data block:", err.Error())
+		it.records, it.nextBlockNumber = nil, -1
+	}
+	it.advance()
+	return it
+}
+
+// advance postavlja CurrentRecord na sledeci zapis, a kad se zapisi tekuceg Data bloka potrose cita sledeci blok
+func (si *SSTableIterator) advance() {
+	for len(si.records) == 0 {
+		if si.nextBlockNumber < 0 {
+			si.CurrentRecord = adapter.MemtableEntry{Key: nil}
+			return
+		}
+		records, next, err := si.sstable.Data.ReadBlock(si.blockManager, si.nextBlockNumber, si.sstable.CompressionKey)
+		if err != nil {
+			println("Error reading data block:", err.Error())
+		}
+		if err != nil || records == nil {
+			si.CurrentRecord = adapter.MemtableEntry{Key: nil}
+			si.nextBlockNumber = -1
+			return
+		}
+		si.records, si.nextBlockNumber = records, next
+	}
+	record := si.records[0]
+	si.records = si.records[1:]
+	si.CurrentRecord = adapter.MemtableEntry{
+		Key:       record.Key,
+		Value:     record.Value,
+		Seq:       record.Seq,
+		Timestamp: record.Timestamp,
+		Tombstone: record.Tombstone,
+		Blob:      record.Blob,
+	}
 }
 
 func (si *SSTableIterator) Next() (adapter.MemtableEntry, bool) {
@@ -30,14 +85,7 @@ func (si *SSTableIterator) Next() (adapter.MemtableEntry, bool) {
 		return adapter.MemtableEntry{}, false // Nema vise zapisa
 	}
 	rec := si.CurrentRecord
-	if si.sstable.SingleFile {
-		if int(si.sstable.Data.DataFile.SizeOnDisk) < si.nextBlockNumber*si.blockManager.BM.BlockSize {
-			si.Stop()
-			return rec, true
-		}
-	}
-	si.CurrentRecord, si.nextBlockNumber = si.sstable.Data.ReadRecord(si.blockManager, si.nextBlockNumber, si.sstable.CompressionKey)
-
+	si.advance()
 	if si.CurrentRecord.Key == nil {
 		si.Stop() // Zatvaranje iteratora ako nema vise zapisa
 	}
@@ -49,6 +97,7 @@ func (si *SSTableIterator) Stop() {
 	si.blockManager = nil
 	si.sstable = nil
 	si.CurrentRecord = adapter.MemtableEntry{Key: nil} // Oslobađanje trenutnog zapisa
+	si.records = nil
 	si.nextBlockNumber = -1
 }
 
@@ -75,20 +124,18 @@ func (sst *SSTable) PrefixIterate(prefix string, bm *block_organization.CachedBl
 			Prefix:   prefix,
 		}
 	}
-	it := SSTableIterator{}
-	it.sstable = sst
-	it.blockManager = bm
-	// Inicijalizujemo iterator sa prvim zapisom koji odgovara prefiksu
-	rec, nextBlock := sst.ReadRecordWithKey(bm, 0, prefix, false)
-	it.CurrentRecord = rec
-	it.nextBlockNumber = nextBlock
-
-	if it.CurrentRecord.Key == nil {
+	// SSTable bez kljuceva sa tim prefiksom se ne pretrazuje
+	if !sst.MayContainPrefix([]byte(prefix)) {
+		return nil
+	}
+	// Prvi zapis sa prefiksom je prvi zapis koji nije manji od prefiksa
+	it := sst.seek([]byte(prefix), bm)
+	if it.CurrentRecord.Key == nil || !bytes.HasPrefix(it.CurrentRecord.Key, []byte(prefix)) {
 		it.Stop() // Ako nema zapisa sa tim prefiksom, zatvaramo iterator
 		return nil
 	}
 	return &PrefixIterator{
-		Iterator: &it,
+		Iterator: it,
 		Prefix:   prefix,
 	}
 }
@@ -100,25 +147,11 @@ func (pi *PrefixIterator) Next() (adapter.MemtableEntry, bool) {
 		return adapter.MemtableEntry{}, false // Nema vise zapisa
 	}
 	record := pi.Iterator.CurrentRecord
-	if pi.Iterator.sstable.SingleFile {
-		if int(pi.Iterator.sstable.Data.DataFile.SizeOnDisk) < pi.Iterator.nextBlockNumber*pi.Iterator.blockManager.BM.BlockSize {
-			pi.Stop()
-			return record, true
-		}
-	}
-	rec, nextBlock := pi.Iterator.sstable.Data.ReadRecord(pi.Iterator.blockManager, pi.Iterator.nextBlockNumber, pi.Iterator.sstable.CompressionKey)
-	if !bytes.HasPrefix(rec.Key, []byte(pi.Prefix)) {
+	if !bytes.HasPrefix(record.Key, []byte(pi.Prefix)) {
 		pi.Stop() // Zatvaramo iterator ako nema vise zapisa sa tim prefiksom
-		return record, true
-	}
-	pi.Iterator.CurrentRecord = rec
-	pi.Iterator.nextBlockNumber = nextBlock
-
-	if nextBlock == -1 {
-		pi.Stop() // Zatvaramo iterator ako nema vise zapisa
 		return adapter.MemtableEntry{}, false
 	}
-
+	pi.Iterator.Next()
 	return record, true
 }
 
@@ -139,13 +172,8 @@ func (sst *SSTable) RangeIterate(startKey, endKey string, bm *block_organization
 	if startKey > endKey {
 		return nil // Nevalidan opseg
 	}
-	it := &SSTableIterator{}
-	it.sstable = sst
-	it.blockManager = bm
-	rec, nextBlock := sst.ReadRecordWithKey(bm, 0, startKey, true)
-	it.CurrentRecord = rec
-	it.nextBlockNumber = nextBlock
-	if it.CurrentRecord.Key == nil {
+	it := sst.seek([]byte(startKey), bm)
+	if it.CurrentRecord.Key == nil || bytes.Compare(it.CurrentRecord.Key, []byte(endKey)) > 0 {
 		it.Stop() // Ako nema zapisa u tom opsegu, zatvaramo iterator
 		return nil
 	}
@@ -161,24 +189,11 @@ func (ri *RangeIterator) Next() (adapter.MemtableEntry, bool) {
 		return adapter.MemtableEntry{}, false // Nema vise zapisa
 	}
 	record := ri.Iterator.CurrentRecord
-	if ri.Iterator.sstable.SingleFile {
-		if int(ri.Iterator.sstable.Data.DataFile.SizeOnDisk) < ri.Iterator.nextBlockNumber*ri.Iterator.blockManager.BM.BlockSize {
-			ri.Stop()
-			return record, false
-		}
-	}
-	rec, nextBlock := ri.Iterator.sstable.Data.ReadRecord(ri.Iterator.blockManager, ri.Iterator.nextBlockNumber, ri.Iterator.sstable.CompressionKey)
-	ri.Iterator.CurrentRecord = rec
-	ri.Iterator.nextBlockNumber = nextBlock
-
-	if nextBlock == -1 {
-		ri.Stop() // Zatvaramo iterator ako nema vise zapisa u opsegu
+	if bytes.Compare(record.Key, []byte(ri.EndKey)) > 0 {
+		ri.Stop() // Zatvaramo iterator kad predjemo kraj opsega
 		return adapter.MemtableEntry{}, false
 	}
-	if bytes.Compare(record.Key, []byte(ri.StartKey)) < 0 || bytes.Compare(record.Key, []byte(ri.EndKey)) > 0 {
-		return ri.Next() // Preskacemo zapise koji nisu u opsegu
-	}
-
+	ri.Iterator.Next()
 	return record, true
 }
 
@@ -0,0 +1,222 @@
+package sstable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/iigor000/database/structures/block_organization"
+	"github.com/iigor000/database/structures/compression"
+)
+
+/*
+	=== STARI FORMAT (verzija 1, pre blokova sa vise zapisa) ===
+
+	Svaki Data, Index i Summary zapis je upisan svojim Append-om, kao lanac blokova Block Manager-a
+	(prvi bajt bloka je oznaka 1 prvi, 3 srednji, 2 poslednji ili jedini blok, ostatak su podaci dopunjeni nulama)
+
+	Data zapis:
+	+---------+---------------+---------------+---------------+-----------------+-----+-------+
+	| CRC (4) | Timestamp (8) | Tombstone (1) | Key Size (1)  | Value Size (1)  | Key | Value |
+	+---------+---------------+---------------+---------------+-----------------+-----+-------+
+	Sa recnikom umesto Key Size i Key ide indeks kljuca u recniku (8), a Value Size stoji ispred vrednosti
+	Obrisan zapis nema Value Size ni vrednost. CRC i Timestamp su little endian, a CRC se racuna nad
+	kljucem, vrednoscu, Timestamp-om (big endian) i Tombstone bajtom
+
+	Index zapis: Key Size (1) + Key + Data Offset (4, big endian)
+	Summary: zaglavlje je jedan blok bez oznake (Key Size (1) + prvi kljuc + Key Size (1) + poslednji kljuc),
+	a iza njega idu zapisi: Key Size (1) + prvi kljuc + Index Offset (4) + broj zapisa (4), oba big endian
+
+	Zapisi nemaju sekvencni broj, pa im je Seq 0. Ovakvi SSTable-ovi se samo citaju, kompakcija ih prepisuje u novi format
+*/
+
+// Velicina CRC-a, Timestamp-a i Tombstone bajta na pocetku Data zapisa
+const legacyDataHeaderSize = 4 + 8 + 1
+
+// legacyBlock pravi blok sa jednim zapisom, da bi se zapis starog formata citao kao zapis bloka
+func legacyBlock(key, value []byte, stored int) *block {
+	b := newBlockBuilder(1)
+	b.add(key, value)
+	return &block{data: b.buf, restarts: b.restarts, codec: compression.CodecNone, stored: stored}
+}
+
+// decodeLegacyDataBlock cita Data zapis starog formata iz podataka lanca (iza zapisa je popuna nulama)
+// Kljuc u vracenom bloku je upisan kao u novom formatu (indeks iz recnika kao varint), pa ga decodeDataRecord cita kao i ostale
+func decodeLegacyDataBlock(payload []byte, dict *compression.Dictionary) (*block, error) {
+	if len(payload) < legacyDataHeaderSize {
+		return nil, fmt.Errorf("legacy data record too short: %d bytes", len(payload))
+	}
+	dr := DataRecord{
+		Timestamp: int64(binary.LittleEndian.Uint64(payload[4:12])),
+		Tombstone: payload[12] == 1,
+	}
+	data := payload[legacyDataHeaderSize:]
+	if dict == nil {
+		sizes := 2
+		if dr.Tombstone {
+			sizes = 1
+		}
+		if len(data) < sizes {
+			return nil, fmt.Errorf("legacy data record too short to read key size")
+		}
+		keySize, valueSize := int(data[0]), 0
+		if !dr.Tombstone {
+			valueSize = int(data[1])
+		}
+		data = data[sizes:]
+		if len(data) < keySize+valueSize {
+			return nil, fmt.Errorf("legacy data record too short: key %d + value %d bytes, %d bytes present", keySize, valueSize, len(data))
+		}
+		dr.Key, dr.Value = data[:keySize], data[keySize:keySize+valueSize]
+	} else {
+		if len(data) < 8 {
+			return nil, fmt.Errorf("legacy data record too short to read key index")
+		}
+		index := binary.LittleEndian.Uint64(data[:8])
+		key, found := dict.SearchIndex(int(index))
+		if !found {
+			return nil, fmt.Errorf("key index %d not found in dictionary", index)
+		}
+		dr.Key = key
+		data = data[8:]
+		if !dr.Tombstone {
+			if len(data) < 1 || len(data)-1 < int(data[0]) {
+				return nil, fmt.Errorf("legacy data record too short to read value")
+			}
+			dr.Value = data[1 : 1+int(data[0])]
+		}
+	}
+	if stored, calculated := binary.LittleEndian.Uint32(payload[:4]), legacyCRC(&dr); stored != calculated {
+		return nil, fmt.Errorf("legacy data record checksum mismatch: stored %08x, calculated %08x", stored, calculated)
+	}
+	key, err := encodeKey(dr.Key, dict)
+	if err != nil {
+		return nil, err
+	}
+	return legacyBlock(key, dr.encodeValue(), len(payload)), nil
+}
+
+// legacyCRC racuna kontrolnu sumu Data zapisa starog formata
+func legacyCRC(dr *DataRecord) uint32 {
+	data := make([]byte, 0, len(dr.Key)+len(dr.Value)+8+1)
+	data = append(data, dr.Key...)
+	data = append(data, dr.Value...)
+	data = binary.BigEndian.AppendUint64(data, uint64(dr.Timestamp))
+	if dr.Tombstone {
+		data = append(data, 1)
+	} else {
+		data = append(data, 0)
+	}
+	return crc32.ChecksumIEEE(data)
+}
+
+// decodeLegacyIndexBlock cita Index zapis starog formata iz podataka lanca
+func decodeLegacyIndexBlock(payload []byte) (*block, error) {
+	if len(payload) < 1 || len(payload)-1 < int(payload[0])+4 {
+		return nil, fmt.Errorf("legacy index record too short: %d bytes", len(payload))
+	}
+	keySize := int(payload[0])
+	key := payload[1 : 1+keySize]
+	offset := binary.BigEndian.Uint32(payload[1+keySize:])
+	return legacyBlock(key, binary.AppendUvarint(nil, uint64(offset)), len(payload)), nil
+}
+
+// decodeDataBlock cita Data blok verzije formata version, dict je potreban samo za proveru zapisa starog formata
+func decodeDataBlock(payload []byte, version int, dict *compression.Dictionary) (*block, error) {
+	if version == FormatVersionLegacy {
+		return decodeLegacyDataBlock(payload, dict)
+	}
+	return decodeBlock(payload, version)
+}
+
+// decodeIndexBlock cita Index blok verzije formata version
+func decodeIndexBlock(payload []byte, version int) (*block, error) {
+	if version == FormatVersionLegacy {
+		return decodeLegacyIndexBlock(payload)
+	}
+	return decodeBlock(payload, version)
+}
+
+// findLegacyDataOffset je FindDataOffsetWithKey za stari format, u kom je svaki Index zapis u svom lancu blokova
+// Zapisi se citaju redom od indexOffset dok im je kljuc <= key (najvise do prvog zapisa sledeceg Summary zapisa)
+func (ib *Index) findLegacyDataOffset(indexOffset int, key []byte, bm *block_organization.CachedBlockManager) (int, error) {
+	offset := -1
+	for blockNum := indexOffset / bm.BM.BlockSize; ; {
+		records, next, err := ib.ReadBlock(bm, blockNum)
+		if err != nil {
+			return -1, err
+		}
+		if len(records) == 0 || (offset != -1 && bytes.Compare(records[0].Key, key) > 0) {
+			break
+		}
+		offset = records[0].Offset
+		blockNum = next
+	}
+	if offset == -1 {
+		return -1, fmt.Errorf("key not found in index")
+	}
+	return offset, nil
+}
+
+// decodeLegacySummaryHeader cita prvi i poslednji kljuc iz zaglavlja Summary-ja starog formata
+func decodeLegacySummaryHeader(data []byte) (*Summary, error) {
+	if len(data) < 1 || len(data)-1 < int(data[0])+1 {
+		return nil, fmt.Errorf("legacy summary header too short")
+	}
+	first := data[1 : 1+int(data[0])]
+	data = data[1+len(first):]
+	if len(data)-1 < int(data[0]) {
+		return nil, fmt.Errorf("legacy summary header too short")
+	}
+	return &Summary{FirstKey: first, LastKey: data[1 : 1+int(data[0])]}, nil
+}
+
+// decodeLegacySummaryRecord cita Summary zapis starog formata iz podataka lanca
+func decodeLegacySummaryRecord(payload []byte) (SummaryRecord, error) {
+	if len(payload) < 1 || len(payload)-1 < int(payload[0])+8 {
+		return SummaryRecord{}, fmt.Errorf("legacy summary record too short: %d bytes", len(payload))
+	}
+	keySize := int(payload[0])
+	return SummaryRecord{
+		FirstKey:        payload[1 : 1+keySize],
+		IndexOffset:     int(binary.BigEndian.Uint32(payload[1+keySize:])),
+		NumberOfRecords: int(binary.BigEndian.Uint32(payload[5+keySize:])),
+	}, nil
+}
+
+// readLegacySummary cita Summary starog formata: zaglavlje iz prvog bloka dela, a zapise iz lanaca iza njega do kraja dela
+func readLegacySummary(file File, bm *block_organization.BlockManager) (*Summary, error) {
+	blockNum := int(file.Offset / int64(bm.BlockSize))
+	end := -1
+	if file.SizeOnDisk >= 0 {
+		end = int((file.Offset + file.SizeOnDisk) / int64(bm.BlockSize))
+	}
+	header, err := bm.ReadBlock(file.Path, blockNum)
+	if err != nil {
+		return nil, fmt.Errorf("error reading summary header from file %s: %w", file.Path, err)
+	}
+	summary, err := decodeLegacySummaryHeader(header)
+	if err != nil {
+		return nil, err
+	}
+	for blockNum++; end == -1 || blockNum < end; {
+		payload, err := bm.Read(file.Path, blockNum)
+		if errors.Is(err, io.EOF) {
+			break // Kraj fajla
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading summary record from file %s: %w", file.Path, err)
+		}
+		sr, err := decodeLegacySummaryRecord(payload)
+		if err != nil {
+			return nil, fmt.Errorf("summary block %d: %w", blockNum, err)
+		}
+		summary.Records = append(summary.Records, sr)
+		blockNum += appendedBlocks(len(payload), bm.BlockSize)
+	}
+	summary.SummaryFile = File{Path: file.Path, Offset: file.Offset, SizeOnDisk: int64(blockNum)*int64(bm.BlockSize) - file.Offset}
+	return summary, nil
+}
@@ -0,0 +1,150 @@
+package sstable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/iigor000/database/config"
+	"github.com/iigor000/database/structures/bloomfilter"
+)
+
+/*
+	=== PREFIKSNI BLOOM FILTER (u Filter delu, iza Bloom filtera kljuceva) ===
+
+	+------------+--------------------+-----------------+------------------------+
+	| Magic (4B) | Name Size (varint) | Ime extractor-a | Bloom filter prefiksa  |
+	+------------+--------------------+-----------------+------------------------+
+
+	Filter vazi samo za extractor kojim je napravljen, pa se njegovo ime (npr. fixed:4 ili delimiter:":") cuva uz filter
+	i SSTable ga koristi i kad se konfiguracija promeni
+	SSTable-ovi bez ovog dela (stariji ili sa extractor-om "none") se pri prefix scan-u nikad ne preskacu po filteru
+*/
+
+var prefixFilterMagic = []byte{'P', 'F', 'X', 1}
+
+// PrefixExtractor izdvaja prefiks kljuca za prefiksni Bloom filter
+// Kljucevi bez prefiksa (kraci od Length, odnosno bez Delimiter-a) se ne upisuju u filter
+type PrefixExtractor struct {
+	Length    int    // Duzina prefiksa, ako je 0 prefiks ide do Delimiter-a
+	Delimiter string // Prefiks se zavrsava prvim pojavljivanjem Delimiter-a (ukljucujuci njega)
+}
+
+// NewPrefixExtractor pravi extractor iz konfiguracije, nil ako prefiksni filter nije ukljucen
+func NewPrefixExtractor(conf *config.SSTableConfig) *PrefixExtractor {
+	switch conf.PrefixExtractor {
+	case config.ExtractorFixed:
+		if conf.PrefixLength > 0 {
+			return &PrefixExtractor{Length: conf.PrefixLength}
+		}
+	case config.ExtractorDelimiter:
+		if conf.PrefixDelimiter != "" {
+			return &PrefixExtractor{Delimiter: conf.PrefixDelimiter}
+		}
+	}
+	return nil
+}
+
+// Extract vraca prefiks kljuca i false ako kljuc nema prefiks
+// Svi kljucevi koji pocinju sa key imaju isti prefiks kao key, pa se po prefiksu moze proveriti i prefix scan
+func (e *PrefixExtractor) Extract(key []byte) ([]byte, bool) {
+	if e.Length > 0 {
+		if len(key) < e.Length {
+			return nil, false
+		}
+		return key[:e.Length], true
+	}
+	i := bytes.Index(key, []byte(e.Delimiter))
+	if i < 0 {
+		return nil, false
+	}
+	return key[:i+len(e.Delimiter)], true
+}
+
+// Name vraca opis extractor-a koji se upisuje uz filter
+func (e *PrefixExtractor) Name() string {
+	if e.Length > 0 {
+		return config.ExtractorFixed + ":" + strconv.Itoa(e.Length)
+	}
+	return config.ExtractorDelimiter + ":" + strconv.Quote(e.Delimiter)
+}
+
+// parsePrefixExtractor pravi extractor od imena koje je vratio Name
+func parsePrefixExtractor(name string) (*PrefixExtractor, error) {
+	kind, arg, _ := strings.Cut(name, ":")
+	switch kind {
+	case config.ExtractorFixed:
+		length, err := strconv.Atoi(arg)
+		if err == nil && length > 0 {
+			return &PrefixExtractor{Length: length}, nil
+		}
+	case config.ExtractorDelimiter:
+		delimiter, err := strconv.Unquote(arg)
+		if err == nil && delimiter != "" {
+			return &PrefixExtractor{Delimiter: delimiter}, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid prefix extractor %q", name)
+}
+
+// encodePrefixFilter serijalizuje prefiksni filter sa imenom extractor-a
+func encodePrefixFilter(e *PrefixExtractor, filter *bloomfilter.BloomFilter) []byte {
+	name := e.Name()
+	out := append([]byte(nil), prefixFilterMagic...)
+	out = binary.AppendUvarint(out, uint64(len(name)))
+	out = append(out, name...)
+	return append(out, filter.Serialize()...)
+}
+
+// decodeFilters cita Filter deo SSTable-a: Bloom filter kljuceva i, ako postoji, prefiksni filter sa njegovim extractor-om
+func decodeFilters(payload []byte) (bloomfilter.BloomFilter, *PrefixExtractor, *bloomfilter.BloomFilter, error) {
+	filter, n := bloomfilter.Decode(payload)
+	if n == 0 {
+		return filter, nil, nil, fmt.Errorf("could not deserialize filter")
+	}
+	rest := payload[n:]
+	if !bytes.HasPrefix(rest, prefixFilterMagic) {
+		return filter, nil, nil, nil
+	}
+	rest = rest[len(prefixFilterMagic):]
+	size, m := binary.Uvarint(rest)
+	if m <= 0 || size > uint64(len(rest)-m) {
+		return filter, nil, nil, fmt.Errorf("invalid prefix filter")
+	}
+	extractor, err := parsePrefixExtractor(string(rest[m : m+int(size)]))
+	if err != nil {
+		return filter, nil, nil, err
+	}
+	prefixFilter, n := bloomfilter.Decode(rest[m+int(size):])
+	if n == 0 {
+		return filter, nil, nil, fmt.Errorf("could not deserialize prefix filter")
+	}
+	return filter, extractor, &prefixFilter, nil
+}
+
+// MayContainPrefix vraca false ako SSTable sigurno nema nijedan kljuc koji pocinje sa prefix
+// Proverava opseg kljuceva iz Summary-ja, a zatim prefiksni Bloom filter ako ga SSTable ima i prefix ima prefiks po njegovom extractor-u
+func (s *SSTable) MayContainPrefix(prefix []byte) bool {
+	if len(prefix) == 0 {
+		return true
+	}
+	// Kljucevi sa prefiksom su jedan neprekidan opseg koji pocinje od samog prefiksa
+	if s.Summary != nil {
+		if bytes.Compare(s.Summary.LastKey, prefix) < 0 {
+			return false
+		}
+		if bytes.Compare(s.Summary.FirstKey, prefix) > 0 && !bytes.HasPrefix(s.Summary.FirstKey, prefix) {
+			return false
+		}
+	}
+	if s.PrefixFilter == nil {
+		return true
+	}
+	p, ok := s.PrefixExtractor.Extract(prefix)
+	if !ok {
+		return true // Prefiks je kraci od onih u filteru, filter ne moze da pomogne
+	}
+	return s.PrefixFilter.Read(p)
+}
@@ -0,0 +1,195 @@
+package sstable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+/*
+	=== PROPERTIES (od verzije 4, poslednji deo SSTable-a pre footer-a) ===
+
+	+--------------+------------------------------------------+----------------------+--------------------------------------+
+	| Verzija (1B) | Brojevi (varint, redom kao u Properties) | Reason Size + Reason | Broj izvora + (Level, Gen) po izvoru |
+	+--------------+------------------------------------------+----------------------+--------------------------------------+
+
+	Statistika SSTable-a se racuna dok Writer upisuje zapise, pa je za nju ne treba ponovo citati
+	SSTable-ovi starijih verzija nemaju ovaj deo, kod njih je SSTable.Properties nil
+*/
+
+const propertiesVersion = 1
+
+// Razlozi nastanka SSTable-a
+const (
+	ReasonFlush      = "flush"       // Flush Memtable-a
+	ReasonLeveled    = "leveled"     // Leveled kompakcija
+	ReasonSizeTiered = "size_tiered" // Size-tiered kompakcija
+	ReasonTombstone  = "tombstone"   // Kompakcija zbog gustine tombstone-ova
+	ReasonManual     = "manual"      // Rucna kompakcija opsega
+)
+
+// Source je SSTable iz kog su kompakcijom nastali zapisi
+type Source struct {
+	Level int
+	Gen   int
+}
+
+// Properties je statistika jednog SSTable-a
+type Properties struct {
+	Entries      int64 // Broj zapisa, sa tombstone-ovima
+	Tombstones   int64
+	BlobValues   int64 // Broj vrednosti izdvojenih u blob fajlove
+	RawKeySize   int64 // Kljucevi pre kodiranja recnikom
+	RawValueSize int64 // Vrednosti pre izdvajanja u blob fajlove (za vec izdvojene velicina blob zapisa)
+	KeySize      int64 // Kljucevi kako su upisani u Data blokove
+	ValueSize    int64 // Vrednosti kako su upisane u Data blokove (pokazivaci umesto izdvojenih vrednosti)
+	DataSize     int64 // Velicina Data dela na disku (posle kompresije blokova)
+	MinTimestamp int64
+	MaxTimestamp int64
+	MaxSeq       uint64
+	CreatedAt    int64  // Unix vreme pravljenja SSTable-a
+	Reason       string // Zasto je SSTable napravljen (Reason* konstante)
+	Sources      []Source
+}
+
+// add dodaje zapis u statistiku, rawValue je velicina vrednosti pre izdvajanja u blob fajl
+func (p *Properties) add(dr *DataRecord, key []byte, rawValue int) {
+	if p.Entries == 0 || dr.Timestamp < p.MinTimestamp {
+		p.MinTimestamp = dr.Timestamp
+	}
+	if p.Entries == 0 || dr.Timestamp > p.MaxTimestamp {
+		p.MaxTimestamp = dr.Timestamp
+	}
+	if dr.Seq > p.MaxSeq {
+		p.MaxSeq = dr.Seq
+	}
+	p.Entries++
+	if dr.Tombstone {
+		p.Tombstones++
+	}
+	if dr.Blob {
+		p.BlobValues++
+	}
+	p.RawKeySize += int64(len(dr.Key))
+	p.RawValueSize += int64(rawValue)
+	p.KeySize += int64(len(key))
+	if !dr.Tombstone {
+		p.ValueSize += int64(len(dr.Value))
+	}
+}
+
+// Serialize vraca Properties u binarnom obliku
+func (p *Properties) Serialize() []byte {
+	out := []byte{propertiesVersion}
+	for _, v := range []int64{p.Entries, p.Tombstones, p.BlobValues, p.RawKeySize, p.RawValueSize, p.KeySize, p.ValueSize, p.DataSize, p.MinTimestamp, p.MaxTimestamp} {
+		out = binary.AppendVarint(out, v)
+	}
+	out = binary.AppendUvarint(out, p.MaxSeq)
+	out = binary.AppendVarint(out, p.CreatedAt)
+	out = binary.AppendUvarint(out, uint64(len(p.Reason)))
+	out = append(out, p.Reason...)
+	out = binary.AppendUvarint(out, uint64(len(p.Sources)))
+	for _, s := range p.Sources {
+		out = binary.AppendUvarint(out, uint64(s.Level))
+		out = binary.AppendUvarint(out, uint64(s.Gen))
+	}
+	return out
+}
+
+// DecodeProperties cita Properties koje je upisao Serialize (iza njih moze biti popuna bloka nulama)
+func DecodeProperties(data []byte) (*Properties, error) {
+	if len(data) == 0 || data[0] != propertiesVersion {
+		return nil, fmt.Errorf("unsupported properties version")
+	}
+	r := bytes.NewReader(data[1:])
+	p := &Properties{}
+	var err error
+	varint := func(v *int64) {
+		if err == nil {
+			*v, err = binary.ReadVarint(r)
+		}
+	}
+	uvarint := func() uint64 {
+		var v uint64
+		if err == nil {
+			v, err = binary.ReadUvarint(r)
+		}
+		return v
+	}
+	for _, v := range []*int64{&p.Entries, &p.Tombstones, &p.BlobValues, &p.RawKeySize, &p.RawValueSize, &p.KeySize, &p.ValueSize, &p.DataSize, &p.MinTimestamp, &p.MaxTimestamp} {
+		varint(v)
+	}
+	p.MaxSeq = uvarint()
+	varint(&p.CreatedAt)
+	if n := uvarint(); err == nil {
+		if n > uint64(r.Len()) {
+			err = io.ErrUnexpectedEOF
+		} else {
+			reason := make([]byte, n)
+			_, err = io.ReadFull(r, reason)
+			p.Reason = string(reason)
+		}
+	}
+	sources := uvarint()
+	if err == nil && sources > uint64(r.Len()) {
+		err = io.ErrUnexpectedEOF
+	}
+	for i := uint64(0); err == nil && i < sources; i++ {
+		p.Sources = append(p.Sources, Source{Level: int(uvarint()), Gen: int(uvarint())})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid properties: %w", err)
+	}
+	return p, nil
+}
+
+// String vraca Properties u obliku za ispis (sstdump)
+func (p *Properties) String() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "entries %d, tombstones %d, blob values %d\n", p.Entries, p.Tombstones, p.BlobValues)
+	fmt.Fprintf(&b, "keys %d bytes (%d raw), values %d bytes (%d raw), data %d bytes on disk\n", p.KeySize, p.RawKeySize, p.ValueSize, p.RawValueSize, p.DataSize)
+	fmt.Fprintf(&b, "timestamps %d..%d, max seq %d\n", p.MinTimestamp, p.MaxTimestamp, p.MaxSeq)
+	fmt.Fprintf(&b, "created %s by %s", time.Unix(p.CreatedAt, 0).UTC().Format(time.RFC3339), p.Reason)
+	for i, s := range p.Sources {
+		if i == 0 {
+			b.WriteString(" from")
+		}
+		fmt.Fprintf(&b, " L%d/%d", s.Level, s.Gen)
+	}
+	return b.String()
+}
+
+// ApproximateSize procenjuje koliko bajtova Data dela zauzimaju kljucevi iz opsega [start, end]
+// Prazan start ili end znaci da opseg nije ogranicen sa te strane
+// Procena se radi po zapisima Summary-ja (svaki pokriva jedan Index blok) i ne cita nista sa diska
+func (s *SSTable) ApproximateSize(start, end []byte) int64 {
+	if (len(end) > 0 && bytes.Compare(s.Summary.FirstKey, end) > 0) || (len(start) > 0 && bytes.Compare(s.Summary.LastKey, start) < 0) {
+		return 0
+	}
+	size := s.Data.DataFile.SizeOnDisk
+	if s.Properties != nil {
+		size = s.Properties.DataSize
+	}
+	if size <= 0 {
+		return 0
+	}
+	var total, inRange int
+	for i, r := range s.Summary.Records {
+		total += r.NumberOfRecords
+		// Zapis pokriva kljuceve od svog prvog do prvog kljuca sledeceg zapisa
+		last := s.Summary.LastKey
+		if i+1 < len(s.Summary.Records) {
+			last = s.Summary.Records[i+1].FirstKey
+		}
+		if (len(end) > 0 && bytes.Compare(r.FirstKey, end) > 0) || (len(start) > 0 && bytes.Compare(last, start) < 0) {
+			continue
+		}
+		inRange += r.NumberOfRecords
+	}
+	if total == 0 {
+		return size
+	}
+	return size * int64(inRange) / int64(total)
+}
@@ -1,12 +1,24 @@
 package sstable
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/iigor000/database/config"
+	"github.com/iigor000/database/structures/adapter"
 	"github.com/iigor000/database/structures/block_organization"
+	"github.com/iigor000/database/structures/bloomfilter"
 	"github.com/iigor000/database/structures/compression"
 	"github.com/iigor000/database/structures/memtable"
+	"github.com/iigor000/database/structures/merkle"
 )
 
 func CreateConfig() *config.Config {
@@ -42,11 +54,11 @@ func TestSSTable(t *testing.T) {
 	// Initialize a memtable with some data
 	memtable := memtable.NewMemtable(conf)
 	// Add some entries to the memtable
-	memtable.Update([]byte("key1"), []byte("value1"), 1, false)
-	memtable.Update([]byte("key2"), []byte("value2"), 2, false)
-	memtable.Update([]byte("key3"), []byte("value3"), 3, false)
-	memtable.Update([]byte("key4"), []byte("value4"), 4, false)
-	memtable.Update([]byte("key5"), []byte("value5"), 5, false)
+	memtable.Update([]byte("key1"), []byte("value1"), 1, 1, false)
+	memtable.Update([]byte("key2"), []byte("value2"), 2, 2, false)
+	memtable.Update([]byte("key3"), []byte("value3"), 3, 3, false)
+	memtable.Update([]byte("key4"), []byte("value4"), 4, 4, false)
+	memtable.Update([]byte("key5"), []byte("value5"), 5, 5, false)
 	println("Memtable entries:")
 	memtable.Print()
 	dict := compression.NewDictionary()
@@ -94,11 +106,11 @@ func TestSSTableRead(t *testing.T) {
 	memtable := memtable.NewMemtable(conf)
 	// Add some entries to the memtable
 
-	memtable.Update([]byte("key5"), []byte("value5"), 5, false)
-	memtable.Update([]byte("key1"), []byte("value1"), 1, false)
-	memtable.Update([]byte("key2"), []byte("value2"), 2, false)
-	memtable.Update([]byte("key3"), []byte("value3"), 3, false)
-	memtable.Update([]byte("key4"), []byte("value4"), 4, false)
+	memtable.Update([]byte("key5"), []byte("value5"), 5, 5, false)
+	memtable.Update([]byte("key1"), []byte("value1"), 1, 1, false)
+	memtable.Update([]byte("key2"), []byte("value2"), 2, 2, false)
+	memtable.Update([]byte("key3"), []byte("value3"), 3, 3, false)
+	memtable.Update([]byte("key4"), []byte("value4"), 4, 4, false)
 	println("Memtable entries:")
 	memtable.Print()
 	dict := compression.NewDictionary()
@@ -288,3 +300,1069 @@ func TestSSTableValidate(t *testing.T) {
 	}
 	println("SSTable validation passed successfully")
 }
+
+func TestDumpAndVerifySSTable(t *testing.T) {
+	for _, singleFile := range []bool{true, false} {
+		for _, useCompression := range []bool{true, false} {
+			conf := CreateConfig()
+			conf.SSTable.SstableDirectory = t.TempDir()
+			conf.SSTable.SingleFile = singleFile
+			conf.SSTable.UseCompression = useCompression
+
+			mem := memtable.NewMemtable(conf)
+			dict := compression.NewDictionary()
+			for i, key := range []string{"key1", "key2", "key3", "key4", "key5"} {
+				mem.Update([]byte(key), []byte("value"+key[3:]), uint64(i+1), int64(i+1), false)
+				dict.Add([]byte(key))
+			}
+			mem.Delete([]byte("key3"))
+
+			cbm := &block_organization.CachedBlockManager{
+				BM: block_organization.NewBlockManager(conf),
+				C:  block_organization.NewBlockCache(conf),
+			}
+			FlushSSTable(conf, *mem, 1, 1, dict, cbm)
+			dir := conf.SSTable.SstableDirectory + "/1/1"
+
+			var out bytes.Buffer
+			if err := DumpSSTable(&out, dir, conf, dict); err != nil {
+				t.Fatalf("DumpSSTable failed (single file %v, compression %v): %v", singleFile, useCompression, err)
+			}
+			dump := out.String()
+			for _, want := range []string{`key="key1"`, `value(6)="value5"`, "tombstone", "Bloom filter: standard, m=", "Merkle tree: root", `first key "key1", last key "key5"`, "data @"} {
+				if !strings.Contains(dump, want) {
+					t.Errorf("dump (single file %v, compression %v) missing %q:\n%s", singleFile, useCompression, want, dump)
+				}
+			}
+			if strings.Contains(dump, "ERROR") || strings.Contains(dump, "BAD") {
+				t.Errorf("dump of a valid SSTable reports errors:\n%s", dump)
+			}
+
+			checked, err := VerifySSTable(dir, conf, dict)
+			if err != nil || checked != 5 {
+				t.Fatalf("VerifySSTable = %d, %v, want 5 records without errors", checked, err)
+			}
+
+			// Svi zapisi su u jednom Data bloku, kvarimo poslednji bajt vrednosti key4
+			dataPath := CreateFileName(dir, 1, "Data", "db")
+			blockSize := int64(conf.Block.BlockSize)
+			badOffset := int64(0) // Data deo pocinje od bloka 0 i u jednom fajlu
+			if singleFile {
+				dataPath = CreateFileName(dir, 1, "SSTable", "db")
+			}
+			raw, err := os.ReadFile(dataPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			valueEnd := badOffset + 1 + int64(bytes.Index(raw[badOffset:badOffset+blockSize], []byte("value4"))) + 5
+			raw[valueEnd-1] ^= 0xff
+			if err := os.WriteFile(dataPath, raw, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = VerifySSTable(dir, conf, dict)
+			var corruption *CorruptionError
+			if !errors.As(err, &corruption) {
+				t.Fatalf("expected CorruptionError after corrupting data, got %v", err)
+			}
+			if corruption.Offset != badOffset || corruption.Record != 0 {
+				t.Errorf("corruption reported at record %d offset %d, want record 0 offset %d", corruption.Record, corruption.Offset, badOffset)
+			}
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	for _, singleFile := range []bool{false, true} {
+		for _, useCompression := range []bool{false, true} {
+			conf := CreateConfig()
+			conf.SSTable.SstableDirectory = t.TempDir()
+			conf.SSTable.SingleFile = singleFile
+			conf.SSTable.UseCompression = useCompression
+			cbm := &block_organization.CachedBlockManager{
+				BM: block_organization.NewBlockManager(conf),
+				C:  block_organization.NewBlockCache(conf),
+			}
+
+			dict := compression.NewDictionary()
+			var entries []adapter.MemtableEntry
+			for i := 0; i < 25; i++ {
+				key := []byte(fmt.Sprintf("key%02d", i))
+				dict.Add(key)
+				entries = append(entries, adapter.MemtableEntry{Key: key, Value: []byte(fmt.Sprintf("value%d", i)), Seq: uint64(i), Timestamp: int64(i), Tombstone: i%7 == 3})
+			}
+
+			w, err := NewWriter(conf, 1, 1, len(entries), dict, cbm)
+			if err != nil {
+				t.Fatalf("NewWriter failed: %v", err)
+			}
+			for _, entry := range entries {
+				if err := w.Add(entry); err != nil {
+					t.Fatalf("Add failed: %v", err)
+				}
+			}
+			if err := w.Finish(); err != nil {
+				t.Fatalf("Finish failed: %v", err)
+			}
+
+			dir := conf.SSTable.SstableDirectory + "/1/1"
+			checked, err := VerifySSTable(dir, conf, dict)
+			if err != nil || checked != len(entries) {
+				t.Fatalf("VerifySSTable (single file %v, compression %v) = %d, %v, want %d records without errors", singleFile, useCompression, checked, err, len(entries))
+			}
+			if _, err := os.Stat(CreateFileName(dir, 1, "Index", "tmp")); !os.IsNotExist(err) {
+				t.Errorf("temporary index left behind: %v", err)
+			}
+
+			table, err := StartSSTable(1, 1, conf, dict, cbm)
+			if err != nil {
+				t.Fatalf("StartSSTable failed: %v", err)
+			}
+			if !bytes.Equal(table.Summary.FirstKey, []byte("key00")) || !bytes.Equal(table.Summary.LastKey, []byte("key24")) {
+				t.Errorf("summary range = [%s, %s], want [key00, key24]", table.Summary.FirstKey, table.Summary.LastKey)
+			}
+			for _, entry := range entries {
+				rec, err := table.Get(conf, entry.Key, cbm)
+				if err != nil || rec == nil {
+					t.Fatalf("Get(%s) (single file %v, compression %v) = %v, %v", entry.Key, singleFile, useCompression, rec, err)
+				}
+				if rec.Tombstone != entry.Tombstone || (!entry.Tombstone && !bytes.Equal(rec.Value, entry.Value)) {
+					t.Errorf("Get(%s) = %+v, want %+v", entry.Key, rec, entry)
+				}
+			}
+
+			iter := table.NewSSTableIterator(cbm)
+			count := 0
+			for {
+				rec, ok := iter.Next()
+				if !ok {
+					break
+				}
+				if !bytes.Equal(rec.Key, entries[count].Key) {
+					t.Fatalf("iterator record %d = %s, want %s", count, rec.Key, entries[count].Key)
+				}
+				count++
+			}
+			if count != len(entries) {
+				t.Errorf("iterator returned %d records, want %d", count, len(entries))
+			}
+		}
+	}
+}
+
+func TestBlockBuilder(t *testing.T) {
+	b := newBlockBuilder(4)
+	var keys [][]byte
+	for i := 0; i < 50; i++ {
+		key := []byte(fmt.Sprintf("user:%04d", i*2))
+		keys = append(keys, key)
+		b.add(key, []byte(fmt.Sprintf("v%d", i)))
+	}
+	payload, err := b.finish(nil)
+	if err != nil {
+		t.Fatalf("finish failed: %v", err)
+	}
+	// Dopuna nulama kao kod BlockManager-a ne sme da smeta
+	decoded, err := decodeBlock(append(payload, make([]byte, 100)...), FormatVersion)
+	if err != nil {
+		t.Fatalf("decodeBlock failed: %v", err)
+	}
+	if len(decoded.restarts) != 13 {
+		t.Errorf("expected 13 restart points, got %d", len(decoded.restarts))
+	}
+	entries, err := decoded.entries()
+	if err != nil || len(entries) != len(keys) {
+		t.Fatalf("entries = %d, %v; want %d", len(entries), err, len(keys))
+	}
+	for i, entry := range entries {
+		if !bytes.Equal(entry.Key, keys[i]) || string(entry.Value) != fmt.Sprintf("v%d", i) {
+			t.Errorf("entry %d = %s/%s", i, entry.Key, entry.Value)
+		}
+	}
+	// Zajednicki prefiks kljuceva se ne ponavlja, pa je blok manji od samih kljuceva i vrednosti
+	raw := 0
+	for i, entry := range entries {
+		raw += len(keys[i]) + len(entry.Value)
+	}
+	if len(payload) >= raw {
+		t.Errorf("block is %d bytes, keys and values alone are %d", len(payload), raw)
+	}
+
+	for _, tc := range []struct {
+		key   string
+		first string
+		count int
+	}{
+		{"a", "user:0000", 50},
+		{"user:0000", "user:0000", 50},
+		{"user:0051", "user:0052", 24},
+		{"user:0052", "user:0052", 24},
+		{"user:0098", "user:0098", 1},
+		{"user:0099", "", 0},
+	} {
+		found, err := decoded.seek([]byte(tc.key), nil)
+		if err != nil {
+			t.Fatalf("seek(%s) failed: %v", tc.key, err)
+		}
+		if len(found) != tc.count || (tc.count > 0 && string(found[0].Key) != tc.first) {
+			t.Errorf("seek(%s) = %d entries, want %d starting at %s", tc.key, len(found), tc.count, tc.first)
+		}
+	}
+
+	// floor je pretraga Index bloka: poslednji kljuc <= key, ili prvi ako je key manji od svih
+	for key, want := range map[string]string{
+		"a":         "user:0000",
+		"user:0000": "user:0000",
+		"user:0007": "user:0006",
+		"user:0008": "user:0008",
+		"user:0051": "user:0050",
+		"user:0098": "user:0098",
+		"zzz":       "user:0098",
+	} {
+		found, err := decoded.floor([]byte(key))
+		if err != nil || string(found.Key) != want {
+			t.Errorf("floor(%s) = %s, %v; want %s", key, found.Key, err, want)
+		}
+	}
+
+	payload[10] ^= 0xff
+	if _, err := decodeBlock(payload, FormatVersion); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("expected checksum error for corrupted block, got %v", err)
+	}
+}
+
+// Ovaj test proverava da se mali zapisi pakuju u blokove i da se citaju preko vise Data i Index blokova
+func TestPackedBlocks(t *testing.T) {
+	for _, singleFile := range []bool{false, true} {
+		conf := CreateConfig()
+		conf.SSTable.SstableDirectory = t.TempDir()
+		conf.SSTable.SingleFile = singleFile
+		conf.SSTable.UseCompression = false
+		conf.SSTable.SummaryLevel = 4
+		cbm := &block_organization.CachedBlockManager{
+			BM: block_organization.NewBlockManager(conf),
+			C:  block_organization.NewBlockCache(conf),
+		}
+
+		const n = 2000
+		w, err := NewWriter(conf, 1, 1, n, nil, cbm)
+		if err != nil {
+			t.Fatalf("NewWriter failed: %v", err)
+		}
+		for i := 0; i < n; i++ {
+			entry := adapter.MemtableEntry{Key: []byte(fmt.Sprintf("key%05d", i*2)), Value: []byte(fmt.Sprintf("value%d", i)), Seq: uint64(i + 1), Timestamp: int64(i), Tombstone: i%100 == 7}
+			if err := w.Add(entry); err != nil {
+				t.Fatalf("Add failed: %v", err)
+			}
+		}
+		if err := w.Finish(); err != nil {
+			t.Fatalf("Finish failed: %v", err)
+		}
+
+		table, err := StartSSTable(1, 1, conf, nil, cbm)
+		if err != nil {
+			t.Fatalf("StartSSTable failed: %v", err)
+		}
+		dataFile := table.Data.DataFile
+		data, err := ReadData(dataFile.Path, conf, nil, dataFile.Offset, dataFile.Offset+dataFile.SizeOnDisk, cbm)
+		if err != nil || len(data.Records) != n {
+			t.Fatalf("ReadData = %d records, %v; want %d", len(data.Records), err, n)
+		}
+		blocks := map[int]int{} // Offset Data bloka -> redni broj njegovog prvog zapisa
+		for i, record := range data.Records {
+			if _, ok := blocks[record.Offset]; !ok {
+				blocks[record.Offset] = i
+			}
+		}
+		if len(blocks) < 5 || len(blocks) > n/100 {
+			t.Errorf("%d records packed into %d data blocks", n, len(blocks))
+		}
+		if len(table.Summary.Records) < 2 {
+			t.Errorf("expected several index blocks, got %d summary records", len(table.Summary.Records))
+		}
+		total := 0
+		for _, sr := range table.Summary.Records {
+			total += sr.NumberOfRecords
+		}
+		if total != n {
+			t.Errorf("summary covers %d records, want %d", total, n)
+		}
+
+		for i := 0; i < n; i += 37 {
+			key := []byte(fmt.Sprintf("key%05d", i*2))
+			rec, err := table.Get(conf, key, cbm)
+			if err != nil || rec == nil || rec.Seq != uint64(i+1) || rec.Tombstone != (i%100 == 7) {
+				t.Fatalf("Get(%s) (single file %v) = %+v, %v", key, singleFile, rec, err)
+			}
+			// Neparni kljucevi ne postoje
+			if rec, err := table.Get(conf, []byte(fmt.Sprintf("key%05d", i*2+1)), cbm); err != nil || rec != nil {
+				t.Errorf("Get of missing key returned %+v, %v", rec, err)
+			}
+		}
+
+		count := 0
+		for it := table.RangeIterate("key01001", "key02999", cbm); ; count++ {
+			rec, ok := it.Next()
+			if !ok {
+				break
+			}
+			if want := fmt.Sprintf("key%05d", 1002+2*count); string(rec.Key) != want {
+				t.Fatalf("range record %d = %s, want %s", count, rec.Key, want)
+			}
+		}
+		if count != 999 {
+			t.Errorf("range returned %d records, want 999", count)
+		}
+		count = 0
+		for it := table.PrefixIterate("key01", cbm); ; count++ {
+			if _, ok := it.Next(); !ok {
+				break
+			}
+		}
+		if count != 500 {
+			t.Errorf("prefix returned %d records, want 500", count)
+		}
+
+		// Kvarimo jedan bajt u Data bloku iz sredine, greska se prijavljuje za njegov prvi zapis
+		dir := conf.SSTable.SstableDirectory + "/1/1"
+		middle := data.Records[n/2].Offset
+		raw, err := os.ReadFile(table.Data.DataFile.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw[middle+20] ^= 0xff
+		if err := os.WriteFile(table.Data.DataFile.Path, raw, 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err = VerifySSTable(dir, conf, nil)
+		var corruption *CorruptionError
+		if !errors.As(err, &corruption) {
+			t.Fatalf("expected CorruptionError, got %v", err)
+		}
+		if corruption.Offset != int64(middle) || corruption.Record != blocks[middle] {
+			t.Errorf("corruption reported at record %d offset %d, want record %d offset %d", corruption.Record, corruption.Offset, blocks[middle], middle)
+		}
+	}
+}
+
+// Ovaj test proverava footer i da se SSTable-ovi starog formata (verzija 1, bez footer-a) i dalje otvaraju
+func TestFooterAndLegacyFormat(t *testing.T) {
+	f := Footer{Version: FormatVersion, Flags: footerFlagCompression}
+	for i := range f.Sections {
+		f.Sections[i] = Handle{Offset: int64(i * 4096), Length: int64(i+1) * 4096}
+	}
+	encoded := f.Serialize()
+	if len(encoded) != footerSize {
+		t.Fatalf("footer is %d bytes, want %d", len(encoded), footerSize)
+	}
+	decoded, err := DecodeFooter(encoded)
+	if err != nil || *decoded != f {
+		t.Fatalf("DecodeFooter = %+v, %v; want %+v", decoded, err, f)
+	}
+	if _, err := DecodeFooter(make([]byte, footerSize)); !errors.Is(err, errNoFooter) {
+		t.Errorf("DecodeFooter without magic = %v, want errNoFooter", err)
+	}
+	encoded[10] ^= 0xff
+	if _, err := DecodeFooter(encoded); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("DecodeFooter of corrupted footer = %v, want checksum error", err)
+	}
+	newer := f
+	newer.Version = FormatVersion + 1
+	if _, err := DecodeFooter(newer.Serialize()); err == nil || !strings.Contains(err.Error(), "unsupported") {
+		t.Errorf("DecodeFooter of newer version = %v, want unsupported version error", err)
+	}
+	// Footer pre Properties dela nema poslednji deo
+	older := f
+	older.Version = formatVersionProperties - 1
+	older.Sections[numSections-1] = Handle{}
+	if encoded := older.Serialize(); len(encoded) != footerSize-16 {
+		t.Errorf("version %d footer is %d bytes, want %d", older.Version, len(encoded), footerSize-16)
+	}
+	if decoded, err := DecodeFooter(append(older.Serialize(), make([]byte, 100)...)); err != nil || *decoded != older {
+		t.Errorf("DecodeFooter of version %d = %+v, %v; want %+v", older.Version, decoded, err, older)
+	}
+
+	for _, singleFile := range []bool{false, true} {
+		conf := CreateConfig()
+		conf.SSTable.SstableDirectory = t.TempDir()
+		conf.SSTable.SingleFile = singleFile
+		conf.SSTable.UseCompression = false
+		bm := block_organization.NewBlockManager(conf)
+		cbm := &block_organization.CachedBlockManager{BM: bm, C: block_organization.NewBlockCache(conf)}
+
+		const n = 50
+		w, err := NewWriter(conf, 1, 1, n, nil, cbm)
+		if err != nil {
+			t.Fatalf("NewWriter failed: %v", err)
+		}
+		if singleFile {
+			// U starom formatu je blok 0 bio TOC, a Data deo je pocinjao od bloka 1
+			if _, err := bm.AppendBlock(w.dataPath, []byte("TOC")); err != nil {
+				t.Fatal(err)
+			}
+			w.firstDataBlock, w.nextDataBlock = 1, 1
+		}
+		for i := 0; i < n; i++ {
+			entry := adapter.MemtableEntry{Key: []byte(fmt.Sprintf("key%03d", i)), Value: []byte(fmt.Sprintf("value%d", i)), Seq: uint64(i + 1)}
+			if err := w.Add(entry); err != nil {
+				t.Fatalf("Add failed: %v", err)
+			}
+		}
+		if err := w.Finish(); err != nil {
+			t.Fatalf("Finish failed: %v", err)
+		}
+		table, err := StartSSTable(1, 1, conf, nil, cbm)
+		if err != nil || table.FormatVersion != FormatVersion {
+			t.Fatalf("StartSSTable = %v; want format version %d", err, FormatVersion)
+		}
+
+		// Pravimo verziju 2: footer bez Properties dela i blokove bez Codec bajta
+		footer, err := readFooter(w.dataPath, bm)
+		if err != nil {
+			t.Fatalf("readFooter failed: %v", err)
+		}
+		info, err := os.Stat(w.dataPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		indexPath := w.dataPath
+		if !singleFile {
+			indexPath = CreateFileName(w.dir, 1, "Index", "db")
+		}
+		downgradeBlocks(t, bm, w.dataPath, footer.Sections[0])
+		downgradeBlocks(t, bm, indexPath, footer.Sections[1])
+		v2 := *footer
+		v2.Version = formatVersionCodec - 1
+		v2.Sections[numSections-1] = Handle{}
+		if err := bm.Write(w.dataPath, int(info.Size())/conf.Block.BlockSize-1, v2.Serialize()); err != nil {
+			t.Fatal(err)
+		}
+
+		cbm = &block_organization.CachedBlockManager{BM: bm, C: block_organization.NewBlockCache(conf)}
+		older, err := StartSSTable(1, 1, conf, nil, cbm)
+		if err != nil {
+			t.Fatalf("StartSSTable of version 2 table (single file %v) failed: %v", singleFile, err)
+		}
+		if older.FormatVersion != int(v2.Version) || older.Properties != nil {
+			t.Errorf("version 2 table opened as version %d, properties %v", older.FormatVersion, older.Properties)
+		}
+		for _, i := range []int{0, 17, n - 1} {
+			key := []byte(fmt.Sprintf("key%03d", i))
+			record, err := older.Get(conf, key, cbm)
+			if err != nil || record == nil || string(record.Value) != fmt.Sprintf("value%d", i) {
+				t.Errorf("Get(%s) from version 2 table = %v, %v", key, record, err)
+			}
+		}
+		if checked, err := VerifySSTable(w.dir, conf, nil); err != nil || checked != n {
+			t.Errorf("VerifySSTable of version 2 table = %d, %v; want %d", checked, err, n)
+		}
+
+		// Verzija 1 je stari format, u kom je svaki zapis upisan u svom lancu blokova
+		legacyConf := CreateConfig()
+		legacyConf.SSTable.SstableDirectory = t.TempDir()
+		legacyConf.SSTable.SingleFile = singleFile
+		legacyConf.SSTable.UseCompression = false
+		records := make([]DataRecord, n)
+		for i := range records {
+			records[i] = NewDataRecord([]byte(fmt.Sprintf("key%03d", i)), []byte(fmt.Sprintf("value%d", i)), 0, int64(i+1), i%10 == 5)
+		}
+		dir := writeLegacyTable(t, legacyConf, 1, 1, records)
+
+		cbm = &block_organization.CachedBlockManager{BM: bm, C: block_organization.NewBlockCache(legacyConf)}
+		legacy, err := StartSSTable(1, 1, legacyConf, nil, cbm)
+		if err != nil {
+			t.Fatalf("StartSSTable of legacy table (single file %v) failed: %v", singleFile, err)
+		}
+		if legacy.FormatVersion != FormatVersionLegacy || legacy.SingleFile != singleFile {
+			t.Errorf("legacy table opened as version %d, single file %v", legacy.FormatVersion, legacy.SingleFile)
+		}
+		for _, i := range []int{0, 15, 17, n - 1} {
+			key := []byte(fmt.Sprintf("key%03d", i))
+			record, err := legacy.Get(legacyConf, key, cbm)
+			if err != nil || record == nil || record.Tombstone != records[i].Tombstone || !bytes.Equal(record.Value, records[i].Value) || record.Timestamp != int64(i+1) {
+				t.Errorf("Get(%s) from legacy table = %+v, %v", key, record, err)
+			}
+		}
+		if record, err := legacy.Get(legacyConf, []byte("key0105"), cbm); err != nil || record != nil {
+			t.Errorf("Get of a missing key from legacy table = %+v, %v", record, err)
+		}
+		it := legacy.NewSSTableIterator(cbm)
+		count := 0
+		for entry, ok := it.Next(); ok; entry, ok = it.Next() {
+			if count < n && (!bytes.Equal(entry.Key, records[count].Key) || entry.Tombstone != records[count].Tombstone || entry.Seq != 0) {
+				t.Errorf("legacy record #%d = %q (tombstone %v, seq %d), want %q", count, entry.Key, entry.Tombstone, entry.Seq, records[count].Key)
+			}
+			count++
+		}
+		if count != n {
+			t.Errorf("iterated over %d legacy records, want %d", count, n)
+		}
+		first, last, err := ReadSummaryMinMax(1, 1, legacyConf, cbm)
+		if err != nil || string(first) != "key000" || string(last) != fmt.Sprintf("key%03d", n-1) {
+			t.Errorf("ReadSummaryMinMax of legacy table = %q, %q, %v", first, last, err)
+		}
+		if checked, err := VerifySSTable(dir, legacyConf, nil); err != nil || checked != n {
+			t.Errorf("VerifySSTable of legacy table = %d, %v; want %d", checked, err, n)
+		}
+	}
+}
+
+// writeLegacyTable upisuje SSTable u starom formatu (verzija 1) i vraca njegov direktorijum
+// Zapisi moraju biti sortirani, a kljucevi i vrednosti kraci od 256 bajtova
+func writeLegacyTable(t *testing.T, conf *config.Config, level, gen int, records []DataRecord) string {
+	t.Helper()
+	bm := block_organization.NewBlockManager(conf)
+	bs := conf.Block.BlockSize
+	dir := fmt.Sprintf("%s/%d/%d", conf.SSTable.SstableDirectory, level, gen)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := func(name string) string {
+		if conf.SSTable.SingleFile {
+			return CreateFileName(dir, gen, "SSTable", "db")
+		}
+		return CreateFileName(dir, gen, name, "db")
+	}
+	offsets := make(map[string]int64)
+	appendChain := func(name string, data []byte) int64 {
+		bn, err := bm.Append(path(name), data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := offsets[name]; !ok {
+			offsets[name] = int64(bn * bs)
+		}
+		return int64(bn * bs)
+	}
+	if conf.SSTable.SingleFile {
+		// Blok 0 su offseti delova, upisuju se na kraju
+		if _, err := bm.AppendBlock(path("Data"), make([]byte, bs)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filter := bloomfilter.NewBloomFilter(len(records), 10, false)
+	leaves := make([][]byte, len(records))
+	dataOffsets := make([]int64, len(records))
+	for i := range records {
+		r := &records[i]
+		rec := binary.LittleEndian.AppendUint32(nil, legacyCRC(r))
+		rec = binary.LittleEndian.AppendUint64(rec, uint64(r.Timestamp))
+		if r.Tombstone {
+			rec = append(rec, 1, byte(len(r.Key)))
+		} else {
+			rec = append(rec, 0, byte(len(r.Key)), byte(len(r.Value)))
+		}
+		rec = append(append(rec, r.Key...), r.Value...)
+		dataOffsets[i] = appendChain("Data", rec)
+		filter.Add(r.Key)
+		leaves[i] = append(append([]byte(nil), r.Key...), r.Value...)
+	}
+	indexOffsets := make([]int64, len(records))
+	for i, r := range records {
+		rec := append([]byte{byte(len(r.Key))}, r.Key...)
+		indexOffsets[i] = appendChain("Index", binary.BigEndian.AppendUint32(rec, uint32(dataOffsets[i])))
+	}
+
+	// Zaglavlje Summary-ja je blok bez oznake lanca
+	header := make([]byte, bs)
+	firstKey, lastKey := records[0].Key, records[len(records)-1].Key
+	header[0] = byte(len(firstKey))
+	copy(header[1:], firstKey)
+	header[1+len(firstKey)] = byte(len(lastKey))
+	copy(header[2+len(firstKey):], lastKey)
+	bn, err := bm.AppendBlock(path("Summary"), header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offsets["Summary"] = int64(bn * bs)
+	step := conf.SSTable.SummaryLevel
+	for i := 0; i < len(records); i += step {
+		count := step
+		if i+count > len(records) {
+			count = len(records) - i
+		}
+		rec := append([]byte{byte(len(records[i].Key))}, records[i].Key...)
+		rec = binary.BigEndian.AppendUint32(rec, uint32(indexOffsets[i]))
+		appendChain("Summary", binary.BigEndian.AppendUint32(rec, uint32(count)))
+	}
+
+	appendChain("Filter", filter.Serialize())
+	metadata, err := merkle.NewMerkleTree(leaves).Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendChain("Metadata", metadata)
+
+	if !conf.SSTable.SingleFile {
+		appendChain("CompressionInfo", []byte{0})
+		return dir
+	}
+	compressionOffset := appendChain("Compression", []byte("No compression"))
+	appendChain("TOC", []byte("TOC\n"))
+	toc := fmt.Sprintf("Data: %d\nIndex: %d\nSummary: %d\nFilter: %d\nMetadata: %d\nCompression: %d\n",
+		offsets["Data"], offsets["Index"], offsets["Summary"], offsets["Filter"], offsets["Metadata"], compressionOffset)
+	if err := bm.WriteBlock(path("Data"), 0, []byte(toc)); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// TestLegacyFixture otvara SSTable koji je napisala verzija pre blokova sa vise zapisa
+// Fixture je kopija sstable_test/1/1 iz te verzije (TestSSTable ga prepisuje), sa kompresijom preko recnika
+func TestLegacyFixture(t *testing.T) {
+	conf := CreateConfig()
+	conf.SSTable.SstableDirectory = "./sstable_test/legacy"
+	cbm := &block_organization.CachedBlockManager{BM: block_organization.NewBlockManager(conf), C: block_organization.NewBlockCache(conf)}
+	dict, err := compression.Read("./sstable_test/legacy/dict.db", cbm)
+	if err != nil {
+		t.Fatalf("Failed to read dictionary: %v", err)
+	}
+
+	table, err := StartSSTable(1, 1, conf, dict, cbm)
+	if err != nil {
+		t.Fatalf("StartSSTable of legacy fixture failed: %v", err)
+	}
+	if table.FormatVersion != FormatVersionLegacy || !table.SingleFile || !table.UseCompression {
+		t.Errorf("fixture opened as version %d, single file %v, compression %v", table.FormatVersion, table.SingleFile, table.UseCompression)
+	}
+	if string(table.Summary.FirstKey) != "key1" || string(table.Summary.LastKey) != "key5" || len(table.Summary.Records) != 3 {
+		t.Errorf("fixture summary = %q..%q with %d records", table.Summary.FirstKey, table.Summary.LastKey, len(table.Summary.Records))
+	}
+	for i := 1; i <= 5; i++ {
+		key := []byte(fmt.Sprintf("key%d", i))
+		record, err := table.Get(conf, key, cbm)
+		if err != nil || record == nil || string(record.Value) != fmt.Sprintf("value%d", i) || record.Timestamp != int64(i) {
+			t.Errorf("Get(%s) from fixture = %+v, %v", key, record, err)
+		}
+	}
+	it := table.NewSSTableIterator(cbm)
+	count := 0
+	for entry, ok := it.Next(); ok; entry, ok = it.Next() {
+		count++
+		if string(entry.Key) != fmt.Sprintf("key%d", count) || string(entry.Value) != fmt.Sprintf("value%d", count) {
+			t.Errorf("fixture record #%d = %q: %q", count, entry.Key, entry.Value)
+		}
+	}
+	if count != 5 {
+		t.Errorf("iterated over %d fixture records, want 5", count)
+	}
+	if checked, err := VerifySSTable("./sstable_test/legacy/1/1", conf, dict); err != nil || checked != 5 {
+		t.Errorf("VerifySSTable of fixture = %d, %v; want 5", checked, err)
+	}
+}
+
+// downgradeBlocks prepisuje blokove dela SSTable-a u zapis pre verzije 3 (bez Codec bajta)
+// Svaki blok mora da stane u jedan fizicki blok
+func downgradeBlocks(t *testing.T, bm *block_organization.BlockManager, path string, h Handle) {
+	t.Helper()
+	for bn := int(h.Offset) / bm.BlockSize; bn < int(h.Offset+h.Length)/bm.BlockSize; bn++ {
+		raw, err := bm.ReadBlock(path, bn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := decodeBlock(raw[1:], FormatVersion)
+		if err != nil || raw[0] != 2 {
+			t.Fatalf("block %d in %s: marker %d, %v", bn, path, raw[0], err)
+		}
+		body := append([]byte(nil), b.data...)
+		for _, restart := range b.restarts {
+			body = binary.LittleEndian.AppendUint32(body, restart)
+		}
+		body = binary.LittleEndian.AppendUint32(body, uint32(len(b.restarts)))
+		legacy := binary.LittleEndian.AppendUint32([]byte{2}, uint32(len(body)))
+		legacy = append(legacy, body...)
+		legacy = binary.LittleEndian.AppendUint32(legacy, crc32.ChecksumIEEE(legacy[1:]))
+		if err := bm.WriteBlock(path, bn, legacy); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Ovaj test proverava kompresiju Data blokova svakim kodekom i citanje SSTable-a sa blokovima razlicitih kodeka
+func TestBlockCompression(t *testing.T) {
+	const n = 1000
+	sizes := map[string]int64{}
+	for _, codec := range []string{config.CodecNone, config.CodecFlate, config.CodecZlib, config.CodecLZ, "mixed"} {
+		conf := CreateConfig()
+		conf.SSTable.SstableDirectory = t.TempDir()
+		conf.SSTable.UseCompression = false
+		conf.SSTable.SingleFile = codec == config.CodecLZ
+		conf.SSTable.BlockCompression = []string{codec, config.CodecNone}
+		if codec == "mixed" {
+			conf.SSTable.BlockCompression = []string{config.CodecFlate}
+		}
+		cbm := &block_organization.CachedBlockManager{
+			BM: block_organization.NewBlockManager(conf),
+			C:  block_organization.NewBlockCache(conf),
+		}
+
+		w, err := NewWriter(conf, 1, 1, n, nil, cbm)
+		if err != nil {
+			t.Fatalf("NewWriter(%s) failed: %v", codec, err)
+		}
+		for i := 0; i < n; i++ {
+			if codec == "mixed" && i%100 == 0 {
+				// Kodek se menja usred SSTable-a, svaki blok nosi svoj
+				w.codec, _ = compression.CodecByName([]string{config.CodecNone, config.CodecFlate, config.CodecZlib, config.CodecLZ}[i/100%4])
+			}
+			entry := adapter.MemtableEntry{Key: []byte(fmt.Sprintf("key%05d", i)), Value: []byte(strings.Repeat(fmt.Sprintf("value%d ", i%10), 10)), Seq: uint64(i + 1)}
+			if err := w.Add(entry); err != nil {
+				t.Fatalf("Add failed: %v", err)
+			}
+		}
+		if err := w.Finish(); err != nil {
+			t.Fatalf("Finish failed: %v", err)
+		}
+		sizes[codec] = w.DataSize()
+
+		table, err := StartSSTable(1, 1, conf, nil, cbm)
+		if err != nil {
+			t.Fatalf("StartSSTable(%s) failed: %v", codec, err)
+		}
+		for _, i := range []int{0, 1, 499, 500, n - 1} {
+			record, err := table.Get(conf, []byte(fmt.Sprintf("key%05d", i)), cbm)
+			if err != nil || record == nil || string(record.Value) != strings.Repeat(fmt.Sprintf("value%d ", i%10), 10) {
+				t.Errorf("%s: Get(key%05d) = %v, %v", codec, i, record, err)
+			}
+		}
+		iter := table.RangeIterate("key00250", "key00749", cbm)
+		count := 0
+		for rec, ok := iter.Next(); ok; rec, ok = iter.Next() {
+			if string(rec.Key) != fmt.Sprintf("key%05d", 250+count) {
+				t.Fatalf("%s: range returned %s at position %d", codec, rec.Key, count)
+			}
+			count++
+		}
+		if count != 500 {
+			t.Errorf("%s: range returned %d records, want 500", codec, count)
+		}
+		if checked, err := VerifySSTable(w.dir, conf, nil); err != nil || checked != n {
+			t.Errorf("%s: VerifySSTable = %d, %v; want %d", codec, checked, err, n)
+		}
+		var out bytes.Buffer
+		if err := DumpSSTable(&out, w.dir, conf, nil); err != nil {
+			t.Fatalf("DumpSSTable failed: %v", err)
+		}
+		if codec != "mixed" && codec != config.CodecNone && !strings.Contains(out.String(), "codec "+codec+")") {
+			t.Errorf("dump of %s table does not show compressed blocks", codec)
+		}
+	}
+	for _, codec := range []string{config.CodecFlate, config.CodecZlib, config.CodecLZ} {
+		if sizes[codec] >= sizes[config.CodecNone]/2 {
+			t.Errorf("data with %s takes %d bytes, without compression %d", codec, sizes[codec], sizes[config.CodecNone])
+		}
+	}
+}
+
+func TestPrefixFilter(t *testing.T) {
+	for _, tc := range []struct {
+		extractor string
+		prefix    func(group int) string // Prefiks grupe kljuceva
+	}{
+		{config.ExtractorFixed, func(group int) string { return fmt.Sprintf("u%03d", group) }},
+		{config.ExtractorDelimiter, func(group int) string { return fmt.Sprintf("user%d:", group) }},
+	} {
+		conf := CreateConfig()
+		conf.SSTable.SstableDirectory = t.TempDir()
+		conf.SSTable.UseCompression = false
+		conf.SSTable.PrefixExtractor = tc.extractor
+		conf.SSTable.PrefixLength = 4
+		conf.SSTable.PrefixDelimiter = ":"
+		conf.SSTable.BitsPerKey = []float64{10}
+		cbm := &block_organization.CachedBlockManager{
+			BM: block_organization.NewBlockManager(conf),
+			C:  block_organization.NewBlockCache(conf),
+		}
+
+		// U SSTable-u su samo parne grupe, a neparne su izmedju prvog i poslednjeg kljuca
+		w, err := NewWriter(conf, 1, 1, 500, nil, cbm)
+		if err != nil {
+			t.Fatalf("NewWriter failed: %v", err)
+		}
+		keys := []string{}
+		for group := 0; group < 100; group += 2 {
+			for i := 0; i < 5; i++ {
+				keys = append(keys, fmt.Sprintf("%sitem%d", tc.prefix(group), i))
+			}
+		}
+		sort.Strings(keys)
+		for i, key := range keys {
+			if err := w.Add(adapter.MemtableEntry{Key: []byte(key), Value: []byte("v"), Seq: uint64(i + 1)}); err != nil {
+				t.Fatalf("Add failed: %v", err)
+			}
+		}
+		if err := w.Finish(); err != nil {
+			t.Fatalf("Finish failed: %v", err)
+		}
+
+		// Extractor se cita iz SSTable-a, ne iz konfiguracije
+		conf.SSTable.PrefixExtractor = config.ExtractorNone
+		table, err := StartSSTable(1, 1, conf, nil, cbm)
+		if err != nil {
+			t.Fatalf("StartSSTable failed: %v", err)
+		}
+		if table.PrefixFilter == nil {
+			t.Fatalf("%s: SSTable has no prefix filter", tc.extractor)
+		}
+		skipped := 0
+		for group := 0; group < 100; group++ {
+			prefix := tc.prefix(group)
+			may := table.MayContainPrefix([]byte(prefix))
+			if group%2 == 0 && !may {
+				t.Errorf("%s: prefix %q is in the table but was skipped", tc.extractor, prefix)
+			}
+			if group%2 == 1 && !may {
+				skipped++
+			}
+			count := 0
+			if iter := table.PrefixIterate(prefix, cbm); iter != nil {
+				for _, ok := iter.Next(); ok; _, ok = iter.Next() {
+					count++
+				}
+			}
+			if want := 5 * (1 - group%2); count != want {
+				t.Errorf("%s: prefix %q returned %d records, want %d", tc.extractor, prefix, count, want)
+			}
+		}
+		if skipped < 40 {
+			t.Errorf("%s: only %d of 50 missing prefixes were skipped", tc.extractor, skipped)
+		}
+		// Opseg kljuceva i kratki prefiksi (za koje filter ne vazi)
+		if table.MayContainPrefix([]byte("zzz")) || table.MayContainPrefix([]byte("a")) {
+			t.Errorf("%s: prefix outside the key range was not skipped", tc.extractor)
+		}
+		if !table.MayContainPrefix([]byte(keys[0][:1])) {
+			t.Errorf("%s: short prefix was skipped", tc.extractor)
+		}
+
+		var out bytes.Buffer
+		if err := DumpSSTable(&out, w.dir, conf, nil); err != nil {
+			t.Fatalf("DumpSSTable failed: %v", err)
+		}
+		if !strings.Contains(out.String(), "extractor "+tc.extractor+":") {
+			t.Errorf("%s: dump does not show prefix filter:\n%s", tc.extractor, out.String())
+		}
+	}
+}
+
+// writeLargeTable upisuje SSTable sa n kljuceva key%08d (samo parni brojevi) i otvara ga
+func writeLargeTable(tb testing.TB, conf *config.Config, n int) (*SSTable, *block_organization.CachedBlockManager) {
+	cbm := &block_organization.CachedBlockManager{
+		BM: block_organization.NewBlockManager(conf),
+		C:  block_organization.NewBlockCache(conf),
+	}
+	w, err := NewWriter(conf, 1, 1, n, nil, cbm)
+	if err != nil {
+		tb.Fatalf("NewWriter failed: %v", err)
+	}
+	for i := 0; i < n; i++ {
+		entry := adapter.MemtableEntry{Key: []byte(fmt.Sprintf("key%08d", 2*i)), Value: []byte(fmt.Sprintf("value%d", i)), Seq: uint64(i + 1)}
+		if err := w.Add(entry); err != nil {
+			tb.Fatalf("Add failed: %v", err)
+		}
+	}
+	if err := w.Finish(); err != nil {
+		tb.Fatalf("Finish failed: %v", err)
+	}
+	table, err := StartSSTable(1, 1, conf, nil, cbm)
+	if err != nil {
+		tb.Fatalf("StartSSTable failed: %v", err)
+	}
+	return table, cbm
+}
+
+// blockReads vraca broj blokova procitanih preko CachedBlockManager-a (iz kesa ili sa diska)
+func blockReads(cbm *block_organization.CachedBlockManager) uint64 {
+	hits, misses, _ := cbm.C.Stats()
+	return hits + misses
+}
+
+func TestSSTableGet(t *testing.T) {
+	const n = 5000
+	conf := CreateConfig()
+	conf.SSTable.SstableDirectory = t.TempDir()
+	conf.SSTable.UseCompression = false
+	conf.SSTable.SummaryLevel = 2
+	conf.Block.BlockSize = 512
+	table, cbm := writeLargeTable(t, conf, n)
+	if len(table.Summary.Records) < 10 {
+		t.Fatalf("table has only %d summary records", len(table.Summary.Records))
+	}
+
+	for i := 0; i < 2*n+2; i++ {
+		key := []byte(fmt.Sprintf("key%08d", i))
+		before := blockReads(cbm)
+		record, err := table.Get(conf, key, cbm)
+		if err != nil {
+			t.Fatalf("Get(%s) failed: %v", key, err)
+		}
+		if reads := blockReads(cbm) - before; reads > 2 {
+			t.Fatalf("Get(%s) read %d blocks, want at most 2", key, reads)
+		}
+		if i%2 == 1 || i == 2*n {
+			if record != nil {
+				t.Errorf("Get(%s) = %q, want nil", key, record.Key)
+			}
+			continue
+		}
+		if record == nil || !bytes.Equal(record.Key, key) || string(record.Value) != fmt.Sprintf("value%d", i/2) || record.Seq != uint64(i/2+1) {
+			t.Fatalf("Get(%s) = %+v", key, record)
+		}
+	}
+	for _, key := range []string{"a", "key", "key00000000a", "zzz"} {
+		if record, err := table.Get(conf, []byte(key), cbm); err != nil || record != nil {
+			t.Errorf("Get(%s) = %v, %v; want nil", key, record, err)
+		}
+	}
+
+	// Summary bez zapisa je ostecen, pa je to greska, a ne odsutan kljuc
+	table.Summary.Records = nil
+	if record, err := table.Get(conf, []byte("key00000000"), cbm); err == nil || record != nil {
+		t.Errorf("Get with an empty summary = %v, %v; want error", record, err)
+	}
+}
+
+// Broj procitanih blokova po Get-u na velikom SSTable-u: tacna pretraga (Summary -> Index blok -> Data blok)
+// i stara pretraga preko PrefixIterate, koja ne gleda Bloom filter, dekodira ostatak Data bloka i cita sledeci ako kljuca nema
+// Kod Get-a odsutni kljucevi uglavnom staju na Bloom filteru, blokove citaju samo lazni pogoci
+// go test -run ^$ -bench SSTableGet ./structures/sstable
+func BenchmarkSSTableGet(b *testing.B) {
+	const n = 200000
+	conf := CreateConfig()
+	conf.SSTable.SstableDirectory = b.TempDir()
+	conf.SSTable.UseCompression = false
+	conf.SSTable.SummaryLevel = 16
+	conf.Cache.Capacity = 16 // Mali kes, pa su skoro sva citanja sa diska
+	table, cbm := writeLargeTable(b, conf, n)
+
+	lookups := map[string]func(key []byte) (*DataRecord, error){
+		"get": func(key []byte) (*DataRecord, error) { return table.Get(conf, key, cbm) },
+		"seek": func(key []byte) (*DataRecord, error) {
+			iter := table.PrefixIterate(string(key), cbm)
+			if iter == nil {
+				return nil, nil
+			}
+			rec, ok := iter.Next()
+			if !ok || !bytes.Equal(rec.Key, key) {
+				return nil, nil
+			}
+			return &DataRecord{Key: rec.Key, Value: rec.Value}, nil
+		},
+	}
+	for _, name := range []string{"get", "seek"} {
+		for _, present := range []bool{true, false} {
+			b.Run(fmt.Sprintf("%s/present=%v", name, present), func(b *testing.B) {
+				lookup := lookups[name]
+				hits, misses, _ := cbm.C.Stats()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					k := 2 * (i * 7919 % n)
+					if !present {
+						k++
+					}
+					record, err := lookup([]byte(fmt.Sprintf("key%08d", k)))
+					if err != nil || (record != nil) != present {
+						b.Fatalf("lookup(key%08d) = %v, %v", k, record, err)
+					}
+				}
+				b.StopTimer()
+				h, m, _ := cbm.C.Stats()
+				b.ReportMetric(float64(h+m-hits-misses)/float64(b.N), "blocks/op")
+				b.ReportMetric(float64(m-misses)/float64(b.N), "disk-reads/op")
+			})
+		}
+	}
+}
+
+func TestProperties(t *testing.T) {
+	const n = 2000
+	conf := CreateConfig()
+	conf.SSTable.SstableDirectory = t.TempDir()
+	conf.SSTable.UseCompression = false
+	conf.Blob.ValueThreshold = 100
+	conf.Blob.Directory = t.TempDir()
+	cbm := &block_organization.CachedBlockManager{
+		BM: block_organization.NewBlockManager(conf),
+		C:  block_organization.NewBlockCache(conf),
+	}
+
+	w, err := NewWriter(conf, 2, 1, n, nil, cbm)
+	if err != nil {
+		t.Fatalf("NewWriter failed: %v", err)
+	}
+	sources := []Source{{Level: 1, Gen: 4}, {Level: 2, Gen: 7}}
+	w.SetOrigin(ReasonLeveled, sources)
+	want := Properties{Entries: n, MinTimestamp: 1000, MaxTimestamp: 1000 + n - 1, MaxSeq: n, Reason: ReasonLeveled, Sources: sources}
+	for i := 0; i < n; i++ {
+		entry := adapter.MemtableEntry{Key: []byte(fmt.Sprintf("key%05d", i)), Seq: uint64(i + 1), Timestamp: int64(1000 + i)}
+		switch {
+		case i%10 == 0:
+			entry.Tombstone = true
+			want.Tombstones++
+		case i%100 == 1:
+			entry.Value = bytes.Repeat([]byte{'x'}, 200) // Ide u blob fajl
+			want.BlobValues++
+			want.RawValueSize += 200
+		default:
+			entry.Value = []byte(fmt.Sprintf("value%d", i))
+			want.RawValueSize += int64(len(entry.Value))
+		}
+		want.RawKeySize += int64(len(entry.Key))
+		if err := w.Add(entry); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	if err := w.Finish(); err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+
+	table, err := StartSSTable(2, 1, conf, nil, cbm)
+	if err != nil {
+		t.Fatalf("StartSSTable failed: %v", err)
+	}
+	p := table.Properties
+	if p == nil {
+		t.Fatal("SSTable has no properties")
+	}
+	if time.Since(time.Unix(p.CreatedAt, 0)) > time.Minute {
+		t.Errorf("CreatedAt = %d", p.CreatedAt)
+	}
+	if p.DataSize != w.DataSize() || table.DiskSize <= p.DataSize {
+		t.Errorf("DataSize = %d, DiskSize = %d; writer wrote %d data bytes", p.DataSize, table.DiskSize, w.DataSize())
+	}
+	// Kljucevi nisu kodirani recnikom, a izdvojene vrednosti su u SSTable-u samo pokazivaci
+	if p.KeySize != want.RawKeySize || p.ValueSize <= 0 || p.ValueSize >= p.RawValueSize {
+		t.Errorf("KeySize = %d, ValueSize = %d; raw %d and %d", p.KeySize, p.ValueSize, p.RawKeySize, p.RawValueSize)
+	}
+	want.KeySize, want.ValueSize, want.DataSize, want.CreatedAt = p.KeySize, p.ValueSize, p.DataSize, p.CreatedAt
+	if fmt.Sprint(*p) != fmt.Sprint(want) {
+		t.Errorf("Properties = %+v\nwant %+v", *p, want)
+	}
+
+	encoded := p.Serialize()
+	for cut := 0; cut < len(encoded); cut++ {
+		if _, err := DecodeProperties(encoded[:cut]); err == nil {
+			t.Fatalf("DecodeProperties of %d/%d bytes succeeded", cut, len(encoded))
+		}
+	}
+
+	if size := table.ApproximateSize(nil, nil); size != p.DataSize {
+		t.Errorf("ApproximateSize of whole table = %d, want %d", size, p.DataSize)
+	}
+	half := table.ApproximateSize([]byte("key00000"), []byte("key00999"))
+	if half < p.DataSize/4 || half > 3*p.DataSize/4 {
+		t.Errorf("ApproximateSize of half the keys = %d of %d", half, p.DataSize)
+	}
+	if size := table.ApproximateSize([]byte("zzz"), nil); size != 0 {
+		t.Errorf("ApproximateSize after last key = %d, want 0", size)
+	}
+
+	var out bytes.Buffer
+	if err := DumpSSTable(&out, w.dir, conf, nil); err != nil {
+		t.Fatalf("DumpSSTable failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "by leveled from L1/4 L2/7") || !strings.Contains(out.String(), fmt.Sprintf("entries %d, tombstones %d", n, want.Tombstones)) {
+		t.Errorf("dump does not show properties:\n%s", out.String())
+	}
+}
@@ -2,19 +2,21 @@ package sstable
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
-	"strings"
+	"io"
 
 	"github.com/iigor000/database/config"
 	"github.com/iigor000/database/structures/block_organization"
 )
 
-// SummaryBlock struktura je skup IndexRecord-a
+// SummaryRecord opisuje jedan Index blok
 // FirstKey je ključ prvog zapisa u bloku
 type SummaryRecord struct {
 	FirstKey        []byte
 	IndexOffset     int // Offset u Index segmentu gde se nalazi ovaj blok
-	NumberOfRecords int
+	NumberOfRecords int // Broj zapisa u Data blokovima na koje pokazuje Index blok
 }
 
 type Summary struct {
@@ -24,179 +26,156 @@ type Summary struct {
 	SummaryFile File
 }
 
+// WriteSummary upisuje header i sve zapise Summary-ja jednim Append-om, pa zauzimaju samo onoliko blokova koliko je potrebno
 func (sb *Summary) WriteSummary(path string, conf *config.Config, cbm *block_organization.CachedBlockManager) error {
-	// Prvo upisujemo header
-	header, err := sb.SerializeHeader()
+	payload, err := sb.SerializeHeader()
 	if err != nil {
 		return fmt.Errorf("failed to serialize summary header: %w", err)
 	}
-	bn, err := cbm.AppendBlock(path, header)
-	if err != nil {
-		return fmt.Errorf("failed to write summary header: %w", err)
-	}
-	sb.SummaryFile.Path = path
-
-	sb.SummaryFile.Offset = int64(bn * conf.Block.BlockSize)
-
+	payload = binary.LittleEndian.AppendUint32(payload, uint32(len(sb.Records)))
 	for _, record := range sb.Records {
-		bn, err := record.WriteSummaryRecord(path, cbm)
+		serializedData, err := record.Serialize()
 		if err != nil {
-			return err
-		}
-
-		sb.SummaryFile.SizeOnDisk = int64(bn * conf.Block.BlockSize)
-	}
-	serializedData, _ := sb.Records[len(sb.Records)-1].Serialize()
-	for i := 1; i < 10001; i++ {
-		if len(serializedData) < i*conf.Block.BlockSize {
-			sb.SummaryFile.SizeOnDisk += int64(i * conf.Block.BlockSize)
-			break
+			return fmt.Errorf("failed to serialize summary record: %w", err)
 		}
+		payload = append(payload, serializedData...)
 	}
-	sb.SummaryFile.SizeOnDisk -= sb.SummaryFile.Offset
-	return nil
-}
-
-func (sr *SummaryRecord) WriteSummaryRecord(path string, bm *block_organization.CachedBlockManager) (int, error) {
-	serializedData, _ := sr.Serialize()
-	bn, err := bm.Append(path, serializedData)
+	bn, err := cbm.Append(path, payload)
 	if err != nil {
-		return -1, err
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
+	sb.SummaryFile = File{
+		Path:       path,
+		Offset:     int64(bn * conf.Block.BlockSize),
+		SizeOnDisk: int64(appendedBlocks(len(payload), conf.Block.BlockSize) * conf.Block.BlockSize),
 	}
-	return bn, nil
+	return nil
 }
 
+// Serialize upisuje duzinu kljuca (varint), kljuc, IndexOffset i NumberOfRecords (varint)
 func (sr *SummaryRecord) Serialize() ([]byte, error) {
-	serializedData := make([]byte, 0)
-
-	// Prvo upisujemo duzinu kljuca
-	serializedData = append(serializedData, byte(len(sr.FirstKey)))
+	serializedData := make([]byte, 0, 3*binary.MaxVarintLen64+len(sr.FirstKey))
+	serializedData = binary.AppendUvarint(serializedData, uint64(len(sr.FirstKey)))
 	serializedData = append(serializedData, sr.FirstKey...)
-
-	// Zatim upisujemo IndexOffset i NumberOfRecords
-	serializedData = append(serializedData, byte(sr.IndexOffset>>24), byte(sr.IndexOffset>>16), byte(sr.IndexOffset>>8), byte(sr.IndexOffset))
-	serializedData = append(serializedData, byte(sr.NumberOfRecords>>24), byte(sr.NumberOfRecords>>16), byte(sr.NumberOfRecords>>8), byte(sr.NumberOfRecords))
-
+	serializedData = binary.AppendUvarint(serializedData, uint64(sr.IndexOffset))
+	serializedData = binary.AppendUvarint(serializedData, uint64(sr.NumberOfRecords))
 	return serializedData, nil
 }
 
+// SerializeHeader upisuje prvi i poslednji kljuc, svaki sa duzinom (varint) ispred
 func (s *Summary) SerializeHeader() ([]byte, error) {
-	serializedData := make([]byte, 0)
-
-	// Prvo upisujemo duzinu FirstKey
-	serializedData = append(serializedData, byte(len(s.FirstKey)))
+	serializedData := make([]byte, 0, 2*binary.MaxVarintLen64+len(s.FirstKey)+len(s.LastKey))
+	serializedData = binary.AppendUvarint(serializedData, uint64(len(s.FirstKey)))
 	serializedData = append(serializedData, s.FirstKey...)
-
-	// Zatim upisujemo duzinu LastKey
-	serializedData = append(serializedData, byte(len(s.LastKey)))
+	serializedData = binary.AppendUvarint(serializedData, uint64(len(s.LastKey)))
 	serializedData = append(serializedData, s.LastKey...)
-
 	return serializedData, nil
 }
 
-func ReadSummary(path string, conf *config.Config, startOffset, endOffset int64, bm *block_organization.CachedBlockManager) (*Summary, error) {
-	block_num := int(startOffset / int64(conf.Block.BlockSize)) // Pocinjemo od bloka koji sadrzi startOffset
-	end_block := int(endOffset / int64(conf.Block.BlockSize))   // Kraj bloka koji sadrzi endOffset
-	if endOffset <= startOffset {
-		end_block = -1 // Kraj bloka koji sadrzi endOffset
+// readBytes cita niz bajtova sa duzinom (varint) ispred i vraca ga zajedno sa brojem procitanih bajtova
+func readBytes(data []byte) ([]byte, int, error) {
+	size, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, 0, fmt.Errorf("invalid length")
 	}
-	summary := &Summary{}
-	data, err := bm.ReadBlock(path, block_num)
+	if size > uint64(len(data)-n) {
+		return nil, 0, fmt.Errorf("length %d out of data (%d bytes left)", size, len(data)-n)
+	}
+	return data[n : n+int(size)], n + int(size), nil
+}
+
+// ReadSummary cita Summary koji pocinje na startOffset
+func ReadSummary(path string, conf *config.Config, startOffset, endOffset int64, bm *block_organization.CachedBlockManager) (*Summary, error) {
+	blockNum := int(startOffset / int64(conf.Block.BlockSize))
+	data, err := bm.Read(path, blockNum)
 	if err != nil {
-		if err.Error() == "EOF" {
+		if errors.Is(err, io.EOF) {
 			return nil, fmt.Errorf("summary file is empty: %w", err)
 		}
 		return nil, fmt.Errorf("error reading summary file: %w", err)
 	}
-
-	if err := summary.DeserializeHeader(data); err != nil {
-		return nil, fmt.Errorf("failed to deserialize summary header: %w", err)
-	}
-	block_num++
-	for {
-		block, err := bm.Read(path, block_num)
-		if err != nil {
-			if err.Error() == "EOF" || strings.Contains(err.Error(), "EOF") {
-				break // Kraj fajla
-			}
-			return nil, err
-		}
-
-		if len(block) == 0 {
-			break // Kraj fajla
-		}
-		block_num1 := block_num
-		i := 1
-		for {
-			if len(block)+(i*1) <= i*conf.Block.BlockSize {
-				block_num1 = i + block_num
-				break
-			}
-			i++
-		}
-		if end_block != -1 && block_num1 > end_block {
-			break // Dostigli smo kraj bloka koji nas zanima
-		}
-		sr := &SummaryRecord{}
-		err = sr.Deserialize(block)
-		if err != nil {
-			return nil, err
-		}
-		summary.Records = append(summary.Records, *sr)
-		block_num = block_num1
+	summary, err := decodeSummary(data)
+	if err != nil {
+		return nil, err
 	}
 	summary.SummaryFile = File{
 		Path:       path,
 		Offset:     startOffset,
-		SizeOnDisk: int64(block_num)*int64(conf.Block.BlockSize) - startOffset,
+		SizeOnDisk: int64(appendedBlocks(len(data), conf.Block.BlockSize) * conf.Block.BlockSize),
 	}
 	return summary, nil
 }
 
-func (sr *SummaryRecord) Deserialize(data []byte) error {
-	if len(data) < 10 {
-		return fmt.Errorf("data too short to deserialize SummaryRecord: %d bytes", len(data))
+// decodeSummary deserializuje header i zapise Summary-ja
+func decodeSummary(data []byte) (*Summary, error) {
+	summary := &Summary{}
+	n, err := summary.DeserializeHeader(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deserialize summary header: %w", err)
 	}
-
-	keyLen := int(data[0])
-	if len(data) < 1+keyLen+1 {
-		return fmt.Errorf("data too short to read key length and first key: %d bytes", len(data))
+	data = data[n:]
+	if len(data) < 4 {
+		return nil, fmt.Errorf("data too short to read number of summary records")
 	}
-	sr.FirstKey = data[1 : 1+keyLen]
-
-	offset := 1 + keyLen
-	if len(data) < offset+8 {
-		return fmt.Errorf("data too short to read index offset and number of records: %d bytes", len(data))
+	count := int(binary.LittleEndian.Uint32(data[:4]))
+	data = data[4:]
+	for i := 0; i < count; i++ {
+		sr := SummaryRecord{}
+		n, err := sr.Deserialize(data)
+		if err != nil {
+			return nil, fmt.Errorf("summary record %d: %w", i, err)
+		}
+		summary.Records = append(summary.Records, sr)
+		data = data[n:]
 	}
-	sr.IndexOffset = int(data[offset])<<24 | int(data[offset+1])<<16 | int(data[offset+2])<<8 | int(data[offset+3])
-	sr.NumberOfRecords = int(data[offset+4])<<24 | int(data[offset+5])<<16 | int(data[offset+6])<<8 | int(data[offset+7])
-
-	return nil
+	return summary, nil
 }
 
-func (s *Summary) DeserializeHeader(data []byte) error {
-	if len(data) < 2 {
-		return fmt.Errorf("data too short to deserialize Summary header: %d bytes", len(data))
+// Deserialize cita zapis sa pocetka data i vraca broj procitanih bajtova
+func (sr *SummaryRecord) Deserialize(data []byte) (int, error) {
+	key, n, err := readBytes(data)
+	if err != nil {
+		return 0, fmt.Errorf("first key: %w", err)
 	}
-
-	firstKeySize := int(data[0])
-	if len(data) < 1+firstKeySize+1 {
-		return fmt.Errorf("data too short to read first key size and first key: %d bytes", len(data))
+	sr.FirstKey = key
+	indexOffset, m := binary.Uvarint(data[n:])
+	if m <= 0 {
+		return 0, fmt.Errorf("invalid index offset")
 	}
-	s.FirstKey = data[1 : 1+firstKeySize]
-
-	lastKeySize := int(data[1+firstKeySize])
-	if len(data) < 1+firstKeySize+1+lastKeySize {
-		return fmt.Errorf("data too short to read last key size and last key: %d bytes", len(data))
+	n += m
+	numberOfRecords, m := binary.Uvarint(data[n:])
+	if m <= 0 {
+		return 0, fmt.Errorf("invalid number of records")
 	}
-	s.LastKey = data[1+firstKeySize+1 : 1+firstKeySize+1+lastKeySize]
+	sr.IndexOffset = int(indexOffset)
+	sr.NumberOfRecords = int(numberOfRecords)
+	return n + m, nil
+}
 
-	return nil
+// DeserializeHeader cita prvi i poslednji kljuc i vraca broj procitanih bajtova
+func (s *Summary) DeserializeHeader(data []byte) (int, error) {
+	firstKey, n, err := readBytes(data)
+	if err != nil {
+		return 0, fmt.Errorf("first key: %w", err)
+	}
+	lastKey, m, err := readBytes(data[n:])
+	if err != nil {
+		return 0, fmt.Errorf("last key: %w", err)
+	}
+	s.FirstKey = firstKey
+	s.LastKey = lastKey
+	return n + m, nil
 }
 
+// errNoSummaryRecord znaci da kljuca nema u SSTable-u, ostale greske iz FindSummaryRecordWithKey su ostecen Summary
+var errNoSummaryRecord = errors.New("no summary record found")
+
 // Pomocna funkcija za citanje SummaryRecord-a sa prefiksom
 // (Summary je vec ucitan iz fajla)
 func (s *Summary) FindSummaryRecordWithKey(key string) (SummaryRecord, error) {
+	if len(s.Records) == 0 {
+		return SummaryRecord{}, fmt.Errorf("summary has no records")
+	}
 	left, right := 0, len(s.Records)-1
 	resultIdx := -1
 
@@ -216,41 +195,43 @@ func (s *Summary) FindSummaryRecordWithKey(key string) (SummaryRecord, error) {
 		if bytes.HasPrefix(s.Records[0].FirstKey, []byte(key)) {
 			return s.Records[0], nil
 		}
-		return SummaryRecord{}, fmt.Errorf("no summary record found for key: %s", key)
+		return SummaryRecord{}, fmt.Errorf("%w for key: %s", errNoSummaryRecord, key)
 	}
 	return s.Records[resultIdx], nil
 }
 
 // ReadSummaryMinMax čita prvi i poslednji ključ iz Summary fajla
-// Konstruiše putanju do Summary/SSTable fajla na osnovu konfiguracije i nivoa/generacije
+// Polozaj Summary-ja se cita iz footer-a (ili kod verzije 1 iz offseta, odnosno TOC-a) SSTable-a sa nivoa level i generacije gen
 func ReadSummaryMinMax(level int, gen int, conf *config.Config, cbm *block_organization.CachedBlockManager) ([]byte, []byte, error) {
 	bm := block_organization.NewBlockManager(conf)
-	path := fmt.Sprintf("%s/%d/%d", conf.SSTable.SstableDirectory, level, gen)
-
-	var blockNum int
+	l, err := readLayout(fmt.Sprintf("%s/%d/%d", conf.SSTable.SstableDirectory, level, gen), gen, bm)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading sstable layout: %w", err)
+	}
 
-	if conf.SSTable.SingleFile {
-		path = CreateFileName(path, gen, "SSTable", "db")
-		offsets, err := ReadOffsetsFromFile(path, conf, cbm)
+	if l.version == FormatVersionLegacy {
+		// Zaglavlje Summary-ja starog formata je blok bez oznake lanca
+		data, err := bm.ReadBlock(l.sections["Summary"].Path, l.blockNumber("Summary", conf.Block.BlockSize))
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading summary file: %w", err)
+		}
+		summary, err := decodeLegacySummaryHeader(data)
 		if err != nil {
-			return nil, nil, fmt.Errorf("error reading offsets from file %s: %w", path, err)
+			return nil, nil, err
 		}
-		blockNum = int(offsets["Summary"] / int64(conf.Block.BlockSize))
-	} else {
-		path = CreateFileName(path, gen, "Summary", "db")
-		blockNum = 0
+		return summary.FirstKey, summary.LastKey, nil
 	}
 
-	data, err := bm.ReadBlock(path, blockNum)
+	data, err := bm.Read(l.sections["Summary"].Path, l.blockNumber("Summary", conf.Block.BlockSize))
 	if err != nil {
-		if err.Error() == "EOF" {
+		if errors.Is(err, io.EOF) {
 			return nil, nil, fmt.Errorf("summary file is empty: %w", err)
 		}
 		return nil, nil, fmt.Errorf("error reading summary file: %w", err)
 	}
 
 	summary := &Summary{}
-	if err := summary.DeserializeHeader(data); err != nil {
+	if _, err := summary.DeserializeHeader(data); err != nil {
 		return nil, nil, fmt.Errorf("failed to deserialize summary header: %w", err)
 	}
 
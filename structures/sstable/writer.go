@@ -0,0 +1,405 @@
+package sstable
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/iigor000/database/config"
+	"github.com/iigor000/database/structures/adapter"
+	"github.com/iigor000/database/structures/blob"
+	"github.com/iigor000/database/structures/block_organization"
+	"github.com/iigor000/database/structures/bloomfilter"
+	"github.com/iigor000/database/structures/compression"
+	"github.com/iigor000/database/structures/merkle"
+)
+
+// Writer upisuje SSTable zapis po zapis, zapisi moraju stizati sortirani po kljucu
+// Zapisi se slazu u Data blokove, a svaki pun Data blok se odmah upisuje i dobija zapis u Index bloku
+// U memoriji ostaju samo blokovi koji se pune, Summary, hash-evi kljuceva za Bloom filter i hash-evi za Merkle stablo
+// Hash-evi rastu sa brojem zapisa: 8 B za Bloom filter (keyHashes) i 32 B za list Merkle stabla (leaves),
+// oko 40 B po zapisu, tj. oko 40 MB za milion zapisa. Broj zapisa jednog SSTable-a ogranicava Memtable pri flush-u,
+// a TargetSSTableSize pri kompakciji
+type Writer struct {
+	conf           *config.Config
+	cbm            *block_organization.CachedBlockManager
+	dict           *compression.Dictionary // nil ako se ne koristi kompresija
+	useCompression bool
+	level          int
+	gen            int
+	dir            string
+	dataPath       string
+	indexPath      string // Kod SingleFile je to privremeni fajl, prepisuje se iza Data dela u Finish
+
+	firstDataBlock int
+	nextDataBlock  int // Blok iza poslednjeg upisanog Data bloka
+	nextIndexBlock int // Blok iza poslednjeg upisanog Index bloka
+	count          int
+	summary        Summary
+	keyHashes      []uint64 // Hash-evi kljuceva za Bloom filter, on se pravi u Finish kad je poznat broj kljuceva
+	leaves         []merkle.HashValue
+	lastKey        []byte
+
+	// Extractor prefiksa i hash-evi razlicitih prefiksa za prefiksni Bloom filter (nil ako nije ukljucen)
+	prefixes     *PrefixExtractor
+	prefixHashes []uint64
+	lastPrefix   []byte
+
+	codec         compression.Codec // Kodek Data blokova, po nivou
+	ratio         float64           // Odnos kompresovane i nekompresovane velicine poslednjeg Data bloka
+	data          *blockBuilder     // Data blok koji se puni
+	dataFirstKey  []byte
+	index         *blockBuilder // Index blok koji se puni
+	indexFirstKey []byte
+	indexRecords  int // Broj zapisa u Data blokovima na koje pokazuje Index blok koji se puni
+
+	// Blob fajl za velike vrednosti, pravi se tek kad stigne prva vrednost veca od praga
+	blobs *blob.Writer
+
+	props Properties // Statistika koja se upisuje u Properties deo
+}
+
+// NewWriter pravi direktorijum SSTable-a i priprema fajlove za upis
+// expectedEntries je procena broja zapisa, Bloom filter se pravi tek u Finish prema stvarnom broju kljuceva
+func NewWriter(conf *config.Config, level, gen, expectedEntries int, dict *compression.Dictionary, cbm *block_organization.CachedBlockManager) (*Writer, error) {
+	codec, err := compression.CodecByName(conf.SSTable.BlockCodec(level))
+	if err != nil {
+		return nil, fmt.Errorf("error creating SSTable writer: %w", err)
+	}
+	w := &Writer{
+		conf:           conf,
+		codec:          codec,
+		ratio:          1,
+		cbm:            cbm,
+		useCompression: conf.SSTable.UseCompression && dict != nil && !dict.IsEmpty(),
+		level:          level,
+		gen:            gen,
+		dir:            fmt.Sprintf("%s/%d/%d", conf.SSTable.SstableDirectory, level, gen),
+		data:           newBlockBuilder(conf.SSTable.RestartInterval),
+		index:          newBlockBuilder(conf.SSTable.RestartInterval),
+	}
+	if w.useCompression {
+		w.dict = dict
+	}
+	if expectedEntries < 1 {
+		expectedEntries = 1
+	}
+	w.keyHashes = make([]uint64, 0, expectedEntries)
+	w.prefixes = NewPrefixExtractor(&conf.SSTable)
+	w.props.Reason = ReasonFlush
+
+	if err := CreateDirectoryIfNotExists(w.dir); err != nil {
+		return nil, fmt.Errorf("error creating directory for SSTable: %w", err)
+	}
+	if conf.SSTable.SingleFile {
+		w.dataPath = CreateFileName(w.dir, gen, "SSTable", "db")
+		w.indexPath = CreateFileName(w.dir, gen, "Index", "tmp")
+		os.Remove(w.indexPath) // Ostatak prekinutog upisa
+	} else {
+		w.dataPath = CreateFileName(w.dir, gen, "Data", "db")
+		w.indexPath = CreateFileName(w.dir, gen, "Index", "db")
+	}
+	return w, nil
+}
+
+// Add dodaje zapis u Data blok koji se puni, a ako zapis ne staje u blok, blok se prvo upisuje
+func (w *Writer) Add(entry adapter.MemtableEntry) error {
+	dr := NewDataRecord(entry.Key, entry.Value, entry.Seq, entry.Timestamp, entry.Tombstone)
+	dr.Blob = entry.Blob && !entry.Tombstone
+	rawValue := len(dr.Value)
+	if p, err := blob.DecodePointer(dr.Value); dr.Blob && err == nil {
+		rawValue = int(p.Size)
+	}
+	if err := w.separateValue(&dr); err != nil {
+		return err
+	}
+	key, err := encodeKey(dr.Key, w.dict)
+	if err != nil {
+		return fmt.Errorf("error encoding key %q: %w", dr.Key, err)
+	}
+	w.props.add(&dr, key, rawValue)
+	value := dr.encodeValue()
+	// Sa kompresijom blok se puni dok procenjena kompresovana velicina staje u jedan blok na disku
+	if !w.data.empty() && int(float64(w.data.sizeWith(key, value))*w.ratio) > w.blockCapacity() {
+		if err := w.flushDataBlock(); err != nil {
+			return err
+		}
+	}
+	if w.data.empty() {
+		w.dataFirstKey = append(w.dataFirstKey[:0], dr.Key...)
+	}
+	w.data.add(key, value)
+
+	if w.count == 0 {
+		w.summary.FirstKey = append([]byte(nil), dr.Key...)
+	}
+	w.lastKey = append(w.lastKey[:0], dr.Key...)
+
+	w.keyHashes = append(w.keyHashes, bloomfilter.Hash(dr.Key))
+	if w.prefixes != nil {
+		// Kljucevi su sortirani, pa su isti prefiksi jedan do drugog
+		if p, ok := w.prefixes.Extract(dr.Key); ok && (len(w.prefixHashes) == 0 || !bytes.Equal(p, w.lastPrefix)) {
+			w.prefixHashes = append(w.prefixHashes, bloomfilter.Hash(p))
+			w.lastPrefix = append(w.lastPrefix[:0], p...)
+		}
+	}
+	leaf := append([]byte(nil), dr.Key...)
+	if !dr.Tombstone {
+		leaf = append(leaf, dr.Value...)
+	}
+	w.leaves = append(w.leaves, merkle.HashLeaf(leaf))
+	w.count++
+	return nil
+}
+
+// separateValue upisuje vrednost vecu od praga u blob fajl, a u zapisu je zamenjuje pokazivacem
+// Vrednost koja je vec u blob fajlu (npr. pri kompakciji) ostaje gde jeste, prepisuje se samo pokazivac
+func (w *Writer) separateValue(dr *DataRecord) error {
+	threshold := w.conf.Blob.ValueThreshold
+	if dr.Tombstone || dr.Blob || threshold <= 0 || len(dr.Value) < threshold {
+		return nil
+	}
+	if w.blobs == nil {
+		blobs, err := blob.NewWriter(w.conf.Blob.Directory)
+		if err != nil {
+			return err
+		}
+		w.blobs = blobs
+	}
+	p, err := w.blobs.Append(dr.Key, dr.Value)
+	if err != nil {
+		return err
+	}
+	dr.Value = p.Encode()
+	dr.Blob = true
+	return nil
+}
+
+// Najmanji odnos kompresije koji se uzima u obzir pri punjenju Data bloka, da nekompresovan blok ne bi bio prevelik
+const minCompressionRatio = 0.1
+
+// blockCapacity vraca broj bajtova koji staje u jedan blok na disku (prvi bajt bloka je oznaka BlockManager-a)
+func (w *Writer) blockCapacity() int {
+	return w.conf.Block.BlockSize - 1
+}
+
+// flushDataBlock upisuje Data blok koji se puni i dodaje zapis za njega u Index blok
+func (w *Writer) flushDataBlock() error {
+	raw := w.data.size()
+	payload, err := w.data.finish(w.codec)
+	if err != nil {
+		return err
+	}
+	bn, err := w.cbm.Append(w.dataPath, payload)
+	if err != nil {
+		return fmt.Errorf("error writing data block to file %s: %w", w.dataPath, err)
+	}
+	w.ratio = math.Min(1, math.Max(minCompressionRatio, float64(len(payload))/float64(raw)))
+	w.nextDataBlock = bn + appendedBlocks(len(payload), w.conf.Block.BlockSize)
+
+	ir := NewIndexRecord(w.dataFirstKey, bn*w.conf.Block.BlockSize)
+	value := ir.encodeValue()
+	// Index blok se zatvara kad se popuni ili kad dostigne SummaryLevel zapisa, jedan zapis Summary-ja pokriva jedan Index blok
+	full := w.conf.SSTable.SummaryLevel > 0 && w.index.entries >= w.conf.SSTable.SummaryLevel
+	if !w.index.empty() && (full || w.index.sizeWith(ir.Key, value) > w.blockCapacity()) {
+		if err := w.flushIndexBlock(); err != nil {
+			return err
+		}
+	}
+	if w.index.empty() {
+		w.indexFirstKey = append(w.indexFirstKey[:0], ir.Key...)
+	}
+	w.index.add(ir.Key, value)
+	w.indexRecords += w.data.entries
+	w.data.reset()
+	return nil
+}
+
+// flushIndexBlock upisuje Index blok koji se puni i dodaje zapis za njega u Summary
+func (w *Writer) flushIndexBlock() error {
+	payload, err := w.index.finish(nil)
+	if err != nil {
+		return err
+	}
+	ibn, err := w.cbm.Append(w.indexPath, payload)
+	if err != nil {
+		return fmt.Errorf("error writing index block to file %s: %w", w.indexPath, err)
+	}
+	w.nextIndexBlock = ibn + appendedBlocks(len(payload), w.conf.Block.BlockSize)
+	w.summary.Records = append(w.summary.Records, SummaryRecord{
+		FirstKey:        append([]byte(nil), w.indexFirstKey...),
+		IndexOffset:     ibn * w.conf.Block.BlockSize,
+		NumberOfRecords: w.indexRecords,
+	})
+	w.index.reset()
+	w.indexRecords = 0
+	return nil
+}
+
+// SetOrigin upisuje u Properties zasto je SSTable napravljen i od kojih SSTable-ova (kod kompakcije)
+func (w *Writer) SetOrigin(reason string, sources []Source) {
+	w.props.Reason = reason
+	w.props.Sources = append([]Source(nil), sources...)
+}
+
+// Count vraca broj upisanih zapisa
+func (w *Writer) Count() int {
+	return w.count
+}
+
+// DataSize vraca velicinu Data dela na disku u bajtovima, zajedno sa blokom koji se puni
+func (w *Writer) DataSize() int64 {
+	blocks := w.nextDataBlock - w.firstDataBlock
+	if !w.data.empty() {
+		blocks += appendedBlocks(int(float64(w.data.size())*w.ratio), w.conf.Block.BlockSize)
+	}
+	return int64(blocks) * int64(w.conf.Block.BlockSize)
+}
+
+// Finish upisuje Summary, Bloom filter, Merkle stablo, Properties i na kraju footer sa polozajem svih delova
+// Kod SSTable-a u vise fajlova footer je poslednji blok Data fajla, a pored njega se upisuje i TOC
+func (w *Writer) Finish() error {
+	if w.count == 0 {
+		return fmt.Errorf("no entries to write")
+	}
+	// Blob fajl mora biti na disku pre SSTable-a koji pokazuje na njega
+	if w.blobs != nil {
+		if err := w.blobs.Close(); err != nil {
+			return err
+		}
+	}
+	if err := w.flushDataBlock(); err != nil {
+		return err
+	}
+	if err := w.flushIndexBlock(); err != nil {
+		return err
+	}
+	w.summary.LastKey = append([]byte(nil), w.lastKey...)
+	metadata, err := merkle.NewMerkleTreeFromHashes(w.leaves).Serialize()
+	if err != nil {
+		return fmt.Errorf("error serializing metadata: %w", err)
+	}
+
+	bs := int64(w.conf.Block.BlockSize)
+	footer := Footer{Version: FormatVersion}
+	if w.useCompression {
+		footer.Flags |= footerFlagCompression
+	}
+	footer.Sections[0] = Handle{Offset: int64(w.firstDataBlock) * bs, Length: int64(w.nextDataBlock-w.firstDataBlock) * bs}
+	footer.Sections[1] = Handle{Offset: 0, Length: int64(w.nextIndexBlock) * bs}
+	summaryPath := CreateFileName(w.dir, w.gen, "Summary", "db")
+	filterPath := CreateFileName(w.dir, w.gen, "Filter", "db")
+	metadataPath := CreateFileName(w.dir, w.gen, "Metadata", "db")
+	propertiesPath := CreateFileName(w.dir, w.gen, "Properties", "db")
+
+	if w.conf.SSTable.SingleFile {
+		// Index je upisan u privremeni fajl, prepisujemo ga blok po blok iza Data dela
+		indexBlock := w.nextDataBlock
+		if err := w.copyIndex(); err != nil {
+			return err
+		}
+		for i := range w.summary.Records {
+			w.summary.Records[i].IndexOffset += indexBlock * w.conf.Block.BlockSize
+		}
+		footer.Sections[1].Offset = int64(indexBlock) * bs
+		summaryPath, filterPath, metadataPath, propertiesPath = w.dataPath, w.dataPath, w.dataPath, w.dataPath
+	}
+
+	if err := w.summary.WriteSummary(summaryPath, w.conf, w.cbm); err != nil {
+		return err
+	}
+	footer.Sections[2] = Handle{Offset: w.summary.SummaryFile.Offset, Length: w.summary.SummaryFile.SizeOnDisk}
+	if footer.Sections[3], err = w.appendSection(filterPath, w.filters()); err != nil {
+		return fmt.Errorf("error writing bloom filter to file: %w", err)
+	}
+	if footer.Sections[4], err = w.appendSection(metadataPath, metadata); err != nil {
+		return fmt.Errorf("error writing metadata to file: %w", err)
+	}
+	w.props.DataSize = footer.Sections[0].Length
+	w.props.CreatedAt = time.Now().Unix()
+	if footer.Sections[5], err = w.appendSection(propertiesPath, w.props.Serialize()); err != nil {
+		return fmt.Errorf("error writing properties to file: %w", err)
+	}
+	if _, err := w.cbm.Append(w.dataPath, footer.Serialize()); err != nil {
+		return fmt.Errorf("error writing footer to file %s: %w", w.dataPath, err)
+	}
+	if !w.conf.SSTable.SingleFile {
+		return writeTOC(w.dir, w.gen)
+	}
+	return nil
+}
+
+// filters pravi Bloom filter kljuceva i prefiksni filter (ako je ukljucen) i vraca ih serijalizovane za Filter deo
+func (w *Writer) filters() []byte {
+	bitsPerKey := w.conf.SSTable.BloomBitsPerKey(w.level)
+	blocked := w.conf.SSTable.BloomFilter == config.BloomBlocked
+	filter := bloomfilter.NewBloomFilter(len(w.keyHashes), bitsPerKey, blocked)
+	for _, h := range w.keyHashes {
+		filter.AddHash(h)
+	}
+	payload := filter.Serialize()
+	if w.prefixes == nil {
+		return payload
+	}
+	prefixFilter := bloomfilter.NewBloomFilter(len(w.prefixHashes), bitsPerKey, blocked)
+	for _, h := range w.prefixHashes {
+		prefixFilter.AddHash(h)
+	}
+	return append(payload, encodePrefixFilter(w.prefixes, &prefixFilter)...)
+}
+
+// appendSection dodaje deo SSTable-a na kraj fajla i vraca njegov polozaj
+func (w *Writer) appendSection(path string, payload []byte) (Handle, error) {
+	bn, err := w.cbm.Append(path, payload)
+	if err != nil {
+		return Handle{}, err
+	}
+	bs := w.conf.Block.BlockSize
+	return Handle{Offset: int64(bn * bs), Length: int64(appendedBlocks(len(payload), bs) * bs)}, nil
+}
+
+// copyIndex dodaje blokove privremenog fajla sa indeksom na kraj SSTable fajla i brise privremeni fajl
+func (w *Writer) copyIndex() error {
+	info, err := os.Stat(w.indexPath)
+	if err != nil {
+		return fmt.Errorf("error reading index: %w", err)
+	}
+	blocks := int(info.Size() / int64(w.conf.Block.BlockSize))
+	for i := 0; i < blocks; i++ {
+		block, err := w.cbm.BM.ReadBlock(w.indexPath, i)
+		if err != nil {
+			return fmt.Errorf("error reading index block %d: %w", i, err)
+		}
+		if _, err := w.cbm.BM.AppendBlock(w.dataPath, block); err != nil {
+			return fmt.Errorf("error writing index block %d: %w", i, err)
+		}
+	}
+	if err := os.Remove(w.indexPath); err != nil {
+		return fmt.Errorf("error removing temporary index: %w", err)
+	}
+	return nil
+}
+
+// appendedBlocks vraca broj blokova koje BlockManager.Append zauzme za podatke velicine size
+// (i broj blokova koje BlockManager.Read procita za njih, jer svaki blok nosi blockSize-1 bajtova)
+func appendedBlocks(size, blockSize int) int {
+	if size <= blockSize-1 {
+		return 1
+	}
+	return (size + blockSize - 2) / (blockSize - 1)
+}
+
+// writeTOC upisuje TOC fajl SSTable-a koji nije u jednom fajlu
+// TOC je samo spisak fajlova za citanje, polozaj delova i kompresija se citaju iz footer-a
+func writeTOC(dir string, gen int) error {
+	tocData := fmt.Sprintf("Generation: %d\nVersion: %d\nData: %s\nIndex: %s\nSummary: %s\nFilter: %s\nMetadata: %s\nProperties: %s\n",
+		gen, FormatVersion, CreateFileName(dir, gen, "Data", "db"),
+		CreateFileName(dir, gen, "Index", "db"),
+		CreateFileName(dir, gen, "Summary", "db"),
+		CreateFileName(dir, gen, "Filter", "db"),
+		CreateFileName(dir, gen, "Metadata", "db"),
+		CreateFileName(dir, gen, "Properties", "db"))
+	return WriteTxtToFile(CreateFileName(dir, gen, "TOC", "txt"), tocData)
+}
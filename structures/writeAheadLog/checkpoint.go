@@ -0,0 +1,120 @@
+package writeaheadlog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+)
+
+// Ime fajla sa checkpoint-om u direktorijumu WAL-a
+const checkpointFileName = "CHECKPOINT"
+
+// Position je mesto u WAL-u: redni broj segmenta i pozicija (u bajtovima) u njemu
+// Segment 0 znaci da pozicija nije postavljena, segmenti se broje od 1
+type Position struct {
+	Segment int
+	Offset  int64
+}
+
+// Before vraca true ako je p pre q u WAL-u
+func (p Position) Before(q Position) bool {
+	return p.Segment < q.Segment || (p.Segment == q.Segment && p.Offset < q.Offset)
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("segment %d offset %d", p.Segment, p.Offset)
+}
+
+// Position vraca poziciju iza poslednjeg upisanog zapisa, tu ce poceti sledeci zapis
+// (ili na pocetku novog segmenta, ako ne stane u aktivni)
+func (w *WAL) Position() Position {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return Position{Segment: w.activeSegment.segmentNumber, Offset: w.activeSegment.size}
+}
+
+// CheckpointPosition vraca poslednji trajno upisan checkpoint (Segment 0 ako ga nema)
+func (w *WAL) CheckpointPosition() Position {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.checkpoint
+}
+
+// Checkpoint trajno belezi da su svi zapisi pre pozicije pos upisani u SSTable-ove
+// Posle toga brise segmente koje checkpoint u potpunosti pokriva, a oporavak cita WAL tek od pos
+// Poziva se tek kad je flush trajan (SSTable sinhronizovan na disk)
+func (w *WAL) Checkpoint(pos Position) error {
+	w.mu.Lock()
+	if pos.Before(w.checkpoint) {
+		w.mu.Unlock()
+		return fmt.Errorf("checkpoint %s is before the current checkpoint %s", pos, w.checkpoint)
+	}
+	w.mu.Unlock()
+
+	if err := writeCheckpoint(w.config.Wal.WalDirectory, pos); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.checkpoint = pos
+	w.mu.Unlock()
+	// Segment u kome je checkpoint moze imati zapise iza njega, brisu se samo raniji
+	return w.RemoveSegmentsUpTo(pos.Segment - 1)
+}
+
+// writeCheckpoint upisuje checkpoint u privremeni fajl, sinhronizuje ga i preimenuje, pa je izmena atomicna
+// Format: Segment (8) + Offset (8) + CRC (4) nad prethodnih 16 bajtova
+func writeCheckpoint(dir string, pos Position) error {
+	data := make([]byte, 20)
+	binary.BigEndian.PutUint64(data[0:8], uint64(pos.Segment))
+	binary.BigEndian.PutUint64(data[8:16], uint64(pos.Offset))
+	binary.BigEndian.PutUint32(data[16:20], crc32.ChecksumIEEE(data[:16]))
+
+	path := filepath.Join(dir, checkpointFileName)
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("error creating checkpoint: %v", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing checkpoint: %v", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("error syncing checkpoint: %v", err)
+	}
+	file.Close()
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error renaming checkpoint: %v", err)
+	}
+	// Sinhronizujemo i direktorijum, da bi preimenovanje bilo trajno
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("error syncing wal directory: %v", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("error syncing wal directory: %v", err)
+	}
+	return nil
+}
+
+// readCheckpoint cita checkpoint iz direktorijuma WAL-a, bez fajla vraca nultu poziciju (citanje od pocetka)
+func readCheckpoint(dir string) (Position, error) {
+	data, err := os.ReadFile(filepath.Join(dir, checkpointFileName))
+	if os.IsNotExist(err) {
+		return Position{}, nil
+	}
+	if err != nil {
+		return Position{}, fmt.Errorf("error reading checkpoint: %v", err)
+	}
+	if len(data) != 20 || crc32.ChecksumIEEE(data[:16]) != binary.BigEndian.Uint32(data[16:20]) {
+		return Position{}, fmt.Errorf("checkpoint file is corrupted")
+	}
+	return Position{
+		Segment: int(binary.BigEndian.Uint64(data[0:8])),
+		Offset:  int64(binary.BigEndian.Uint64(data[8:16])),
+	}, nil
+}
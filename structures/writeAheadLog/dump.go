@@ -0,0 +1,341 @@
+package writeaheadlog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/iigor000/database/config"
+)
+
+// Velicina zaglavlja zapisa: CRC (4) + Timestamp (8) + Seq (8) + Type (1) + Tombstone (1) + KeySize (8) + ValueSize (8)
+const recordHeaderSize = 38
+
+// RecordInfo opisuje jedan zapis pronadjen pri skeniranju segmenta
+type RecordInfo struct {
+	Offset    int64 // Pozicija prvog fragmenta u segmentu
+	Size      int64 // Broj bajtova koje zauzimaju svi fragmenti zapisa (sa zaglavljima i popunom)
+	Fragments int
+	Timestamp int64
+	Seq       uint64
+	Tombstone bool
+	KeySize   uint64
+	ValueSize uint64
+	CRCOk     bool // CRC kljuca i vrednosti, CRC svakog fragmenta je vec proveren
+}
+
+// DroppedRange je deo segmenta koji je odbacen pri skeniranju, bajtovi [Start, End)
+type DroppedRange struct {
+	Path   string
+	Start  int64
+	End    int64
+	Reason error
+}
+
+func (d DroppedRange) String() string {
+	return fmt.Sprintf("%s bytes %d-%d (%d bytes): %v", d.Path, d.Start, d.End, d.End-d.Start, d.Reason)
+}
+
+// SegmentInfo je pregled jednog segmenta posle skeniranja
+type SegmentInfo struct {
+	Path         string
+	Number       int
+	Format       int   // SegmentFormatFragments ili SegmentFormatLegacy
+	FileBytes    int64 // Velicina fajla
+	Records      int   // Broj ispravnih zapisa
+	PayloadBytes int64 // Ukupna velicina serijalizovanih zapisa (bez zaglavlja fragmenata)
+	// ValidBytes je kraj poslednjeg ispravnog zapisa, na tu velicinu se segment skracuje pri popravci
+	ValidBytes int64
+	Corruption error          // Prvi osteceni ili nepotpun zapis, nil ako je segment ispravan
+	Dropped    []DroppedRange // Odbaceni delovi segmenta, samo kad se osteceni zapisi preskacu
+}
+
+// ScanSegment prolazi kroz sve zapise segmenta i za svaki poziva fn (ako nije nil)
+// Skeniranje staje na prvom ostecenom ili nepotpunom zapisu, koji se upisuje u SegmentInfo.Corruption
+// Segment nepoznatog formata je greska
+func ScanSegment(path string, cfg *config.Config, fn func(RecordInfo)) (*SegmentInfo, error) {
+	return scanSegment(path, cfg.Block.BlockSize, false, func(info RecordInfo, _ *WALRecord) {
+		if fn != nil {
+			fn(info)
+		}
+	})
+}
+
+// scanSegment cita fragmente segmenta, spaja ih u zapise i za svaki ispravan zapis poziva fn
+// Ako je skip false, staje na prvom ostecenju. Ako je true, osteceni deo se odbacuje (i upisuje u Dropped),
+// a citanje se nastavlja od sledeceg bloka, kao u LevelDB-u: fragmenti ne prelaze granicu bloka, pa tu moze da pocne novi zapis
+func scanSegment(path string, blockSize int, skip bool, fn func(RecordInfo, *WALRecord)) (*SegmentInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading segment %s: %v", path, err)
+	}
+	format, err := segmentFormat(path, data, blockSize)
+	if err != nil {
+		return nil, err
+	}
+	info := &SegmentInfo{Path: path, Format: format, FileBytes: int64(len(data))}
+	fmt.Sscanf(filepath.Base(path), "wal_%d.log", &info.Number)
+	if format == SegmentFormatLegacy {
+		scanLegacySegment(info, data, blockSize, skip, fn)
+		return info, nil
+	}
+
+	var buf []byte           // Podaci zapisa koji se sklapa iz fragmenata
+	recordStart := int64(-1) // Pozicija prvog fragmenta zapisa koji se sklapa
+	fragments := 0
+	// Fragmenti pocinju iza zaglavlja segmenta, a segment sa nepotpunim zaglavljem nema zapisa
+	pos := int64(segmentHeaderSize)
+	info.ValidBytes = pos
+	if pos > info.FileBytes {
+		pos, info.ValidBytes = info.FileBytes, info.FileBytes
+	}
+
+	// drop belezi ostecenje, vraca false ako skeniranje treba da stane
+	drop := func(start, end int64, reason error) bool {
+		if info.Corruption == nil {
+			info.Corruption = reason
+		}
+		if !skip {
+			return false
+		}
+		if n := len(info.Dropped); n > 0 && info.Dropped[n-1].End >= start {
+			info.Dropped[n-1].End = end // Spajamo susedne odbacene delove
+		} else {
+			info.Dropped = append(info.Dropped, DroppedRange{Path: path, Start: start, End: end, Reason: reason})
+		}
+		recordStart = -1
+		return true
+	}
+
+	for {
+		frag, next, ok, err := readFragment(data, pos, blockSize)
+		if err != nil {
+			// Ostatak bloka ne moze da se procita, odbacujemo i nezavrsen zapis
+			// next je pozicija neispravnog fragmenta (posle eventualne popune na kraju prethodnog bloka)
+			start := next
+			if recordStart != -1 {
+				start = recordStart
+			}
+			end := (next/int64(blockSize) + 1) * int64(blockSize)
+			if end > int64(len(data)) {
+				end = int64(len(data))
+			}
+			if !drop(start, end, err) {
+				break
+			}
+			pos = end
+			continue
+		}
+		if !ok {
+			break
+		}
+		switch frag.Type {
+		case FULL, FIRST:
+			if recordStart != -1 && !drop(recordStart, frag.Offset, fmt.Errorf("offset %d: %s fragment inside record started at offset %d", frag.Offset, frag.Type, recordStart)) {
+				return info, nil
+			}
+			recordStart, fragments = frag.Offset, 0
+			buf = buf[:0]
+		case MIDDLE, LAST:
+			if recordStart == -1 {
+				if !drop(frag.Offset, next, fmt.Errorf("offset %d: orphaned %s fragment", frag.Offset, frag.Type)) {
+					return info, nil
+				}
+				pos = next
+				continue
+			}
+		}
+		buf = append(buf, frag.Data...)
+		fragments++
+		pos = next
+		if frag.Type == FIRST || frag.Type == MIDDLE {
+			continue
+		}
+
+		rec, crc, key, value, err := parseRecord(buf)
+		if err != nil {
+			if !drop(recordStart, next, fmt.Errorf("offset %d: %v", recordStart, err)) {
+				break
+			}
+			continue
+		}
+		rec.Offset, rec.Size, rec.Fragments = recordStart, next-recordStart, fragments
+		rec.CRCOk = crc32.Update(crc32.ChecksumIEEE(key), crc32.IEEETable, value) == crc
+		if !rec.CRCOk {
+			if !skip && fn != nil {
+				fn(rec, nil) // Ispis ostecenog zapisa u dump-u
+			}
+			if !drop(recordStart, next, fmt.Errorf("offset %d: record CRC mismatch", recordStart)) {
+				break
+			}
+			continue
+		}
+		if fn != nil {
+			fn(rec, &WALRecord{
+				CRC:       crc,
+				Timestamp: rec.Timestamp,
+				Seq:       rec.Seq,
+				Type:      FULL,
+				Tombstone: rec.Tombstone,
+				KeySize:   rec.KeySize,
+				ValueSize: rec.ValueSize,
+				Key:       append([]byte{}, key...),
+				Value:     append([]byte{}, value...),
+			})
+		}
+		info.Records++
+		info.PayloadBytes += int64(len(buf))
+		info.ValidBytes = next
+		recordStart = -1
+	}
+
+	if recordStart != -1 && (info.Corruption == nil || skip) {
+		drop(recordStart, int64(len(data)), fmt.Errorf("offset %d: record is not finished", recordStart))
+	}
+	return info, nil
+}
+
+// parseRecord cita zaglavlje, kljuc i vrednost iz podataka jednog zapisa sklopljenog iz fragmenata
+// Vraca opis zapisa, upisani CRC, kljuc i vrednost
+func parseRecord(data []byte) (RecordInfo, uint32, []byte, []byte, error) {
+	rec := RecordInfo{}
+	if len(data) < recordHeaderSize {
+		return rec, 0, nil, nil, fmt.Errorf("record header too short: %d bytes", len(data))
+	}
+	crc := binary.BigEndian.Uint32(data[0:4])
+	rec.Timestamp = int64(binary.BigEndian.Uint64(data[4:12]))
+	rec.Seq = binary.BigEndian.Uint64(data[12:20])
+	rec.Tombstone = data[21] != 0
+	rec.KeySize = binary.BigEndian.Uint64(data[22:30])
+	rec.ValueSize = binary.BigEndian.Uint64(data[30:38])
+	rest := data[recordHeaderSize:]
+	if rec.KeySize > uint64(len(rest)) || rec.ValueSize != uint64(len(rest))-rec.KeySize {
+		return rec, 0, nil, nil, fmt.Errorf("record size mismatch: key %d + value %d bytes, %d bytes present", rec.KeySize, rec.ValueSize, len(rest))
+	}
+	key := rest[:rec.KeySize]
+	value := rest[rec.KeySize : rec.KeySize+rec.ValueSize]
+	return rec, crc, key, value, nil
+}
+
+// Dump ispisuje sve zapise svih WAL segmenata i pregled zauzetosti blokova po segmentu
+func Dump(w io.Writer, cfg *config.Config) error {
+	var segments []*WALSegment
+	if _, err := os.Stat(cfg.Wal.WalDirectory); err == nil {
+		if segments, err = listSegments(cfg.Wal.WalDirectory); err != nil {
+			return err
+		}
+	}
+	if len(segments) == 0 {
+		fmt.Fprintf(w, "No WAL segments in %s\n", cfg.Wal.WalDirectory)
+		return nil
+	}
+	checkpoint, err := readCheckpoint(cfg.Wal.WalDirectory)
+	if err != nil {
+		return err
+	}
+	if checkpoint.Segment > 0 {
+		fmt.Fprintf(w, "Checkpoint: %s (older records are in SSTables)\n", checkpoint)
+	}
+	for _, segment := range segments {
+		info, err := ScanSegment(segment.filePath, cfg, nil)
+		if err != nil {
+			return err
+		}
+		if info.Format == SegmentFormatLegacy {
+			fmt.Fprintf(w, "Segment %s (legacy format, read only):\n", segment.filePath)
+		} else {
+			fmt.Fprintf(w, "Segment %s:\n", segment.filePath)
+		}
+		info, err = ScanSegment(segment.filePath, cfg, func(r RecordInfo) {
+			crc := "ok"
+			if !r.CRCOk {
+				crc = "BAD"
+			}
+			fmt.Fprintf(w, "  @%d (%d fragments, %d bytes) seq=%d ts=%s tombstone=%v key=%dB value=%dB crc %s\n",
+				r.Offset, r.Fragments, r.Size, r.Seq,
+				time.Unix(0, r.Timestamp).UTC().Format(time.RFC3339Nano), r.Tombstone, r.KeySize, r.ValueSize, crc)
+		})
+		if err != nil {
+			return err
+		}
+		if info.Corruption != nil {
+			fmt.Fprintf(w, "  CORRUPTED: %v\n", info.Corruption)
+		}
+		capacity := int64(cfg.Wal.WalSegmentSize) * int64(cfg.Block.BlockSize)
+		usage := 0.0
+		if info.ValidBytes > 0 {
+			usage = float64(info.PayloadBytes) / float64(info.ValidBytes) * 100
+		}
+		fmt.Fprintf(w, "  %d records, %d/%d bytes used (%d in file), %d payload bytes, %.1f%% payload\n",
+			info.Records, info.ValidBytes, capacity, info.FileBytes, info.PayloadBytes, usage)
+	}
+	return nil
+}
+
+// Nastavak imena segmenta koji je popravka izbacila iz WAL-a
+const quarantineSuffix = ".corrupt"
+
+// RepairResult opisuje popravku jednog segmenta
+type RepairResult struct {
+	Path           string
+	Corruption     error
+	TruncatedBytes int64  // Broj odbacenih bajtova
+	Quarantined    string // Novo ime segmenta koji je ceo izbacen iz WAL-a, prazno ako je segment samo skracen
+}
+
+// Repair skracuje WAL na prvom ostecenom ili nepotpunom zapisu
+// Zapisi pre ostecenja ostaju, a sve od ostecenja do kraja segmenta se odbacuje
+// Svi kasniji segmenti se izbacuju iz WAL-a (preimenuju se u wal_NNNN.log.corrupt), jer bi
+// njihovi zapisi posle rupe u WAL-u bili primenjeni bez zapisa koji su izgubljeni
+// Vraca samo segmente koji su promenjeni
+func Repair(cfg *config.Config) ([]RepairResult, error) {
+	if _, err := os.Stat(cfg.Wal.WalDirectory); os.IsNotExist(err) {
+		return nil, nil // Nema WAL-a, nema ni sta da se popravi
+	}
+	segments, err := listSegments(cfg.Wal.WalDirectory)
+	if err != nil {
+		return nil, err
+	}
+	var results []RepairResult
+	for i, segment := range segments {
+		info, err := ScanSegment(segment.filePath, cfg, nil)
+		if err != nil {
+			return results, err
+		}
+		if info.Corruption == nil {
+			continue
+		}
+		// Kasniji segmenti se sklanjaju pre skracivanja, da prekid popravke ne ostavi rupu u WAL-u
+		for _, later := range segments[i+1:] {
+			stat, err := os.Stat(later.filePath)
+			if err != nil {
+				return results, fmt.Errorf("error reading segment %s: %v", later.filePath, err)
+			}
+			quarantined := later.filePath + quarantineSuffix
+			if err := os.Rename(later.filePath, quarantined); err != nil {
+				return results, fmt.Errorf("error moving segment %s out of the WAL: %v", later.filePath, err)
+			}
+			results = append(results, RepairResult{
+				Path:           later.filePath,
+				Corruption:     fmt.Errorf("follows the corruption in %s", segment.filePath),
+				TruncatedBytes: stat.Size(),
+				Quarantined:    quarantined,
+			})
+		}
+		if err := os.Truncate(segment.filePath, info.ValidBytes); err != nil {
+			return results, fmt.Errorf("error truncating segment %s: %v", segment.filePath, err)
+		}
+		// Skraceni segment je u rezultatu pre kasnijih
+		results = append([]RepairResult{{
+			Path:           segment.filePath,
+			Corruption:     info.Corruption,
+			TruncatedBytes: info.FileBytes - info.ValidBytes,
+		}}, results...)
+		break
+	}
+	return results, nil
+}
@@ -0,0 +1,164 @@
+package writeaheadlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"path/filepath"
+)
+
+// Segment pocinje zaglavljem: Magic (4) + Version (4), iza njega su fragmenti
+// Segmenti bez zaglavlja su iz verzije pre fragmenata, kada je svaki zapis bio jedan lanac blokova Block Manager-a (legacy.go)
+const segmentHeaderSize = 8
+
+var segmentMagic = []byte{'W', 'A', 'L', 'S'}
+
+// Formati segmenta
+const (
+	SegmentFormatLegacy    = 1 // Zapis po lancu blokova, bez zaglavlja segmenta i sekvencnog broja, samo za citanje
+	SegmentFormatFragments = 2 // Fragmenti u blokovima, zapis sa sekvencnim brojem
+)
+
+// segmentHeader vraca zaglavlje novog segmenta
+func segmentHeader() []byte {
+	header := append([]byte(nil), segmentMagic...)
+	return binary.BigEndian.AppendUint32(header, SegmentFormatFragments)
+}
+
+// segmentFormat vraca format segmenta sa podacima data
+// Segment kraci od zaglavlja koji je pocetak zaglavlja (pad odmah posle pravljenja segmenta) je prazan segment sa fragmentima
+// Segment bez zaglavlja koji ne pocinje ispravnim zapisom starog formata je napisala razvojna verzija pre uvodjenja zaglavlja
+// (ili mu je prvi zapis ostecen) i ne cita se
+func segmentFormat(path string, data []byte, blockSize int) (int, error) {
+	if len(data) < segmentHeaderSize && bytes.HasPrefix(segmentHeader(), data) {
+		return SegmentFormatFragments, nil
+	}
+	if bytes.HasPrefix(data, segmentMagic) && len(data) >= segmentHeaderSize {
+		if version := binary.BigEndian.Uint32(data[4:8]); version != SegmentFormatFragments {
+			return 0, fmt.Errorf("wal segment %s has unsupported format version %d", path, version)
+		}
+		return SegmentFormatFragments, nil
+	}
+	if isLegacySegment(data, blockSize) {
+		return SegmentFormatLegacy, nil
+	}
+	return 0, fmt.Errorf("wal segment %s has no format header and does not start with a valid legacy record: "+
+		"if it was written by a development build; open the database with that build, run flush and close it, "+
+		"then remove the wal_*.log segments from %s (after the flush all their records are in SSTables)",
+		path, filepath.Dir(path))
+}
+
+// Zapisi se u segment upisuju kao fragmenti, po uzoru na LevelDB log
+// Zaglavlje fragmenta: CRC (4, nad tipom i podacima) + Length (2) + Type (1)
+// Fragment nikad ne prelazi granicu bloka: zapis koji ne stane u ostatak bloka se deli na FIRST, MIDDLE... LAST,
+// a ako u bloku ostane manje od zaglavlja, ostatak se popunjava nulama i sledeci fragment pocinje u novom bloku
+const fragmentHeaderSize = 7
+
+// appendFragments dodaje u dst fragmente zapisa record, koji pocinje na poziciji pos u segmentu
+func appendFragments(dst []byte, pos int64, record []byte, blockSize int) []byte {
+	for first := true; ; first = false {
+		left := blockSize - int(pos%int64(blockSize))
+		if left < fragmentHeaderSize {
+			dst = append(dst, make([]byte, left)...) // Popuna do kraja bloka
+			pos += int64(left)
+			left = blockSize
+		}
+		n := left - fragmentHeaderSize
+		if n > len(record) {
+			n = len(record)
+		}
+		last := n == len(record)
+
+		var typ WALRecordType
+		switch {
+		case first && last:
+			typ = FULL
+		case first:
+			typ = FIRST
+		case last:
+			typ = LAST
+		default:
+			typ = MIDDLE
+		}
+
+		var header [fragmentHeaderSize]byte
+		binary.BigEndian.PutUint32(header[0:4], fragmentCRC(typ, record[:n]))
+		binary.BigEndian.PutUint16(header[4:6], uint16(n))
+		header[6] = byte(typ)
+		dst = append(dst, header[:]...)
+		dst = append(dst, record[:n]...)
+		pos += int64(fragmentHeaderSize + n)
+		record = record[n:]
+		if last {
+			return dst
+		}
+	}
+}
+
+// fragmentsSize vraca koliko bajtova zauzimaju fragmenti zapisa duzine size koji pocinje na poziciji pos
+func fragmentsSize(pos int64, size, blockSize int) int64 {
+	start := pos
+	for first := true; first || size > 0; first = false {
+		left := blockSize - int(pos%int64(blockSize))
+		if left < fragmentHeaderSize {
+			pos += int64(left)
+			left = blockSize
+		}
+		n := left - fragmentHeaderSize
+		if n > size {
+			n = size
+		}
+		pos += int64(fragmentHeaderSize + n)
+		size -= n
+	}
+	return pos - start
+}
+
+func fragmentCRC(typ WALRecordType, data []byte) uint32 {
+	crc := crc32.ChecksumIEEE([]byte{byte(typ)})
+	return crc32.Update(crc, crc32.IEEETable, data)
+}
+
+// fragment je jedan procitan fragment, Offset je pozicija njegovog zaglavlja u segmentu
+type fragment struct {
+	Offset int64
+	Type   WALRecordType
+	Data   []byte
+}
+
+// readFragment cita fragment koji pocinje na poziciji pos (ili u sledecem bloku, ako je ostatak bloka popuna)
+// Vraca fragment i poziciju sledeceg, a za kraj podataka ok == false
+// Uz gresku vraca poziciju neispravnog fragmenta
+func readFragment(data []byte, pos int64, blockSize int) (frag fragment, next int64, ok bool, err error) {
+	left := blockSize - int(pos%int64(blockSize))
+	if left < fragmentHeaderSize {
+		pos += int64(left)
+		left = blockSize
+	}
+	if pos >= int64(len(data)) {
+		return fragment{}, pos, false, nil
+	}
+	if int64(len(data))-pos < fragmentHeaderSize {
+		return fragment{}, pos, false, fmt.Errorf("offset %d: torn fragment header", pos)
+	}
+	header := data[pos : pos+fragmentHeaderSize]
+	crc := binary.BigEndian.Uint32(header[0:4])
+	length := int(binary.BigEndian.Uint16(header[4:6]))
+	typ := WALRecordType(header[6])
+	if typ > LAST {
+		return fragment{}, pos, false, fmt.Errorf("offset %d: unknown fragment type %d", pos, byte(typ))
+	}
+	if length > left-fragmentHeaderSize {
+		return fragment{}, pos, false, fmt.Errorf("offset %d: fragment length %d crosses block boundary", pos, length)
+	}
+	end := pos + fragmentHeaderSize + int64(length)
+	if end > int64(len(data)) {
+		return fragment{}, pos, false, fmt.Errorf("offset %d: torn fragment, %d of %d bytes present", pos, int64(len(data))-pos-fragmentHeaderSize, length)
+	}
+	payload := data[pos+fragmentHeaderSize : end]
+	if fragmentCRC(typ, payload) != crc {
+		return fragment{}, pos, false, fmt.Errorf("offset %d: fragment CRC mismatch", pos)
+	}
+	return fragment{Offset: pos, Type: typ, Data: payload}, end, true, nil
+}
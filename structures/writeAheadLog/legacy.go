@@ -0,0 +1,150 @@
+package writeaheadlog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+/*
+	=== STARI FORMAT SEGMENTA (pre fragmenata, bez zaglavlja segmenta) ===
+
+	Svaki zapis je upisan preko Block Manager-a kao lanac blokova: prvi bajt bloka je oznaka
+	(1 prvi, 3 srednji, 2 poslednji ili jedini blok), a ostatak bloka su podaci zapisa dopunjeni nulama
+
+	+---------+---------------+----------+---------------+--------------+----------------+-----+-------+
+	| CRC (4) | Timestamp (8) | Type (1) | Tombstone (1) | Key Size (8) | Value Size (8) | Key | Value |
+	+---------+---------------+----------+---------------+--------------+----------------+-----+-------+
+
+	CRC je nad kljucem i vrednoscu. Zapisi nemaju sekvencni broj, ReadRecords im ga dodeljuje redom citanja
+	Ovakvi segmenti se samo citaju, novi zapisi idu u novi segment
+*/
+
+const legacyRecordHeaderSize = 30
+
+// Oznake blokova u lancu Block Manager-a
+const (
+	legacyBlockFirst  = 1
+	legacyBlockLast   = 2
+	legacyBlockMiddle = 3
+)
+
+// isLegacySegment proverava da li segment pocinje ispravnim zapisom starog formata
+func isLegacySegment(data []byte, blockSize int) bool {
+	if len(data) == 0 || (data[0] != legacyBlockFirst && data[0] != legacyBlockLast) {
+		return false
+	}
+	payload, _, err := legacyChain(data, 0, blockSize)
+	if err != nil {
+		return false
+	}
+	_, crc, key, value, err := parseLegacyRecord(payload)
+	return err == nil && crc32.Update(crc32.ChecksumIEEE(key), crc32.IEEETable, value) == crc
+}
+
+// legacyChain cita lanac blokova koji pocinje na poziciji pos i vraca njegove podatke i poziciju iza lanca
+// Uz gresku vraca poziciju neispravnog bloka
+func legacyChain(data []byte, pos int64, blockSize int) ([]byte, int64, error) {
+	var payload []byte
+	for first := true; ; first = false {
+		if pos+int64(blockSize) > int64(len(data)) {
+			return nil, pos, fmt.Errorf("offset %d: torn block", pos)
+		}
+		block := data[pos : pos+int64(blockSize)]
+		marker := block[0]
+		if (first && marker != legacyBlockFirst && marker != legacyBlockLast) || (!first && marker != legacyBlockMiddle && marker != legacyBlockLast) {
+			return nil, pos, fmt.Errorf("offset %d: unexpected block marker %d", pos, marker)
+		}
+		payload = append(payload, block[1:]...)
+		pos += int64(blockSize)
+		if marker == legacyBlockLast {
+			return payload, pos, nil
+		}
+	}
+}
+
+// parseLegacyRecord cita zapis starog formata iz podataka lanca (iza zapisa je popuna nulama)
+func parseLegacyRecord(payload []byte) (RecordInfo, uint32, []byte, []byte, error) {
+	rec := RecordInfo{}
+	if len(payload) < legacyRecordHeaderSize {
+		return rec, 0, nil, nil, fmt.Errorf("record header too short: %d bytes", len(payload))
+	}
+	crc := binary.BigEndian.Uint32(payload[0:4])
+	rec.Timestamp = int64(binary.BigEndian.Uint64(payload[4:12]))
+	rec.Tombstone = payload[13] != 0
+	rec.KeySize = binary.BigEndian.Uint64(payload[14:22])
+	rec.ValueSize = binary.BigEndian.Uint64(payload[22:30])
+	rest := payload[legacyRecordHeaderSize:]
+	if rec.KeySize > uint64(len(rest)) || rec.ValueSize > uint64(len(rest))-rec.KeySize {
+		return rec, 0, nil, nil, fmt.Errorf("record size mismatch: key %d + value %d bytes, %d bytes present", rec.KeySize, rec.ValueSize, len(rest))
+	}
+	key := rest[:rec.KeySize]
+	value := rest[rec.KeySize : rec.KeySize+rec.ValueSize]
+	return rec, crc, key, value, nil
+}
+
+// scanLegacySegment je scanSegment za segment starog formata
+// Ostecen zapis se odbacuje do kraja svog lanca (ili do kraja neispravnog bloka) i citanje se nastavlja od sledeceg bloka
+func scanLegacySegment(info *SegmentInfo, data []byte, blockSize int, skip bool, fn func(RecordInfo, *WALRecord)) {
+	for pos := int64(0); pos < int64(len(data)); {
+		start := pos
+		payload, next, err := legacyChain(data, pos, blockSize)
+		if err != nil {
+			next += int64(blockSize)
+			if next > int64(len(data)) {
+				next = int64(len(data))
+			}
+		}
+		var rec RecordInfo
+		var crc uint32
+		var key, value []byte
+		if err == nil {
+			rec, crc, key, value, err = parseLegacyRecord(payload)
+			if err != nil {
+				err = fmt.Errorf("offset %d: %v", start, err)
+			}
+		}
+		if err == nil {
+			rec.Offset, rec.Size, rec.Fragments = start, next-start, int((next-start)/int64(blockSize))
+			rec.CRCOk = crc32.Update(crc32.ChecksumIEEE(key), crc32.IEEETable, value) == crc
+			if !rec.CRCOk {
+				if !skip && fn != nil {
+					fn(rec, nil) // Ispis ostecenog zapisa u dump-u
+				}
+				err = fmt.Errorf("offset %d: record CRC mismatch", start)
+			}
+		}
+		if err != nil {
+			if info.Corruption == nil {
+				info.Corruption = err
+			}
+			if !skip {
+				return
+			}
+			if n := len(info.Dropped); n > 0 && info.Dropped[n-1].End >= start {
+				info.Dropped[n-1].End = next
+			} else {
+				info.Dropped = append(info.Dropped, DroppedRange{Path: info.Path, Start: start, End: next, Reason: err})
+			}
+			pos = next
+			continue
+		}
+
+		if fn != nil {
+			fn(rec, &WALRecord{
+				CRC:       crc,
+				Timestamp: rec.Timestamp,
+				Type:      FULL,
+				Tombstone: rec.Tombstone,
+				KeySize:   rec.KeySize,
+				ValueSize: rec.ValueSize,
+				Key:       append([]byte{}, key...),
+				Value:     append([]byte{}, value...),
+			})
+		}
+		info.Records++
+		info.PayloadBytes += int64(legacyRecordHeaderSize + len(key) + len(value))
+		info.ValidBytes = next
+		pos = next
+	}
+}
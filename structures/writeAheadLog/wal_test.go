@@ -4,8 +4,13 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -51,7 +56,7 @@ func TestWAL_BasicAppendAndRead(t *testing.T) {
 	value := []byte("value1")
 	tombstone := false
 
-	if err := wal.Append(key, value, tombstone); err != nil {
+	if _, err := wal.Append(key, value, tombstone); err != nil {
 		t.Fatalf("Append failed: %v", err)
 	}
 
@@ -113,7 +118,7 @@ func TestWAL_TombstoneAppendAndRead(t *testing.T) {
 	value := []byte("value2")
 	tombstone := true
 
-	if err := wal.Append(key, value, tombstone); err != nil {
+	if _, err := wal.Append(key, value, tombstone); err != nil {
 		t.Fatalf("Append failed: %v", err)
 	}
 
@@ -175,7 +180,7 @@ func TestWAL_EmptyValueAppendAndRead(t *testing.T) {
 	value := []byte("")
 	tombstone := false
 
-	if err := wal.Append(key, value, tombstone); err != nil {
+	if _, err := wal.Append(key, value, tombstone); err != nil {
 		t.Fatalf("Append failed: %v", err)
 	}
 
@@ -234,11 +239,11 @@ func TestWAL_SegmentRotation(t *testing.T) {
 		t.Fatalf("Failed to initialize WAL: %v", err)
 	}
 
-	// Upis dovoljno podataka da izazove rotaciju
-	for i := 0; i < 5; i++ {
+	// Upis dovoljno podataka da izazove rotaciju (vise zapisa staje u jedan blok)
+	for i := 0; i < 20; i++ {
 		key := []byte(fmt.Sprintf("key%d", i))
 		value := []byte(fmt.Sprintf("value%d", i))
-		if err := wal.Append(key, value, false); err != nil {
+		if _, err := wal.Append(key, value, false); err != nil {
 			t.Fatal(err)
 		}
 	}
@@ -282,7 +287,7 @@ func TestWAL_LargeRecord(t *testing.T) {
 		largeValue[i] = byte('A' + (i % 26))
 	}
 
-	if err := wal.Append([]byte("largeKey"), largeValue, false); err != nil {
+	if _, err := wal.Append([]byte("largeKey"), largeValue, false); err != nil {
 		t.Fatal(err)
 	}
 
@@ -304,6 +309,95 @@ func TestWAL_LargeRecord(t *testing.T) {
 	}
 }
 
+// Zapisi razlicitih velicina, od praznih do vise megabajta, kroz mnogo blokova i preko granica segmenata
+// Posle ponovnog otvaranja WAL nastavlja upis usred bloka i svi zapisi se citaju redom
+func TestWAL_Fragmentation(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := &config.Config{
+		Block: config.BlockConfig{
+			BlockSize: 256,
+		},
+		Cache: config.CacheConfig{
+			Capacity: 10,
+		},
+		Wal: config.WalConfig{
+			WalDirectory:   tempDir,
+			WalSegmentSize: 8, // 2048 bajtova po segmentu
+			SyncMode:       config.SyncNone,
+		},
+	}
+
+	sizes := []int{0, 1, 200, 242, 249, 250, 256, 500, 1000, 2041, 2048, 5000, 3 << 20, 10, 1500, 1500, 1500}
+	value := func(i, size int) []byte {
+		v := make([]byte, size)
+		for j := range v {
+			v[j] = byte(i*31 + j)
+		}
+		return v
+	}
+
+	wal, err := SetOffWAL(cfg, createTestCachedBlockManager(cfg))
+	if err != nil {
+		t.Fatalf("Failed to initialize WAL: %v", err)
+	}
+	for i, size := range sizes {
+		if i == len(sizes)/2 {
+			// Ponovo otvaramo WAL, novi zapisi se nastavljaju na kraj aktivnog segmenta
+			if err := wal.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+			if wal, err = SetOffWAL(cfg, createTestCachedBlockManager(cfg)); err != nil {
+				t.Fatalf("Failed to reopen WAL: %v", err)
+			}
+		}
+		if _, err := wal.Append([]byte(fmt.Sprintf("key%02d", i)), value(i, size), i%3 == 0); err != nil {
+			t.Fatalf("Append %d (%d bytes) failed: %v", i, size, err)
+		}
+	}
+
+	records, err := wal.ReadRecords()
+	if err != nil {
+		t.Fatalf("ReadRecords failed: %v", err)
+	}
+	if len(records) != len(sizes) {
+		t.Fatalf("Expected %d records, got %d", len(sizes), len(records))
+	}
+	for i, r := range records {
+		if string(r.Key) != fmt.Sprintf("key%02d", i) || !bytes.Equal(r.Value, value(i, sizes[i])) || r.Tombstone != (i%3 == 0) {
+			t.Errorf("Record %d mismatch: key %s, %d value bytes, tombstone %v", i, r.Key, len(r.Value), r.Tombstone)
+		}
+	}
+
+	// Svaki segment: fragmenti ne prelaze granicu bloka, a zapis se ne deli izmedju segmenata
+	capacity := int64(cfg.Wal.WalSegmentSize * cfg.Block.BlockSize)
+	if len(wal.segments) < 5 {
+		t.Errorf("Expected records to span several segments, got %d", len(wal.segments))
+	}
+	for _, segment := range wal.segments {
+		info, err := ScanSegment(segment.filePath, cfg, nil)
+		if err != nil || info.Corruption != nil {
+			t.Fatalf("Scan of %s failed: %v %v", segment.filePath, err, info.Corruption)
+		}
+		if info.Records > 1 && info.FileBytes > capacity {
+			t.Errorf("Segment %s has %d bytes and %d records, only a single oversized record may exceed %d bytes", segment.filePath, info.FileBytes, info.Records, capacity)
+		}
+		data, _ := os.ReadFile(segment.filePath)
+		for pos := int64(segmentHeaderSize); ; {
+			frag, next, ok, err := readFragment(data, pos, cfg.Block.BlockSize)
+			if err != nil {
+				t.Fatalf("readFragment in %s: %v", segment.filePath, err)
+			}
+			if !ok {
+				break
+			}
+			if frag.Offset/256 != (next-1)/256 {
+				t.Errorf("Fragment at %d crosses a block boundary", frag.Offset)
+			}
+			pos = next
+		}
+	}
+}
+
 // Ovaj test proverava da li se segmenti pravilno uklanjaju
 func TestWAL_RemoveSegments(t *testing.T) {
 	tempDir, err := os.MkdirTemp("", "wal_test")
@@ -331,9 +425,9 @@ func TestWAL_RemoveSegments(t *testing.T) {
 		t.Fatalf("Failed to initialize WAL: %v", err)
 	}
 
-	// Dodaj nekoliko zapisa da kreira vise segmenata
-	for i := 0; i < 3; i++ {
-		if err := wal.Append([]byte(fmt.Sprintf("key%d", i)), []byte("value"), false); err != nil {
+	// Dodaj dovoljno zapisa da kreira vise segmenata (vise zapisa staje u jedan blok)
+	for i := 0; i < 15; i++ {
+		if _, err := wal.Append([]byte(fmt.Sprintf("key%d", i)), []byte("value"), false); err != nil {
 			t.Fatal(err)
 		}
 	}
@@ -353,15 +447,22 @@ func TestWAL_RemoveSegments(t *testing.T) {
 		t.Error("Expected at least 1 segment remaining")
 	}
 
-	// Proveri da li su svi preostali segmenti preimenovani redom: wal_0001.log, wal_0002.log, ...
-	for i, segment := range wal.segments {
-		expectedName := fmt.Sprintf("wal_%04d.log", i+1)
-		expectedPath := filepath.Join(tempDir, expectedName)
+	// Preostali segmenti zadrzavaju svoje brojeve (checkpoint se poziva na njih), pa su svi posle segmenta 2
+	for _, segment := range wal.segments {
+		if segment.segmentNumber <= 2 {
+			t.Errorf("Segment %d should have been removed", segment.segmentNumber)
+		}
+		expectedPath := filepath.Join(tempDir, fmt.Sprintf("wal_%04d.log", segment.segmentNumber))
 		if segment.filePath != expectedPath {
 			t.Errorf("Expected segment path %s, got %s", expectedPath, segment.filePath)
 		}
-		if segment.segmentNumber != i+1 {
-			t.Errorf("Expected segment number %d, got %d", i+1, segment.segmentNumber)
+		if _, err := os.Stat(segment.filePath); err != nil {
+			t.Errorf("Segment file missing: %v", err)
+		}
+	}
+	for _, name := range []string{"wal_0001.log", "wal_0002.log"} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed", name)
 		}
 	}
 }
@@ -372,6 +473,7 @@ func TestWAL_RecordSerialization(t *testing.T) {
 	record := &WALRecord{
 		CRC:       12345,
 		Timestamp: now,
+		Seq:       42,
 		Type:      FULL,
 		Tombstone: true,
 		KeySize:   3,
@@ -386,7 +488,7 @@ func TestWAL_RecordSerialization(t *testing.T) {
 	}
 
 	// Proveri osnovne karakteristike serijalizovanih podataka
-	if len(data) < 30 { // Minimalna velicina zaglavlja + key/value
+	if len(data) < recordHeaderSize { // Minimalna velicina zaglavlja + key/value
 		t.Errorf("Serialized data too small: %d bytes", len(data))
 	}
 
@@ -402,6 +504,9 @@ func TestWAL_RecordSerialization(t *testing.T) {
 	if string(newRecord.Key) != "key" {
 		t.Errorf("Key mismatch: want 'key', got '%s'", newRecord.Key)
 	}
+	if newRecord.Seq != record.Seq {
+		t.Errorf("Seq mismatch: want %d, got %d", record.Seq, newRecord.Seq)
+	}
 }
 
 // Pomocna funkcija za deserijalizaciju (potrebna za testove)
@@ -415,6 +520,9 @@ func DeserializeWALRecord(data []byte) (*WALRecord, error) {
 	if err := binary.Read(reader, binary.BigEndian, &record.Timestamp); err != nil {
 		return nil, err
 	}
+	if err := binary.Read(reader, binary.BigEndian, &record.Seq); err != nil {
+		return nil, err
+	}
 	var recordType byte
 	if err := binary.Read(reader, binary.BigEndian, &recordType); err != nil {
 		return nil, err
@@ -444,3 +552,760 @@ func DeserializeWALRecord(data []byte) (*WALRecord, error) {
 
 	return record, nil
 }
+
+// testiramo waldump i walrepair: osteceni CRC i nepotpun (torn) zapis na kraju segmenta
+func TestWAL_DumpAndRepair(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := &config.Config{
+		Block: config.BlockConfig{
+			BlockSize: 256,
+		},
+		Cache: config.CacheConfig{
+			Capacity: 10,
+		},
+		Wal: config.WalConfig{
+			WalDirectory:   tempDir,
+			WalSegmentSize: 1024,
+		},
+	}
+
+	wal, err := SetOffWAL(cfg, createTestCachedBlockManager(cfg))
+	if err != nil {
+		t.Fatalf("Failed to initialize WAL: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := wal.Append([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)), i == 1); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	// Zapis koji zauzima vise blokova
+	if _, err := wal.Append([]byte("big"), bytes.Repeat([]byte("x"), 600), false); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	segmentPath := filepath.Join(tempDir, "wal_0001.log")
+
+	// Iza zaglavlja segmenta (8) mali zapisi zauzimaju po 55 bajtova (7 zaglavlje fragmenta + 48), veliki pocinje na 228 i ima 4 fragmenta
+	info, err := ScanSegment(segmentPath, cfg, nil)
+	if err != nil {
+		t.Fatalf("ScanSegment failed: %v", err)
+	}
+	if info.Corruption != nil || info.Records != 5 || info.ValidBytes != 897 || info.FileBytes != 897 {
+		t.Fatalf("unexpected scan of intact segment: %+v", info)
+	}
+
+	// Odsecemo kraj poslednjeg fragmenta velikog zapisa
+	if err := os.Truncate(segmentPath, 800); err != nil {
+		t.Fatal(err)
+	}
+	// Kvarimo vrednost treceg zapisa (offset 118)
+	raw, err := os.ReadFile(segmentPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw[118+fragmentHeaderSize+recordHeaderSize+len("key2")] ^= 0xff
+	if err := os.WriteFile(segmentPath, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := Dump(&out, cfg); err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+	for _, want := range []string{"@8 (1 fragments, 55 bytes) seq=1", "tombstone=true", "crc ok", "CORRUPTED: offset 118: fragment CRC mismatch"} {
+		if !bytes.Contains(out.Bytes(), []byte(want)) {
+			t.Errorf("dump missing %q:\n%s", want, out.String())
+		}
+	}
+
+	results, err := Repair(cfg)
+	if err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+	if len(results) != 1 || results[0].TruncatedBytes != 800-118 {
+		t.Fatalf("unexpected repair results: %+v", results)
+	}
+	if stat, _ := os.Stat(segmentPath); stat.Size() != 118 {
+		t.Errorf("segment size after repair = %d, want %d", stat.Size(), 118)
+	}
+
+	// Posle popravke WAL moze da se procita
+	wal, err = SetOffWAL(cfg, createTestCachedBlockManager(cfg))
+	if err != nil {
+		t.Fatalf("Failed to initialize WAL: %v", err)
+	}
+	records, err := wal.ReadRecords()
+	if err != nil {
+		t.Fatalf("ReadRecords after repair failed: %v", err)
+	}
+	if len(records) != 2 || string(records[0].Key) != "key0" || !records[1].Tombstone {
+		t.Errorf("unexpected records after repair: %d", len(records))
+	}
+
+	// Torn zapis: segment se zavrsava usred zapisa koji se prostire kroz vise blokova
+	if _, err := wal.Append([]byte("big"), bytes.Repeat([]byte("y"), 600), false); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if err := os.Truncate(segmentPath, 600); err != nil {
+		t.Fatal(err)
+	}
+	info, err = ScanSegment(segmentPath, cfg, nil)
+	if err != nil {
+		t.Fatalf("ScanSegment failed: %v", err)
+	}
+	if info.Corruption == nil || info.ValidBytes != 118 {
+		t.Errorf("expected torn record after offset 118, got %+v", info)
+	}
+}
+
+// Ostecenje u srednjem segmentu: WAL se skracuje tu, a kasniji segment se izbacuje
+func TestWAL_RepairMiddleSegment(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := &config.Config{
+		Block: config.BlockConfig{
+			BlockSize: 256,
+		},
+		Cache: config.CacheConfig{
+			Capacity: 10,
+		},
+		Wal: config.WalConfig{
+			WalDirectory:   tempDir,
+			WalSegmentSize: 2,
+		},
+	}
+
+	wal, err := SetOffWAL(cfg, createTestCachedBlockManager(cfg))
+	if err != nil {
+		t.Fatalf("Failed to initialize WAL: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		if _, err := wal.Append([]byte(fmt.Sprintf("key%02d", i)), []byte(fmt.Sprintf("value%02d", i)), false); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	first := filepath.Join(tempDir, "wal_0001.log")
+	middle := filepath.Join(tempDir, "wal_0002.log")
+	last := filepath.Join(tempDir, "wal_0003.log")
+	if _, err := os.Stat(last); err != nil {
+		t.Fatalf("expected three segments: %v", err)
+	}
+	info, err := ScanSegment(first, cfg, nil)
+	if err != nil {
+		t.Fatalf("ScanSegment failed: %v", err)
+	}
+
+	// Kvarimo kljuc treceg zapisa srednjeg segmenta
+	raw, err := os.ReadFile(middle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordSize := fragmentHeaderSize + recordHeaderSize + len("key00") + len("value00")
+	raw[segmentHeaderSize+2*recordSize+fragmentHeaderSize+recordHeaderSize] ^= 0xff
+	if err := os.WriteFile(middle, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Repair(cfg)
+	if err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+	if len(results) != 2 || results[0].Path != middle || results[0].Quarantined != "" || results[1].Path != last || results[1].Quarantined != last+quarantineSuffix {
+		t.Fatalf("unexpected repair results: %+v", results)
+	}
+	if stat, _ := os.Stat(middle); stat.Size() != int64(segmentHeaderSize+2*recordSize) {
+		t.Errorf("middle segment size after repair = %d, want %d", stat.Size(), segmentHeaderSize+2*recordSize)
+	}
+	if _, err := os.Stat(last); !os.IsNotExist(err) {
+		t.Errorf("expected segment after the corruption to be moved aside, got %v", err)
+	}
+
+	// Posle popravke WAL sadrzi samo zapise pre ostecenja, bez rupe
+	wal, err = SetOffWAL(cfg, createTestCachedBlockManager(cfg))
+	if err != nil {
+		t.Fatalf("Failed to initialize WAL: %v", err)
+	}
+	records, err := wal.ReadRecords()
+	if err != nil {
+		t.Fatalf("ReadRecords after repair failed: %v", err)
+	}
+	if len(records) != info.Records+2 {
+		t.Fatalf("expected %d records after repair, got %d", info.Records+2, len(records))
+	}
+	for i, rec := range records {
+		if want := fmt.Sprintf("key%02d", i); string(rec.Key) != want {
+			t.Errorf("record %d has key %q, want %q", i, rec.Key, want)
+		}
+	}
+}
+
+func newSyncTestWAL(t testing.TB, mode string) *WAL {
+	t.Helper()
+	cfg := &config.Config{
+		Block: config.BlockConfig{
+			BlockSize: 256,
+		},
+		Cache: config.CacheConfig{
+			Capacity: 10,
+		},
+		Wal: config.WalConfig{
+			WalDirectory:   t.TempDir(),
+			WalSegmentSize: 64,
+			SyncMode:       mode,
+			SyncIntervalMs: 5,
+		},
+	}
+	wal, err := SetOffWAL(cfg, createTestCachedBlockManager(cfg))
+	if err != nil {
+		t.Fatalf("Failed to initialize WAL: %v", err)
+	}
+	return wal
+}
+
+// testiramo da istovremeni upisi dele fsync i da su posle Append-a (always) ili Close-a (interval) svi zapisi na disku
+func TestWAL_GroupCommit(t *testing.T) {
+	const writers, perWriter = 8, 40
+	for _, mode := range []string{config.SyncAlways, config.SyncInterval, config.SyncNone} {
+		t.Run(mode, func(t *testing.T) {
+			wal := newSyncTestWAL(t, mode)
+			errs := make(chan error, writers)
+			for g := 0; g < writers; g++ {
+				go func(g int) {
+					for i := 0; i < perWriter; i++ {
+						key := []byte(fmt.Sprintf("w%d-k%d", g, i))
+						if _, err := wal.Append(key, []byte("value"), false); err != nil {
+							errs <- err
+							return
+						}
+						if mode == config.SyncAlways {
+							wal.mu.Lock()
+							durable := wal.durable
+							wal.mu.Unlock()
+							if durable == 0 {
+								errs <- fmt.Errorf("append returned before its record was synced")
+								return
+							}
+						}
+					}
+					errs <- nil
+				}(g)
+			}
+			for g := 0; g < writers; g++ {
+				if err := <-errs; err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := wal.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			total := uint64(writers * perWriter)
+			switch mode {
+			case config.SyncNone:
+				if wal.syncs != 0 {
+					t.Errorf("Expected no fsync with sync_mode none, got %d", wal.syncs)
+				}
+			default:
+				if wal.durable != total {
+					t.Errorf("Expected %d durable records, got %d", total, wal.durable)
+				}
+				// Najvise jedan fsync po upisu i po jedan pri svakoj rotaciji segmenta
+				maxSyncs := total + uint64(len(wal.segments)-1)
+				if wal.syncs == 0 || wal.syncs > maxSyncs {
+					t.Errorf("Expected between 1 and %d fsyncs, got %d", maxSyncs, wal.syncs)
+				}
+			}
+
+			records, err := wal.ReadRecords()
+			if err != nil {
+				t.Fatalf("ReadRecords failed: %v", err)
+			}
+			if uint64(len(records)) != total {
+				t.Errorf("Expected %d records, got %d", total, len(records))
+			}
+		})
+	}
+}
+
+// Latencija upisa za svaki nacin sinhronizacije, sa vise istovremenih upisa koji dele fsync
+// go test -bench WAL_AppendLatency ./structures/writeAheadLog
+func BenchmarkWAL_AppendLatency(b *testing.B) {
+	for _, mode := range []string{config.SyncAlways, config.SyncInterval, config.SyncNone} {
+		b.Run(mode, func(b *testing.B) {
+			wal := newSyncTestWAL(b, mode)
+			value := bytes.Repeat([]byte("v"), 100)
+			var mu sync.Mutex
+			var total time.Duration
+			b.SetParallelism(4)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				var local time.Duration
+				i := 0
+				for pb.Next() {
+					start := time.Now()
+					if _, err := wal.Append([]byte(fmt.Sprintf("key%d", i)), value, false); err != nil {
+						b.Error(err)
+						return
+					}
+					local += time.Since(start)
+					i++
+				}
+				mu.Lock()
+				total += local
+				mu.Unlock()
+			})
+			b.StopTimer()
+			wal.Close()
+			b.ReportMetric(float64(total.Microseconds())/float64(b.N), "us/append")
+			b.ReportMetric(float64(wal.syncs)/float64(b.N), "fsyncs/append")
+		})
+	}
+}
+
+func newRecoveryTestConfig(dir, mode string) *config.Config {
+	return &config.Config{
+		Block: config.BlockConfig{
+			BlockSize: 128,
+		},
+		Cache: config.CacheConfig{
+			Capacity: 10,
+		},
+		Wal: config.WalConfig{
+			WalDirectory:   dir,
+			WalSegmentSize: 100,
+			SyncMode:       config.SyncNone,
+			RecoveryMode:   mode,
+		},
+	}
+}
+
+// writeRecoverySegment upisuje zapise razlicitih velicina i vraca sadrzaj segmenta i opis svakog zapisa
+func writeRecoverySegment(t *testing.T) ([]byte, []RecordInfo) {
+	t.Helper()
+	cfg := newRecoveryTestConfig(t.TempDir(), config.RecoveryStrict)
+	wal, err := SetOffWAL(cfg, createTestCachedBlockManager(cfg))
+	if err != nil {
+		t.Fatalf("Failed to initialize WAL: %v", err)
+	}
+	for i, size := range []int{5, 40, 300, 17, 600, 3, 54, 120} {
+		if _, err := wal.Append([]byte(fmt.Sprintf("key%d", i)), bytes.Repeat([]byte{byte('a' + i)}, size), i == 3); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	wal.Close()
+	path := filepath.Join(cfg.Wal.WalDirectory, "wal_0001.log")
+	var infos []RecordInfo
+	if _, err := ScanSegment(path, cfg, func(r RecordInfo) { infos = append(infos, r) }); err != nil {
+		t.Fatalf("ScanSegment failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, infos
+}
+
+// Crash injection: segment se sece na svakom bajtu, kao da je proces pao usred upisa
+// tail i skip vracaju sve zavrsene zapise i odbacuju tacno nezavrsen deo, strict vraca gresku
+func TestWAL_RecoveryTornTail(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	data, infos := writeRecoverySegment(t)
+	for cut := 0; cut <= len(data); cut++ {
+		// Zapisi koji su ceo upisani pre preseka i pocetak prvog koji nije
+		complete, validEnd, nextStart := 0, int64(segmentHeaderSize), int64(len(data))
+		for _, r := range infos {
+			if r.Offset+r.Size <= int64(cut) {
+				complete++
+				validEnd = r.Offset + r.Size
+			} else {
+				nextStart = r.Offset
+				break
+			}
+		}
+		torn := int64(cut) > nextStart
+
+		for _, mode := range []string{config.RecoveryStrict, config.RecoveryTail, config.RecoverySkip} {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "wal_0001.log")
+			if err := os.WriteFile(path, data[:cut], 0644); err != nil {
+				t.Fatal(err)
+			}
+			cfg := newRecoveryTestConfig(dir, mode)
+			wal, err := SetOffWAL(cfg, createTestCachedBlockManager(cfg))
+			if err != nil {
+				t.Fatalf("cut %d %s: SetOffWAL failed: %v", cut, mode, err)
+			}
+			records, err := wal.ReadRecords()
+			if mode == config.RecoveryStrict {
+				if torn != (err != nil) {
+					t.Errorf("cut %d strict: torn %v, error %v", cut, torn, err)
+				}
+				wal.Close()
+				continue
+			}
+			if err != nil {
+				t.Fatalf("cut %d %s: ReadRecords failed: %v", cut, mode, err)
+			}
+			if len(records) != complete {
+				t.Fatalf("cut %d %s: got %d records, want %d", cut, mode, len(records), complete)
+			}
+			var dropped int64
+			for _, d := range wal.Dropped() {
+				dropped += d.End - d.Start
+			}
+			wantSize := int64(cut)
+			if cut < segmentHeaderSize {
+				wantSize = segmentHeaderSize // Nepotpuno zaglavlje se upisuje ponovo
+			}
+			if torn {
+				wantSize = validEnd
+				if dropped != int64(cut)-nextStart {
+					t.Errorf("cut %d %s: dropped %d bytes %v, want %d", cut, mode, dropped, wal.Dropped(), int64(cut)-nextStart)
+				}
+			} else if dropped != 0 {
+				t.Errorf("cut %d %s: nothing is torn, but dropped %v", cut, mode, wal.Dropped())
+			}
+			if stat, _ := os.Stat(path); stat.Size() != wantSize {
+				t.Errorf("cut %d %s: segment has %d bytes after recovery, want %d", cut, mode, stat.Size(), wantSize)
+			}
+
+			// Upis posle oporavka nastavlja iza poslednjeg ispravnog zapisa
+			if _, err := wal.Append([]byte("after"), []byte("crash"), false); err != nil {
+				t.Fatalf("cut %d %s: Append after recovery failed: %v", cut, mode, err)
+			}
+			wal.Close()
+			wal, err = SetOffWAL(cfg, createTestCachedBlockManager(cfg))
+			if err != nil {
+				t.Fatalf("cut %d %s: reopen failed: %v", cut, mode, err)
+			}
+			records, err = wal.ReadRecords()
+			if err != nil || len(records) != complete+1 || string(records[complete].Key) != "after" || len(wal.Dropped()) != 0 {
+				t.Errorf("cut %d %s: after reopen got %d records, dropped %v, error %v", cut, mode, len(records), wal.Dropped(), err)
+			}
+			wal.Close()
+		}
+	}
+}
+
+// Ostecenje usred segmenta: tail i strict vracaju gresku, skip preskace samo osteceni deo
+func TestWAL_RecoverySkipCorrupted(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	data, infos := writeRecoverySegment(t)
+	corrupted := append([]byte{}, data...)
+	bad := infos[2] // Zapis od 300 bajtova, u vise blokova
+	corrupted[bad.Offset+fragmentHeaderSize+recordHeaderSize+10] ^= 0xff
+
+	for _, mode := range []string{config.RecoveryStrict, config.RecoveryTail, config.RecoverySkip} {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "wal_0001.log"), corrupted, 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg := newRecoveryTestConfig(dir, mode)
+		wal, err := SetOffWAL(cfg, createTestCachedBlockManager(cfg))
+		if err != nil {
+			t.Fatalf("%s: SetOffWAL failed: %v", mode, err)
+		}
+		records, err := wal.ReadRecords()
+		wal.Close()
+		if mode != config.RecoverySkip {
+			if err == nil {
+				t.Errorf("%s: expected error for corruption in the middle of the segment", mode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("skip: ReadRecords failed: %v", err)
+		}
+		// Preskace se osteceni fragment do kraja bloka, pa i ostatak zapisa koji je poceo u njemu
+		dropped := wal.Dropped()
+		if len(dropped) == 0 || dropped[0].Start != bad.Offset {
+			t.Fatalf("skip: unexpected dropped ranges %v", dropped)
+		}
+		want := 0
+		for _, r := range infos {
+			overlaps := false
+			for _, d := range dropped {
+				if r.Offset < d.End && r.Offset+r.Size > d.Start {
+					overlaps = true
+				}
+			}
+			if overlaps {
+				continue
+			}
+			if want >= len(records) || records[want].Timestamp != r.Timestamp {
+				t.Fatalf("skip: record at offset %d missing from %d recovered records", r.Offset, len(records))
+			}
+			want++
+		}
+		if want != len(records) || want < len(infos)-2 {
+			t.Errorf("skip: recovered %d records of %d, dropped %v", len(records), len(infos), dropped)
+		}
+	}
+}
+
+// Ovaj test proverava da oporavak cita WAL tek od checkpoint-a i da checkpoint prezivi ponovno otvaranje
+func TestWAL_Checkpoint(t *testing.T) {
+	dir := t.TempDir()
+	cfg := newRecoveryTestConfig(dir, config.RecoveryStrict)
+	cfg.Wal.WalSegmentSize = 1
+	wal, err := SetOffWAL(cfg, createTestCachedBlockManager(cfg))
+	if err != nil {
+		t.Fatalf("Failed to initialize WAL: %v", err)
+	}
+
+	var checkpoint Position
+	for i := 0; i < 20; i++ {
+		if i == 13 {
+			checkpoint = wal.Position()
+		}
+		if _, err := wal.Append([]byte(fmt.Sprintf("key%02d", i)), []byte("value"), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if checkpoint.Segment < 3 {
+		t.Fatalf("Expected checkpoint past segment 2, got %s", checkpoint)
+	}
+	if err := wal.Checkpoint(checkpoint); err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+	if err := wal.Checkpoint(Position{Segment: 1}); err == nil {
+		t.Error("Expected error for checkpoint before the current one")
+	}
+	for _, segment := range wal.segments {
+		if segment.segmentNumber < checkpoint.Segment {
+			t.Errorf("Segment %d is covered by the checkpoint and should be removed", segment.segmentNumber)
+		}
+	}
+	wal.Close()
+
+	wal, err = SetOffWAL(cfg, createTestCachedBlockManager(cfg))
+	if err != nil {
+		t.Fatalf("Failed to reopen WAL: %v", err)
+	}
+	defer wal.Close()
+	if wal.CheckpointPosition() != checkpoint {
+		t.Fatalf("Expected checkpoint %s after reopen, got %s", checkpoint, wal.CheckpointPosition())
+	}
+	records, err := wal.ReadRecords()
+	if err != nil {
+		t.Fatalf("ReadRecords failed: %v", err)
+	}
+	if len(records) != 7 {
+		t.Fatalf("Expected 7 records after the checkpoint, got %d", len(records))
+	}
+	for i, record := range records {
+		if want := fmt.Sprintf("key%02d", 13+i); string(record.Key) != want {
+			t.Errorf("Record %d: expected key %s, got %s", i, want, record.Key)
+		}
+		if record.Start.Before(checkpoint) || !record.Start.Before(record.End) {
+			t.Errorf("Record %d: invalid position %s - %s", i, record.Start, record.End)
+		}
+	}
+}
+
+// Ovaj test proverava da novi segmenti ne dobijaju brojeve ispod checkpoint-a kad su svi segmenti obrisani
+func TestWAL_CheckpointWithoutSegments(t *testing.T) {
+	dir := t.TempDir()
+	cfg := newRecoveryTestConfig(dir, config.RecoveryStrict)
+	if err := writeCheckpoint(dir, Position{Segment: 7, Offset: 300}); err != nil {
+		t.Fatal(err)
+	}
+	wal, err := SetOffWAL(cfg, createTestCachedBlockManager(cfg))
+	if err != nil {
+		t.Fatalf("Failed to initialize WAL: %v", err)
+	}
+	if _, err := wal.Append([]byte("key"), []byte("value"), false); err != nil {
+		t.Fatal(err)
+	}
+	wal.Close()
+
+	wal, err = SetOffWAL(cfg, createTestCachedBlockManager(cfg))
+	if err != nil {
+		t.Fatalf("Failed to reopen WAL: %v", err)
+	}
+	defer wal.Close()
+	records, err := wal.ReadRecords()
+	if err != nil {
+		t.Fatalf("ReadRecords failed: %v", err)
+	}
+	if len(records) != 1 || records[0].Start.Segment != 8 {
+		t.Fatalf("Expected the record in segment 8, got %d records", len(records))
+	}
+}
+
+// Ovaj test proverava da svaki upis dobija sledeci sekvencni broj i da se brojac nastavlja posle ponovnog otvaranja
+func TestWAL_Sequence(t *testing.T) {
+	dir := t.TempDir()
+	cfg := newRecoveryTestConfig(dir, config.RecoveryStrict)
+	wal, err := SetOffWAL(cfg, createTestCachedBlockManager(cfg))
+	if err != nil {
+		t.Fatalf("Failed to initialize WAL: %v", err)
+	}
+	for i := 1; i <= 5; i++ {
+		seq, err := wal.Append([]byte(fmt.Sprintf("key%d", i)), []byte("value"), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seq != uint64(i) {
+			t.Errorf("Append %d: expected seq %d, got %d", i, i, seq)
+		}
+	}
+	wal.Close()
+
+	wal, err = SetOffWAL(cfg, createTestCachedBlockManager(cfg))
+	if err != nil {
+		t.Fatalf("Failed to reopen WAL: %v", err)
+	}
+	defer wal.Close()
+	records, err := wal.ReadRecords()
+	if err != nil {
+		t.Fatalf("ReadRecords failed: %v", err)
+	}
+	for i, record := range records {
+		if record.Seq != uint64(i+1) {
+			t.Errorf("Record %d: expected seq %d, got %d", i, i+1, record.Seq)
+		}
+	}
+	if wal.LastSequence() != 5 {
+		t.Fatalf("Expected last seq 5 after reopen, got %d", wal.LastSequence())
+	}
+
+	// Manji broj ne vraca brojac unazad
+	wal.AdvanceSequence(3)
+	wal.AdvanceSequence(100)
+	seq, err := wal.Append([]byte("key6"), []byte("value"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq != 101 {
+		t.Errorf("Expected seq 101 after AdvanceSequence, got %d", seq)
+	}
+}
+
+// appendLegacyRecord dodaje u segment zapis u starom formatu, kako ga je upisivao Block Manager
+func appendLegacyRecord(segment []byte, key, value []byte, tombstone bool, blockSize int) []byte {
+	record := make([]byte, legacyRecordHeaderSize, legacyRecordHeaderSize+len(key)+len(value))
+	binary.BigEndian.PutUint32(record[0:4], crc32.Update(crc32.ChecksumIEEE(key), crc32.IEEETable, value))
+	binary.BigEndian.PutUint64(record[4:12], uint64(time.Now().UnixNano()))
+	if tombstone {
+		record[13] = 1
+	}
+	binary.BigEndian.PutUint64(record[14:22], uint64(len(key)))
+	binary.BigEndian.PutUint64(record[22:30], uint64(len(value)))
+	record = append(append(record, key...), value...)
+	for i := 0; i < len(record); i += blockSize - 1 {
+		block := make([]byte, blockSize)
+		end := i + blockSize - 1
+		switch {
+		case end >= len(record):
+			block[0] = legacyBlockLast
+			end = len(record)
+		case i == 0:
+			block[0] = legacyBlockFirst
+		default:
+			block[0] = legacyBlockMiddle
+		}
+		copy(block[1:], record[i:end])
+		segment = append(segment, block...)
+	}
+	return segment
+}
+
+// Segmenti starog formata (bez zaglavlja) se citaju, a novi zapisi idu u novi segment sa zaglavljem
+func TestWAL_LegacySegment(t *testing.T) {
+	cfg := newRecoveryTestConfig(t.TempDir(), config.RecoveryStrict)
+	var legacy []byte
+	for i := 0; i < 4; i++ {
+		legacy = appendLegacyRecord(legacy, []byte(fmt.Sprintf("key%d", i)), bytes.Repeat([]byte{byte('a' + i)}, 50*i), i == 2, cfg.Block.BlockSize)
+	}
+	legacyPath := filepath.Join(cfg.Wal.WalDirectory, "wal_0001.log")
+	if err := os.WriteFile(legacyPath, legacy, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	wal, err := SetOffWAL(cfg, createTestCachedBlockManager(cfg))
+	if err != nil {
+		t.Fatalf("Failed to initialize WAL: %v", err)
+	}
+	records, err := wal.ReadRecords()
+	if err != nil {
+		t.Fatalf("ReadRecords failed: %v", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("Expected 4 legacy records, got %d", len(records))
+	}
+	for i, r := range records {
+		if string(r.Key) != fmt.Sprintf("key%d", i) || len(r.Value) != 50*i || r.Tombstone != (i == 2) || r.Seq != uint64(i+1) {
+			t.Errorf("Legacy record %d mismatch: key %s, %d value bytes, tombstone %v, seq %d", i, r.Key, len(r.Value), r.Tombstone, r.Seq)
+		}
+	}
+	seq, err := wal.Append([]byte("new"), []byte("record"), false)
+	if err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if seq != 5 {
+		t.Errorf("Expected seq 5 after legacy records, got %d", seq)
+	}
+	wal.Close()
+
+	if data, _ := os.ReadFile(legacyPath); !bytes.Equal(data, legacy) {
+		t.Errorf("Legacy segment was modified")
+	}
+	info, err := ScanSegment(filepath.Join(cfg.Wal.WalDirectory, "wal_0002.log"), cfg, nil)
+	if err != nil || info.Format != SegmentFormatFragments || info.Records != 1 {
+		t.Fatalf("Expected the new record in a new segment, got %+v, %v", info, err)
+	}
+
+	wal, err = SetOffWAL(cfg, createTestCachedBlockManager(cfg))
+	if err != nil {
+		t.Fatalf("Failed to reopen WAL: %v", err)
+	}
+	defer wal.Close()
+	if records, err = wal.ReadRecords(); err != nil || len(records) != 5 || string(records[4].Key) != "new" {
+		t.Fatalf("Expected 5 records after reopen, got %d, %v", len(records), err)
+	}
+}
+
+// Segment bez zaglavlja koji nije u starom formatu se odbija uz uputstvo, i pri otvaranju i pri citanju
+func TestWAL_HeaderlessSegmentRefused(t *testing.T) {
+	cfg := newRecoveryTestConfig(t.TempDir(), config.RecoveryTail)
+	wal, err := SetOffWAL(cfg, createTestCachedBlockManager(cfg))
+	if err != nil {
+		t.Fatalf("Failed to initialize WAL: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := wal.Append([]byte(fmt.Sprintf("key%d", i)), []byte("value"), false); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	wal.Close()
+
+	// Segment bez zaglavlja, kakav je pisala razvojna verzija sa fragmentima
+	path := filepath.Join(cfg.Wal.WalDirectory, "wal_0001.log")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data[segmentHeaderSize:], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SetOffWAL(cfg, createTestCachedBlockManager(cfg)); err == nil || !strings.Contains(err.Error(), "no format header") {
+		t.Fatalf("Expected headerless segment to be refused, got %v", err)
+	}
+
+	// Isto i kad segment nije poslednji, tada ga odbija ReadRecords
+	next := filepath.Join(cfg.Wal.WalDirectory, "wal_0002.log")
+	if err := os.WriteFile(next, segmentHeader(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wal, err = SetOffWAL(cfg, createTestCachedBlockManager(cfg))
+	if err != nil {
+		t.Fatalf("Failed to initialize WAL: %v", err)
+	}
+	defer wal.Close()
+	if _, err := wal.ReadRecords(); err == nil || !strings.Contains(err.Error(), "no format header") {
+		t.Fatalf("Expected ReadRecords to refuse headerless segment, got %v", err)
+	}
+}
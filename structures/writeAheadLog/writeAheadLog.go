@@ -5,13 +5,13 @@ import (
 	"encoding/binary"
 	"fmt"
 	"hash/crc32"
-	"io"
+	"log"
 	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/iigor000/database/config"
@@ -21,12 +21,17 @@ import (
 type WALRecord struct {
 	CRC       uint32
 	Timestamp int64
+	Seq       uint64 // Sekvencni broj, dodeljuje ga Append i raste sa svakim upisom
 	Type      WALRecordType
 	Tombstone bool
 	KeySize   uint64
 	ValueSize uint64
 	Key       []byte
 	Value     []byte
+
+	// Pozicija zapisa u WAL-u, popunjava je ReadRecords (ne upisuje se)
+	Start Position // Pocetak prvog fragmenta
+	End   Position // Kraj poslednjeg fragmenta
 }
 
 type WALRecordType byte
@@ -38,10 +43,24 @@ const (
 	LAST
 )
 
+func (t WALRecordType) String() string {
+	switch t {
+	case FULL:
+		return "FULL"
+	case FIRST:
+		return "FIRST"
+	case MIDDLE:
+		return "MIDDLE"
+	case LAST:
+		return "LAST"
+	}
+	return fmt.Sprintf("UNKNOWN(%d)", byte(t))
+}
+
 type WALSegment struct {
 	filePath      string
 	segmentNumber int
-	writtenBlocks int
+	size          int64 // Broj upisanih bajtova
 	isActive      bool
 }
 
@@ -50,6 +69,21 @@ type WAL struct {
 	segments      []*WALSegment
 	activeSegment *WALSegment
 	cachedBM      *block_organization.CachedBlockManager
+
+	// Group commit: upisi koji cekaju fsync dele jedan poziv, fsync radi prvi koji stigne
+	mu         sync.Mutex     // Stiti segmente i sva polja ispod
+	synced     *sync.Cond     // Budi upise koji cekaju da se zavrsi fsync
+	activeFile *os.File       // Otvoren aktivni segment, za fsync (ne smeta mu preimenovanje fajla)
+	written    uint64         // Broj upisanih zapisa
+	durable    uint64         // Broj zapisa koji su sigurno na disku
+	syncing    bool           // Da li je fsync u toku
+	syncErr    error          // Greska fsync-a, posle nje se WAL vise ne koristi
+	syncs      uint64         // Broj fsync poziva
+	dropped    []DroppedRange // Delovi koje je oporavak odbacio
+	checkpoint Position       // Zapisi pre ove pozicije su u SSTable-ovima
+	lastSeq    uint64         // Poslednji dodeljeni sekvencni broj
+	stop       chan struct{}
+	done       chan struct{}
 }
 
 // Funkcija koja inicijalizuje wal
@@ -57,18 +91,73 @@ func SetOffWAL(cfg *config.Config, cbm *block_organization.CachedBlockManager) (
 	if err := os.MkdirAll(cfg.Wal.WalDirectory, 0755); err != nil { // Ako ne postoji folder za wal segmente, kreiramo ga
 		return nil, fmt.Errorf("error creating wal directory: %v", err)
 	}
-	files, err := os.ReadDir(cfg.Wal.WalDirectory) // Prolazimo kroz folder
+	segments, err := listSegments(cfg.Wal.WalDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	switch syncMode(cfg) {
+	case config.SyncAlways, config.SyncNone:
+	case config.SyncInterval:
+		if cfg.Wal.SyncIntervalMs <= 0 {
+			return nil, fmt.Errorf("invalid wal sync interval: %d ms", cfg.Wal.SyncIntervalMs)
+		}
+	default:
+		return nil, fmt.Errorf("invalid wal sync mode: %s", cfg.Wal.SyncMode)
+	}
+	switch recoveryMode(cfg) {
+	case config.RecoveryStrict, config.RecoveryTail, config.RecoverySkip:
+	default:
+		return nil, fmt.Errorf("invalid wal recovery mode: %s", cfg.Wal.RecoveryMode)
+	}
+
+	wal := &WAL{
+		config:   cfg,
+		segments: segments,
+		cachedBM: cbm, // Prosledjujemo CachedBlockManager
+	}
+	wal.synced = sync.NewCond(&wal.mu)
+	if wal.checkpoint, err = readCheckpoint(cfg.Wal.WalDirectory); err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 { // Ako nema segmenata, kreiramo novi
+		if err := wal.newSegment(); err != nil {
+			return nil, fmt.Errorf("error creating new wal segment: %v", err)
+		}
+	} else if err := wal.openLastSegment(); err != nil {
+		return nil, err
+	}
+
+	if syncMode(cfg) == config.SyncInterval {
+		wal.stop = make(chan struct{})
+		wal.done = make(chan struct{})
+		go wal.syncLoop(time.Duration(cfg.Wal.SyncIntervalMs) * time.Millisecond)
+	}
+	return wal, nil
+}
+
+// syncMode vraca nacin sinhronizacije, prazan znaci "always"
+func syncMode(cfg *config.Config) string {
+	if cfg.Wal.SyncMode == "" {
+		return config.SyncAlways
+	}
+	return cfg.Wal.SyncMode
+}
+
+// listSegments vraca sve wal_NNNN.log segmente iz direktorijuma, sortirane po rednom broju
+func listSegments(dir string) ([]*WALSegment, error) {
+	files, err := os.ReadDir(dir) // Prolazimo kroz folder
 	if err != nil {
 		return nil, fmt.Errorf("error reading wal directory: %v", err)
 	}
 
 	var segments []*WALSegment
-	segmentRegex := regexp.MustCompile(`^wal_(\d{4})\.log$`)
+	segmentRegex := regexp.MustCompile(`^wal_(\d{4,})\.log$`)
 	for _, file := range files {
 		if matches := segmentRegex.FindStringSubmatch(file.Name()); matches != nil { // Ako ime fajla odgovara regexu
 			segmentNumber, _ := strconv.Atoi(matches[1]) // Uzimamo broj segmenta
 			segments = append(segments, &WALSegment{     // Dodajemo segment u listu
-				filePath:      filepath.Join(cfg.Wal.WalDirectory, file.Name()),
+				filePath:      filepath.Join(dir, file.Name()),
 				segmentNumber: segmentNumber, // Redni broj segmenta
 				isActive:      false,         // Inicijalno nije aktivan
 			})
@@ -79,20 +168,65 @@ func SetOffWAL(cfg *config.Config, cbm *block_organization.CachedBlockManager) (
 		return segments[i].segmentNumber < segments[j].segmentNumber
 	})
 
-	wal := &WAL{
-		config:   cfg,
-		segments: segments,
-		cachedBM: cbm, // Prosledjujemo CachedBlockManager
+	return segments, nil
+}
+
+// Files vraca fajlove WAL-a iz direktorijuma dir: checkpoint (ako postoji), pa segmente redom
+// Koristi se za backup, izbaceni segmenti (.corrupt) nisu deo WAL-a
+func Files(dir string) ([]string, error) {
+	var files []string
+	checkpoint := filepath.Join(dir, checkpointFileName)
+	if _, err := os.Stat(checkpoint); err == nil {
+		files = append(files, checkpoint)
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading checkpoint: %v", err)
 	}
-	if len(segments) == 0 { // Ako nema segmenata, kreiramo novi
-		if err := wal.newSegment(); err != nil {
-			return nil, fmt.Errorf("error creating new wal segment: %v", err)
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, segment := range segments {
+		files = append(files, segment.filePath)
+	}
+	return files, nil
+}
+
+// openLastSegment nastavlja upis u poslednji segment
+// U segment starog formata se ne upisuje, pa novi zapisi idu u novi segment, a segment nepoznatog formata je greska
+func (w *WAL) openLastSegment() error {
+	last := w.segments[len(w.segments)-1]
+	data, err := os.ReadFile(last.filePath)
+	if err != nil {
+		return fmt.Errorf("error reading wal segment: %v", err)
+	}
+	format, err := segmentFormat(last.filePath, data, w.config.Block.BlockSize)
+	if err != nil {
+		return err
+	}
+	if format == SegmentFormatLegacy {
+		if err := w.newSegment(); err != nil {
+			return fmt.Errorf("error creating new wal segment: %v", err)
 		}
-	} else {
-		wal.activeSegment = segments[len(segments)-1] // Uzimamo poslednji segment
-		wal.activeSegment.isActive = true
+		return nil
 	}
-	return wal, nil
+
+	w.activeSegment = last
+	w.activeSegment.isActive = true
+	file, err := os.OpenFile(last.filePath, os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening wal segment: %v", err)
+	}
+	w.activeFile = file
+	w.activeSegment.size = int64(len(data)) // Novi zapisi se nastavljaju na kraj segmenta
+	if w.activeSegment.size < segmentHeaderSize {
+		// Pad pri pravljenju segmenta, zaglavlje se upisuje ponovo
+		if _, err := file.WriteAt(segmentHeader(), 0); err != nil {
+			file.Close()
+			return fmt.Errorf("error writing wal segment header: %v", err)
+		}
+		w.activeSegment.size = segmentHeaderSize
+	}
+	return nil
 }
 
 // Funkcija koja kreira novi segment
@@ -101,6 +235,9 @@ func (w *WAL) newSegment() error {
 	segmentNum := 1
 	if len(w.segments) > 0 {
 		segmentNum = w.segments[len(w.segments)-1].segmentNumber + 1
+	} else if w.checkpoint.Segment > 0 {
+		// Brojevi segmenata se ne ponavljaju, inace bi checkpoint preskocio nove zapise
+		segmentNum = w.checkpoint.Segment + 1
 	}
 
 	fileName := fmt.Sprintf("wal_%04d.log", segmentNum)
@@ -110,27 +247,85 @@ func (w *WAL) newSegment() error {
 	if err != nil {
 		return fmt.Errorf("error creating wal segment file: %v", err)
 	}
-	file.Close()
+	if _, err := file.Write(segmentHeader()); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing wal segment header: %v", err)
+	}
 
 	newSegment := &WALSegment{
 		filePath:      filePath,
 		segmentNumber: segmentNum,
 		isActive:      true,
-		writtenBlocks: 0,
+		size:          segmentHeaderSize,
 	}
 
 	w.segments = append(w.segments, newSegment)
 	w.activeSegment = newSegment
+	w.activeFile = file
 	return nil
 }
 
-func (w *WAL) Append(key, value []byte, tombstone bool) error {
-	if err := w.changeActiveSegmentIfNeeded(); err != nil {
-		return fmt.Errorf("error changing active segment: %v", err)
+// rotate zatvara aktivni segment i pravi novi
+// Stari segment se prvo sinhronizuje, pa su posle rotacije svi dotadasnji zapisi na disku
+func (w *WAL) rotate() error {
+	for w.syncing { // Ne zatvaramo fajl dok ga neko sinhronizuje
+		w.synced.Wait()
+	}
+	if w.activeFile != nil {
+		if syncMode(w.config) != config.SyncNone {
+			if err := w.activeFile.Sync(); err != nil {
+				w.syncErr = fmt.Errorf("error syncing wal segment: %v", err)
+				return w.syncErr
+			}
+			w.syncs++
+			w.durable = w.written
+		}
+		w.activeFile.Close()
+		w.activeFile = nil
+	}
+	w.activeSegment.isActive = false
+	return w.newSegment()
+}
+
+// Append upisuje zapis u aktivni segment i vraca njegov sekvencni broj
+// Sa sync_mode "always" vraca se tek kad je zapis na disku, a istovremeni upisi dele jedan fsync
+func (w *WAL) Append(key, value []byte, tombstone bool) (uint64, error) {
+	seq, n, err := w.Write(key, value, tombstone)
+	if err != nil {
+		return 0, err
+	}
+	if err := w.WaitDurable(n); err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
+
+// Write upisuje zapis bez cekanja na fsync i vraca njegov sekvencni broj i redni broj upisa
+// Pozivalac koji drzi svoje zakljucavanje dok upisuje u WAL posle njegovog oslobadjanja poziva WaitDurable,
+// da bi istovremeni upisi delili jedan fsync
+func (w *WAL) Write(key, value []byte, tombstone bool) (uint64, uint64, error) {
+	return w.write(key, value, tombstone)
+}
+
+// WaitDurable ceka da upis sa rednim brojem n (iz Write) bude na disku, samo sa sync_mode "always"
+func (w *WAL) WaitDurable(n uint64) error {
+	if syncMode(w.config) != config.SyncAlways {
+		return nil
+	}
+	return w.waitDurable(n)
+}
+
+// write upisuje zapis bez cekanja na fsync i vraca njegov sekvencni broj i redni broj upisa (za waitDurable)
+func (w *WAL) write(key, value []byte, tombstone bool) (uint64, uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.syncErr != nil {
+		return 0, 0, w.syncErr
 	}
 
 	record := &WALRecord{
 		Timestamp: time.Now().UnixNano(),
+		Seq:       w.lastSeq + 1,
 		Type:      FULL,
 		Tombstone: tombstone,
 		KeySize:   uint64(len(key)),
@@ -141,34 +336,119 @@ func (w *WAL) Append(key, value []byte, tombstone bool) error {
 
 	serialized, err := record.Serialize()
 	if err != nil {
-		return fmt.Errorf("error serializing record: %v", err)
+		return 0, 0, fmt.Errorf("error serializing record: %v", err)
 	}
 
-	// Izracunavanje broja blokova potrebnih za upis
+	// Zapis se ne deli izmedju segmenata: ako ne stane u ostatak aktivnog segmenta, prelazimo u novi
+	// Zapis veci od celog segmenta dobija svoj segment, koji je zato veci od wal_segment_size blokova
 	blockSize := w.config.Block.BlockSize
-	blocksNeeded := len(serialized) / blockSize
-	if len(serialized)%blockSize != 0 {
-		blocksNeeded++
+	capacity := int64(w.config.Wal.WalSegmentSize) * int64(blockSize)
+	if w.activeSegment.size > segmentHeaderSize && w.activeSegment.size+fragmentsSize(w.activeSegment.size, len(serialized), blockSize) > capacity {
+		if err := w.rotate(); err != nil {
+			return 0, 0, fmt.Errorf("error creating new segment: %v", err)
+		}
 	}
 
-	// proveri kapacitet segmenta
-	if w.activeSegment.writtenBlocks+blocksNeeded > w.config.Wal.WalSegmentSize {
-		w.activeSegment.isActive = false
-		if err := w.newSegment(); err != nil {
-			return fmt.Errorf("error creating new segment: %v", err)
-		}
+	framed := appendFragments(nil, w.activeSegment.size, serialized, blockSize)
+	if _, err := w.activeFile.WriteAt(framed, w.activeSegment.size); err != nil {
+		return 0, 0, fmt.Errorf("error writing wal segment: %v", err)
 	}
+	w.activeSegment.size += int64(len(framed))
+	w.written++
+	w.lastSeq = record.Seq
+	return record.Seq, w.written, nil
+}
 
-	// Upisivanje serijalizovanog zapisa u aktivni segment
-	_, err = w.cachedBM.Append(w.activeSegment.filePath, serialized)
-	if err != nil {
-		return err
+// LastSequence vraca poslednji dodeljeni sekvencni broj
+func (w *WAL) LastSequence() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lastSeq
+}
+
+// AdvanceSequence postavlja poslednji sekvencni broj na seq ako je veci od trenutnog
+// Pri otvaranju baze se poziva sa sekvencnim brojem iz SSTable-ova, jer WAL segmenti pre checkpoint-a su obrisani
+func (w *WAL) AdvanceSequence(seq uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if seq > w.lastSeq {
+		w.lastSeq = seq
 	}
+}
 
-	w.activeSegment.writtenBlocks += blocksNeeded
+// waitDurable ceka da zapis sa rednim brojem upisa n bude na disku
+// Ako fsync nije u toku, ovaj upis ga radi za sve do sada upisane zapise, a ostali cekaju njegov rezultat
+func (w *WAL) waitDurable(n uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.durable < n {
+		if w.syncErr != nil {
+			return w.syncErr
+		}
+		if w.syncing {
+			w.synced.Wait()
+			continue
+		}
+		w.syncing = true
+		target, file := w.written, w.activeFile
+		w.mu.Unlock()
+		err := file.Sync()
+		w.mu.Lock()
+		w.syncing = false
+		w.syncs++
+		if err != nil {
+			w.syncErr = fmt.Errorf("error syncing wal segment: %v", err)
+		} else if target > w.durable {
+			w.durable = target
+		}
+		w.synced.Broadcast()
+	}
 	return nil
 }
 
+// Sync sinhronizuje na disk sve do sada upisane zapise
+func (w *WAL) Sync() error {
+	w.mu.Lock()
+	n := w.written
+	w.mu.Unlock()
+	return w.waitDurable(n)
+}
+
+// syncLoop periodicno sinhronizuje WAL za sync_mode "interval"
+func (w *WAL) syncLoop(interval time.Duration) {
+	defer close(w.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.Sync() // Greska ostaje u syncErr i vraca se sledecem upisu
+		}
+	}
+}
+
+// Close zaustavlja periodicnu sinhronizaciju, sinhronizuje preostale zapise (osim za "none") i zatvara aktivni segment
+func (w *WAL) Close() error {
+	if w.stop != nil {
+		close(w.stop)
+		<-w.done
+		w.stop = nil
+	}
+	var err error
+	if syncMode(w.config) != config.SyncNone {
+		err = w.Sync()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.activeFile != nil {
+		w.activeFile.Close()
+		w.activeFile = nil
+	}
+	return err
+}
+
 // Funkcija koja serijalizuje zapis
 func (r *WALRecord) Serialize() ([]byte, error) {
 	buffer := new(bytes.Buffer)
@@ -181,6 +461,9 @@ func (r *WALRecord) Serialize() ([]byte, error) {
 	if err := binary.Write(buffer, binary.BigEndian, r.Timestamp); err != nil {
 		return nil, err
 	}
+	if err := binary.Write(buffer, binary.BigEndian, r.Seq); err != nil {
+		return nil, err
+	}
 	if err := binary.Write(buffer, binary.BigEndian, byte(r.Type)); err != nil {
 		return nil, err
 	}
@@ -204,164 +487,101 @@ func (r *WALRecord) Serialize() ([]byte, error) {
 
 }
 
-// Funkcija koja menja aktivni segment ako je potrebno
-func (w *WAL) changeActiveSegmentIfNeeded() error {
-	if w.activeSegment.writtenBlocks < w.config.Wal.WalSegmentSize {
-		return nil
-	}
-	w.activeSegment.isActive = false
-	if err := w.newSegment(); err != nil {
-		return fmt.Errorf("error creating new segment: %v", err)
-	}
-	return nil
-
-}
-
 // Funkcija koja cita zapise iz wal, poziva se prilikom oporavka sistema (rekonstrukcije mem strukture iz wal-a)
+// Fragmenti se spajaju u zapise i proverava se CRC svakog fragmenta i celog zapisa
+// Sa ostecenim zapisima se postupa po recovery_mode:
+//   - strict: svako ostecenje je greska
+//   - tail: ostecen kraj poslednjeg segmenta (prekinut upis) se odbacuje, a ostecenje iza kog ima ispravnih zapisa je greska
+//   - skip: osteceni delovi se preskacu u svim segmentima
+//
+// Zapisi pre checkpoint-a su vec u SSTable-ovima i preskacu se, kao i segmenti koje checkpoint u potpunosti pokriva.
+// Poslednji sekvencni broj se podize na najveci procitani, pa se novi zapisi nastavljaju iza njega
+// U tail i skip nacinu se poslednji segment skracuje iza poslednjeg ispravnog zapisa, da bi novi zapisi nastavili odatle
+// Svaki odbaceni deo se loguje i moze se procitati preko Dropped
 func (w *WAL) ReadRecords() ([]*WALRecord, error) {
+	mode := recoveryMode(w.config)
 	var records []*WALRecord
-	var currentRecord *WALRecord
-	var accumulatedData []byte
-
-	for _, segment := range w.segments {
-		fileInfo, err := os.Stat(segment.filePath)
-		if err != nil {
-			return nil, fmt.Errorf("stat failed: %v", err)
-		}
-		if fileInfo.Size() == 0 {
+	w.dropped = nil
+	for i, segment := range w.segments {
+		if segment.segmentNumber < w.checkpoint.Segment {
 			continue
 		}
-
-		i := 0
-		for {
-			data, err := w.cachedBM.Read(segment.filePath, i)
-			if err != nil {
-				if strings.Contains(err.Error(), "EOF") {
-					break
-				}
-				return nil, fmt.Errorf("error reading segment %s: %v", segment.filePath, err)
-			}
-
-			reader := bytes.NewReader(data)
-			var crc uint32
-			var timestamp int64
-			var recordType byte
-			var tombstoneByte byte
-			var keySize, valueSize uint64
-
-			// prcitaj zaglavlje zapisa
-			if err := binary.Read(reader, binary.BigEndian, &crc); err != nil {
-				if err == io.EOF {
-					break
-				}
-				return nil, fmt.Errorf("error reading CRC: %v", err)
-			}
-			if err := binary.Read(reader, binary.BigEndian, &timestamp); err != nil {
-				return nil, err
-			}
-			if err := binary.Read(reader, binary.BigEndian, &recordType); err != nil {
-				print("Error reading record type: %v\n", err)
-				return nil, err
-			}
-			if err := binary.Read(reader, binary.BigEndian, &tombstoneByte); err != nil {
-				print("Error reading tombstone byte: %v\n", err)
-				return nil, err
+		info, err := scanSegment(segment.filePath, w.config.Block.BlockSize, mode != config.RecoveryStrict, func(rec RecordInfo, record *WALRecord) {
+			if record == nil {
+				return
 			}
-			if err := binary.Read(reader, binary.BigEndian, &keySize); err != nil {
-				print("Error reading key size: %v\n", err)
-				return nil, err
+			record.Start = Position{Segment: segment.segmentNumber, Offset: rec.Offset}
+			record.End = Position{Segment: segment.segmentNumber, Offset: rec.Offset + rec.Size}
+			if record.Seq == 0 {
+				// Zapisi starog formata nemaju sekvencni broj, dobijaju ga redom citanja
+				record.Seq = w.LastSequence() + 1
 			}
-			if err := binary.Read(reader, binary.BigEndian, &valueSize); err != nil {
-				print("Error reading value size: %v\n", err)
-				return nil, err
+			w.AdvanceSequence(record.Seq)
+			if record.Start.Before(w.checkpoint) {
+				return
 			}
+			records = append(records, record)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if info.Corruption == nil {
+			continue
+		}
+		last := i == len(w.segments)-1
+		switch {
+		case mode == config.RecoveryStrict:
+			return nil, fmt.Errorf("error reading segment %s: %v", segment.filePath, info.Corruption)
+		case mode == config.RecoveryTail && (!last || info.ValidBytes > info.Dropped[0].Start):
+			return nil, fmt.Errorf("error reading segment %s: %v (valid records follow the corruption, recovery_mode \"skip\" drops them)", segment.filePath, info.Corruption)
+		}
+		for _, d := range info.Dropped {
+			log.Printf("wal: dropped %s", d)
+		}
+		w.dropped = append(w.dropped, info.Dropped...)
 
-			// hendluj rekord na osnovu njegovog tipa
-			switch WALRecordType(recordType) {
-			case FULL:
-				// Slucaj kada je zapis FULL
-				record := &WALRecord{
-					CRC:       crc,
-					Timestamp: timestamp,
-					Type:      FULL,
-					Tombstone: tombstoneByte != 0,
-					KeySize:   keySize,
-					ValueSize: valueSize,
-				}
-				record.Key = make([]byte, keySize)
-				if _, err := io.ReadFull(reader, record.Key); err != nil {
-					return nil, fmt.Errorf("error reading key: %v", err)
-				}
-				record.Value = make([]byte, valueSize)
-				if _, err := io.ReadFull(reader, record.Value); err != nil {
-					return nil, fmt.Errorf("error reading value: %v", err)
-				}
-
-				// Verifikuj CRC kontrolni zbir
-				combined := append(record.Key, record.Value...)
-				if crc32.ChecksumIEEE(combined) != crc {
-					return nil, fmt.Errorf("CRC mismatch")
-				}
-				records = append(records, record)
-
-			case FIRST:
-				// Slucaj kada je zapis fragmentiran i ovo je prvi deo
-				currentRecord = &WALRecord{
-					CRC:       crc,
-					Timestamp: timestamp,
-					Type:      FIRST,
-					Tombstone: tombstoneByte != 0,
-					KeySize:   keySize,
-					ValueSize: valueSize,
-				}
-				accumulatedData = make([]byte, 0, keySize+valueSize)
-				data := make([]byte, keySize+valueSize)
-				if _, err := io.ReadFull(reader, data); err != nil {
-					return nil, fmt.Errorf("error reading fragmented data: %v", err)
-				}
-				accumulatedData = append(accumulatedData, data...)
-
-			case MIDDLE, LAST:
-				// Nastavi fragmentaciju
-				if currentRecord == nil {
-					return nil, fmt.Errorf("orphaned MIDDLE/LAST record")
-				}
-				data := make([]byte, keySize+valueSize)
-				if _, err := io.ReadFull(reader, data); err != nil {
-					return nil, fmt.Errorf("error reading fragmented data: %v", err)
-				}
-				accumulatedData = append(accumulatedData, data...)
-
-				if WALRecordType(recordType) == LAST {
-					// Verifikuj CRC i duzinu fragmentiranog zapisa
-					if crc32.ChecksumIEEE(accumulatedData) != currentRecord.CRC {
-						return nil, fmt.Errorf("fragmented record CRC mismatch")
-					}
-					if uint64(len(accumulatedData)) != currentRecord.KeySize+currentRecord.ValueSize {
-						return nil, fmt.Errorf("fragmented record size mismatch")
-					}
-					currentRecord.Key = accumulatedData[:currentRecord.KeySize]
-					currentRecord.Value = accumulatedData[currentRecord.KeySize:]
-					records = append(records, currentRecord)
-					currentRecord = nil
-					accumulatedData = nil
-				}
+		if last && info.ValidBytes < info.FileBytes {
+			// Sve iza poslednjeg ispravnog zapisa je vec odbaceno
+			if err := os.Truncate(segment.filePath, info.ValidBytes); err != nil {
+				return nil, fmt.Errorf("error truncating segment %s: %v", segment.filePath, err)
+			}
+			w.mu.Lock()
+			if segment == w.activeSegment {
+				w.activeSegment.size = info.ValidBytes
 			}
-			i += 1
+			w.mu.Unlock()
+			log.Printf("wal: truncated %s from %d to %d bytes", segment.filePath, info.FileBytes, info.ValidBytes)
 		}
 	}
+	return records, nil
+}
 
-	if currentRecord != nil {
-		return nil, fmt.Errorf("unfinished fragmented record at end of WAL")
+// Dropped vraca delove WAL-a koje je poslednji ReadRecords odbacio
+func (w *WAL) Dropped() []DroppedRange {
+	return w.dropped
+}
+
+// recoveryMode vraca nacin oporavka, prazan znaci "strict"
+func recoveryMode(cfg *config.Config) string {
+	if cfg.Wal.RecoveryMode == "" {
+		return config.RecoveryStrict
 	}
+	return cfg.Wal.RecoveryMode
+}
 
-	return records, nil
+// SegmentCount vraca broj WAL segmenata na disku (ukljucujuci aktivni)
+func (w *WAL) SegmentCount() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.segments)
 }
 
-// Funkcija koja brise segmente do odredjenog broja, poziva se nakon perzistiranja podataka u sstable
-// sto se tice samog lwm potrebno je da se dinamicki racuna tokom rada sistema
-// npr. nakon perzistiranja podataka u sstable/nakon brisanja podataka iz memtable, treba dodatno implementirati to
+// Funkcija koja brise segmente sa rednim brojem <= lowWaterMark, osim aktivnog
+// Brojevi preostalih segmenata se ne menjaju, jer se checkpoint poziva na njih
+// Obicno se ne poziva direktno, vec preko Checkpoint
 func (w *WAL) RemoveSegmentsUpTo(lowWaterMark int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	// Filtriraj segmente: uvek zadrži aktivni, a od ostalih ukloni one sa brojem ≤ lowWaterMark
 	var segmentsToKeep []*WALSegment
 	for _, seg := range w.segments {
@@ -379,20 +599,6 @@ func (w *WAL) RemoveSegmentsUpTo(lowWaterMark int) error {
 		}
 	}
 
-	// Normalizuj numeraciju (ponovno preimenuj fajlove u 0001, 0002, …)
-	for i, seg := range segmentsToKeep {
-		newNum := i + 1
-		if seg.segmentNumber == newNum {
-			continue
-		}
-		newPath := filepath.Join(w.config.Wal.WalDirectory, fmt.Sprintf("wal_%04d.log", newNum))
-		if err := os.Rename(seg.filePath, newPath); err != nil {
-			return err
-		}
-		seg.segmentNumber = newNum
-		seg.filePath = newPath
-	}
-
 	w.segments = segmentsToKeep
 	return nil
 }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/iigor000/database/config"
+	"github.com/iigor000/database/fun"
+	"github.com/iigor000/database/shell"
+	writeaheadlog "github.com/iigor000/database/structures/writeAheadLog"
+)
+
+// registerToolCommands registruje alate koji rade direktno nad fajlovima i ne traze otvorenu bazu
+// walrepair i restore menjaju fajlove baze na disku, pa su dostupni samo kada baza nije otvorena (offline)
+func registerToolCommands(sh *shell.Shell, cfg *config.Config, offline bool) {
+	sh.Register(&shell.Command{
+		Name:        "waldump",
+		Description: "Print all WAL records and block usage per segment",
+		Run: func(args []string) error {
+			return writeaheadlog.Dump(os.Stdout, cfg)
+		},
+	})
+	if !offline {
+		return
+	}
+	sh.Register(&shell.Command{
+		Name:        "restore",
+		Args:        "<backup>",
+		Description: "Verify a backup and restore it into the configured data directories",
+		MinArgs:     1,
+		MaxArgs:     1,
+		Run: func(args []string) error {
+			manifest, err := fun.Restore(args[0], cfg)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Restored %d files into %s, %s, %s and %s\n", len(manifest.Files),
+				cfg.SSTable.SstableDirectory, cfg.Blob.Directory, cfg.Wal.WalDirectory, cfg.Compression.DictionaryDir)
+			return nil
+		},
+	})
+	sh.Register(&shell.Command{
+		Name:        "walrepair",
+		Description: "Truncate the WAL at the first corrupt or torn record and move later segments aside",
+		Run: func(args []string) error {
+			results, err := writeaheadlog.Repair(cfg)
+			for _, r := range results {
+				fmt.Printf("%s: %v\n  dropped %d bytes\n", r.Path, r.Corruption, r.TruncatedBytes)
+				if r.Quarantined != "" {
+					fmt.Printf("  moved to %s\n", r.Quarantined)
+				}
+			}
+			if err != nil {
+				return err
+			}
+			if len(results) == 0 {
+				fmt.Println("All WAL segments are intact")
+			}
+			return nil
+		},
+	})
+}
+
+// runTool izvrsava jednu komandu alata iz argumenata komandne linije, bez otvaranja baze
+// npr. `database walrepair` kada baza ne moze da se pokrene zbog ostecenog WAL-a
+func runTool(cfg *config.Config, args []string) error {
+	sh := shell.New(os.Stdin, os.Stdout, nil)
+	registerToolCommands(sh, cfg, true)
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shell.Quote(arg)
+	}
+	return sh.Execute(strings.Join(quoted, " "))
+}